@@ -1,11 +1,17 @@
 package puff
 
 import (
+	"cmp"
 	"context"
 	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
+	"net/netip"
 	"reflect"
+	"slices"
+	"sync"
+	"sync/atomic"
 )
 
 type PuffApp struct {
@@ -16,6 +22,43 @@ type PuffApp struct {
 
 	// Server is the http.Server that will be used to serve requests.
 	Server *http.Server
+	// listener is the listener the Server accepts connections on, passed on by Handoff.
+	listener net.Listener
+
+	// healthChecks are the checks registered with AddHealthCheck.
+	healthChecks []namedHealthCheck
+	// rules are the compiled AppConfig.Rules, compiled once on first use.
+	rules     []compiledRule
+	rulesOnce sync.Once
+	// trustedProxies are the parsed AppConfig.TrustedProxies, parsed once on first use.
+	trustedProxies     []netip.Prefix
+	trustedProxiesOnce sync.Once
+	// routesMu guards the route table against routes registered or removed while serving.
+	routesMu sync.RWMutex
+	// patched is set once ListenAndServe prepared the routes for serving.
+	patched atomic.Bool
+	// mounted are the applications mounted with MountApp.
+	mounted []*PuffApp
+	// registrationErrors are the errors recorded while AppConfig.DeferRegistrationErrors is set.
+	registrationErrors   []*RegistrationError
+	registrationErrorsMu sync.Mutex
+	// settings are the runtime settings set with UpdateSettings, nil until the first update.
+	settings            atomic.Pointer[RuntimeSettings]
+	settingsMu          sync.Mutex
+	settingsSubscribers []func(RuntimeSettings)
+	// errorMappings are the mappings of errors to statuses added with MapError and MapErrorType.
+	errorMappings   []errorMapping
+	errorMappingsMu sync.RWMutex
+	// connections collects the metrics of WebSocket connections and SSE streams.
+	connections connectionMetrics
+	// openAPIGenerated is set if the OpenAPI spec was generated from the routes
+	// rather than set in AppConfig.OpenAPI, so it is regenerated when they change.
+	openAPIGenerated bool
+	// openAPISpec is the encoded spec served at DocsURL + ".json", regenerated on
+	// the next request once openAPIStale is set.
+	openAPISpec   *openAPISpecCache
+	openAPIStale  atomic.Bool
+	openAPISpecMu sync.Mutex
 }
 
 // Add a Router to the main app.
@@ -50,17 +93,32 @@ func (a *PuffApp) addOpenAPIRoutes() {
 	docsRouter := Router{
 		Prefix: a.Config.DocsURL,
 		Name:   "OpenAPI Documentation Router",
+		// the spec is served at DocsURL + ".json", inside the last prefix segment.
+		partialPrefix: true,
 	}
 
-	// Provides JSON OpenAPI Schema.
-	docsRouter.Get(".json", nil, func(c *Context) {
-		res := JSONResponse{
-			StatusCode: 200,
-			Content:    a.Config.OpenAPI,
-		}
+	// Provides JSON OpenAPI Schema. The spec is encoded once here, and again
+	// when routes are registered or removed while serving, so polling tooling
+	// gets conditional (ETag/Last-Modified) and gzip responses cheaply.
+	spec, err := newOpenAPISpecCache(a.Config.OpenAPI)
+	if err != nil {
+		slog.Error(fmt.Sprintf("puff: encoding OpenAPI spec failed: %s", err.Error()))
+		return
+	}
+	a.openAPISpec = spec
+	docsRouter.Get(".json", nil, a.serveOpenAPISpec)
+	docsRouter.Head(".json", nil, a.serveOpenAPISpec)
 
-		c.SendResponse(res)
-	})
+	if a.Config.OpenAPIBaseline != "" {
+		// the diff is computed once here, as the spec does not change while serving.
+		changes := a.diffOpenAPIBaseline()
+		if changes == nil {
+			changes = []OpenAPIChange{}
+		}
+		docsRouter.Get(".diff", nil, func(c *Context) {
+			c.SendResponse(JSONResponse{Content: changes})
+		})
+	}
 
 	// Renders OpenAPI schema.
 	docsRouter.Get("", nil, func(c *Context) {
@@ -68,7 +126,7 @@ func (a *PuffApp) addOpenAPIRoutes() {
 
 			swaggerConfig := SwaggerUIConfig{
 				Title:           a.Config.Name,
-				URL:             a.Config.DocsURL + ".json",
+				URL:             a.RootRouter.Prefix + a.Config.DocsURL + ".json",
 				Theme:           "obsidian",
 				Filter:          true,
 				RequestDuration: false,
@@ -82,9 +140,32 @@ func (a *PuffApp) addOpenAPIRoutes() {
 		c.SendResponse(res)
 	})
 
+	// left out of the spec when it is regenerated while serving.
+	for _, route := range docsRouter.Routes {
+		route.ExcludeFromOpenAPI = true
+	}
 	a.IncludeRouter(&docsRouter)
 }
 
+// prepare readies the routes of the application and of the applications
+// mounted into it for serving. It does nothing if they are already prepared.
+func (a *PuffApp) prepare() {
+	if a.patched.Load() {
+		return
+	}
+	a.patchAllRoutes()
+	a.addOpenAPIRoutes()
+	a.RootRouter.compileRoutes()
+	for _, route := range a.AllRoutes() {
+		route.resolveDescription()
+	}
+	// routes registered from now on are prepared on registration.
+	a.patched.Store(true)
+	for _, child := range a.mounted {
+		child.prepare()
+	}
+}
+
 // attachMiddlewares recursively applies middlewares to all routes within a router.
 // This function traverses through the router's sub-routers and routes, applying the
 // middleware functions in the given order.
@@ -93,20 +174,40 @@ func (a *PuffApp) addOpenAPIRoutes() {
 // - middleware_combo: A pointer to a slice of Middleware to be applied.
 // - router: The router whose middlewares and routes should be processed.
 func attachMiddlewares(middleware_combo *[]Middleware, router *Router) {
+	if router.isolated {
+		middleware_combo = &[]Middleware{}
+	}
 	for _, m := range router.Middlewares {
 		nmc := append(*middleware_combo, *m)
 		middleware_combo = &nmc
 	}
 	for _, route := range router.Routes {
-		for _, m := range *middleware_combo {
-			route.Handler = (m)(route.Handler)
-		}
+		attachRouteMiddlewares(route, *middleware_combo)
 	}
 	for _, router := range router.Routers {
 		attachMiddlewares((middleware_combo), router)
 	}
 }
 
+// attachRouteMiddlewares wraps the handler of route with the input binding,
+// the route's own middlewares and the router middlewares in chain.
+func attachRouteMiddlewares(route *Route, chain []Middleware) {
+	// binding is the innermost layer so middlewares see the request before it is
+	// bound, e.g. to verify or capture the raw body. Websocket routes are bound
+	// before the upgrade instead.
+	if !route.WebSocket && !route.bindsInput {
+		route.Handler = route.withInputBinding(route.Handler)
+		route.bindsInput = true
+	}
+	// wrapped in reverse so route middlewares run in the order they were added.
+	for i := len(route.Middlewares) - 1; i >= 0; i-- {
+		route.Handler = (*route.Middlewares[i])(route.Handler)
+	}
+	for _, m := range chain {
+		route.Handler = (m)(route.Handler)
+	}
+}
+
 // patchAllRoutes applies middlewares to all routes and sub-routers in the root router
 // of the PuffApp. It also patches the routes of each router to ensure they have been
 // processed for middlewares.
@@ -115,22 +216,70 @@ func (a *PuffApp) patchAllRoutes() {
 	for _, r := range a.RootRouter.Routers {
 		r.patchRoutes()
 	}
+	a.detectConflicts()
 	attachMiddlewares(&[]Middleware{}, a.RootRouter)
 }
 
+// detectConflicts panics with a RegistrationError of kind RegistrationConflict
+// if two routes are registered with the same method and full path, or with
+// the first error deferred by AppConfig.DeferRegistrationErrors.
+func (a *PuffApp) detectConflicts() {
+	if deferred := a.deferredRegistrationErrors(); len(deferred) > 0 {
+		panic(deferred[0])
+	}
+	if conflicts := a.findConflicts(); len(conflicts) > 0 {
+		panic(conflicts[0])
+	}
+}
+
+// findConflicts returns a RegistrationError for every route registered with
+// the same method and full path as a route registered before it.
+func (a *PuffApp) findConflicts() []*RegistrationError {
+	var conflicts []*RegistrationError
+	seen := map[string]*Route{}
+	for _, route := range a.AllRoutes() {
+		if route.fullPath == "" {
+			route.getCompletePath()
+		}
+		key := conflictKey(route)
+		if existing, ok := seen[key]; ok {
+			conflicts = append(conflicts, &RegistrationError{
+				Kind:   RegistrationConflict,
+				Router: route.Router.Name,
+				Method: route.Protocol,
+				Path:   route.fullPath,
+				Source: route.source,
+				Err:    fmt.Errorf("route already registered on router %s%s", existing.Router.Name, sourceSuffix(existing.source)),
+			})
+			continue
+		}
+		seen[key] = route
+	}
+	return conflicts
+}
+
 // ListenAndServe starts the PuffApp server on the specified address.
-// Before starting, it patches all routes, adds OpenAPI documentation routes (if available),
-// and sets up logging.
+// Before starting, it runs SelfCheck (unless DisableSelfCheck is set), patches all routes,
+// adds OpenAPI documentation routes (if available), and sets up logging.
 //
-// If TLS certificates are provided (TLSPublicCertFile and TLSPrivateKeyFile), the server
-// starts with TLS enabled; otherwise, it runs a standard HTTP server.
+// If TLS certificates are provided (TLSCertificateSecret and TLSPrivateKeySecret, or
+// TLSPublicCertFile and TLSPrivateKeyFile), the server starts with TLS enabled; otherwise,
+// it runs a standard HTTP server. Secrets and the SettingsFile in AppConfig are loaded before listening.
+// Client certificates are verified for mutual TLS if TLSClientCAs or TLSClientCAFile is set.
+//
+// A listener inherited from a previous process through Handoff or systemd socket
+// activation is used instead of listening on listenAddr.
 //
 // Parameters:
 // - listenAddr: The address the server will listen on (e.g., ":8080").
 func (a *PuffApp) ListenAndServe(listenAddr string) error {
+	if !a.Config.DisableSelfCheck {
+		if err := a.SelfCheck(); err != nil {
+			return err
+		}
+	}
 
-	a.patchAllRoutes()
-	a.addOpenAPIRoutes()
+	a.prepare()
 
 	slog.Debug(fmt.Sprintf("Running Puff 💨 on %s", listenAddr))
 	slog.Debug(fmt.Sprintf("Visit docs 💨 on %s", fmt.Sprintf("http://localhost%s%s", listenAddr, a.Config.DocsURL)))
@@ -142,16 +291,77 @@ func (a *PuffApp) ListenAndServe(listenAddr string) error {
 		}
 	}
 
-	var err error
-	if a.Config.TLSPublicCertFile != "" && a.Config.TLSPrivateKeyFile != "" {
-		err = a.Server.ListenAndServeTLS(a.Config.TLSPublicCertFile, a.Config.TLSPrivateKeyFile)
+	if err := a.loadSecrets(context.Background()); err != nil {
+		return err
+	}
+	if err := a.loadSettingsFile(); err != nil {
+		return err
+	}
+
+	useSecrets := a.Config.TLSCertificateSecret != nil && a.Config.TLSPrivateKeySecret != nil
+	useFiles := a.Config.TLSPublicCertFile != "" && a.Config.TLSPrivateKeyFile != ""
+	if useSecrets {
+		a.Server.TLSConfig = a.tlsConfigFromSecrets(a.Server.TLSConfig)
+	}
+	if useSecrets || useFiles {
+		tlsConfig, err := a.clientTLSConfig(a.Server.TLSConfig)
+		if err != nil {
+			return err
+		}
+		a.Server.TLSConfig = tlsConfig
+	}
+
+	l, err := a.listen(a.Server.Addr)
+	if err != nil {
+		return err
+	}
+	a.listener = l
+	signalReady()
+
+	if useSecrets {
+		err = a.Server.ServeTLS(l, "", "")
+	} else if useFiles {
+		err = a.Server.ServeTLS(l, a.Config.TLSPublicCertFile, a.Config.TLSPrivateKeyFile)
 	} else {
-		err = a.Server.ListenAndServe()
+		err = a.Server.Serve(l)
 	}
 
 	return err
 }
 
+// Handler prepares the PuffApp for serving like ListenAndServe does, without
+// listening, and returns it as an http.Handler. Use it to serve puff from an
+// existing server or alongside other handlers:
+//
+//	mux := http.NewServeMux()
+//	mux.Handle("/api/", app.Handler())
+//	mux.Handle("/metrics", promhttp.Handler())
+//	http.ListenAndServe(":8000", mux)
+//
+// Routes see the full request path, so the prefix the handler is registered
+// under must be part of the route paths, e.g. with NewRouter("API", "/api").
+// Handler runs SelfCheck unless DisableSelfCheck is set and loads the secrets
+// and the SettingsFile; it panics if either fails, as the application could
+// not serve requests. Calling it again returns the same handler.
+func (a *PuffApp) Handler() http.Handler {
+	if a.RootRouter.serving() {
+		return a.RootRouter
+	}
+	if !a.Config.DisableSelfCheck {
+		if err := a.SelfCheck(); err != nil {
+			panic(err)
+		}
+	}
+	a.prepare()
+	if err := a.loadSecrets(context.Background()); err != nil {
+		panic(err)
+	}
+	if err := a.loadSettingsFile(); err != nil {
+		panic(err)
+	}
+	return a.RootRouter
+}
+
 // Get registers an HTTP GET route in the PuffApp's root router.
 //
 // Parameters:
@@ -159,7 +369,7 @@ func (a *PuffApp) ListenAndServe(listenAddr string) error {
 // - fields: Optional fields associated with the route.
 // - handleFunc: The handler function that will be executed when the route is accessed.
 func (a *PuffApp) Get(path string, fields any, handleFunc func(*Context)) *Route {
-	return a.RootRouter.Get(path, fields, handleFunc)
+	return a.RootRouter.registerRoute(http.MethodGet, path, handleFunc, fields)
 }
 
 // Post registers an HTTP POST route in the PuffApp's root router.
@@ -169,7 +379,7 @@ func (a *PuffApp) Get(path string, fields any, handleFunc func(*Context)) *Route
 // - fields: Optional fields associated with the route.
 // - handleFunc: The handler function that will be executed when the route is accessed.
 func (a *PuffApp) Post(path string, fields any, handleFunc func(*Context)) *Route {
-	return a.RootRouter.Post(path, fields, handleFunc)
+	return a.RootRouter.registerRoute(http.MethodPost, path, handleFunc, fields)
 }
 
 // Patch registers an HTTP PATCH route in the PuffApp's root router.
@@ -179,7 +389,7 @@ func (a *PuffApp) Post(path string, fields any, handleFunc func(*Context)) *Rout
 // - fields: Optional fields associated with the route.
 // - handleFunc: The handler function that will be executed when the route is accessed.
 func (a *PuffApp) Patch(path string, fields any, handleFunc func(*Context)) *Route {
-	return a.RootRouter.Patch(path, fields, handleFunc)
+	return a.RootRouter.registerRoute(http.MethodPatch, path, handleFunc, fields)
 }
 
 // Put registers an HTTP PUT route in the PuffApp's root router.
@@ -189,7 +399,7 @@ func (a *PuffApp) Patch(path string, fields any, handleFunc func(*Context)) *Rou
 // - fields: Optional fields associated with the route.
 // - handleFunc: The handler function that will be executed when the route is accessed.
 func (a *PuffApp) Put(path string, fields any, handleFunc func(*Context)) *Route {
-	return a.RootRouter.Put(path, fields, handleFunc)
+	return a.RootRouter.registerRoute(http.MethodPut, path, handleFunc, fields)
 }
 
 // Delete registers an HTTP DELETE route in the PuffApp's root router.
@@ -199,7 +409,68 @@ func (a *PuffApp) Put(path string, fields any, handleFunc func(*Context)) *Route
 // - fields: Optional fields associated with the route.
 // - handleFunc: The handler function that will be executed when the route is accessed.
 func (a *PuffApp) Delete(path string, fields any, handleFunc func(*Context)) *Route {
-	return a.RootRouter.Delete(path, fields, handleFunc)
+	return a.RootRouter.registerRoute(http.MethodDelete, path, handleFunc, fields)
+}
+
+// Head registers an HTTP HEAD route in the PuffApp's root router.
+//
+// Parameters:
+// - path: The URL path of the route.
+// - fields: Optional fields associated with the route.
+// - handleFunc: The handler function that will be executed when the route is accessed.
+func (a *PuffApp) Head(path string, fields any, handleFunc func(*Context)) *Route {
+	return a.RootRouter.registerRoute(http.MethodHead, path, handleFunc, fields)
+}
+
+// Options registers an HTTP OPTIONS route in the PuffApp's root router.
+//
+// Parameters:
+// - path: The URL path of the route.
+// - fields: Optional fields associated with the route.
+// - handleFunc: The handler function that will be executed when the route is accessed.
+func (a *PuffApp) Options(path string, fields any, handleFunc func(*Context)) *Route {
+	return a.RootRouter.registerRoute(http.MethodOptions, path, handleFunc, fields)
+}
+
+// Trace registers an HTTP TRACE route in the PuffApp's root router.
+//
+// Parameters:
+// - path: The URL path of the route.
+// - fields: Optional fields associated with the route.
+// - handleFunc: The handler function that will be executed when the route is accessed.
+func (a *PuffApp) Trace(path string, fields any, handleFunc func(*Context)) *Route {
+	return a.RootRouter.registerRoute(http.MethodTrace, path, handleFunc, fields)
+}
+
+// Connect registers an HTTP CONNECT route in the PuffApp's root router.
+//
+// Parameters:
+// - path: The URL path of the route.
+// - fields: Optional fields associated with the route.
+// - handleFunc: The handler function that will be executed when the route is accessed.
+func (a *PuffApp) Connect(path string, fields any, handleFunc func(*Context)) *Route {
+	return a.RootRouter.registerRoute(http.MethodConnect, path, handleFunc, fields)
+}
+
+// HandleMethods registers one route per method in the PuffApp's root router, all served by handleFunc.
+//
+// Parameters:
+// - methods: The HTTP methods of the routes, e.g. []string{"GET", "POST"}.
+// - path: The URL path of the routes.
+// - fields: Optional fields associated with the routes.
+// - handleFunc: The handler function that will be executed when a route is accessed.
+func (a *PuffApp) HandleMethods(methods []string, path string, fields any, handleFunc func(*Context)) []*Route {
+	return a.RootRouter.registerRoutes(methods, path, handleFunc, fields)
+}
+
+// Any registers routes for GET, POST, PUT, PATCH and DELETE in the PuffApp's root router.
+//
+// Parameters:
+// - path: The URL path of the routes.
+// - fields: Optional fields associated with the routes.
+// - handleFunc: The handler function that will be executed when a route is accessed.
+func (a *PuffApp) Any(path string, fields any, handleFunc func(*Context)) []*Route {
+	return a.RootRouter.registerRoutes(anyMethods, path, handleFunc, fields)
 }
 
 // WebSocket registers a WebSocket route in the PuffApp's root router.
@@ -210,7 +481,20 @@ func (a *PuffApp) Delete(path string, fields any, handleFunc func(*Context)) *Ro
 // - fields: Optional fields associated with the route.
 // - handleFunc: The handler function to handle WebSocket connections.
 func (a *PuffApp) WebSocket(path string, fields any, handleFunc func(*Context)) *Route {
-	return a.RootRouter.WebSocket(path, fields, handleFunc)
+	return a.RootRouter.registerWebSocket(path, fields, handleFunc)
+}
+
+// RPC registers a WebSocket route at path on the root router serving the methods of rpc.
+func (a *PuffApp) RPC(path string, rpc *RPC) *Route {
+	return a.RootRouter.RPC(path, rpc)
+}
+
+// WithDefaultResponses documents responses for every route of the PuffApp,
+// e.g. a 401 returned by an authentication middleware. Responses set on a
+// router or route for the same status code take precedence.
+func (a *PuffApp) WithDefaultResponses(responses ...ResponseDefinition) *PuffApp {
+	a.RootRouter.WithResponses(responses...)
+	return a
 }
 
 // AllRoutes returns all routes registered in the PuffApp, including those in sub-routers.
@@ -222,26 +506,39 @@ func (a *PuffApp) AllRoutes() []*Route {
 // GenerateOpenAPISpec is responsible for taking the PuffApp configuration and turning it into an OpenAPI json.
 func (a *PuffApp) GenerateOpenAPISpec() {
 	if reflect.ValueOf(a.Config.OpenAPI).IsZero() {
-		a.Config.OpenAPI = NewOpenAPI(a)
-		paths, tags := a.GeneratePathsTags()
-		a.Config.OpenAPI.Tags = tags
-		a.Config.OpenAPI.Paths = paths
+		a.Config.OpenAPI = a.newOpenAPISpec()
+		a.openAPIGenerated = true
 	}
 }
 
+// newOpenAPISpec generates the OpenAPI spec of the current routes.
+func (a *PuffApp) newOpenAPISpec() *OpenAPI {
+	spec := NewOpenAPI(a)
+	paths, tags := a.GeneratePathsTags()
+	spec.Tags = tags
+	spec.Paths = paths
+	return spec
+}
+
 // GeneratePathsTags is a helper function to auto-define OpenAPI tags and paths if you would like to customize OpenAPI schema.
 // Returns (paths, tags) to populate the 'Paths' and 'Tags' attribute of OpenAPI
 func (a *PuffApp) GeneratePathsTags() (*Paths, *[]Tag) {
 	tags := []Tag{}
 	tagNames := []string{}
 	var paths = make(Paths)
-	for _, route := range a.RootRouter.Routes {
-		addRoute(route, &tags, &tagNames, &paths)
-	}
+	routes := slices.Clone(a.RootRouter.Routes)
 	for _, router := range a.RootRouter.Routers {
-		for _, route := range router.Routes {
-			addRoute(route, &tags, &tagNames, &paths)
+		routes = append(routes, router.Routes...)
+	}
+	// routes without query constraints are added first so query variants are merged into them.
+	slices.SortStableFunc(routes, func(x, y *Route) int {
+		return cmp.Compare(len(x.queryConstraints), len(y.queryConstraints))
+	})
+	for _, route := range routes {
+		if route.ExcludeFromOpenAPI || !a.featuresEnabled(route) {
+			continue
 		}
+		addRoute(route, &tags, &tagNames, &paths)
 	}
 	return &paths, &tags
 }
@@ -0,0 +1,142 @@
+package puff
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// AuditOutcome is the result of an audited action.
+type AuditOutcome string
+
+const (
+	AuditSuccess AuditOutcome = "success"
+	AuditFailure AuditOutcome = "failure"
+	// AuditDenied is used when the actor was not allowed to perform the action.
+	AuditDenied AuditOutcome = "denied"
+)
+
+// AuditRecord is a single entry of the audit log, written by Context.Audit.
+// Unlike access logs, audit records describe business actions, e.g.
+// "user.delete" on "user:42", and always identify who performed them.
+type AuditRecord struct {
+	Time    time.Time    `json:"time"`
+	Action  string       `json:"action"`
+	Target  string       `json:"target"`
+	Outcome AuditOutcome `json:"outcome"`
+	// Actor is the authenticated caller, see AuditConfig.Actor.
+	Actor     string         `json:"actor"`
+	RequestID string         `json:"request_id"`
+	IP        string         `json:"ip"`
+	Method    string         `json:"method"`
+	Path      string         `json:"path"`
+	Fields    map[string]any `json:"fields,omitempty"`
+}
+
+// AuditSink stores audit records, e.g. in an append-only table or a SIEM.
+type AuditSink interface {
+	WriteAudit(record AuditRecord) error
+}
+
+// AuditSinkFunc adapts a function to an AuditSink.
+type AuditSinkFunc func(record AuditRecord) error
+
+// WriteAudit calls f(record).
+func (f AuditSinkFunc) WriteAudit(record AuditRecord) error {
+	return f(record)
+}
+
+// JSONAuditSink writes audit records to W as JSON, one per line.
+type JSONAuditSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewJSONAuditSink creates a JSONAuditSink writing to w.
+func NewJSONAuditSink(w io.Writer) *JSONAuditSink {
+	return &JSONAuditSink{w: w}
+}
+
+// WriteAudit writes record as a line of JSON.
+func (s *JSONAuditSink) WriteAudit(record AuditRecord) error {
+	b, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.w.Write(append(b, '\n'))
+	return err
+}
+
+// AuditConfig configures the audit log written with Context.Audit.
+type AuditConfig struct {
+	// Sink stores the audit records. Required.
+	Sink AuditSink
+	// Actor identifies the authenticated caller of a request.
+	// Default: the value stored under SubjectKey, formatted with %v, or "anonymous" if there is none.
+	Actor func(c *Context) string
+}
+
+// defaultAuditActor formats the subject stored under SubjectKey.
+func defaultAuditActor(c *Context) string {
+	subject := c.Get(SubjectKey)
+	if subject == nil {
+		return "anonymous"
+	}
+	return fmt.Sprint(subject)
+}
+
+// Audit writes an audit record of action on target to AppConfig.Audit.Sink.
+// The actor, request ID and client IP are filled in from the request.
+// Fields are additional key-value pairs, as in log/slog:
+//
+//	err := c.Audit("invoice.refund", "invoice:"+id, puff.AuditSuccess, "amount", amount)
+//
+// The error of the sink is returned so handlers can refuse to perform actions
+// that cannot be audited. Records are discarded if no sink is configured.
+func (ctx *Context) Audit(action, target string, outcome AuditOutcome, fields ...any) error {
+	if ctx.puff == nil || ctx.puff.Config.Audit == nil || ctx.puff.Config.Audit.Sink == nil {
+		return nil
+	}
+	config := ctx.puff.Config.Audit
+	actor := config.Actor
+	if actor == nil {
+		actor = defaultAuditActor
+	}
+	record := AuditRecord{
+		Time:      time.Now().UTC(),
+		Action:    action,
+		Target:    target,
+		Outcome:   outcome,
+		Actor:     actor(ctx),
+		RequestID: ctx.GetRequestID(),
+		IP:        ctx.ClientIP(),
+		Method:    ctx.Request.Method,
+		Path:      ctx.Request.URL.Path,
+		Fields:    auditFields(fields),
+	}
+	if err := config.Sink.WriteAudit(record); err != nil {
+		return fmt.Errorf("puff: writing audit record %s failed: %w", action, err)
+	}
+	return nil
+}
+
+// auditFields converts key-value pairs into a map. A key without a value is
+// stored under "!BADKEY", as log/slog does.
+func auditFields(pairs []any) map[string]any {
+	if len(pairs) == 0 {
+		return nil
+	}
+	fields := make(map[string]any, (len(pairs)+1)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		if i+1 == len(pairs) {
+			fields["!BADKEY"] = pairs[i]
+			break
+		}
+		fields[fmt.Sprint(pairs[i])] = pairs[i+1]
+	}
+	return fields
+}
@@ -0,0 +1,90 @@
+package puff
+
+import (
+	"context"
+	"log/slog"
+	"runtime/debug"
+)
+
+type backgroundValuesKey struct{}
+
+// backgroundValues are the request values copied into a background task's context.
+type backgroundValues struct {
+	requestID string
+	values    map[string]any
+	logger    *slog.Logger
+}
+
+// BackgroundContext returns a context for work that outlives the request. It
+// is not canceled when the request ends, but carries the request ID, the
+// tenant, the Context values listed in AppConfig.PropagatedKeys and a logger
+// annotated with the request ID and tenant, so logs and traces of the task
+// stay correlated with the originating request.
+func (ctx *Context) BackgroundContext() context.Context {
+	bv := &backgroundValues{
+		requestID: ctx.GetRequestID(),
+		values:    map[string]any{},
+	}
+	if ctx.puff != nil {
+		for _, key := range ctx.puff.Config.PropagatedKeys {
+			if v, ok := ctx.registry[key]; ok {
+				bv.values[key] = v
+			}
+		}
+	}
+	logger := slog.Default()
+	if bv.requestID != "" {
+		logger = logger.With(slog.String("request_id", bv.requestID))
+	}
+	if tenant := ctx.Tenant(); tenant != nil {
+		logger = logger.With(slog.String("tenant", tenant.ID))
+	}
+	bv.logger = logger
+	return context.WithValue(context.WithoutCancel(ctx.Request.Context()), backgroundValuesKey{}, bv)
+}
+
+// Go runs task in a new goroutine with BackgroundContext. A panic in task is
+// recovered and logged with the originating request ID.
+func (ctx *Context) Go(task func(ctx context.Context)) {
+	bctx := ctx.BackgroundContext()
+	go func() {
+		defer func() {
+			if a := recover(); a != nil {
+				LoggerFromContext(bctx).Error("Panic During Background Task", slog.Any("Error", a), slog.String("Stack", string(debug.Stack())))
+			}
+		}()
+		task(bctx)
+	}()
+}
+
+// RequestIDFromContext returns the ID of the request a background context was created from.
+func RequestIDFromContext(ctx context.Context) string {
+	if bv, ok := ctx.Value(backgroundValuesKey{}).(*backgroundValues); ok {
+		return bv.requestID
+	}
+	return ""
+}
+
+// TenantFromContext returns the tenant of the request a context was derived from, or nil.
+func TenantFromContext(ctx context.Context) *Tenant {
+	t, _ := ctx.Value(tenantContextKey{}).(*Tenant)
+	return t
+}
+
+// ValueFromContext returns a Context value propagated into a background context
+// through AppConfig.PropagatedKeys, or nil.
+func ValueFromContext(ctx context.Context, key string) any {
+	if bv, ok := ctx.Value(backgroundValuesKey{}).(*backgroundValues); ok {
+		return bv.values[key]
+	}
+	return nil
+}
+
+// LoggerFromContext returns the logger of a background context, annotated with the
+// originating request ID and tenant. It returns slog.Default() for other contexts.
+func LoggerFromContext(ctx context.Context) *slog.Logger {
+	if bv, ok := ctx.Value(backgroundValuesKey{}).(*backgroundValues); ok {
+		return bv.logger
+	}
+	return slog.Default()
+}
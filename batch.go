@@ -0,0 +1,192 @@
+package puff
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// BatchConfig configures the batch endpoint added with PuffApp.Batch.
+type BatchConfig struct {
+	// MaxRequests is the maximum number of sub-requests in a batch. Default: 20.
+	MaxRequests int
+	// Concurrency is the number of sub-requests dispatched at the same time. Default: 4.
+	Concurrency int
+	// ForwardHeaders are the headers of the batch request copied to every sub-request,
+	// so authentication applies to each of them. Default: Authorization and Cookie.
+	ForwardHeaders []string
+}
+
+// DefaultBatchConfig is a BatchConfig with specified default values.
+var DefaultBatchConfig = BatchConfig{
+	MaxRequests:    20,
+	Concurrency:    4,
+	ForwardHeaders: []string{"Authorization", "Cookie"},
+}
+
+// BatchRequest is a single sub-request of a batch.
+type BatchRequest struct {
+	// ID is echoed in the matching BatchResponse.
+	ID      string            `json:"id"`
+	Method  string            `json:"method"`
+	Path    string            `json:"path"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    json.RawMessage   `json:"body,omitempty"`
+}
+
+// BatchResponse is the response to a single sub-request of a batch. Body holds
+// the response body as JSON if it is JSON, and as a JSON string otherwise.
+type BatchResponse struct {
+	ID      string            `json:"id"`
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    json.RawMessage   `json:"body,omitempty"`
+}
+
+// Batch adds a POST route at path accepting a JSON array of BatchRequest. Every
+// sub-request is dispatched through the application in-process, running the
+// middlewares of its route, and the JSON array of BatchResponse is returned in
+// the same order. A failing or panicking sub-request only affects its own response.
+func (a *PuffApp) Batch(path string, config BatchConfig) *Route {
+	if config.MaxRequests <= 0 {
+		config.MaxRequests = DefaultBatchConfig.MaxRequests
+	}
+	if config.Concurrency <= 0 {
+		config.Concurrency = DefaultBatchConfig.Concurrency
+	}
+	if config.ForwardHeaders == nil {
+		config.ForwardHeaders = DefaultBatchConfig.ForwardHeaders
+	}
+	return a.RootRouter.Post(path, nil, func(c *Context) {
+		if c.Request.Context().Value(batchRequestKey{}) != nil {
+			c.BadRequest("Batches cannot be nested.")
+			return
+		}
+		body, err := c.GetBody()
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.sendError(http.StatusRequestEntityTooLarge, "Batch body is too large.", err)
+			return
+		} else if err != nil {
+			c.BadRequest("Batch body could not be read.")
+			return
+		}
+		var requests []BatchRequest
+		if err := json.Unmarshal(body, &requests); err != nil {
+			c.BadRequest("Batch body must be a JSON array of requests: %s", err.Error())
+			return
+		}
+		if len(requests) > config.MaxRequests {
+			c.BadRequest("Batch contains %d requests, the maximum is %d.", len(requests), config.MaxRequests)
+			return
+		}
+
+		responses := make([]BatchResponse, len(requests))
+		sem := make(chan struct{}, config.Concurrency)
+		var wg sync.WaitGroup
+		for i, sub := range requests {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func() {
+				defer wg.Done()
+				defer func() { <-sem }()
+				responses[i] = a.dispatchBatchRequest(c, config, sub)
+			}()
+		}
+		wg.Wait()
+		c.SendResponse(JSONResponse{StatusCode: http.StatusOK, Content: responses})
+	})
+}
+
+// batchRequestKey marks the context of the sub-requests of a batch, so they
+// cannot reach a batch endpoint themselves under any path.
+type batchRequestKey struct{}
+
+// dispatchBatchRequest serves a single sub-request of the batch c.
+func (a *PuffApp) dispatchBatchRequest(c *Context, config BatchConfig, sub BatchRequest) (res BatchResponse) {
+	res.ID = sub.ID
+	defer func() {
+		if v := recover(); v != nil {
+			slog.Error("Panic During Batch Request", slog.String("id", sub.ID), slog.Any("Error", v))
+			res = a.batchError(c, sub.ID, http.StatusInternalServerError, "An unexpected error occured.")
+		}
+	}()
+	if sub.Method == "" {
+		sub.Method = http.MethodGet
+	}
+	if !strings.HasPrefix(sub.Path, "/") {
+		return a.batchError(c, sub.ID, http.StatusBadRequest, "path must start with /")
+	}
+	ctx := context.WithValue(c.Request.Context(), batchRequestKey{}, true)
+	req, err := http.NewRequestWithContext(ctx, sub.Method, sub.Path, bytes.NewReader(sub.Body))
+	if err != nil {
+		return a.batchError(c, sub.ID, http.StatusBadRequest, err.Error())
+	}
+	req.Host = c.Request.Host
+	req.RemoteAddr = c.Request.RemoteAddr
+	req.TLS = c.Request.TLS
+	for _, h := range config.ForwardHeaders {
+		if v := c.Request.Header.Get(h); v != "" {
+			req.Header.Set(h, v)
+		}
+	}
+	for k, v := range sub.Headers {
+		req.Header.Set(k, v)
+	}
+	if len(sub.Body) > 0 && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	w := &batchResponseWriter{header: http.Header{}}
+	a.RootRouter.ServeHTTP(w, req)
+	res.Status = w.statusCode
+	if res.Status == 0 {
+		res.Status = http.StatusOK
+	}
+	res.Headers = map[string]string{}
+	for k := range w.header {
+		res.Headers[k] = w.header.Get(k)
+	}
+	if out := bytes.TrimSpace(w.body.Bytes()); json.Valid(out) && len(out) > 0 {
+		res.Body = out
+	} else if len(out) > 0 {
+		res.Body, _ = json.Marshal(w.body.String())
+	}
+	return res
+}
+
+// batchError returns a BatchResponse for a sub-request of the batch c that
+// could not be served, with the error body configured by ErrorConfig.
+func (a *PuffApp) batchError(c *Context, id string, status int, message string) BatchResponse {
+	body, _ := json.Marshal(a.errorConfig().body(status, message, c.GetResponseHeader("X-Request-ID"), nil))
+	return BatchResponse{ID: id, Status: status, Body: body}
+}
+
+// batchResponseWriter records the response of a sub-request in memory.
+type batchResponseWriter struct {
+	header     http.Header
+	body       bytes.Buffer
+	statusCode int
+}
+
+func (w *batchResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *batchResponseWriter) WriteHeader(statusCode int) {
+	if w.statusCode == 0 && statusCode >= 200 {
+		w.statusCode = statusCode
+	}
+}
+
+func (w *batchResponseWriter) Write(b []byte) (int, error) {
+	if w.statusCode == 0 {
+		w.statusCode = http.StatusOK
+	}
+	return w.body.Write(b)
+}
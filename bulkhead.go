@@ -0,0 +1,177 @@
+package puff
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Bulkhead limits how many requests to the routes assigned to it are served
+// at once, so a slow dependency behind one class of routes cannot tie up all
+// of the server's capacity. Requests that find it full wait up to MaxWait for
+// a slot and are otherwise answered with 503 Service Unavailable.
+//
+// Share one Bulkhead between routes to put them in the same pool:
+//
+//	reports, err := puff.NewBulkhead("reports", 4)
+//	app.Get("/reports/{id}", nil, getReport).WithBulkhead(reports)
+//	app.Post("/reports", nil, createReport).WithBulkhead(reports)
+//
+// A Bulkhead can also be declared as a struct literal, e.g.
+// &puff.Bulkhead{Name: "reports", MaxConcurrent: 4}. It must not be copied
+// or have MaxConcurrent changed after first use.
+type Bulkhead struct {
+	// Name identifies the bulkhead in its stats. It is not sent to clients.
+	Name string
+	// MaxConcurrent is the number of requests served at once. Default: 1.
+	MaxConcurrent int
+	// MaxWait is how long a request waits for a free slot before it is rejected.
+	// Default: 0, rejecting immediately.
+	MaxWait time.Duration
+	// RetryAfter is sent in the Retry-After header of rejected requests, if set, rounded up to
+	// whole seconds.
+	RetryAfter time.Duration
+
+	once     sync.Once
+	slots    chan struct{}
+	waiting  atomic.Int64
+	served   atomic.Uint64
+	rejected atomic.Uint64
+}
+
+// BulkheadStats is a snapshot of the saturation of a Bulkhead.
+type BulkheadStats struct {
+	Name string `json:"name"`
+	// MaxConcurrent is the number of requests served at once.
+	MaxConcurrent int `json:"max_concurrent"`
+	// InFlight is the number of requests currently being served.
+	InFlight int `json:"in_flight"`
+	// Waiting is the number of requests currently waiting for a slot.
+	Waiting int `json:"waiting"`
+	// Saturation is InFlight divided by MaxConcurrent.
+	Saturation float64 `json:"saturation"`
+	// Served is the number of requests served since creation.
+	Served uint64 `json:"served"`
+	// Rejected is the number of requests rejected with 503 since creation.
+	Rejected uint64 `json:"rejected"`
+}
+
+// NewBulkhead creates a Bulkhead named name serving at most maxConcurrent
+// requests at once. It returns an error if maxConcurrent is not positive.
+func NewBulkhead(name string, maxConcurrent int) (*Bulkhead, error) {
+	if maxConcurrent <= 0 {
+		return nil, fmt.Errorf("puff: bulkhead %s must allow at least one concurrent request", name)
+	}
+	return &Bulkhead{Name: name, MaxConcurrent: maxConcurrent}, nil
+}
+
+// init creates the slots of the bulkhead on first use.
+func (b *Bulkhead) init() {
+	b.once.Do(func() {
+		b.slots = make(chan struct{}, max(b.MaxConcurrent, 1))
+	})
+}
+
+// Stats returns the current saturation of the bulkhead.
+func (b *Bulkhead) Stats() BulkheadStats {
+	b.init()
+	inFlight := len(b.slots)
+	return BulkheadStats{
+		Name:          b.Name,
+		MaxConcurrent: cap(b.slots),
+		InFlight:      inFlight,
+		Waiting:       int(b.waiting.Load()),
+		Saturation:    float64(inFlight) / float64(cap(b.slots)),
+		Served:        b.served.Load(),
+		Rejected:      b.rejected.Load(),
+	}
+}
+
+// acquire takes a slot, waiting up to MaxWait or until the request is
+// canceled. It reports whether a slot was taken.
+func (b *Bulkhead) acquire(req *http.Request) bool {
+	b.init()
+	select {
+	case b.slots <- struct{}{}:
+		b.served.Add(1)
+		return true
+	default:
+	}
+	if b.MaxWait > 0 {
+		b.waiting.Add(1)
+		defer b.waiting.Add(-1)
+		timer := time.NewTimer(b.MaxWait)
+		defer timer.Stop()
+		select {
+		case b.slots <- struct{}{}:
+			b.served.Add(1)
+			return true
+		case <-timer.C:
+		case <-req.Context().Done():
+		}
+	}
+	b.rejected.Add(1)
+	return false
+}
+
+// release frees a slot taken with acquire.
+func (b *Bulkhead) release() {
+	<-b.slots
+}
+
+// WithBulkhead assigns the route to b, overriding the Bulkhead of its routers.
+func (r *Route) WithBulkhead(b *Bulkhead) *Route {
+	r.Bulkhead = b
+	return r
+}
+
+// bulkhead returns the bulkhead of the route, or of its closest router with one.
+func (r *Route) bulkhead() *Bulkhead {
+	if r.Bulkhead != nil {
+		return r.Bulkhead
+	}
+	for current := r.Router; current != nil; current = current.parent {
+		if current.Bulkhead != nil {
+			return current.Bulkhead
+		}
+	}
+	return nil
+}
+
+// enterBulkhead takes a slot of the route's bulkhead. If it is full, it
+// responds with 503 and returns false. The returned func frees the slot and
+// must be called once the handler finished, even if it timed out.
+func (r *Router) enterBulkhead(c *Context, route *Route) (func(), bool) {
+	b := route.bulkhead()
+	if b == nil {
+		return func() {}, true
+	}
+	if !b.acquire(c.Request) {
+		if b.RetryAfter > 0 {
+			c.SetResponseHeader("Retry-After", strconv.Itoa(int(math.Ceil(b.RetryAfter.Seconds()))))
+		}
+		c.response(http.StatusServiceUnavailable, "too many concurrent requests")
+		return nil, false
+	}
+	return b.release, true
+}
+
+// Bulkheads returns the stats of every bulkhead used by the application's
+// routes, e.g. to export pool saturation as metrics.
+func (a *PuffApp) Bulkheads() []BulkheadStats {
+	var stats []BulkheadStats
+	seen := map[*Bulkhead]bool{}
+	a.routesMu.RLock()
+	defer a.routesMu.RUnlock()
+	for _, route := range a.AllRoutes() {
+		if b := route.bulkhead(); b != nil && !seen[b] {
+			seen[b] = true
+			stats = append(stats, b.Stats())
+		}
+	}
+	return stats
+}
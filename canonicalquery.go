@@ -0,0 +1,93 @@
+package puff
+
+import (
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// DefaultTrackingParams are the query parameters dropped from cache keys when
+// AppConfig.IgnoredQueryParams is nil. They identify campaigns and clicks, and
+// never change the response.
+var DefaultTrackingParams = []string{
+	"utm_*",
+	"gclid",
+	"dclid",
+	"fbclid",
+	"msclkid",
+	"mc_cid",
+	"mc_eid",
+	"_ga",
+	"_gl",
+}
+
+// CanonicalQuery returns rawQuery in a canonical form, so equivalent query
+// strings produce the same cache key: parameters are sorted by key, keeping
+// the order of repeated values, and re-encoded consistently ("%7E" becomes
+// "~", "%20" becomes "+", "a" becomes "a="). Parameters matching one of drop
+// are removed; a pattern ending in "*" matches by prefix, e.g. "utm_*", and
+// matching is case-insensitive. Malformed escapes are kept as sent.
+func CanonicalQuery(rawQuery string, drop []string) string {
+	type param struct{ key, value string }
+	var params []param
+	for _, pair := range strings.FieldsFunc(rawQuery, func(r rune) bool { return r == '&' || r == ';' }) {
+		key, value, _ := strings.Cut(pair, "=")
+		key, value = unescapeQueryPart(key), unescapeQueryPart(value)
+		if key == "" || queryParamDropped(key, drop) {
+			continue
+		}
+		params = append(params, param{key, value})
+	}
+	slices.SortStableFunc(params, func(a, b param) int {
+		return strings.Compare(a.key, b.key)
+	})
+	var sb strings.Builder
+	for i, p := range params {
+		if i > 0 {
+			sb.WriteByte('&')
+		}
+		sb.WriteString(url.QueryEscape(p.key))
+		sb.WriteByte('=')
+		sb.WriteString(url.QueryEscape(p.value))
+	}
+	return sb.String()
+}
+
+// unescapeQueryPart decodes a key or value of a query string, returning it
+// unchanged if it is not validly escaped.
+func unescapeQueryPart(s string) string {
+	if unescaped, err := url.QueryUnescape(s); err == nil {
+		return unescaped
+	}
+	return s
+}
+
+// queryParamDropped reports whether key matches one of the patterns in drop.
+func queryParamDropped(key string, drop []string) bool {
+	for _, pattern := range drop {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if len(key) >= len(prefix) && strings.EqualFold(key[:len(prefix)], prefix) {
+				return true
+			}
+		} else if strings.EqualFold(key, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// CacheKey identifies the resource requested, for use by caching, idempotency
+// and request coalescing middlewares. It is made of the method, the path and
+// the canonical query (see CanonicalQuery) without the parameters in
+// AppConfig.IgnoredQueryParams, e.g. "GET /products?color=red&size=m".
+func (ctx *Context) CacheKey() string {
+	drop := DefaultTrackingParams
+	if ctx.puff != nil && ctx.puff.Config.IgnoredQueryParams != nil {
+		drop = ctx.puff.Config.IgnoredQueryParams
+	}
+	key := ctx.Request.Method + " " + ctx.Request.URL.EscapedPath()
+	if query := CanonicalQuery(ctx.Request.URL.RawQuery, drop); query != "" {
+		key += "?" + query
+	}
+	return key
+}
@@ -0,0 +1,122 @@
+package puff
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// PanicCircuitConfig configures tripping routes that panic repeatedly into a
+// 503 state, instead of letting them keep failing requests.
+type PanicCircuitConfig struct {
+	// Threshold is the number of panics within Window that trips the circuit of a route. Default: 5.
+	Threshold int
+	// Window is the period panics are counted over. Default: 1 minute.
+	Window time.Duration
+	// Cooldown is how long a tripped route responds with 503 before it is tried again. Default: 30 seconds.
+	Cooldown time.Duration
+	// OnTrip is called when the circuit of a route trips, with the last panic value. Use it to alert.
+	OnTrip func(route *Route, lastPanic any)
+}
+
+// panicCircuit tracks the recent panics of a route.
+type panicCircuit struct {
+	mu        sync.Mutex
+	panics    []time.Time
+	openUntil time.Time
+	trips     int
+}
+
+func (pc *PanicCircuitConfig) withDefaults() PanicCircuitConfig {
+	c := *pc
+	if c.Threshold <= 0 {
+		c.Threshold = 5
+	}
+	if c.Window <= 0 {
+		c.Window = time.Minute
+	}
+	if c.Cooldown <= 0 {
+		c.Cooldown = 30 * time.Second
+	}
+	return c
+}
+
+// record registers a panic and reports whether it tripped the circuit.
+func (pc *panicCircuit) record(config PanicCircuitConfig, now time.Time) bool {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	cutoff := now.Add(-config.Window)
+	recent := pc.panics[:0]
+	for _, t := range pc.panics {
+		if t.After(cutoff) {
+			recent = append(recent, t)
+		}
+	}
+	pc.panics = append(recent, now)
+	if len(pc.panics) < config.Threshold || now.Before(pc.openUntil) {
+		return false
+	}
+	pc.openUntil = now.Add(config.Cooldown)
+	pc.panics = pc.panics[:0]
+	pc.trips++
+	return true
+}
+
+// openFor returns how long the circuit stays open, or 0 if it is closed.
+func (pc *panicCircuit) openFor(now time.Time) time.Duration {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	if now.Before(pc.openUntil) {
+		return pc.openUntil.Sub(now)
+	}
+	return 0
+}
+
+// CircuitOpen reports whether the route is currently tripped because of repeated panics.
+func (r *Route) CircuitOpen() bool {
+	return r.circuit != nil && r.circuit.openFor(time.Now()) > 0
+}
+
+// CircuitTrips returns the number of times the route has been tripped since registration.
+func (r *Route) CircuitTrips() int {
+	if r.circuit == nil {
+		return 0
+	}
+	r.circuit.mu.Lock()
+	defer r.circuit.mu.Unlock()
+	return r.circuit.trips
+}
+
+// RecordPanic registers a panic recovered while serving the request against
+// the route's panic circuit (see AppConfig.PanicCircuit). Recovery
+// middlewares should call it so routes trip no matter where the panic is
+// recovered; puff's own recovery calls it automatically.
+func (ctx *Context) RecordPanic(v any) {
+	if ctx.route == nil || ctx.route.circuit == nil || ctx.puff == nil || ctx.puff.Config.PanicCircuit == nil {
+		return
+	}
+	config := ctx.puff.Config.PanicCircuit.withDefaults()
+	if ctx.route.circuit.record(config, time.Now()) {
+		slog.Error(fmt.Sprintf("route %s %s tripped after %d panics within %s", ctx.route.Protocol, ctx.route.fullPath, config.Threshold, config.Window))
+		if config.OnTrip != nil {
+			config.OnTrip(ctx.route, v)
+		}
+	}
+}
+
+// rejectIfTripped responds with 503 if the route's circuit is open.
+func (r *Router) rejectIfTripped(c *Context, route *Route) bool {
+	if route.circuit == nil || r.puff == nil || r.puff.Config.PanicCircuit == nil {
+		return false
+	}
+	wait := route.circuit.openFor(time.Now())
+	if wait <= 0 {
+		return false
+	}
+	c.SetResponseHeader("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+	c.response(http.StatusServiceUnavailable, "route is temporarily unavailable")
+	return true
+}
@@ -0,0 +1,58 @@
+package puff
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// clientTLSConfig applies the mutual TLS settings of the AppConfig to cfg,
+// creating it if nil. Client certificates are required and verified against
+// the client CAs unless AppConfig.TLSClientAuth says otherwise. Verifying
+// client certificates without client CAs, set in the AppConfig or in cfg, is
+// an error: Go would verify them against the system roots instead.
+func (a *PuffApp) clientTLSConfig(cfg *tls.Config) (*tls.Config, error) {
+	pool := a.Config.TLSClientCAs
+	if pool == nil && a.Config.TLSClientCAFile != "" {
+		pem, err := os.ReadFile(a.Config.TLSClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading TLS client CAs failed: %w", err)
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("loading TLS client CAs failed: no certificates found in %s", a.Config.TLSClientCAFile)
+		}
+	}
+	if pool == nil && cfg != nil {
+		pool = cfg.ClientCAs
+	}
+	auth := a.Config.TLSClientAuth
+	if pool == nil && auth == tls.NoClientCert {
+		return cfg, nil
+	}
+	if pool != nil && auth == tls.NoClientCert {
+		auth = tls.RequireAndVerifyClientCert
+	}
+	if pool == nil && (auth == tls.VerifyClientCertIfGiven || auth == tls.RequireAndVerifyClientCert) {
+		return nil, fmt.Errorf("TLS client auth %s requires TLSClientCAs or TLSClientCAFile", auth)
+	}
+	if cfg == nil {
+		cfg = &tls.Config{}
+	}
+	cfg.ClientCAs = pool
+	cfg.ClientAuth = auth
+	return cfg, nil
+}
+
+// ClientCertificate returns the verified certificate the client presented
+// during the TLS handshake, or nil if the connection is not TLS or no
+// certificate was verified. Certificates accepted without verification, as
+// with tls.RequireAnyClientCert, are available in Request.TLS.PeerCertificates.
+func (ctx *Context) ClientCertificate() *x509.Certificate {
+	state := ctx.Request.TLS
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return state.VerifiedChains[0][0]
+}
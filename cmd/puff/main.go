@@ -0,0 +1,66 @@
+// Command puff scaffolds new Puff projects.
+//
+// Usage:
+//
+//	puff new [-module path] [-dir directory] <name>
+//
+// It creates a project with a main.go serving a DefaultApp with the default
+// middlewares, a routers package with an example router and its fields
+// structs, a go.mod and a Dockerfile.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+const usage = `Usage:
+  puff new [-module path] [-dir directory] <name>
+
+Commands:
+  new  scaffold a new Puff project
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	switch os.Args[1] {
+	case "new":
+		if err := runNew(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, "puff new:", err)
+			os.Exit(1)
+		}
+	case "help", "-h", "-help", "--help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "puff: unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+}
+
+// runNew implements the new command.
+func runNew(args []string) error {
+	flags := flag.NewFlagSet("new", flag.ContinueOnError)
+	module := flags.String("module", "", "the module path of the project. Default: the project name")
+	dir := flags.String("dir", "", "the directory the project is created in. Default: the project name")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("expected the project name, got %d arguments", flags.NArg())
+	}
+	project := newProject(flags.Arg(0), *module)
+	if *dir == "" {
+		*dir = project.Binary
+	}
+	if err := project.scaffold(*dir); err != nil {
+		return err
+	}
+	fmt.Printf("Created %s in %s. Next steps:\n\n", project.Name, *dir)
+	fmt.Printf("  cd %s\n  go get github.com/ThePuffProject/puff\n  go mod tidy\n  go run .\n\n", *dir)
+	fmt.Println("The docs are served at http://localhost:8000/docs.")
+	return nil
+}
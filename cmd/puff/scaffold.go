@@ -0,0 +1,93 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"text/template"
+)
+
+//go:embed templates
+var templates embed.FS
+
+// projectFiles maps the templates to the files they are rendered to, relative
+// to the project directory.
+var projectFiles = map[string]string{
+	"templates/go.mod.tmpl":     "go.mod",
+	"templates/main.go.tmpl":    "main.go",
+	"templates/pizzas.go.tmpl":  "routers/pizzas.go",
+	"templates/Dockerfile.tmpl": "Dockerfile",
+}
+
+// project is the data the templates are rendered with.
+type project struct {
+	// Name is the application name, as given on the command line.
+	Name string
+	// Module is the module path of the project.
+	Module string
+	// Binary is the name of the built executable, the last element of Module.
+	Binary string
+	// GoVersion is the Go version written to go.mod and used by the Dockerfile.
+	GoVersion string
+}
+
+// newProject creates a project called name. The module path defaults to
+// name, lowercased and with spaces replaced by dashes.
+func newProject(name, module string) project {
+	if module == "" {
+		module = strings.ToLower(strings.Join(strings.Fields(name), "-"))
+	}
+	return project{
+		Name:      name,
+		Module:    module,
+		Binary:    path.Base(module),
+		GoVersion: goVersion(),
+	}
+}
+
+// goVersion returns the major and minor version of the running Go toolchain,
+// e.g. "1.22". Development builds of Go fall back to "1.22".
+func goVersion() string {
+	parts := strings.SplitN(strings.TrimPrefix(runtime.Version(), "go"), ".", 3)
+	if !strings.HasPrefix(runtime.Version(), "go1.") || len(parts) < 2 {
+		return "1.22"
+	}
+	return parts[0] + "." + parts[1]
+}
+
+// scaffold renders the project files into dir. It refuses to overwrite
+// existing files, so running it twice does not lose changes.
+func (p project) scaffold(dir string) error {
+	for _, name := range projectFiles {
+		target := filepath.Join(dir, filepath.FromSlash(name))
+		if _, err := os.Stat(target); err == nil {
+			return fmt.Errorf("%s already exists", target)
+		}
+	}
+	for tmpl, name := range projectFiles {
+		t, err := template.ParseFS(templates, tmpl)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return err
+		}
+		f, err := os.Create(target)
+		if err != nil {
+			return err
+		}
+		err = t.Execute(f, p)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return fmt.Errorf("writing %s failed: %w", target, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestProject_Scaffold(t *testing.T) {
+	dir := t.TempDir()
+	p := newProject("Pizza Shop", "example.com/pizza-shop")
+	if p.Binary != "pizza-shop" {
+		t.Errorf("Expected binary pizza-shop, got %s", p.Binary)
+	}
+	if err := p.scaffold(dir); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"main.go", "routers/pizzas.go"} {
+		if _, err := parser.ParseFile(token.NewFileSet(), filepath.Join(dir, name), nil, 0); err != nil {
+			t.Errorf("Expected %s to be valid Go: %s", name, err)
+		}
+	}
+	main, _ := os.ReadFile(filepath.Join(dir, "main.go"))
+	if !strings.Contains(string(main), `"example.com/pizza-shop/routers"`) || !strings.Contains(string(main), `puff.DefaultApp("Pizza Shop")`) {
+		t.Errorf("Expected main.go to use the module and name, got %s", main)
+	}
+	if err := p.scaffold(dir); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("Expected scaffolding twice to fail, got %v", err)
+	}
+	if p := newProject("Pizza Shop", ""); p.Module != "pizza-shop" {
+		t.Errorf("Expected module pizza-shop, got %s", p.Module)
+	}
+
+	dir = t.TempDir()
+	if err := newProject(`Luigi's "Best" Pizza\`, "example.com/luigi").scaffold(dir); err != nil {
+		t.Fatal(err)
+	}
+	main, _ = os.ReadFile(filepath.Join(dir, "main.go"))
+	if _, err := parser.ParseFile(token.NewFileSet(), "main.go", main, 0); err != nil || !strings.Contains(string(main), `puff.DefaultApp("Luigi's \"Best\" Pizza\\")`) {
+		t.Errorf("Expected the name to be quoted in main.go, got %v: %s", err, main)
+	}
+}
@@ -0,0 +1,205 @@
+package puff
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// CodeSample is an example invocation of an operation, documented under the
+// x-codeSamples extension read by ReDoc and puff's Swagger UI page.
+type CodeSample struct {
+	Lang   string `json:"lang"`
+	Label  string `json:"label"`
+	Source string `json:"source"`
+}
+
+// codeSampleBaseURL is used in code samples when AppConfig.BaseURL is not set.
+const codeSampleBaseURL = "http://localhost:8000"
+
+var pathPlaceholder = regexp.MustCompile(`\{[^}]+\}`)
+
+// codeSamples returns a curl and an HTTPie invocation of route built from
+// the examples of its parameters and body.
+func codeSamples(route *Route) []CodeSample {
+	baseURL := codeSampleBaseURL
+	if route.Router != nil && route.Router.puff != nil && route.Router.puff.Config.BaseURL != "" {
+		baseURL = strings.TrimSuffix(route.Router.puff.Config.BaseURL, "/")
+	}
+
+	var pathValues []string
+	query := url.Values{}
+	var headers, cookies, form, files [][2]string
+	var body string
+	for _, p := range append(slices.Clip(route.params), route.implicitPathParameters()...) {
+		value := exampleString(p.Schema)
+		switch p.In {
+		case "path":
+			pathValues = append(pathValues, url.PathEscape(value))
+		case "query":
+			if p.Required {
+				query.Set(p.Name, value)
+			}
+		case "header":
+			if p.Required {
+				headers = append(headers, [2]string{p.Name, value})
+			}
+		case "cookie":
+			if p.Required {
+				cookies = append(cookies, [2]string{p.Name, value})
+			}
+		case "form":
+			if example, ok := exampleValue(p.Schema, 0).(map[string]any); ok && p.formStruct {
+				keys := make([]string, 0, len(example))
+				for key := range example {
+					keys = append(keys, key)
+				}
+				slices.Sort(keys)
+				for _, key := range keys {
+					form = append(form, [2]string{key, fmt.Sprint(example[key])})
+				}
+				continue
+			}
+			form = append(form, [2]string{p.Name, value})
+		case "file":
+			files = append(files, [2]string{p.Name, p.Name})
+		case "body":
+			if b, err := json.Marshal(exampleValue(p.Schema, 0)); err == nil {
+				body = string(b)
+			}
+		}
+	}
+	for key, value := range route.queryConstraints {
+		query.Set(key, value)
+	}
+	// path params are bound by position, so fill the placeholders in order.
+	path := pathPlaceholder.ReplaceAllStringFunc(route.openAPIPath(), func(placeholder string) string {
+		if len(pathValues) == 0 {
+			return placeholder
+		}
+		value := pathValues[0]
+		pathValues = pathValues[1:]
+		return value
+	})
+	target := baseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	curl := []string{"curl"}
+	httpie := []string{"http"}
+	switch route.Protocol {
+	case http.MethodGet:
+	case http.MethodHead:
+		// -X HEAD makes curl wait for a body that never comes.
+		curl = append(curl, "-I")
+	default:
+		curl = append(curl, "-X", route.Protocol)
+	}
+	httpie = append(httpie, route.Protocol, shellQuote(target))
+	curl = append(curl, shellQuote(target))
+	for _, h := range headers {
+		curl = append(curl, "-H", shellQuote(h[0]+": "+h[1]))
+		httpie = append(httpie, shellQuote(h[0]+":"+h[1]))
+	}
+	if len(cookies) > 0 {
+		pairs := make([]string, len(cookies))
+		for i, c := range cookies {
+			pairs[i] = c[0] + "=" + c[1]
+		}
+		curl = append(curl, "-b", shellQuote(strings.Join(pairs, "; ")))
+		httpie = append(httpie, shellQuote("Cookie:"+strings.Join(pairs, "; ")))
+	}
+	if len(form) > 0 || len(files) > 0 {
+		httpie = slices.Insert(httpie, 1, "--form")
+	}
+	for _, f := range form {
+		curl = append(curl, "-F", shellQuote(f[0]+"="+f[1]))
+		httpie = append(httpie, shellQuote(f[0]+"="+f[1]))
+	}
+	for _, f := range files {
+		curl = append(curl, "-F", shellQuote(f[0]+"=@"+f[1]))
+		httpie = append(httpie, shellQuote(f[0]+"@"+f[1]))
+	}
+	if body != "" {
+		curl = append(curl, "-H", shellQuote("Content-Type: application/json"), "-d", shellQuote(body))
+		httpie = append([]string{"echo", shellQuote(body), "|"}, httpie...)
+	}
+
+	return []CodeSample{
+		{Lang: "Shell", Label: "curl", Source: strings.Join(curl, " ")},
+		{Lang: "Shell", Label: "HTTPie", Source: strings.Join(httpie, " ")},
+	}
+}
+
+// shellQuote quotes s for POSIX shells if needed.
+func shellQuote(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\n'\"\\$`!&|;<>()*?[]{}#~=%") {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// exampleString returns the example of a parameter schema as a string.
+func exampleString(s *Schema) string {
+	if s == nil {
+		return "string"
+	}
+	if len(s.Examples) > 0 {
+		return fmt.Sprint(s.Examples[0])
+	}
+	switch {
+	case isNumericSchema(s):
+		return "0"
+	case s.Type == "boolean":
+		return "false"
+	}
+	return "string"
+}
+
+// exampleValue returns an example value of s, resolving references to
+// component schemas. depth guards against recursive schemas.
+func exampleValue(s *Schema, depth int) any {
+	if s == nil || depth > 8 {
+		return nil
+	}
+	if name, ok := strings.CutPrefix(s.Ref, "#/components/schemas/"); ok {
+		return exampleValue(Schemas[name], depth+1)
+	}
+	switch {
+	case s.Items != nil || s.Type == "array":
+		return []any{exampleValue(s.Items, depth+1)}
+	case s.Properties != nil:
+		m := map[string]any{}
+		for name, prop := range s.Properties {
+			m[name] = exampleValue(prop, depth+1)
+		}
+		return m
+	case s.AdditionalProperties != nil:
+		return map[string]any{"key": exampleValue(s.AdditionalProperties, depth+1)}
+	case isNumericSchema(s):
+		return json.Number(exampleString(s))
+	case len(s.Examples) > 0:
+		return s.Examples[0]
+	case s.Type == "boolean":
+		return false
+	}
+	return "string"
+}
+
+// isNumericSchema reports whether s describes a number.
+func isNumericSchema(s *Schema) bool {
+	switch s.Type {
+	case "integer", "number":
+		return true
+	}
+	switch s.Format {
+	case "int", "int8", "int16", "int32", "int64", "float", "double":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,289 @@
+package puff
+
+import (
+	"bufio"
+	"encoding/binary"
+	"maps"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// ConnectionStats are the metrics of the long-lived connections of an
+// application, e.g. to export the health of WebSocket and SSE connections as
+// gauges and counters.
+type ConnectionStats struct {
+	WebSocket WebSocketStats
+	SSE       SSEStats
+}
+
+// WebSocketStats are the metrics of the WebSocket connections of an
+// application. Counters cover every connection since the application started.
+type WebSocketStats struct {
+	// Active is the number of open connections.
+	Active int64
+	// Accepted is the number of connections accepted.
+	Accepted uint64
+	// MessagesIn and MessagesOut count the text and binary messages received
+	// and sent. Control frames such as pings are not counted.
+	MessagesIn  uint64
+	MessagesOut uint64
+	// BytesIn and BytesOut count the bytes received and sent, including frame
+	// headers and control frames.
+	BytesIn  uint64
+	BytesOut uint64
+	// CloseCodes counts the closed connections by the status code of the first
+	// close frame received or sent, e.g. 1000 for a normal closure. Connections
+	// closed without a close frame count as 1006 (abnormal closure).
+	CloseCodes map[int]uint64
+}
+
+// SSEStats are the metrics of the server-sent event streams, sent with
+// StreamingResponse, of an application.
+type SSEStats struct {
+	// Active is the number of open streams.
+	Active int64
+	// Opened is the number of streams opened.
+	Opened uint64
+	// EventsOut counts the events sent.
+	EventsOut uint64
+	// BytesOut counts the bytes of the events sent.
+	BytesOut uint64
+}
+
+// connectionMetrics collects the ConnectionStats of an application.
+type connectionMetrics struct {
+	wsActive      atomic.Int64
+	wsAccepted    atomic.Uint64
+	wsMessagesIn  atomic.Uint64
+	wsMessagesOut atomic.Uint64
+	wsBytesIn     atomic.Uint64
+	wsBytesOut    atomic.Uint64
+	closeCodesMu  sync.Mutex
+	closeCodes    map[int]uint64
+
+	sseActive    atomic.Int64
+	sseOpened    atomic.Uint64
+	sseEventsOut atomic.Uint64
+	sseBytesOut  atomic.Uint64
+}
+
+// ConnectionStats returns the metrics of the WebSocket connections and SSE
+// streams of the application.
+func (a *PuffApp) ConnectionStats() ConnectionStats {
+	m := &a.connections
+	m.closeCodesMu.Lock()
+	closeCodes := maps.Clone(m.closeCodes)
+	m.closeCodesMu.Unlock()
+	return ConnectionStats{
+		WebSocket: WebSocketStats{
+			Active:      m.wsActive.Load(),
+			Accepted:    m.wsAccepted.Load(),
+			MessagesIn:  m.wsMessagesIn.Load(),
+			MessagesOut: m.wsMessagesOut.Load(),
+			BytesIn:     m.wsBytesIn.Load(),
+			BytesOut:    m.wsBytesOut.Load(),
+			CloseCodes:  closeCodes,
+		},
+		SSE: SSEStats{
+			Active:    m.sseActive.Load(),
+			Opened:    m.sseOpened.Load(),
+			EventsOut: m.sseEventsOut.Load(),
+			BytesOut:  m.sseBytesOut.Load(),
+		},
+	}
+}
+
+// connectionMetrics returns the metrics of the application serving the
+// request, or nil outside of an application.
+func (ctx *Context) connectionMetrics() *connectionMetrics {
+	if ctx.puff == nil {
+		return nil
+	}
+	return &ctx.puff.connections
+}
+
+// sseStream records a new SSE stream and returns the function recording
+// that it closed.
+func (m *connectionMetrics) sseStream() func() {
+	if m == nil {
+		return func() {}
+	}
+	m.sseOpened.Add(1)
+	m.sseActive.Add(1)
+	return func() { m.sseActive.Add(-1) }
+}
+
+// sseEvent records an event of n bytes sent on an SSE stream.
+func (m *connectionMetrics) sseEvent(n int) {
+	if m == nil {
+		return
+	}
+	m.sseEventsOut.Add(1)
+	m.sseBytesOut.Add(uint64(n))
+}
+
+// meteredHijacker counts the traffic of the WebSocket connection hijacked
+// from the wrapped ResponseWriter.
+type meteredHijacker struct {
+	http.ResponseWriter
+	metrics *connectionMetrics
+}
+
+func (h *meteredHijacker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(h.ResponseWriter).Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	h.metrics.wsAccepted.Add(1)
+	h.metrics.wsActive.Add(1)
+	mc := &meteredConn{Conn: conn, metrics: h.metrics}
+	mc.in.onFrame = func(opcode byte) { countMessage(opcode, &h.metrics.wsMessagesIn) }
+	mc.out.onFrame = func(opcode byte) { countMessage(opcode, &h.metrics.wsMessagesOut) }
+	mc.in.onClose, mc.out.onClose = mc.setCloseCode, mc.setCloseCode
+	return mc, rw, nil
+}
+
+// meteredConn is a WebSocket connection whose frames are counted.
+type meteredConn struct {
+	net.Conn
+	metrics   *connectionMetrics
+	in, out   frameParser
+	closeCode atomic.Int32
+	closeOnce sync.Once
+}
+
+func (c *meteredConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.metrics.wsBytesIn.Add(uint64(n))
+	c.in.feed(b[:n])
+	return n, err
+}
+
+func (c *meteredConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.metrics.wsBytesOut.Add(uint64(n))
+	c.out.feed(b[:n])
+	return n, err
+}
+
+func (c *meteredConn) Close() error {
+	c.closeOnce.Do(func() {
+		c.metrics.wsActive.Add(-1)
+		code := int(c.closeCode.Load())
+		if code == 0 {
+			code = 1006
+		}
+		c.metrics.closeCodesMu.Lock()
+		if c.metrics.closeCodes == nil {
+			c.metrics.closeCodes = map[int]uint64{}
+		}
+		c.metrics.closeCodes[code]++
+		c.metrics.closeCodesMu.Unlock()
+	})
+	return c.Conn.Close()
+}
+
+// setCloseCode records the status code of the first close frame.
+func (c *meteredConn) setCloseCode(code int) {
+	c.closeCode.CompareAndSwap(0, int32(code))
+}
+
+// countMessage counts the frames with opcode in messages if they are data
+// frames.
+func countMessage(opcode byte, messages *atomic.Uint64) {
+	if opcode == 0x1 || opcode == 0x2 {
+		messages.Add(1)
+	}
+}
+
+// frameParser follows the WebSocket frames (RFC 6455 section 5.2) of one
+// direction of a connection, however the bytes are split into reads or
+// writes.
+type frameParser struct {
+	// onFrame is called with the opcode of every frame.
+	onFrame func(opcode byte)
+	// onClose is called with the status code of close frames, 1005 (no status
+	// received) if they have none.
+	onClose func(code int)
+
+	header  [14]byte
+	headerN int
+	opcode  byte
+	masked  bool
+	maskKey [4]byte
+	// payloadN and payloadLeft are the payload bytes read and left of the frame.
+	payloadN    uint64
+	payloadLeft uint64
+	closeCode   [2]byte
+}
+
+// feed parses the next bytes of the stream.
+func (p *frameParser) feed(b []byte) {
+	for len(b) > 0 {
+		if p.payloadLeft == 0 {
+			p.header[p.headerN] = b[0]
+			p.headerN++
+			b = b[1:]
+			if p.headerN < 2 || p.headerN < p.headerLen() {
+				continue
+			}
+			p.startFrame()
+			continue
+		}
+		n := min(uint64(len(b)), p.payloadLeft)
+		if p.opcode == 0x8 {
+			for i := uint64(0); i < n && p.payloadN+i < 2; i++ {
+				c := b[i]
+				if p.masked {
+					c ^= p.maskKey[(p.payloadN+i)%4]
+				}
+				p.closeCode[p.payloadN+i] = c
+			}
+			if p.payloadN < 2 && p.payloadN+n >= 2 {
+				p.onClose(int(binary.BigEndian.Uint16(p.closeCode[:])))
+			}
+		}
+		p.payloadN += n
+		p.payloadLeft -= n
+		b = b[n:]
+	}
+}
+
+// headerLen returns the length of the header of the frame, once its first two
+// bytes are read.
+func (p *frameParser) headerLen() int {
+	n := 2
+	switch p.header[1] & 0x7F {
+	case 126:
+		n += 2
+	case 127:
+		n += 8
+	}
+	if p.header[1]&0x80 != 0 {
+		n += 4
+	}
+	return n
+}
+
+// startFrame starts the payload of the frame whose header was read.
+func (p *frameParser) startFrame() {
+	p.opcode = p.header[0] & 0x0F
+	p.masked = p.header[1]&0x80 != 0
+	length, offset := uint64(p.header[1]&0x7F), 2
+	switch length {
+	case 126:
+		length, offset = uint64(binary.BigEndian.Uint16(p.header[2:4])), 4
+	case 127:
+		length, offset = binary.BigEndian.Uint64(p.header[2:10]), 10
+	}
+	if p.masked {
+		copy(p.maskKey[:], p.header[offset:offset+4])
+	}
+	p.headerN, p.payloadN, p.payloadLeft = 0, 0, length
+	p.onFrame(p.opcode)
+	if p.opcode == 0x8 && length < 2 {
+		p.onClose(1005)
+	}
+}
@@ -27,6 +27,17 @@ type Context struct {
 	// LoggerConfig
 	LoggerConfig LoggerConfig
 	statusCode   int
+	// raw is true once the response has been handed to the handler through Raw.
+	raw bool
+
+	// puff maps to the PuffApp serving the request.
+	puff *PuffApp
+	// route is the route serving the request, nil until a route matched.
+	route *Route
+	// incomingFlashes caches the flash messages read by Flashes.
+	incomingFlashes *[]string
+	// outgoingFlashes are the flash messages queued by Flash.
+	outgoingFlashes []string
 }
 
 func NewContext(w http.ResponseWriter, r *http.Request, a *PuffApp) *Context {
@@ -35,6 +46,7 @@ func NewContext(w http.ResponseWriter, r *http.Request, a *PuffApp) *Context {
 		ResponseWriter: w,
 		registry:       make(map[string]any), // prevents assignment to nil map
 		LoggerConfig:   *a.Config.LoggerConfig,
+		puff:           a,
 	}
 }
 
@@ -72,10 +84,36 @@ func (ctx *Context) SetResponseHeader(k, v string) {
 	ctx.ResponseWriter.Header().Set(k, v)
 }
 
-// GetBody returns the request body.
+// GetBody returns the request body. Bodies sent with a gzip or deflate
+// Content-Encoding are decompressed, failing with an *http.MaxBytesError if
+// they are larger than AppConfig.MaxDecodedBodyBytes once decompressed.
 func (ctx *Context) GetBody() ([]byte, error) {
 	defer ctx.Request.Body.Close()
-	return io.ReadAll(ctx.Request.Body)
+	body, err := decodeContentEncoding(ctx.ResponseWriter, ctx.Request.Body, ctx.GetRequestHeader("Content-Encoding"), ctx.maxDecodedBodyBytes())
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return io.ReadAll(body)
+}
+
+// maxDecodedBodyBytes returns AppConfig.MaxDecodedBodyBytes, or its default if unset.
+func (ctx *Context) maxDecodedBodyBytes() int64 {
+	if ctx.puff != nil && ctx.puff.Config.MaxDecodedBodyBytes > 0 {
+		return ctx.puff.Config.MaxDecodedBodyBytes
+	}
+	return defaultMaxDecodedBodyBytes
+}
+
+// BodyReader returns the request body as a stream instead of reading it into
+// memory, for proxies and large uploads. If maxBytes is greater than 0, reading
+// more than maxBytes bytes fails with an *http.MaxBytesError. The caller is
+// responsible for closing the returned reader.
+func (ctx *Context) BodyReader(maxBytes int64) io.ReadCloser {
+	if maxBytes > 0 {
+		return http.MaxBytesReader(ctx.ResponseWriter, ctx.Request.Body, maxBytes)
+	}
+	return ctx.Request.Body
 }
 
 // GetQueryParam retrives the value of a query param from k.
@@ -105,10 +143,51 @@ func (ctx *Context) GetCookie(k string) string {
 // characters will also be silently dropped. Ex. SetCookie with value
 // ""HELLO WORLD"". The quotation marks are invalid characters,
 // therefore the final cookie will be "HELLO WORLD" instead.
+// If AppConfig.CookieDefaults is set, its Path, Domain and SameSite fill in
+// the attributes the cookie leaves empty, and its Secure and HttpOnly are
+// added to the cookie, as an http.Cookie cannot tell them unset from false.
+// Use the Cookie builder to opt a cookie out, e.g. with HttpOnly(false) for
+// a cookie read by JavaScript.
 func (ctx *Context) SetCookie(cookie *http.Cookie) {
+	if ctx.puff != nil && ctx.puff.Config.CookieDefaults != nil {
+		d := ctx.puff.Config.CookieDefaults
+		c := *cookie
+		if c.Path == "" {
+			c.Path = d.Path
+		}
+		if c.Domain == "" {
+			c.Domain = d.Domain
+		}
+		if c.SameSite == 0 {
+			c.SameSite = d.SameSite
+		}
+		c.Secure = c.Secure || d.Secure
+		c.HttpOnly = c.HttpOnly || d.HttpOnly
+		enforceCookieRules(&c)
+		cookie = &c
+	}
 	http.SetCookie(ctx.ResponseWriter, cookie)
 }
 
+// DeclareTrailers announces the HTTP trailers the response will carry, e.g. a
+// checksum or record count computed while streaming a large export. It must
+// be called before the response body is written. Set the values with
+// SetTrailer once the body has been written.
+func (ctx *Context) DeclareTrailers(names ...string) {
+	for _, name := range names {
+		ctx.ResponseWriter.Header().Add("Trailer", http.CanonicalHeaderKey(name))
+	}
+}
+
+// SetTrailer sets the value of the trailer k to v. It should be called after
+// the response body has been written. Trailers not announced with
+// DeclareTrailers are still sent, but clients may not expect them.
+func (ctx *Context) SetTrailer(k, v string) {
+	// the prefixed form is sent as a trailer even if the headers were written
+	// before k was declared.
+	ctx.ResponseWriter.Header().Set(http.TrailerPrefix+http.CanonicalHeaderKey(k), v)
+}
+
 // SetContentType sets the content type of the response.
 func (ctx *Context) SetContentType(v string) {
 	ctx.SetResponseHeader("Content-Type", v)
@@ -120,6 +199,21 @@ func (ctx *Context) SetStatusCode(sc int) {
 	ctx.statusCode = sc
 }
 
+// EarlyHints sends a 103 Early Hints informational response with the given
+// Link header values (e.g. "</style.css>; rel=preload; as=style") so browsers
+// can start preloading assets while the final response is prepared. It must
+// be called before the final response is written, and is a no-op for
+// HTTP/1.0 clients, which do not support informational responses.
+func (ctx *Context) EarlyHints(links ...string) {
+	if ctx.statusCode != 0 || !ctx.Request.ProtoAtLeast(1, 1) {
+		return
+	}
+	for _, link := range links {
+		ctx.ResponseWriter.Header().Add("Link", link)
+	}
+	ctx.ResponseWriter.WriteHeader(http.StatusEarlyHints)
+}
+
 // GetStatusCode returns the status code. If response not written, returns default 0.
 func (ctx *Context) GetStatusCode() int {
 	return ctx.statusCode
@@ -147,9 +241,47 @@ func (c *Context) SendResponse(res Response) {
 		slog.Error("calls to SendResponse on routes using websockets is not permitted.")
 		return
 	}
+	if c.raw {
+		slog.Error("calls to SendResponse after Raw are not permitted; the response is handled externally.")
+		return
+	}
+
+	if h, ok := res.(HTMLResponse); ok {
+		// templates are rendered before the status is written, so their
+		// functions, e.g. flash, can still set cookies.
+		content, err := h.render(c)
+		if err != nil {
+			slog.Error(fmt.Sprintf("An unexpected error occured while rendering a template: %s.", err.Error()))
+			c.InternalServerError("An unknown error occured.")
+			return
+		}
+		res = HTMLResponse{StatusCode: h.StatusCode, Content: content}
+	}
 
 	c.SetContentType(res.GetContentType())
 
+	if j, ok := res.(JSONResponse); ok && j.Page != nil {
+		c.SetPageLinks(*j.Page)
+	}
+
+	if j, ok := res.(JSONResponse); ok && c.puff != nil && c.puff.Config.Dev && c.puff.Config.EnforceResponseSchemas {
+		c.checkResponseSchema(resolveStatusCode(j.StatusCode, http.StatusOK), j.Content)
+	}
+
+	if j, ok := res.(JSONResponse); ok {
+		if !c.selectFields(&j) {
+			return
+		}
+		res = j
+	}
+
+	if res.GetStatusCode() == http.StatusCreated && c.puff != nil && c.puff.Config.BaseURL != "" {
+		// a relative Location on a 201 response is made absolute so it is correct behind proxies.
+		if location := c.GetResponseHeader("Location"); strings.HasPrefix(location, "/") && !strings.HasPrefix(location, "//") {
+			c.SetResponseHeader("Location", c.URLFor(location))
+		}
+	}
+
 	if res.GetStatusCode() != 0 { // don't write statusCode for certain content types
 		c.SetStatusCode(res.GetStatusCode())
 	}
@@ -165,6 +297,76 @@ func (c *Context) SendResponse(res Response) {
 	}
 }
 
+// Raw is the escape hatch to the underlying http.ResponseWriter and *http.Request.
+// It marks the response as externally handled: subsequent calls to SendResponse
+// are ignored, and the status code written through the returned writer is recorded
+// so GetStatusCode (and therefore logging and metrics) stays accurate.
+func (ctx *Context) Raw() (http.ResponseWriter, *http.Request) {
+	if !ctx.raw {
+		ctx.raw = true
+		ctx.ResponseWriter = &rawResponseWriter{ResponseWriter: ctx.ResponseWriter, ctx: ctx}
+	}
+	return ctx.ResponseWriter, ctx.Request
+}
+
+// Route returns the route serving the request, or nil if no route matched.
+func (ctx *Context) Route() *Route {
+	return ctx.route
+}
+
+// PathParams returns the path parameters of the request by name, as
+// declared in the route path. It returns nil if no route matched.
+func (ctx *Context) PathParams() map[string]string {
+	if ctx.route == nil || ctx.route.regexp == nil {
+		return nil
+	}
+	matches := ctx.route.matcher().FindStringSubmatch(ctx.Request.URL.Path)
+	params := map[string]string{}
+	for i, name := range ctx.route.pathParamNames() {
+		if i+1 < len(matches) {
+			params[name] = matches[i+1]
+		}
+	}
+	return params
+}
+
+// IsRaw reports whether the response is handled externally through Raw.
+func (ctx *Context) IsRaw() bool {
+	return ctx.raw
+}
+
+// rawResponseWriter records the status code written by handlers using Raw.
+type rawResponseWriter struct {
+	http.ResponseWriter
+	ctx *Context
+}
+
+func (w *rawResponseWriter) WriteHeader(statusCode int) {
+	if w.ctx.statusCode == 0 && statusCode >= 200 {
+		w.ctx.statusCode = statusCode
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *rawResponseWriter) Write(b []byte) (int, error) {
+	if w.ctx.statusCode == 0 {
+		w.ctx.statusCode = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap allows http.ResponseController to reach the underlying writer.
+func (w *rawResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Flush implements http.Flusher if the underlying writer supports it.
+func (w *rawResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
 func (ctx *Context) ClientIP() (IPAddress string) {
 	return ctx.Request.RemoteAddr
 }
@@ -187,12 +389,14 @@ func (ctx *Context) GetBearerToken() string {
 // below are methods that are more error message focused.
 
 func (ctx *Context) response(status_code int, message string, a ...any) {
-	ctx.SendResponse(JSONResponse{
-		StatusCode: status_code,
-		Content: map[string]any{
-			"error": fmt.Sprintf(message, a...),
-		},
-	})
+	ctx.sendError(status_code, fmt.Sprintf(message, a...), nil)
+}
+
+// Error returns a json response with the given status code and
+// the formatted string from message and the arguments following,
+// shaped by AppConfig.ErrorConfig.
+func (ctx *Context) Error(statusCode int, message string, a ...any) {
+	ctx.response(statusCode, message, a...)
 }
 
 // BadRequest returns a json response with status code 400
@@ -0,0 +1,180 @@
+package puff
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+// ControllerRoutes declares the paths of controller methods in its struct tag,
+// keyed by method name:
+//
+//	type UserController struct {
+//		_ puff.ControllerRoutes `GetUser:"/users/{id}" PostUser:"/users"`
+//	}
+type ControllerRoutes struct{}
+
+// controllerMethods maps method name prefixes to HTTP methods.
+var controllerMethods = []struct {
+	prefix string
+	method string
+}{
+	{"Get", http.MethodGet},
+	{"Post", http.MethodPost},
+	{"Put", http.MethodPut},
+	{"Patch", http.MethodPatch},
+	{"Delete", http.MethodDelete},
+}
+
+var (
+	contextType = reflect.TypeOf((*Context)(nil))
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// Controller registers the methods of controller, a pointer to a struct, as
+// routes on the router. Methods named after an HTTP method followed by a
+// name, e.g. GetUser or PostUser, become routes; other methods are ignored.
+// The path of a method is read from the tag of a ControllerRoutes field and
+// defaults to the kebab-cased name, e.g. "/user" for GetUser.
+//
+// Methods take a *Context, optionally followed by a pointer to the input
+// fields struct, and return nothing, an error, or a result and an error:
+//
+//	func (uc *UserController) GetUser(c *puff.Context, input *GetUserInput) (*User, error)
+//
+// A result is sent as a JSON response with status 200 and documented in
+// OpenAPI. An *HTTPError is sent with its status code and other errors as 500.
+func (r *Router) Controller(controller any) []*Route {
+	cv := reflect.ValueOf(controller)
+	if cv.Kind() != reflect.Ptr || cv.Elem().Kind() != reflect.Struct {
+		panic(&RegistrationError{Kind: RegistrationBadFields, Router: r.Name, Err: fmt.Errorf("controller must be a pointer to a struct, got %T", controller)})
+	}
+	paths := controllerPaths(cv.Elem().Type())
+
+	var routes []*Route
+	ct := cv.Type()
+	for i := range ct.NumMethod() {
+		m := ct.Method(i)
+		method, name := splitControllerMethod(m.Name)
+		if method == "" {
+			continue
+		}
+		path, ok := paths[m.Name]
+		if !ok {
+			path = "/" + kebabCase(name)
+		}
+		handler, fields, result, err := controllerHandler(cv.Method(i))
+		if err != nil {
+			panic(&RegistrationError{Kind: RegistrationBadFields, Router: r.Name, Method: method, Path: path, Err: fmt.Errorf("controller method %s: %w", m.Name, err)})
+		}
+		route := r.registerRoute(method, path, handler, fields)
+		if result != nil {
+			if result.Kind() == reflect.Ptr {
+				result = result.Elem()
+			}
+			route.WithResponse(http.StatusOK, func() reflect.Type { return result })
+		}
+		routes = append(routes, route)
+	}
+	return routes
+}
+
+// controllerPaths reads the paths declared on ControllerRoutes fields of t.
+func controllerPaths(t reflect.Type) map[string]string {
+	paths := map[string]string{}
+	for i := range t.NumField() {
+		field := t.Field(i)
+		if field.Type != reflect.TypeOf(ControllerRoutes{}) {
+			continue
+		}
+		for _, entry := range strings.Fields(string(field.Tag)) {
+			key, _, _ := strings.Cut(entry, ":")
+			if path, ok := field.Tag.Lookup(key); ok {
+				paths[key] = path
+			}
+		}
+	}
+	return paths
+}
+
+// splitControllerMethod splits a method name such as GetUser into its HTTP
+// method and name. The method is empty if the name has no HTTP method prefix.
+func splitControllerMethod(name string) (string, string) {
+	for _, cm := range controllerMethods {
+		rest, ok := strings.CutPrefix(name, cm.prefix)
+		if ok && rest != "" && unicode.IsUpper(rune(rest[0])) {
+			return cm.method, rest
+		}
+	}
+	return "", ""
+}
+
+// kebabCase converts a Go identifier such as UserProfile to user-profile.
+func kebabCase(name string) string {
+	var b strings.Builder
+	for i, c := range name {
+		if unicode.IsUpper(c) {
+			if i > 0 {
+				b.WriteByte('-')
+			}
+			c = unicode.ToLower(c)
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// controllerHandler adapts a controller method to a handler. It returns the
+// input fields to bind and the result type, if any.
+func controllerHandler(fn reflect.Value) (func(*Context), any, reflect.Type, error) {
+	ft := fn.Type()
+	if ft.NumIn() < 1 || ft.NumIn() > 2 || ft.In(0) != contextType {
+		return nil, nil, nil, errors.New("must take *puff.Context, optionally followed by a pointer to an input struct")
+	}
+	var fields any
+	if ft.NumIn() == 2 {
+		in := ft.In(1)
+		if in.Kind() != reflect.Ptr || in.Elem().Kind() != reflect.Struct {
+			return nil, nil, nil, errors.New("input must be a pointer to a struct")
+		}
+		fields = reflect.New(in.Elem()).Interface()
+	}
+	var result reflect.Type
+	switch {
+	case ft.NumOut() == 0:
+	case ft.NumOut() == 1 && ft.Out(0) == errorType:
+	case ft.NumOut() == 2 && ft.Out(1) == errorType:
+		result = ft.Out(0)
+	default:
+		return nil, nil, nil, errors.New("must return nothing, an error, or a result and an error")
+	}
+
+	handler := func(c *Context) {
+		args := []reflect.Value{reflect.ValueOf(c)}
+		if fields != nil {
+			args = append(args, reflect.ValueOf(fields))
+		}
+		out := fn.Call(args)
+		if len(out) == 0 {
+			return
+		}
+		if err, _ := out[len(out)-1].Interface().(error); err != nil {
+			var httpErr *HTTPError
+			if errors.As(err, &httpErr) {
+				c.response(httpErr.StatusCode, "%s", httpErr.Message)
+				return
+			}
+			slog.Error("Controller Error", slog.String("route", c.Request.URL.Path), slog.String("error", err.Error()))
+			c.InternalServerError("An unexpected error occured.")
+			return
+		}
+		if result != nil {
+			c.SendResponse(JSONResponse{StatusCode: http.StatusOK, Content: out[0].Interface()})
+		}
+	}
+	return handler, fields, result, nil
+}
@@ -0,0 +1,81 @@
+package puff
+
+import (
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// conventionEntry is a package that registered its routes with RegisterRoutes.
+type conventionEntry struct {
+	pkgPath  string
+	register func(*Router)
+}
+
+var (
+	conventionMu       sync.Mutex
+	conventionRegistry []conventionEntry
+)
+
+// RegisterRoutes registers the routes of the calling package so they can be
+// mounted by IncludeRegisteredRouters. It is meant to be called from an init
+// function in each handler package:
+//
+//	package pizza
+//
+//	func init() {
+//	    puff.RegisterRoutes(func(r *puff.Router) {
+//	        r.Get("/{id}", &PizzaInput{}, getPizza)
+//	    })
+//	}
+//
+// The package is blank-imported by the main package (import _ ".../handlers/pizza")
+// so that its init function runs.
+func RegisterRoutes(register func(r *Router)) {
+	pkgPath := ""
+	if pc, _, _, ok := runtime.Caller(1); ok {
+		pkgPath = packagePathOf(runtime.FuncForPC(pc).Name())
+	}
+	conventionMu.Lock()
+	defer conventionMu.Unlock()
+	conventionRegistry = append(conventionRegistry, conventionEntry{pkgPath: pkgPath, register: register})
+}
+
+// IncludeRegisteredRouters mounts a router for every package below the import
+// path root that called RegisterRoutes. The router prefix is derived from the
+// package path relative to root, so ".../handlers/v1/pizza" is mounted at
+// "/v1/pizza" for root ".../handlers", and is named and tagged after the
+// package name. Routers are included in order of their package path.
+func (a *PuffApp) IncludeRegisteredRouters(root string) {
+	conventionMu.Lock()
+	entries := slices.Clone(conventionRegistry)
+	conventionMu.Unlock()
+
+	slices.SortStableFunc(entries, func(x, y conventionEntry) int {
+		return strings.Compare(x.pkgPath, y.pkgPath)
+	})
+
+	root = strings.TrimSuffix(root, "/")
+	for _, entry := range entries {
+		if entry.pkgPath != root && !strings.HasPrefix(entry.pkgPath, root+"/") {
+			continue
+		}
+		prefix := strings.TrimPrefix(entry.pkgPath, root)
+		name := entry.pkgPath[strings.LastIndex(entry.pkgPath, "/")+1:]
+		router := NewRouter(name, prefix)
+		router.Tag = name
+		entry.register(router)
+		a.IncludeRouter(router)
+	}
+}
+
+// packagePathOf returns the import path of the package a function belongs
+// to, given its fully-qualified name (e.g. "example.com/svc/pizza.init.0").
+func packagePathOf(funcName string) string {
+	slash := strings.LastIndex(funcName, "/")
+	if dot := strings.Index(funcName[slash+1:], "."); dot != -1 {
+		return funcName[:slash+1+dot]
+	}
+	return funcName
+}
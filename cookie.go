@@ -0,0 +1,132 @@
+package puff
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// CookieDefaults are the attributes applied to the response cookies set
+// through Context.SetCookie or Context.Cookie that leave them unset.
+type CookieDefaults struct {
+	// Secure restricts cookies to HTTPS. Only enable it if the application is
+	// served over HTTPS, as browsers drop Secure cookies sent over plain HTTP.
+	Secure bool
+	// HttpOnly hides cookies from JavaScript.
+	HttpOnly bool
+	// SameSite is the default SameSite mode.
+	SameSite http.SameSite
+	// Domain is the default cookie domain.
+	Domain string
+	// Path is the default cookie path.
+	Path string
+}
+
+// DefaultCookieDefaults are the CookieDefaults used by Context.Cookie if
+// AppConfig.CookieDefaults is nil. Secure and HttpOnly are left off, so
+// cookies keep working over plain HTTP and from JavaScript.
+var DefaultCookieDefaults = CookieDefaults{
+	SameSite: http.SameSiteLaxMode,
+	Path:     "/",
+}
+
+// cookieDefaults returns the app cookie defaults.
+func (ctx *Context) cookieDefaults() CookieDefaults {
+	if ctx.puff != nil && ctx.puff.Config.CookieDefaults != nil {
+		return *ctx.puff.Config.CookieDefaults
+	}
+	return DefaultCookieDefaults
+}
+
+// CookieBuilder builds a response cookie starting from the app CookieDefaults.
+type CookieBuilder struct {
+	ctx    *Context
+	cookie http.Cookie
+}
+
+// Cookie starts building a response cookie called name with value. The cookie
+// is only written once Set is called:
+//
+//	c.Cookie("session", token).MaxAge(3600).Set()
+func (ctx *Context) Cookie(name, value string) *CookieBuilder {
+	d := ctx.cookieDefaults()
+	return &CookieBuilder{
+		ctx: ctx,
+		cookie: http.Cookie{
+			Name:     name,
+			Value:    value,
+			Secure:   d.Secure,
+			HttpOnly: d.HttpOnly,
+			SameSite: d.SameSite,
+			Domain:   d.Domain,
+			Path:     d.Path,
+		},
+	}
+}
+
+// MaxAge sets the Max-Age attribute in seconds.
+func (b *CookieBuilder) MaxAge(seconds int) *CookieBuilder {
+	b.cookie.MaxAge = seconds
+	return b
+}
+
+// Expires sets the Expires attribute.
+func (b *CookieBuilder) Expires(t time.Time) *CookieBuilder {
+	b.cookie.Expires = t
+	return b
+}
+
+// Path overrides the default path.
+func (b *CookieBuilder) Path(path string) *CookieBuilder {
+	b.cookie.Path = path
+	return b
+}
+
+// Domain overrides the default domain.
+func (b *CookieBuilder) Domain(domain string) *CookieBuilder {
+	b.cookie.Domain = domain
+	return b
+}
+
+// SameSite overrides the default SameSite mode.
+func (b *CookieBuilder) SameSite(mode http.SameSite) *CookieBuilder {
+	b.cookie.SameSite = mode
+	return b
+}
+
+// Secure overrides the default Secure attribute.
+func (b *CookieBuilder) Secure(secure bool) *CookieBuilder {
+	b.cookie.Secure = secure
+	return b
+}
+
+// HttpOnly overrides the default HttpOnly attribute.
+func (b *CookieBuilder) HttpOnly(httpOnly bool) *CookieBuilder {
+	b.cookie.HttpOnly = httpOnly
+	return b
+}
+
+// Set validates the cookie and writes it to the response. The attributes of
+// the builder are written as they are, so Secure(false) and HttpOnly(false)
+// opt the cookie out of the defaults.
+func (b *CookieBuilder) Set() {
+	c := b.cookie
+	enforceCookieRules(&c)
+	http.SetCookie(b.ctx.ResponseWriter, &c)
+}
+
+// enforceCookieRules fixes attribute combinations browsers reject or that are
+// insecure: SameSite=None and the __Secure- and __Host- prefixes require
+// Secure, and __Host- cookies must have Path "/" and no Domain.
+func enforceCookieRules(c *http.Cookie) {
+	if (c.SameSite == http.SameSiteNoneMode || strings.HasPrefix(c.Name, "__Secure-") || strings.HasPrefix(c.Name, "__Host-")) && !c.Secure {
+		slog.Warn("cookie requires the Secure attribute; setting it", slog.String("cookie", c.Name))
+		c.Secure = true
+	}
+	if strings.HasPrefix(c.Name, "__Host-") && (c.Path != "/" || c.Domain != "") {
+		slog.Warn("__Host- cookie must have Path / and no Domain; fixing it", slog.String("cookie", c.Name))
+		c.Path = "/"
+		c.Domain = ""
+	}
+}
@@ -0,0 +1,93 @@
+package puff
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxTimeoutBudget caps the time budget sent by the client, so that huge
+// values cannot overflow time.Duration.
+const maxTimeoutBudget = 24 * time.Hour
+
+// parseTimeoutBudget parses the remaining time budget sent by the client in
+// the X-Request-Timeout header (a Go duration such as "1.5s", or a number of
+// seconds) or the grpc-timeout header (at most 8 digits followed by one of the
+// units H, M, S, m, u or n). Budgets above maxTimeoutBudget are clamped.
+func parseTimeoutBudget(h http.Header) (time.Duration, bool) {
+	if v := strings.TrimSpace(h.Get("X-Request-Timeout")); v != "" {
+		if seconds, err := strconv.ParseFloat(v, 64); err == nil {
+			if math.IsNaN(seconds) || math.IsInf(seconds, 0) || seconds <= 0 {
+				return 0, false
+			}
+			if seconds >= maxTimeoutBudget.Seconds() {
+				return maxTimeoutBudget, true
+			}
+			return time.Duration(seconds * float64(time.Second)), true
+		}
+		if d, err := time.ParseDuration(v); err == nil {
+			return min(d, maxTimeoutBudget), d > 0
+		}
+	}
+	if v := strings.TrimSpace(h.Get("grpc-timeout")); len(v) >= 2 && len(v) <= 9 {
+		digits := v[:len(v)-1]
+		if strings.Trim(digits, "0123456789") != "" {
+			return 0, false
+		}
+		n, err := strconv.ParseInt(digits, 10, 64)
+		if err != nil || n <= 0 {
+			return 0, false
+		}
+		units := map[byte]time.Duration{
+			'H': time.Hour,
+			'M': time.Minute,
+			'S': time.Second,
+			'm': time.Millisecond,
+			'u': time.Microsecond,
+			'n': time.Nanosecond,
+		}
+		unit, ok := units[v[len(v)-1]]
+		if !ok {
+			return 0, false
+		}
+		if n >= int64(maxTimeoutBudget/unit) {
+			return maxTimeoutBudget, true
+		}
+		return time.Duration(n) * unit, true
+	}
+	return 0, false
+}
+
+// withTimeoutBudget shrinks the deadline of the request context to the time
+// budget sent by the client, if any. The returned cancel func must be called
+// once the request is served.
+func withTimeoutBudget(req *http.Request) (*http.Request, context.CancelFunc) {
+	budget, ok := parseTimeoutBudget(req.Header)
+	if !ok {
+		return req, func() {}
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), budget)
+	return req.WithContext(ctx), cancel
+}
+
+// Deadline returns the time by which the request should be served, derived
+// from the timeout budget sent by the client (X-Request-Timeout or
+// grpc-timeout) and any server-side timeouts. ok is false if there is no
+// deadline. Pass c.Request.Context() to downstream calls so they respect
+// the end-to-end budget.
+func (ctx *Context) Deadline() (deadline time.Time, ok bool) {
+	return ctx.Request.Context().Deadline()
+}
+
+// RemainingBudget returns the time left until Deadline, or 0 and false if
+// there is no deadline.
+func (ctx *Context) RemainingBudget() (time.Duration, bool) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0, false
+	}
+	return time.Until(deadline), true
+}
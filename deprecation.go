@@ -0,0 +1,48 @@
+package puff
+
+import (
+	"net/http"
+	"time"
+)
+
+// deprecationInfo holds the deprecation of a route. Set with Deprecate.
+type deprecationInfo struct {
+	sunset time.Time
+	link   string
+}
+
+// Deprecate marks the route as deprecated. Every response of the route then
+// carries a Deprecation header, a Sunset header with sunsetDate unless it is
+// zero, and a Link header pointing to link, e.g. a migration guide, unless it
+// is empty. The operation is marked deprecated in the OpenAPI spec.
+func (r *Route) Deprecate(sunsetDate time.Time, link string) *Route {
+	r.deprecation = &deprecationInfo{sunset: sunsetDate, link: link}
+	return r
+}
+
+// Deprecated reports whether the route was marked deprecated with Deprecate.
+func (r *Route) Deprecated() bool {
+	return r.deprecation != nil
+}
+
+// setHeaders sets the deprecation headers on the response.
+func (d *deprecationInfo) setHeaders(c *Context) {
+	c.SetResponseHeader("Deprecation", "true")
+	if !d.sunset.IsZero() {
+		c.SetResponseHeader("Sunset", d.sunset.UTC().Format(http.TimeFormat))
+	}
+	if d.link != "" {
+		c.ResponseWriter.Header().Add("Link", "<"+d.link+`>; rel="deprecation"`)
+	}
+}
+
+// document marks op as deprecated.
+func (d *deprecationInfo) document(op *Operation) {
+	op.Deprecated = true
+	if !d.sunset.IsZero() {
+		op.Sunset = d.sunset.UTC().Format(time.RFC3339)
+	}
+	if d.link != "" {
+		op.ExternalDocs = ExternalDocumentation{Description: "Deprecation", URL: d.link}
+	}
+}
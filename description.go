@@ -5,8 +5,32 @@ import (
 	"log/slog"
 	"os"
 	"strings"
+	"sync"
 )
 
+// sourceLines caches the lines of the source files routes are registered in,
+// so registering many routes from one file reads it once.
+var sourceLines = struct {
+	sync.Mutex
+	files map[string][]string
+}{files: map[string][]string{}}
+
+// readSourceLines returns the lines of file, reading it on first use.
+func readSourceLines(file string) ([]string, error) {
+	sourceLines.Lock()
+	defer sourceLines.Unlock()
+	if lines, ok := sourceLines.files[file]; ok {
+		return lines, nil
+	}
+	srcfile, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.Split(string(srcfile), "\n")
+	sourceLines.files[file] = lines
+	return lines, nil
+}
+
 // readDescription reads comments based on the file and line number of
 // the caller that called the GET, POST, etc. methods on the router. It
 // will read upwards of the method call.
@@ -15,15 +39,14 @@ func readDescription(file string, lineNumber int, ok bool) string {
 		slog.Error("puff/readDescription cannot read description: ok is false.")
 		return ""
 	}
-	srcfile, err := os.ReadFile(file)
+	lines, err := readSourceLines(file)
 	if err != nil {
 		slog.Error(fmt.Sprintf("puff/readDescription cannot read description: os.ReadFile failed with error: %s", err.Error()))
 		return ""
 	}
-	lines := strings.Split(string(srcfile), "\n")
 	comments := []string{}
 	// read file in reverse
-	for i := lineNumber - 2; i >= 0; i-- { // guess and check got us to line number - 2
+	for i := min(lineNumber-2, len(lines)-1); i >= 0; i-- { // guess and check got us to line number - 2
 		line := strings.TrimSpace(lines[i])
 		if line == "" { // empty line (ignore)
 			continue
@@ -37,3 +60,45 @@ func readDescription(file string, lineNumber int, ok bool) string {
 	}
 	return strings.Join(comments, " ") // trim space removed the spaces
 }
+
+// lazyDescription is the description of a route read from the comment above
+// its registration on first use, as reading source files is too slow to do
+// for every route at startup. Routes registered together share one.
+type lazyDescription struct {
+	once sync.Once
+	file string
+	line int
+	ok   bool
+	text string
+}
+
+// newLazyDescription returns the description of the route registered at file:line.
+func newLazyDescription(file string, line int, ok bool) *lazyDescription {
+	return &lazyDescription{file: file, line: line, ok: ok}
+}
+
+// String reads the description on first call.
+func (d *lazyDescription) String() string {
+	d.once.Do(func() {
+		d.text = readDescription(d.file, d.line, d.ok)
+	})
+	return d.text
+}
+
+// description returns the Description of the route, or the comment above its
+// registration if none is set.
+func (route *Route) description() string {
+	if route.Description != "" || route.comment == nil {
+		return route.Description
+	}
+	return route.comment.String()
+}
+
+// resolveDescription sets the Description of the route to the comment above
+// its registration if none is set, once the route is prepared, so it is
+// populated for callers reading it after registration.
+func (route *Route) resolveDescription() {
+	if route.Description == "" {
+		route.Description = route.description()
+	}
+}
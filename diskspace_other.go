@@ -0,0 +1,10 @@
+//go:build !(linux || darwin || freebsd)
+
+package puff
+
+import "errors"
+
+// diskFree fails since free space cannot be determined on this platform.
+func diskFree(path string) (uint64, error) {
+	return 0, errors.New("disk space health checks are not supported on this platform")
+}
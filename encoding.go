@@ -0,0 +1,87 @@
+package puff
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+// defaultMaxDecodedBodyBytes is the default of AppConfig.MaxDecodedBodyBytes.
+const defaultMaxDecodedBodyBytes = 10 << 20
+
+// decodeContentEncoding wraps body with a decompressor for the
+// Content-Encoding of the request. Only gzip, deflate and identity are
+// supported. Reading more than maxBytes decompressed bytes fails with an
+// *http.MaxBytesError, so a small compressed body cannot expand without bound.
+func decodeContentEncoding(w http.ResponseWriter, body io.ReadCloser, contentEncoding string, maxBytes int64) (io.ReadCloser, error) {
+	switch strings.ToLower(strings.TrimSpace(contentEncoding)) {
+	case "", "identity":
+		return body, nil
+	case "gzip", "x-gzip":
+		zr, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gzip request body: %s", err.Error())
+		}
+		return http.MaxBytesReader(w, &decodedBody{Reader: zr, closers: []io.Closer{zr, body}}, maxBytes), nil
+	case "deflate":
+		fr := flate.NewReader(body)
+		return http.MaxBytesReader(w, &decodedBody{Reader: fr, closers: []io.Closer{fr, body}}, maxBytes), nil
+	default:
+		return nil, fmt.Errorf("unsupported Content-Encoding %s", contentEncoding)
+	}
+}
+
+// decodedBody closes both the decompressor and the original body.
+type decodedBody struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (d *decodedBody) Close() error {
+	var err error
+	for _, c := range d.closers {
+		if cerr := c.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// windows1252 maps bytes 0x80-0x9F of Windows-1252 to their code points.
+// All other bytes map to the code point of the same value, as in ISO-8859-1.
+var windows1252 = [32]rune{
+	'€', 0x81, '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', 0x8D, 'Ž', 0x8F,
+	0x90, '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', 0x9D, 'ž', 'Ÿ',
+}
+
+// toUTF8 converts body from the charset declared in contentType to UTF-8.
+// Bodies without a declared charset, or declared as UTF-8 or US-ASCII, are
+// returned unchanged.
+func toUTF8(body []byte, contentType string) ([]byte, error) {
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return body, nil
+	}
+	charset := strings.ToLower(params["charset"])
+	switch charset {
+	case "", "utf-8", "utf8", "us-ascii", "ascii":
+		return body, nil
+	case "iso-8859-1", "latin1", "latin-1", "iso8859-1", "windows-1252", "cp1252":
+		out := make([]byte, 0, len(body)+len(body)/4)
+		for _, b := range body {
+			r := rune(b)
+			if b >= 0x80 && b <= 0x9F && (charset == "windows-1252" || charset == "cp1252") {
+				r = windows1252[b-0x80]
+			}
+			out = utf8.AppendRune(out, r)
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("unsupported charset %s", charset)
+	}
+}
@@ -0,0 +1,173 @@
+package puff
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// ErrorNaming is the naming convention of the default error body keys.
+type ErrorNaming int
+
+const (
+	// SnakeCase names keys like request_id and field_errors.
+	SnakeCase ErrorNaming = iota
+	// CamelCase names keys like requestId and fieldErrors.
+	CamelCase
+)
+
+// ErrorConfig defines the JSON body of every error generated by puff, e.g.
+// 404 and 405 responses, input validation failures and Context.BadRequest.
+// The zero value produces {"error": "message"}.
+type ErrorConfig struct {
+	// Naming is the naming convention of the default keys. Default: SnakeCase.
+	Naming ErrorNaming
+	// MessageKey is the key of the error message. Default: "error".
+	MessageKey string
+	// IncludeStatus adds the status code to the body.
+	IncludeStatus bool
+	// StatusKey is the key of the status code. Default: "status".
+	StatusKey string
+	// IncludeRequestID adds the X-Request-ID of the request to the body.
+	IncludeRequestID bool
+	// RequestIDKey is the key of the request ID. Default: "request_id" or "requestId".
+	RequestIDKey string
+	// IncludeFieldErrors adds the input fields that failed validation to the body.
+	IncludeFieldErrors bool
+	// FieldErrorsKey is the key of the field errors. Default: "field_errors" or "fieldErrors".
+	FieldErrorsKey string
+}
+
+// FieldError describes an input field that could not be bound from the request.
+type FieldError struct {
+	// Field is the name of the parameter, e.g. the query parameter name.
+	Field string `json:"field"`
+	// In is the location of the parameter, e.g. "query" or "path".
+	In string `json:"in"`
+	// Message describes why binding failed.
+	Message string `json:"message"`
+
+	err error
+}
+
+func (e *FieldError) Error() string {
+	if e.err == nil {
+		return e.Message
+	}
+	return e.err.Error()
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.err
+}
+
+// newFieldError wraps err as the error of parameter p, unless it is one already.
+func newFieldError(p Parameter, err error) error {
+	var fe *FieldError
+	if errors.As(err, &fe) {
+		return err
+	}
+	return &FieldError{Field: p.Name, In: p.In, Message: err.Error(), err: err}
+}
+
+// key returns custom if set, otherwise the snake or camel cased default.
+func (ec *ErrorConfig) key(custom, snake, camel string) string {
+	switch {
+	case custom != "":
+		return custom
+	case ec.Naming == CamelCase:
+		return camel
+	default:
+		return snake
+	}
+}
+
+// body returns the error body for status and message.
+func (ec *ErrorConfig) body(status int, message, requestID string, fieldErrors []FieldError) map[string]any {
+	body := map[string]any{ec.key(ec.MessageKey, "error", "error"): message}
+	if ec.IncludeStatus {
+		body[ec.key(ec.StatusKey, "status", "status")] = status
+	}
+	if ec.IncludeRequestID {
+		body[ec.key(ec.RequestIDKey, "request_id", "requestId")] = requestID
+	}
+	if ec.IncludeFieldErrors {
+		if fieldErrors == nil {
+			fieldErrors = []FieldError{}
+		}
+		body[ec.key(ec.FieldErrorsKey, "field_errors", "fieldErrors")] = fieldErrors
+	}
+	return body
+}
+
+// schema returns the OpenAPI schema of the error body.
+func (ec *ErrorConfig) schema() *Schema {
+	messageKey := ec.key(ec.MessageKey, "error", "error")
+	s := &Schema{
+		Type:       "object",
+		Properties: map[string]*Schema{messageKey: {Type: "string"}},
+		Required:   []string{messageKey},
+	}
+	if ec.IncludeStatus {
+		s.Properties[ec.key(ec.StatusKey, "status", "status")] = &Schema{Type: "integer"}
+	}
+	if ec.IncludeRequestID {
+		s.Properties[ec.key(ec.RequestIDKey, "request_id", "requestId")] = &Schema{Type: "string"}
+	}
+	if ec.IncludeFieldErrors {
+		s.Properties[ec.key(ec.FieldErrorsKey, "field_errors", "fieldErrors")] = &Schema{
+			Type: "array",
+			Items: &Schema{
+				Type: "object",
+				Properties: map[string]*Schema{
+					"field":   {Type: "string"},
+					"in":      {Type: "string"},
+					"message": {Type: "string"},
+				},
+			},
+		}
+	}
+	return s
+}
+
+// errorConfig returns the ErrorConfig of the application, or the zero value.
+func (a *PuffApp) errorConfig() *ErrorConfig {
+	if a == nil || a.Config.ErrorConfig == nil {
+		return &ErrorConfig{}
+	}
+	return a.Config.ErrorConfig
+}
+
+// fieldErrorsOf returns the FieldErrors held by err, including those joined
+// with errors.Join.
+func fieldErrorsOf(err error) []FieldError {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		var fieldErrors []FieldError
+		for _, e := range joined.Unwrap() {
+			fieldErrors = append(fieldErrors, fieldErrorsOf(e)...)
+		}
+		return fieldErrors
+	}
+	var fe *FieldError
+	if errors.As(err, &fe) {
+		return []FieldError{*fe}
+	}
+	return nil
+}
+
+// sendError sends the error body for status and message. The FieldErrors
+// held by err are included in the field errors.
+func (ctx *Context) sendError(status int, message string, err error) {
+	ctx.SendResponse(JSONResponse{
+		StatusCode: status,
+		Content:    ctx.puff.errorConfig().body(status, message, ctx.GetRequestID(), fieldErrorsOf(err)),
+	})
+}
+
+// writeErrorResponse writes the error body for requests rejected before a
+// Context is created.
+func (a *PuffApp) writeErrorResponse(w http.ResponseWriter, statusCode int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(a.errorConfig().body(statusCode, message, w.Header().Get("X-Request-ID"), nil))
+}
@@ -0,0 +1,108 @@
+package puff
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+)
+
+// errorMapping maps the errors matching match to an error response.
+type errorMapping struct {
+	match      func(error) bool
+	statusCode int
+}
+
+// MapError makes HandleError respond with statusCode to errors matching
+// target with errors.Is, so errors of the persistence layer translate the same
+// way everywhere, e.g.
+//
+//	app.MapError(sql.ErrNoRows, http.StatusNotFound)
+//
+// The message is the status text, as the error itself may not be safe to
+// show to clients. Mappings are tried in the order they were added.
+func (a *PuffApp) MapError(target error, statusCode int) *PuffApp {
+	a.addErrorMapping(errorMapping{
+		match:      func(err error) bool { return errors.Is(err, target) },
+		statusCode: statusCode,
+	})
+	return a
+}
+
+// MapErrorType makes HandleError respond with statusCode to errors of type T
+// found with errors.As, e.g.
+//
+//	puff.MapErrorType[*pgconn.PgError](app, http.StatusConflict)
+func MapErrorType[T error](a *PuffApp, statusCode int) *PuffApp {
+	a.addErrorMapping(errorMapping{
+		match: func(err error) bool {
+			var target T
+			return errors.As(err, &target)
+		},
+		statusCode: statusCode,
+	})
+	return a
+}
+
+func (a *PuffApp) addErrorMapping(m errorMapping) {
+	a.errorMappingsMu.Lock()
+	defer a.errorMappingsMu.Unlock()
+	a.errorMappings = append(a.errorMappings, m)
+}
+
+// mappedStatus returns the status code err is mapped to with MapError or
+// MapErrorType, if any.
+func (a *PuffApp) mappedStatus(err error) (int, bool) {
+	if a == nil {
+		return 0, false
+	}
+	a.errorMappingsMu.RLock()
+	defer a.errorMappingsMu.RUnlock()
+	for _, m := range a.errorMappings {
+		if m.match(err) {
+			return m.statusCode, true
+		}
+	}
+	return 0, false
+}
+
+// HandleError sends the error response for err, so handlers return errors
+// of any layer without a switch statement of their own:
+//
+//   - an HTTPError in err's chain, e.g. puff.Err404("pizza not found"), is
+//     sent with its status code and message.
+//   - errors mapped with MapError or MapErrorType are sent with the mapped
+//     status code and its status text.
+//   - any other error is logged and sent as 500 Internal Server Error.
+//
+// The response is rendered by the ErrorHandler of the route's routers, like
+// 404 and 500 errors. FieldErrors held by err are included in the field
+// errors. A nil err sends nothing.
+func (ctx *Context) HandleError(err error) {
+	if err == nil {
+		return
+	}
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		ctx.handleError(&HTTPError{StatusCode: httpErr.StatusCode, Message: httpErr.Message, Err: err})
+		return
+	}
+	if status, ok := ctx.puff.mappedStatus(err); ok {
+		ctx.handleError(&HTTPError{StatusCode: status, Message: http.StatusText(status), Err: err})
+		return
+	}
+	slog.Error("Unhandled error", slog.String("request_id", ctx.GetRequestID()), slog.String("error", err.Error()))
+	ctx.handleError(&HTTPError{StatusCode: http.StatusInternalServerError, Message: "An unexpected error occured.", Err: err})
+}
+
+// handleError renders err with the ErrorHandler of the routers of the route
+// serving the request.
+func (ctx *Context) handleError(err *HTTPError) {
+	switch {
+	case ctx.route != nil && ctx.route.Router != nil:
+		ctx.route.Router.handleError(ctx, err)
+	case ctx.puff != nil && ctx.puff.RootRouter != nil:
+		ctx.puff.RootRouter.handleError(ctx, err)
+	default:
+		ctx.sendError(err.StatusCode, err.Message, err.Err)
+	}
+}
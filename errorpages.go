@@ -0,0 +1,186 @@
+package puff
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httputil"
+	"runtime/debug"
+	"strings"
+)
+
+// HTTPError describes a request that could not be served by a route handler:
+// no route matched (404), the method is not allowed (405), or the handler
+// panicked (500).
+type HTTPError struct {
+	// StatusCode is the HTTP status code of the error.
+	StatusCode int
+	// Message is a short, client-safe description of the error.
+	Message string
+	// Panic is the recovered value if the handler panicked.
+	Panic any
+	// Stack is the stack trace of the panic, if any.
+	Stack []byte
+	// Err is the error the response was derived from, e.g. the error passed
+	// to Context.HandleError or mapped with MapError, if any.
+	Err error
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("%d %s", e.StatusCode, e.Message)
+}
+
+// Unwrap returns the error the response was derived from.
+func (e *HTTPError) Unwrap() error {
+	return e.Err
+}
+
+// ErrorHandler renders the response for an HTTPError.
+type ErrorHandler func(c *Context, err *HTTPError)
+
+// handleError renders err using the ErrorHandler of the closest router that
+// defines one. Otherwise a rich HTML page is rendered in dev mode and a terse
+// JSON body in production.
+func (r *Router) handleError(c *Context, err *HTTPError) {
+	for current := r; current != nil; current = current.parent {
+		if current.ErrorHandler != nil {
+			current.ErrorHandler(c, err)
+			return
+		}
+	}
+	if r.puff != nil && r.puff.Config.Dev {
+		r.renderDevErrorPage(c, err)
+		return
+	}
+	c.sendError(err.StatusCode, err.Message, err.Err)
+}
+
+// recoverPanic recovers a panicking handler and renders a 500 error, or the
+// status a panicking error is mapped to with MapError. It must be deferred.
+func (r *Router) recoverPanic(c *Context) {
+	a := recover()
+	if a == nil {
+		return
+	}
+	if a == http.ErrAbortHandler {
+		panic(a)
+	}
+	stack := debug.Stack()
+	slog.Error("Panic During Execution", slog.Any("Error", a), slog.String("Path", c.Request.URL.Path))
+	c.RecordPanic(a)
+	if c.statusCode != 0 || c.raw || c.WebSocket != nil {
+		// the response has already been (partially) written; nothing more can be sent.
+		return
+	}
+	httpErr := &HTTPError{
+		StatusCode: http.StatusInternalServerError,
+		Message:    "An unexpected error occured.",
+		Panic:      a,
+		Stack:      stack,
+	}
+	if err, ok := a.(error); ok {
+		if status, ok := r.puff.mappedStatus(err); ok {
+			httpErr.StatusCode, httpErr.Message, httpErr.Err = status, http.StatusText(status), err
+		}
+	}
+	r.handleError(c, httpErr)
+}
+
+type devErrorPageData struct {
+	Error       *HTTPError
+	StatusText  string
+	Method      string
+	Path        string
+	Suggestions []*Route
+	Routes      []*Route
+	Request     string
+}
+
+// renderDevErrorPage renders a rich HTML error page including the stack
+// trace, routes similar to the requested path, and a dump of the request.
+// It must never be used in production.
+func (r *Router) renderDevErrorPage(c *Context, err *HTTPError) {
+	root := r
+	for root.parent != nil {
+		root = root.parent
+	}
+	routes := root.AllRoutes()
+
+	dump, dumpErr := httputil.DumpRequest(c.Request, false)
+	if dumpErr != nil {
+		dump = []byte(dumpErr.Error())
+	}
+
+	c.SendResponse(HTMLResponse{
+		StatusCode: err.StatusCode,
+		Template:   devErrorPageHTML,
+		Data: devErrorPageData{
+			Error:       err,
+			StatusText:  http.StatusText(err.StatusCode),
+			Method:      c.Request.Method,
+			Path:        c.Request.URL.Path,
+			Suggestions: suggestRoutes(routes, c.Request.URL.Path),
+			Routes:      routes,
+			Request:     string(dump),
+		},
+	})
+}
+
+// suggestRoutes returns the routes whose full path shares the longest
+// leading run of segments with path.
+func suggestRoutes(routes []*Route, path string) []*Route {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	best := 0
+	var suggestions []*Route
+	for _, route := range routes {
+		routeSegments := strings.Split(strings.Trim(route.fullPath, "/"), "/")
+		shared := 0
+		for shared < len(segments) && shared < len(routeSegments) {
+			rs := routeSegments[shared]
+			if rs != segments[shared] && !(strings.HasPrefix(rs, "{") && strings.HasSuffix(rs, "}")) {
+				break
+			}
+			shared++
+		}
+		switch {
+		case shared == 0:
+		case shared > best:
+			best = shared
+			suggestions = []*Route{route}
+		case shared == best:
+			suggestions = append(suggestions, route)
+		}
+	}
+	return suggestions
+}
+
+// devErrorPageHTML is the template of the dev error page. HTMLResponse uses
+// html/template, so all data is escaped.
+var devErrorPageHTML = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="UTF-8">
+<title>{{.Error.StatusCode}} {{.StatusText}}</title>
+<style>
+body { font-family: -apple-system, sans-serif; margin: 2rem; color: #222; }
+h1 { color: #c0392b; }
+pre { background: #f4f4f4; padding: 1rem; overflow-x: auto; }
+td { padding: 0.2rem 1rem 0.2rem 0; font-family: monospace; }
+</style>
+</head>
+<body>
+<h1>{{.Error.StatusCode}} {{.StatusText}}</h1>
+<p><code>{{.Method}} {{.Path}}</code>: {{.Error.Message}}</p>
+{{if .Error.Panic}}<h2>Panic</h2>
+<pre>{{printf "%v" .Error.Panic}}</pre>
+<h2>Stack Trace</h2>
+<pre>{{printf "%s" .Error.Stack}}</pre>{{end}}
+{{if .Suggestions}}<h2>Did you mean</h2>
+<table>{{range .Suggestions}}<tr><td>{{.Protocol}}</td><td>{{.GetFullPath}}</td></tr>{{end}}</table>{{end}}
+<h2>Routes</h2>
+<table>{{range .Routes}}<tr><td>{{.Protocol}}</td><td>{{.GetFullPath}}</td></tr>{{end}}</table>
+<h2>Request</h2>
+<pre>{{.Request}}</pre>
+<p><small>This page is shown because AppConfig.Dev is enabled. Do not enable it in production.</small></p>
+</body>
+</html>`
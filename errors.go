@@ -1,6 +1,10 @@
 package puff
 
-import "fmt"
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
 
 func FieldTypeError(value string, expectedType string) error {
 	return fmt.Errorf(
@@ -19,6 +23,18 @@ func BadFieldType(k string, got string, expected string) error {
 	)
 }
 
+func EnumValueError(value string, allowed []any) error {
+	values := make([]string, len(allowed))
+	for i, v := range allowed {
+		values[i] = fmt.Sprint(v)
+	}
+	return fmt.Errorf(
+		"enum error: the value %s is not one of the allowed values: %s",
+		value,
+		strings.Join(values, ", "),
+	)
+}
+
 func ExpectedButNotFound(k string) error {
 	return fmt.Errorf("expected key %s but not found in json", k)
 }
@@ -30,3 +46,106 @@ func UnexpectedJSONKey(k string) error {
 func InvalidJSONError(v string) error {
 	return fmt.Errorf("expected json, but got invalid json")
 }
+
+// RegistrationErrorKind classifies why registering a route or router failed.
+type RegistrationErrorKind string
+
+const (
+	// RegistrationNilRouter is used when a nil *Router is included.
+	RegistrationNilRouter RegistrationErrorKind = "nil router"
+	// RegistrationRouterAttached is used when a router is included into more than one parent.
+	RegistrationRouterAttached RegistrationErrorKind = "router already attached"
+	// RegistrationBadPath is used when a route path is malformed.
+	RegistrationBadPath RegistrationErrorKind = "bad path"
+	// RegistrationBadFields is used when a route's fields are not a valid input schema.
+	RegistrationBadFields RegistrationErrorKind = "bad fields"
+	// RegistrationBadMethod is used when a route is registered without a valid HTTP method.
+	RegistrationBadMethod RegistrationErrorKind = "bad method"
+	// RegistrationConflict is used when two routes share the same method and full path.
+	RegistrationConflict RegistrationErrorKind = "conflict"
+)
+
+// RegistrationError is the value puff panics with when a route or router
+// cannot be registered. Recover it and use errors.As to inspect Kind
+// instead of matching on the message.
+type RegistrationError struct {
+	// Kind is the category of the failure.
+	Kind RegistrationErrorKind
+	// Router is the name of the router the failure happened on, if any.
+	Router string
+	// Method is the HTTP method of the offending route, if any.
+	Method string
+	// Path is the path of the offending route, if any.
+	Path string
+	// Source is the file:line the offending route or router was registered at, if known.
+	Source string
+	// Err is the underlying error, if any.
+	Err error
+}
+
+func (e *RegistrationError) Error() string {
+	msg := "puff: registration failed (" + string(e.Kind) + ")"
+	if e.Method != "" || e.Path != "" {
+		msg += fmt.Sprintf(" for route %s %s", e.Method, e.Path)
+	}
+	if e.Router != "" {
+		msg += " on router " + e.Router
+	}
+	if e.Source != "" {
+		msg += " at " + e.Source
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *RegistrationError) Unwrap() error {
+	return e.Err
+}
+
+// callerSource formats a location returned by runtime.Caller as file:line.
+func callerSource(file string, line int, ok bool) string {
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("%s:%d", file, line)
+}
+
+// sourceSuffix returns " at source", or "" if source is unknown.
+func sourceSuffix(source string) string {
+	if source == "" {
+		return ""
+	}
+	return " at " + source
+}
+
+// app returns the PuffApp the router is attached to, or nil.
+func (r *Router) app() *PuffApp {
+	for current := r; current != nil; current = current.parent {
+		if current.puff != nil {
+			return current.puff
+		}
+	}
+	return nil
+}
+
+// fail reports a registration error. It panics with err, unless the router
+// is attached to an app with AppConfig.DeferRegistrationErrors set, in which
+// case err is recorded and reported by SelfCheck.
+func (r *Router) fail(err *RegistrationError) {
+	a := r.app()
+	if a == nil || !a.Config.DeferRegistrationErrors {
+		panic(err)
+	}
+	a.registrationErrorsMu.Lock()
+	defer a.registrationErrorsMu.Unlock()
+	a.registrationErrors = append(a.registrationErrors, err)
+}
+
+// deferredRegistrationErrors returns the errors recorded by fail.
+func (a *PuffApp) deferredRegistrationErrors() []*RegistrationError {
+	a.registrationErrorsMu.Lock()
+	defer a.registrationErrorsMu.Unlock()
+	return slices.Clone(a.registrationErrors)
+}
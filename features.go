@@ -0,0 +1,85 @@
+package puff
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// FeatureProvider reports whether a feature flag is enabled. Implement it to
+// back flags with a remote flag service.
+type FeatureProvider interface {
+	FeatureEnabled(name string) bool
+}
+
+// FeatureProviderFunc adapts a function to a FeatureProvider.
+type FeatureProviderFunc func(name string) bool
+
+// FeatureEnabled calls f(name).
+func (f FeatureProviderFunc) FeatureEnabled(name string) bool {
+	return f(name)
+}
+
+// StaticFeatures is a FeatureProvider backed by a map, e.g. loaded from a config file.
+// Features missing from the map are disabled.
+type StaticFeatures map[string]bool
+
+// FeatureEnabled reports whether name is set to true.
+func (s StaticFeatures) FeatureEnabled(name string) bool {
+	return s[name]
+}
+
+// EnvFeatureProvider reads feature flags from environment variables. The name
+// is upper-cased, has "-" and "." replaced by "_" and is prefixed with Prefix,
+// so "new-billing" with Prefix "FEATURE_" is read from FEATURE_NEW_BILLING.
+// The variable must parse as a true boolean for the feature to be enabled.
+type EnvFeatureProvider struct {
+	Prefix string
+}
+
+// FeatureEnabled reports whether the environment variable for name is true.
+func (e EnvFeatureProvider) FeatureEnabled(name string) bool {
+	key := e.Prefix + strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(name))
+	enabled, _ := strconv.ParseBool(os.Getenv(key))
+	return enabled
+}
+
+// Feature gates the route behind the feature flags names. While any of them
+// is disabled the route responds as if it did not exist (see
+// AppConfig.DisabledFeatureStatus) and is left out of the OpenAPI spec.
+// Without an AppConfig.Features provider every flag is disabled.
+func (r *Route) Feature(names ...string) *Route {
+	r.features = append(r.features, names...)
+	return r
+}
+
+// featuresEnabled reports whether every feature flag of route is enabled.
+func (a *PuffApp) featuresEnabled(route *Route) bool {
+	if len(route.features) == 0 {
+		return true
+	}
+	if a == nil || a.Config.Features == nil {
+		return false
+	}
+	for _, name := range route.features {
+		if !a.Config.Features.FeatureEnabled(name) {
+			return false
+		}
+	}
+	return true
+}
+
+// rejectIfFeatureDisabled responds with AppConfig.DisabledFeatureStatus if a
+// feature flag of route is disabled.
+func (r *Router) rejectIfFeatureDisabled(c *Context, route *Route) bool {
+	if r.puff.featuresEnabled(route) {
+		return false
+	}
+	status := http.StatusNotFound
+	if r.puff != nil && r.puff.Config.DisabledFeatureStatus != 0 {
+		status = r.puff.Config.DisabledFeatureStatus
+	}
+	r.handleError(c, &HTTPError{StatusCode: status, Message: strings.ToLower(http.StatusText(status))})
+	return true
+}
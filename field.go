@@ -2,9 +2,15 @@ package puff
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"math"
+	"net/http"
 	"reflect"
+	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 )
@@ -17,6 +23,7 @@ func isValidKind(specified_kind string) bool {
 	// https://swagger.io/specification/#:~:text=the%20in%20property.-,in,query%22%2C%20%22header%22%2C%20%22path%22%20or%20%22cookie%22.,-description
 	return specified_kind == "header" ||
 		specified_kind == "path" ||
+		specified_kind == "host" ||
 		specified_kind == "query" ||
 		specified_kind == "cookie" ||
 		specified_kind == "body" ||
@@ -49,8 +56,8 @@ func enforceKindTypes(specifiedKind string, t reflect.Type) error {
 			return nil
 		}
 	case "file":
-		if t != reflect.TypeOf(new(File)) {
-			return fmt.Errorf("type for a param of kind file MUST be a pointer to File")
+		if t != reflect.TypeOf(new(File)) && t != filesType {
+			return fmt.Errorf("type for a param of kind file MUST be a pointer to File or a slice of them")
 		}
 	case "form":
 		switch t.Kind() {
@@ -63,6 +70,14 @@ func enforceKindTypes(specifiedKind string, t reflect.Type) error {
 	return nil
 }
 
+var readCloserType = reflect.TypeOf((*io.ReadCloser)(nil)).Elem()
+
+// isReaderField reports whether t is a streaming interface (such as io.Reader
+// or io.ReadCloser) that a body field can be bound to without buffering.
+func isReaderField(t reflect.Type) bool {
+	return t.Kind() == reflect.Interface && t.NumMethod() > 0 && readCloserType.Implements(t)
+}
+
 // handleParam takes the value as recieved, returns an error if the value
 // is empty AND required.
 func handleParam(value string, param Parameter) (string, error) {
@@ -73,6 +88,38 @@ func handleParam(value string, param Parameter) (string, error) {
 	return value, nil
 }
 
+// wireName returns the name the struct field f is sent as: its name tag, the
+// name of its json tag if useJSON is set, or its Go name. A field tagged "-"
+// returns "-".
+func wireName(f reflect.StructField, useJSON bool) string {
+	if name := f.Tag.Get("name"); name != "" {
+		return name
+	}
+	if useJSON {
+		if name, _, _ := strings.Cut(f.Tag.Get("json"), ","); name != "" {
+			return name
+		}
+	}
+	return f.Name
+}
+
+// paramName returns the name the input field f is sent as, reading its json
+// tag if AppConfig.JSONParamNames is set. Input fields are always bound, so
+// a field tagged "-" keeps its Go name.
+func paramName(f reflect.StructField, useJSON bool) string {
+	if name := wireName(f, useJSON); name != "-" {
+		return name
+	}
+	return f.Name
+}
+
+// jsonParamNames reports whether input fields of the routes of the router
+// are named after their json tag, as set with AppConfig.JSONParamNames.
+func (r *Router) jsonParamNames() bool {
+	app := r.app()
+	return app != nil && app.Config.JSONParamNames
+}
+
 // validate validates the input string against the type to ensure with options
 // from Parameter.
 func validate(input map[string]any, schemaType reflect.Type) (bool, error) {
@@ -92,7 +139,7 @@ func validate(input map[string]any, schemaType reflect.Type) (bool, error) {
 			name = nameTag
 		}
 		fields[name] = field
-		b, _ := resolveBool(field.Tag.Get("required"), true)
+		b, _ := resolveBool(field.Tag.Get("required"), !isOptionalField(field.Type))
 		expectedNotFoundKeys[name] = b
 	}
 	for k, v := range input {
@@ -108,7 +155,7 @@ func validate(input map[string]any, schemaType reflect.Type) (bool, error) {
 		tr := reflect.TypeOf(v)
 		if tr == nil {
 			if required && !p {
-				return false, BadFieldType(k, "nil", ft.Kind().String())
+				return false, malformedBody(BadFieldType(k, "nil", ft.Kind().String()))
 			} else {
 				continue
 			}
@@ -120,37 +167,64 @@ func validate(input map[string]any, schemaType reflect.Type) (bool, error) {
 		}
 		switch t {
 		case reflect.String, reflect.Bool:
-			if ft.Kind() != t {
-				return false, BadFieldType(k, t.String(), ft.Kind().String())
+			// time.Time is unmarshaled from an RFC 3339 string.
+			if ft.Kind() != t && !(t == reflect.String && ft == timeType) {
+				return false, malformedBody(BadFieldType(k, t.String(), ft.Kind().String()))
 			}
 		case reflect.Int:
 			if isAnyOfThese(ft.Kind(), reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64) {
 				if !(v.(int) >= 0) {
-					return false, BadFieldType(k, t.String(), ft.Kind().String())
+					return false, malformedBody(BadFieldType(k, t.String(), ft.Kind().String()))
 				}
 			} else if !isAnyOfThese(ft.Kind(), reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64) {
-				return false, BadFieldType(k, t.String(), ft.Kind().String())
+				return false, malformedBody(BadFieldType(k, t.String(), ft.Kind().String()))
 			}
 		case reflect.Float32, reflect.Float64:
-			if !isAnyOfThese(ft.Kind(), reflect.Float32, reflect.Float64) {
-				return false, BadFieldType(k, t.String(), ft.Kind().String())
+			// JSON numbers are decoded as float64, so integers are accepted if whole.
+			f := reflect.ValueOf(v).Float()
+			whole := f == math.Trunc(f)
+			switch {
+			case isAnyOfThese(ft.Kind(), reflect.Float32, reflect.Float64):
+			case isAnyOfThese(ft.Kind(), reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64) && whole:
+			case isAnyOfThese(ft.Kind(), reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64) && whole && f >= 0:
+			default:
+				return false, malformedBody(BadFieldType(k, t.String(), ft.Kind().String()))
 			}
 		case reflect.Array, reflect.Slice:
-			if reflect.TypeOf(v).AssignableTo(f.Type) {
-				return false, BadFieldType(k, ft.String(), reflect.TypeOf(v).String())
+			if ft.Kind() != reflect.Array && ft.Kind() != reflect.Slice {
+				return false, malformedBody(BadFieldType(k, t.String(), ft.Kind().String()))
 			}
 		case reflect.Map:
+			if ft.Kind() == reflect.Map {
+				// map values are checked when the body is decoded.
+				continue
+			}
 			if ft.Kind() != reflect.Struct {
-				return false, BadFieldType(k, t.String(), ft.Kind().String())
+				return false, malformedBody(BadFieldType(k, t.String(), ft.Kind().String()))
+			}
+			if ok, err := validate(v.(map[string]any), ft); !ok {
+				return false, err
 			}
-			return validate(v.(map[string]any), ft)
 		default:
-			return false, BadFieldType(k, "unsupported type: "+t.String(), ft.Kind().String())
+			return false, malformedBody(BadFieldType(k, "unsupported type: "+t.String(), ft.Kind().String()))
+		}
+	}
+	for k, v := range input {
+		tag := fields[k].Tag.Get("enum")
+		if tag == "" || v == nil {
+			continue
+		}
+		enum, err := parseEnum(tag, fields[k].Type)
+		if err != nil {
+			return false, err
+		}
+		if !inEnum(v, enum) {
+			return false, EnumValueError(fmt.Sprint(v), enum)
 		}
 	}
 	for k, required := range expectedNotFoundKeys {
 		if required {
-			return false, ExpectedButNotFound(k)
+			return false, malformedBody(ExpectedButNotFound(k))
 		}
 	}
 	return true, nil
@@ -171,6 +245,55 @@ func getQueryParam(c *Context, param Parameter) (string, error) {
 	return handleParam(value, param)
 }
 
+// isSliceField reports whether a query field of type t is bound from a
+// repeated query param, e.g. ?Tags=a&Tags=b.
+func isSliceField(t reflect.Type) bool {
+	return t.Kind() == reflect.Slice
+}
+
+// populateQuerySlice populates the slice field from every value of the query
+// param, or from its comma separated values if the param does not explode.
+// Each value must match pattern and the enum of the param.
+func populateQuerySlice(c *Context, param Parameter, field reflect.Value, pattern *regexp.Regexp) error {
+	var values []string
+	for _, v := range c.Request.URL.Query()[param.Name] {
+		if !param.Explode {
+			values = append(values, strings.Split(v, ",")...)
+			continue
+		}
+		values = append(values, v)
+	}
+	values = slices.DeleteFunc(values, func(v string) bool { return v == "" })
+	if len(values) == 0 {
+		if param.Required {
+			return fmt.Errorf("required %s param %s not provided", param.In, param.Name)
+		}
+		field.SetZero()
+		return nil
+	}
+	slice := reflect.MakeSlice(field.Type(), len(values), len(values))
+	for i, value := range values {
+		if pattern != nil && !pattern.MatchString(value) {
+			return fmt.Errorf("%s param %s does not match pattern %s", param.In, param.Name, pattern)
+		}
+		elem := slice.Index(i)
+		var err error
+		if isTimeType(elem.Type()) {
+			err = populateTimeField(value, elem, param.layout)
+		} else {
+			err = populateField(value, elem)
+		}
+		if err != nil {
+			return err
+		}
+		if len(param.enum) > 0 && !inEnum(elem.Interface(), param.enum) {
+			return EnumValueError(value, param.enum)
+		}
+	}
+	field.Set(slice)
+	return nil
+}
+
 // getCookieParam gets the value of the param from the cookie header.
 // It may return an error if it not found AND required.
 func getCookieParam(c *Context, param Parameter) (string, error) {
@@ -187,13 +310,18 @@ func getPathParam(index int, param Parameter, matches []string) (string, error)
 	}
 }
 
-// getBodyParam gets the value of the param from the body.
+// getBodyParam gets the value of the param from the body, converted to UTF-8
+// from the charset declared in Content-Type.
 // It will return an error if it is not found AND required.
 func getBodyParam(c *Context, param Parameter) (string, error) {
 	// Read the body content
 	body, err := c.GetBody()
 	if err != nil {
-		return "", fmt.Errorf("an error occurred while reading the body: %s", err.Error())
+		return "", fmt.Errorf("an error occurred while reading the body: %w", err)
+	}
+	body, err = toUTF8(body, c.GetRequestHeader("Content-Type"))
+	if err != nil {
+		return "", fmt.Errorf("an error occurred while decoding the body: %s", err.Error())
 	}
 	return handleParam(string(body), param)
 }
@@ -258,14 +386,46 @@ func populateField(value string, field reflect.Value) error {
 	return nil
 }
 
-func populateInputSchema(c *Context, s any, p []Parameter, matches []string) error {
+// isOptionalField reports whether a field of type t is optional: pointer fields
+// are not required by default and left nil when the param is absent. *File
+// fields are required like other files.
+func isOptionalField(t reflect.Type) bool {
+	return t.Kind() == reflect.Pointer && t != reflect.TypeOf(new(File))
+}
+
+// populateOptionalField parses value into a new value of the type field points
+// to and sets field to it.
+func populateOptionalField(value string, field reflect.Value, layout string) error {
+	elem := reflect.New(field.Type().Elem())
+	var err error
+	if isTimeType(elem.Elem().Type()) {
+		err = populateTimeField(value, elem.Elem(), layout)
+	} else {
+		err = populateField(value, elem.Elem())
+	}
+	if err != nil {
+		return err
+	}
+	field.Set(elem)
+	return nil
+}
+
+func populateInputSchema(c *Context, s any, p []Parameter, patterns []*regexp.Regexp, matches []string) error {
 	if len(p) == 0 { //no input schema
 		return nil
 	}
 	// FIXME: allow user to specify memory
-	c.Request.ParseMultipartForm(10 << 20) // leftshift to represent 10 mb
-	sve := reflect.ValueOf(s).Elem()       //will not panic because we can confirm
-	pathparamsindex := 0                   //pathparamsindex is the amount of path params already reviewed
+	if err := c.Request.ParseMultipartForm(multipartMemory); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return &uploadError{
+				statusCode: http.StatusRequestEntityTooLarge,
+				err:        fmt.Errorf("request body is larger than the %d bytes allowed by the maxsize of its files", tooLarge.Limit),
+			}
+		}
+	}
+	sve := reflect.ValueOf(s).Elem() //will not panic because we can confirm
+	pathparamsindex := 0             //pathparamsindex is the amount of path params already reviewed
 	for i, pa := range p {
 		var value string
 		var err error
@@ -274,38 +434,108 @@ func populateInputSchema(c *Context, s any, p []Parameter, matches []string) err
 			value, err = getRequestHeaderParam(c, pa)
 		case "path":
 			value, err = getPathParam(pathparamsindex, pa, matches)
+			pathparamsindex++
+		case "host":
+			value, err = handleParam(c.HostParams()[pa.Name], pa)
 		case "query":
+			if pa.Style == "form" {
+				var pattern *regexp.Regexp
+				if i < len(patterns) {
+					pattern = patterns[i]
+				}
+				if err := populateQuerySlice(c, pa, sve.Field(i), pattern); err != nil {
+					return newFieldError(pa, err)
+				}
+				continue
+			}
 			value, err = getQueryParam(c, pa)
 		case "cookie":
 			value, err = getCookieParam(c, pa)
 		case "body":
+			field := sve.Field(i)
+			if isReaderField(field.Type()) {
+				// special case since the body is streamed instead of read into memory
+				field.Set(reflect.ValueOf(c.BodyReader(0)))
+				continue
+			}
 			value, err = getBodyParam(c, pa)
+			if err == nil && pa.strict && !isXMLMedia(pa.bodyMedia(c)) {
+				if err := rejectUnknownFields(value, pa, field.Type()); err != nil {
+					return err
+				}
+			}
 		case "form":
+			if pa.formStruct {
+				if err := populateFormStruct(c, pa, sve.Field(i)); err != nil {
+					return newFieldError(pa, err)
+				}
+				continue
+			}
 			value, err = getFormParam(c, pa)
 		case "file":
+			if sve.Field(i).Type() == filesType {
+				files, err := getFormFiles(c, pa.Name)
+				if err == nil && len(files) == 0 && pa.Required {
+					err = fmt.Errorf("required file param %s not provided", pa.Name)
+				}
+				if err == nil {
+					err = pa.upload.checkAll(pa.Name, files)
+				}
+				if err != nil {
+					closeFiles(files...)
+					return newFieldError(pa, err)
+				}
+				sve.Field(i).Set(reflect.ValueOf(files))
+				continue
+			}
 			// special case since we're populating to *puff.File
 			newFile := new(File)
 			file, fileHeader, err := c.GetFormFile(pa.Name)
 			if err != nil {
-				return err
+				return newFieldError(pa, err)
 			}
+			newFile.MultipartFile = file
 			if fileHeader == nil {
-				return fmt.Errorf("file header is nil")
+				closeFiles(newFile)
+				return newFieldError(pa, fmt.Errorf("file header is nil"))
 			}
 			newFile.Name = fileHeader.Filename
 			newFile.Size = fileHeader.Size
-			newFile.MultipartFile = file
+			if err := pa.upload.check(pa.Name, newFile); err != nil {
+				closeFiles(newFile)
+				return newFieldError(pa, err)
+			}
 			f := sve.Field(i)
 			f.Set(reflect.ValueOf(newFile))
 			continue
 		}
 		if err != nil {
-			return err
+			return newFieldError(pa, err)
+		}
+		if i < len(patterns) && patterns[i] != nil && value != "" && !patterns[i].MatchString(value) {
+			return newFieldError(pa, fmt.Errorf("%s param %s does not match pattern %s", pa.In, pa.Name, patterns[i]))
 		}
 		field := sve.Field(i) //has to be there because handleInputSchema
-		err = populateField(value, field)
+		if isOptionalField(field.Type()) && value == "" {
+			field.SetZero()
+			continue
+		}
+		if pa.In == "body" && isJSONBodyField(field.Type()) && isXMLMedia(pa.bodyMedia(c)) {
+			err = populateXMLBodyField(value, field)
+		} else if pa.In == "body" && isJSONBodyField(field.Type()) {
+			err = populateBodyField(value, field)
+		} else if isOptionalField(field.Type()) {
+			err = populateOptionalField(value, field, pa.layout)
+		} else if isTimeType(field.Type()) {
+			err = populateTimeField(value, field, pa.layout)
+		} else {
+			err = populateField(value, field)
+		}
 		if err != nil {
-			return err
+			return newFieldError(pa, err)
+		}
+		if len(pa.enum) > 0 && value != "" && !inEnum(reflect.Indirect(field).Interface(), pa.enum) {
+			return newFieldError(pa, EnumValueError(value, pa.enum))
 		}
 	}
 	return nil
@@ -400,6 +630,14 @@ func newDefinition(route *Route, schema any) *Schema {
 	if st.Kind() == reflect.Pointer {
 		st = st.Elem()
 		sv = sv.Elem()
+		if !sv.IsValid() {
+			// nil pointers, e.g. optional fields, are described by their zero value.
+			sv = reflect.Zero(st)
+		}
+	}
+
+	if isTimeType(st) {
+		return timeSchema(st, "")
 	}
 
 	switch st.Kind() {
@@ -470,10 +708,17 @@ func handleStructType(route *Route, st reflect.Type, sv reflect.Value) *Schema {
 			fieldName = field.Name
 		}
 
-		if isFieldRequired(field.Tag) {
+		if isFieldRequired(field) {
 			newDef.Required = append(newDef.Required, fieldName)
 		}
 
+		// invalid enums are reported when the route is registered, see checkEnumTags.
+		if tag := field.Tag.Get("enum"); tag != "" {
+			if enum, err := parseEnum(tag, field.Type); err == nil {
+				fieldSchema.Enum = enum
+			}
+		}
+
 		newDef.Properties[fieldName] = fieldSchema
 	}
 
@@ -492,12 +737,87 @@ func parseJSONTag(tag reflect.StructTag) string {
 	return strings.Split(jsonTag, ",")[0]
 }
 
-// isFieldRequired is a helpermethod to grab the 'required' value
-func isFieldRequired(tag reflect.StructTag) bool {
-	requiredTag := tag.Get("required")
-	isRequired, err := resolveBool(requiredTag, true)
+// isFieldRequired is a helpermethod to grab the 'required' value. Pointer
+// fields are optional unless tagged otherwise.
+func isFieldRequired(field reflect.StructField) bool {
+	requiredTag := field.Tag.Get("required")
+	isRequired, err := resolveBool(requiredTag, !isOptionalField(field.Type))
 	if err != nil {
 		panic(err)
 	}
 	return isRequired
 }
+
+// parseEnum parses the comma separated values of an enum tag into values of
+// the type t, or its elements if t is a slice, as listed in the OpenAPI schema.
+func parseEnum(tag string, t reflect.Type) ([]any, error) {
+	if t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	var enum []any
+	for _, s := range strings.Split(tag, ",") {
+		s = strings.TrimSpace(s)
+		var v any
+		var err error
+		switch t.Kind() {
+		case reflect.String:
+			v = s
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			v, err = strconv.ParseInt(s, 10, 64)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			v, err = strconv.ParseUint(s, 10, 64)
+		case reflect.Float32, reflect.Float64:
+			v, err = strconv.ParseFloat(s, 64)
+		case reflect.Bool:
+			v, err = strconv.ParseBool(s)
+		default:
+			return nil, fmt.Errorf("enum is not supported on type %s", t)
+		}
+		if err != nil {
+			return nil, FieldTypeError(s, t.Kind().String())
+		}
+		enum = append(enum, v)
+	}
+	return enum, nil
+}
+
+// checkEnumTags returns an error for the first field of t, or of the structs
+// nested in t, whose enum tag cannot be parsed.
+func checkEnumTags(t reflect.Type) error {
+	return checkEnumTagsOf(t, map[reflect.Type]bool{})
+}
+
+func checkEnumTagsOf(t reflect.Type, seen map[reflect.Type]bool) error {
+	for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || seen[t] {
+		return nil
+	}
+	seen[t] = true
+	for i := range t.NumField() {
+		field := t.Field(i)
+		if tag := field.Tag.Get("enum"); tag != "" {
+			if _, err := parseEnum(tag, field.Type); err != nil {
+				return fmt.Errorf("invalid enum on field %s: %w", field.Name, err)
+			}
+		}
+		if err := checkEnumTagsOf(field.Type, seen); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// inEnum reports whether value is one of the values of enum. Values are
+// compared by their formatting, so 3 as an int and as a float64 decoded from
+// JSON are equal.
+func inEnum(value any, enum []any) bool {
+	s := fmt.Sprint(value)
+	for _, v := range enum {
+		if fmt.Sprint(v) == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,168 @@
+package puff
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// fieldSelectionParams are the query params selecting the fields of a
+// response, e.g. ?fields=name,price or ?select=name,owner.name.
+var fieldSelectionParams = []string{"fields", "select"}
+
+// fieldSelection is the configuration of routes with WithFieldSelection.
+type fieldSelection struct {
+	// allowed are the fields clients may select. Empty allows every field.
+	allowed []string
+}
+
+// WithFieldSelection lets clients prune the JSON responses of the route to
+// the fields they need with ?fields=name,price (or ?select=), e.g. to reduce
+// payloads for mobile clients. Nested fields are selected with dots, such as
+// owner.name; the selection applies to every element of arrays.
+//
+// allowed lists the fields that may be selected; selecting another field is
+// rejected with 400 Bad Request. Selecting a field allows its nested fields.
+// Without allowed fields every field may be selected. Only 2xx responses sent
+// as JSONResponse are pruned.
+func (r *Route) WithFieldSelection(allowed ...string) *Route {
+	r.fieldSelection = &fieldSelection{allowed: allowed}
+	return r
+}
+
+// requested returns the fields selected by the request, or nil if it does
+// not select any.
+func (fs *fieldSelection) requested(c *Context) []string {
+	query := c.Request.URL.Query()
+	var fields []string
+	for _, param := range fieldSelectionParams {
+		for _, v := range query[param] {
+			for _, field := range strings.Split(v, ",") {
+				if field = strings.TrimSpace(field); field != "" {
+					fields = append(fields, field)
+				}
+			}
+		}
+	}
+	return fields
+}
+
+// allows reports whether field may be selected.
+func (fs *fieldSelection) allows(field string) bool {
+	if len(fs.allowed) == 0 {
+		return true
+	}
+	for _, allowed := range fs.allowed {
+		if field == allowed || strings.HasPrefix(field, allowed+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// selectionTree holds the selected fields by name. An empty tree keeps the
+// whole value.
+type selectionTree map[string]selectionTree
+
+// newSelectionTree returns the tree of the dotted field paths.
+func newSelectionTree(fields []string) selectionTree {
+	tree := selectionTree{}
+	for _, field := range fields {
+		node := tree
+		for _, name := range strings.Split(field, ".") {
+			child, ok := node[name]
+			if !ok {
+				child = selectionTree{}
+				node[name] = child
+			}
+			node = child
+		}
+	}
+	return tree
+}
+
+// prune returns v with the fields of objects not in the tree removed.
+func (t selectionTree) prune(v any) any {
+	if len(t) == 0 {
+		return v
+	}
+	switch v := v.(type) {
+	case map[string]any:
+		pruned := make(map[string]any, len(t))
+		for name, child := range t {
+			if value, ok := v[name]; ok {
+				pruned[name] = child.prune(value)
+			}
+		}
+		return pruned
+	case []any:
+		for i, e := range v {
+			v[i] = t.prune(e)
+		}
+		return v
+	}
+	return v
+}
+
+// selectFields prunes the content of a JSONResponse to the fields selected by
+// the request. It responds with 400 and returns false if the request selects
+// fields that are not allowed.
+func (ctx *Context) selectFields(j *JSONResponse) bool {
+	if ctx.route == nil || ctx.route.fieldSelection == nil {
+		return true
+	}
+	if status := resolveStatusCode(j.StatusCode, http.StatusOK); status < 200 || status > 299 {
+		return true
+	}
+	fs := ctx.route.fieldSelection
+	fields := fs.requested(ctx)
+	if len(fields) == 0 {
+		return true
+	}
+	var denied []string
+	for _, field := range fields {
+		if !fs.allows(field) {
+			denied = append(denied, field)
+		}
+	}
+	if len(denied) > 0 {
+		slices.Sort(denied)
+		ctx.BadRequest("fields cannot be selected: %s", strings.Join(denied, ", "))
+		return false
+	}
+	// the content is pruned as JSON, so json tags and marshalers are honored.
+	b, err := json.Marshal(j.Content)
+	if err != nil {
+		// left to WriteContent to report.
+		return true
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var content any
+	if err := dec.Decode(&content); err != nil {
+		return true
+	}
+	j.Content = newSelectionTree(fields).prune(content)
+	return true
+}
+
+// fieldSelectionParameter documents the fields query param of routes with
+// WithFieldSelection.
+func (route *Route) fieldSelectionParameter() []Parameter {
+	if route.fieldSelection == nil {
+		return nil
+	}
+	description := "Comma separated fields to include in the response, e.g. name,owner.name. Alias: select."
+	if len(route.fieldSelection.allowed) > 0 {
+		description += fmt.Sprintf(" Selectable: %s.", strings.Join(route.fieldSelection.allowed, ", "))
+	}
+	return []Parameter{{
+		Name:        fieldSelectionParams[0],
+		In:          "query",
+		Description: description,
+		Schema:      &Schema{Type: "string"},
+	}}
+}
@@ -3,6 +3,7 @@ package puff
 import (
 	"mime/multipart"
 	"os"
+	"reflect"
 )
 
 type File struct {
@@ -11,6 +12,27 @@ type File struct {
 	MultipartFile multipart.File
 }
 
+// filesType is the type of fields bound to every file uploaded under a form
+// key, e.g. from <input type="file" multiple>.
+var filesType = reflect.TypeOf([]*File{})
+
+// getFormFiles returns every file uploaded under the form key name.
+func getFormFiles(c *Context, name string) ([]*File, error) {
+	if c.Request.MultipartForm == nil {
+		return nil, nil
+	}
+	var files []*File
+	for _, header := range c.Request.MultipartForm.File[name] {
+		f, err := header.Open()
+		if err != nil {
+			closeFiles(files...)
+			return nil, err
+		}
+		files = append(files, &File{Name: header.Filename, Size: header.Size, MultipartFile: f})
+	}
+	return files, nil
+}
+
 func (f *File) SaveTo(filepath ...string) (n int, err error) {
 	fp := ""
 	if len(filepath) == 0 {
@@ -0,0 +1,56 @@
+package puff
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// FlashCookieName is the name of the cookie flash messages are carried in.
+const FlashCookieName = "puff_flash"
+
+// Flash queues message to be shown on the next page the client loads, e.g.
+// "Profile saved." before redirecting after a form submission. The messages
+// are carried in a cookie and read with Flashes or the flash template function.
+// It must be called before the response is written.
+func (ctx *Context) Flash(message string) {
+	ctx.outgoingFlashes = append(ctx.outgoingFlashes, message)
+	b, _ := json.Marshal(ctx.outgoingFlashes)
+	ctx.setFlashCookie(base64.RawURLEncoding.EncodeToString(b), 0)
+}
+
+// Flashes returns the flash messages queued by the previous request and
+// clears them, so they are shown once. Repeated calls return the same
+// messages. It must be called before the response is written.
+func (ctx *Context) Flashes() []string {
+	if ctx.incomingFlashes != nil {
+		return *ctx.incomingFlashes
+	}
+	flashes := []string{}
+	ctx.incomingFlashes = &flashes
+	value := ctx.GetCookie(FlashCookieName)
+	if value == "" {
+		return flashes
+	}
+	if b, err := base64.RawURLEncoding.DecodeString(value); err == nil {
+		json.Unmarshal(b, &flashes)
+	}
+	if len(ctx.outgoingFlashes) == 0 {
+		ctx.setFlashCookie("", -1)
+	}
+	return flashes
+}
+
+// setFlashCookie sets the flash cookie, replacing one set earlier in the response.
+func (ctx *Context) setFlashCookie(value string, maxAge int) {
+	header := ctx.ResponseWriter.Header()
+	cookies := header.Values("Set-Cookie")
+	header.Del("Set-Cookie")
+	for _, c := range cookies {
+		if !strings.HasPrefix(c, FlashCookieName+"=") {
+			header.Add("Set-Cookie", c)
+		}
+	}
+	ctx.SetCookie(&http.Cookie{Name: FlashCookieName, Value: value, Path: "/", MaxAge: maxAge, HttpOnly: true})
+}
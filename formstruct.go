@@ -0,0 +1,216 @@
+package puff
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+)
+
+// isFormStructField reports whether a form field of type t is bound as a
+// whole from the form values, one struct field per form key.
+func isFormStructField(t reflect.Type) bool {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct && t != timeType && t != reflect.TypeOf(File{})
+}
+
+// formFieldName returns the form key of the struct field f: its name tag, the
+// name of its json tag or its Go name.
+func formFieldName(f reflect.StructField) string {
+	return wireName(f, true)
+}
+
+// formStructFields returns the fields of the struct t bound from form values.
+func formStructFields(t reflect.Type) []reflect.StructField {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	var fields []reflect.StructField
+	for i := range t.NumField() {
+		if f := t.Field(i); f.IsExported() && formFieldName(f) != "-" {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// checkFormStruct returns an error if a field of the struct t cannot be bound
+// from form values, and the upload constraints of its file fields.
+func checkFormStruct(t reflect.Type) ([]*uploadConstraints, error) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	var uploads []*uploadConstraints
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if !f.IsExported() || formFieldName(f) == "-" {
+			continue
+		}
+		upload, err := parseUploadConstraints(f)
+		if err != nil {
+			return nil, err
+		}
+		if upload != nil {
+			uploads = append(uploads, upload)
+		}
+		if f.Type == reflect.TypeOf(new(File)) || f.Type == filesType {
+			continue
+		}
+		ft := f.Type
+		if ft.Kind() == reflect.Slice || ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		if isTimeType(ft) {
+			continue
+		}
+		switch ft.Kind() {
+		case reflect.String, reflect.Bool,
+			reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Float32, reflect.Float64:
+		default:
+			return nil, fmt.Errorf("field %s of type %s cannot be bound from a form value", f.Name, f.Type)
+		}
+		if tag := f.Tag.Get("enum"); tag != "" {
+			if _, err := parseEnum(tag, f.Type); err != nil {
+				return nil, fmt.Errorf("invalid enum on field %s: %w", f.Name, err)
+			}
+		}
+	}
+	return uploads, nil
+}
+
+// formStructRequestBody documents the form body of the struct form param p.
+func formStructRequestBody(p Parameter) RequestBodyOrReference {
+	return RequestBodyOrReference{
+		Description: p.Description,
+		Content: map[string]MediaType{
+			"application/x-www-form-urlencoded": {Schema: p.Schema},
+			"multipart/form-data":               {Schema: p.Schema},
+		},
+		Required: p.Required,
+	}
+}
+
+// populateFormStruct binds the struct field from the values of the
+// urlencoded or multipart form body, each struct field from the form key
+// named after it. Slice fields take every value of their key.
+func populateFormStruct(c *Context, param Parameter, field reflect.Value) error {
+	form := c.Request.PostForm
+	hasFiles := c.Request.MultipartForm != nil && len(c.Request.MultipartForm.File) > 0
+	if len(form) == 0 && !hasFiles {
+		if param.Required {
+			return fmt.Errorf("required %s param %s not provided", param.In, param.Name)
+		}
+		field.SetZero()
+		return nil
+	}
+	t := field.Type()
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	target := reflect.New(t)
+	for i := range t.NumField() {
+		f := t.Field(i)
+		name := formFieldName(f)
+		if !f.IsExported() || name == "-" {
+			continue
+		}
+		if err := populateFormValue(c, name, f, target.Elem().Field(i)); err != nil {
+			return err
+		}
+	}
+	if field.Kind() == reflect.Pointer {
+		field.Set(target)
+	} else {
+		field.Set(target.Elem())
+	}
+	return nil
+}
+
+// populateFormValue binds the struct field f, with value v, from the form
+// key name.
+func populateFormValue(c *Context, name string, f reflect.StructField, v reflect.Value) error {
+	required, err := resolveBool(f.Tag.Get("required"), !isOptionalField(f.Type))
+	if err != nil {
+		return err
+	}
+	if f.Type == reflect.TypeOf(new(File)) {
+		file, header, err := c.GetFormFile(name)
+		if err != nil {
+			if required {
+				return fmt.Errorf("required form value %s not provided", name)
+			}
+			return nil
+		}
+		newFile := &File{Name: header.Filename, Size: header.Size, MultipartFile: file}
+		// the tags were checked on registration.
+		upload, _ := parseUploadConstraints(f)
+		if err := upload.check(name, newFile); err != nil {
+			closeFiles(newFile)
+			return err
+		}
+		v.Set(reflect.ValueOf(newFile))
+		return nil
+	}
+	if f.Type == filesType {
+		files, err := getFormFiles(c, name)
+		if err != nil {
+			return fmt.Errorf("form value %s: %w", name, err)
+		}
+		if len(files) == 0 && required {
+			return fmt.Errorf("required form value %s not provided", name)
+		}
+		upload, _ := parseUploadConstraints(f)
+		if err := upload.checkAll(name, files); err != nil {
+			closeFiles(files...)
+			return err
+		}
+		v.Set(reflect.ValueOf(files))
+		return nil
+	}
+	values := slices.DeleteFunc(slices.Clone(c.Request.PostForm[name]), func(s string) bool { return s == "" })
+	if len(values) == 0 {
+		if required {
+			return fmt.Errorf("required form value %s not provided", name)
+		}
+		return nil
+	}
+	if !isSliceField(f.Type) {
+		values = values[:1]
+	}
+	var enum []any
+	if tag := f.Tag.Get("enum"); tag != "" {
+		enum, _ = parseEnum(tag, f.Type)
+	}
+	layout := f.Tag.Get("layout")
+	elems := v
+	if isSliceField(f.Type) {
+		elems = reflect.MakeSlice(f.Type, len(values), len(values))
+	}
+	for i, value := range values {
+		elem := elems
+		if isSliceField(f.Type) {
+			elem = elems.Index(i)
+		}
+		switch {
+		case isOptionalField(elem.Type()):
+			err = populateOptionalField(value, elem, layout)
+		case isTimeType(elem.Type()):
+			err = populateTimeField(value, elem, layout)
+		default:
+			err = populateField(value, elem)
+		}
+		if err != nil {
+			return fmt.Errorf("form value %s: %w", name, err)
+		}
+		if len(enum) > 0 && !inEnum(reflect.Indirect(elem).Interface(), enum) {
+			return fmt.Errorf("form value %s: %w", name, EnumValueError(value, enum))
+		}
+	}
+	if isSliceField(f.Type) {
+		v.Set(elems)
+	}
+	return nil
+}
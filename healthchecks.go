@@ -0,0 +1,197 @@
+package puff
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+)
+
+// HealthStatus is the outcome of a health check.
+type HealthStatus string
+
+const (
+	// HealthUp means the dependency works.
+	HealthUp HealthStatus = "up"
+	// HealthDegraded means the dependency works but poorly, e.g. it is slow
+	// or almost out of capacity. Degraded checks do not fail SelfCheck.
+	HealthDegraded HealthStatus = "degraded"
+	// HealthDown means the dependency does not work.
+	HealthDown HealthStatus = "down"
+)
+
+// DegradedError marks the error of a health check as degraded instead of
+// down. Return one with Degraded.
+type DegradedError struct {
+	Err error
+}
+
+func (e *DegradedError) Error() string {
+	return "degraded: " + e.Err.Error()
+}
+
+func (e *DegradedError) Unwrap() error {
+	return e.Err
+}
+
+// Degraded wraps err so a health check returning it is reported as degraded.
+func Degraded(err error) error {
+	return &DegradedError{Err: err}
+}
+
+// healthStatusOf returns the status of a health check that returned err.
+func healthStatusOf(err error) HealthStatus {
+	var degraded *DegradedError
+	switch {
+	case err == nil:
+		return HealthUp
+	case errors.As(err, &degraded):
+		return HealthDegraded
+	default:
+		return HealthDown
+	}
+}
+
+// HealthCheckConfig configures the health checks created by the constructors
+// in this file, e.g. SQLHealthCheck.
+type HealthCheckConfig struct {
+	// Timeout bounds a single run of the check; the check is down if it is exceeded.
+	// Default: no limit besides the one of the caller, e.g. AppConfig.HealthCheckTimeout.
+	Timeout time.Duration
+	// SlowThreshold reports a check that succeeds but takes longer than it as degraded.
+	// Default: 0, which never reports slow checks.
+	SlowThreshold time.Duration
+}
+
+// wrap applies the timeout and slow threshold of config to check.
+func (config HealthCheckConfig) wrap(check HealthCheck) HealthCheck {
+	return func(ctx context.Context) error {
+		if config.Timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, config.Timeout)
+			defer cancel()
+		}
+		start := time.Now()
+		if err := check(ctx); err != nil {
+			return err
+		}
+		if took := time.Since(start); config.SlowThreshold > 0 && took > config.SlowThreshold {
+			return Degraded(fmt.Errorf("took %s, more than %s", took.Round(time.Millisecond), config.SlowThreshold))
+		}
+		return nil
+	}
+}
+
+// SQLHealthCheck pings db. It is degraded while every open connection is in
+// use and requests are waiting for one.
+func SQLHealthCheck(db *sql.DB, config HealthCheckConfig) HealthCheck {
+	return config.wrap(func(ctx context.Context) error {
+		if err := db.PingContext(ctx); err != nil {
+			return err
+		}
+		stats := db.Stats()
+		if stats.MaxOpenConnections > 0 && stats.InUse >= stats.MaxOpenConnections && stats.WaitCount > 0 {
+			return Degraded(fmt.Errorf("all %d connections are in use", stats.MaxOpenConnections))
+		}
+		return nil
+	})
+}
+
+// TCPHealthCheck dials address, e.g. "cache:6379", and closes the connection.
+func TCPHealthCheck(address string, config HealthCheckConfig) HealthCheck {
+	return config.wrap(func(ctx context.Context) error {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", address)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	})
+}
+
+// HTTPHealthCheck sends a GET request to url. It is up for 2xx responses,
+// degraded for 429 Too Many Requests and down otherwise.
+func HTTPHealthCheck(url string, config HealthCheckConfig) HealthCheck {
+	return config.wrap(func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		res.Body.Close()
+		switch {
+		case res.StatusCode >= 200 && res.StatusCode < 300:
+			return nil
+		case res.StatusCode == http.StatusTooManyRequests:
+			return Degraded(fmt.Errorf("GET %s: %s", url, res.Status))
+		default:
+			return fmt.Errorf("GET %s: %s", url, res.Status)
+		}
+	})
+}
+
+// DiskSpaceHealthCheck checks the space available on the file system of path.
+// It is degraded below degradedBelow bytes and down below downBelow bytes.
+// It is always down on platforms where free space cannot be determined.
+func DiskSpaceHealthCheck(path string, degradedBelow, downBelow uint64, config HealthCheckConfig) HealthCheck {
+	return config.wrap(func(ctx context.Context) error {
+		free, err := diskFree(path)
+		if err != nil {
+			return err
+		}
+		switch {
+		case free < downBelow:
+			return fmt.Errorf("%s has %d bytes free, less than %d", path, free, downBelow)
+		case free < degradedBelow:
+			return Degraded(fmt.Errorf("%s has %d bytes free, less than %d", path, free, degradedBelow))
+		}
+		return nil
+	})
+}
+
+// HealthResult is the outcome of a single health check, as returned by CheckHealth.
+type HealthResult struct {
+	Name     string        `json:"name"`
+	Status   HealthStatus  `json:"status"`
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"duration"`
+}
+
+// CheckHealth runs every health check registered with AddHealthCheck, each
+// limited by AppConfig.HealthCheckTimeout, and returns their results in the
+// order they were registered. Use it to serve a health endpoint.
+func (a *PuffApp) CheckHealth(ctx context.Context) []HealthResult {
+	results := make([]HealthResult, len(a.healthChecks))
+	for i, hc := range a.healthChecks {
+		start := time.Now()
+		err := a.runHealthCheck(ctx, hc)
+		results[i] = HealthResult{Name: hc.name, Status: healthStatusOf(err), Duration: time.Since(start)}
+		if err != nil {
+			results[i].Error = err.Error()
+		}
+	}
+	return results
+}
+
+// runHealthCheck runs hc limited by AppConfig.HealthCheckTimeout.
+func (a *PuffApp) runHealthCheck(ctx context.Context, hc namedHealthCheck) error {
+	timeout := a.Config.HealthCheckTimeout
+	if timeout == 0 {
+		timeout = 5 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return hc.check(ctx)
+}
+
+// logDegraded logs a health check that SelfCheck found degraded.
+func logDegraded(name string, err error) {
+	slog.Warn(fmt.Sprintf("puff: health check %s failed: %s", name, err))
+}
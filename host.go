@@ -0,0 +1,106 @@
+package puff
+
+import (
+	"net"
+	"regexp"
+	"strings"
+)
+
+// Host includes router scoped to requests whose host matches pattern, e.g.
+// "api.example.com" or "{tenant}.example.com". Every {name} placeholder
+// matches a single host label, available through Context.HostParams and to
+// input fields of kind "host". Matching ignores case and the port.
+//
+// Host routers are tried before the routes of the root router, so a host
+// router without a prefix serves every path of its host.
+func (a *PuffApp) Host(pattern string, router *Router) {
+	router.Host = pattern
+	a.IncludeRouter(router)
+}
+
+// hostPattern converts a host pattern to the regular expression matching it.
+func hostPattern(pattern string) string {
+	var b strings.Builder
+	b.WriteString("(?i)^")
+	for i, label := range strings.Split(pattern, ".") {
+		if i > 0 {
+			b.WriteString(`\.`)
+		}
+		if strings.HasPrefix(label, "{") && strings.HasSuffix(label, "}") {
+			b.WriteString("([^.]+)")
+			continue
+		}
+		b.WriteString(regexp.QuoteMeta(label))
+	}
+	b.WriteString("$")
+	return b.String()
+}
+
+// hostNames returns the placeholder names of a host pattern in order.
+func hostNames(pattern string) []string {
+	var names []string
+	for _, label := range strings.Split(pattern, ".") {
+		if strings.HasPrefix(label, "{") && strings.HasSuffix(label, "}") {
+			names = append(names, label[1:len(label)-1])
+		}
+	}
+	return names
+}
+
+// hostMatcher returns the compiled Host pattern of the router. The pattern is
+// compiled when the router is included; a Host changed afterwards is compiled
+// on every call.
+func (r *Router) hostMatcher() *regexp.Regexp {
+	if r.hostRegexp == nil || r.hostRegexpSource != r.Host {
+		return regexp.MustCompile(hostPattern(r.Host))
+	}
+	return r.hostRegexp
+}
+
+// matchesHost reports whether the request host matches the Host of the
+// router. Routers without a Host match every host.
+func (r *Router) matchesHost(host string) bool {
+	if r.Host == "" {
+		return true
+	}
+	return r.hostMatcher().MatchString(stripPort(host))
+}
+
+// stripPort removes the port from a request host.
+func stripPort(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return host
+}
+
+// hostRouter returns the closest router with a Host, or nil.
+func (r *Router) hostRouter() *Router {
+	for current := r; current != nil; current = current.parent {
+		if current.Host != "" {
+			return current
+		}
+	}
+	return nil
+}
+
+// HostParams returns the host labels matched by the placeholders of the Host
+// pattern of the route's router, e.g. {"tenant": "acme"} for "acme.example.com"
+// and "{tenant}.example.com". It returns nil if the route has no host pattern.
+func (ctx *Context) HostParams() map[string]string {
+	if ctx.route == nil || ctx.route.Router == nil {
+		return nil
+	}
+	hr := ctx.route.Router.hostRouter()
+	if hr == nil {
+		return nil
+	}
+	matches := hr.hostMatcher().FindStringSubmatch(stripPort(ctx.Request.Host))
+	params := map[string]string{}
+	for i, name := range hostNames(hr.Host) {
+		if i+1 < len(matches) {
+			params[name] = matches[i+1]
+		}
+	}
+	return params
+}
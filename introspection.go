@@ -0,0 +1,99 @@
+package puff
+
+import (
+	"reflect"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+// RouteInfo describes a registered route, e.g. for permission audits or
+// route table dumps. See PuffApp.Routes.
+type RouteInfo struct {
+	// Method is the HTTP method, or GET for WebSocket routes.
+	Method string `json:"method"`
+	// Path is the full path including the prefixes of all routers.
+	Path string `json:"path"`
+	// Router is the name of the router the route belongs to.
+	Router string `json:"router"`
+	// Host is the host pattern the route is scoped to, if any.
+	Host string `json:"host,omitempty"`
+	// WebSocket is set for WebSocket routes.
+	WebSocket bool `json:"websocket,omitempty"`
+	// Params are the input parameters bound from the request.
+	Params []RouteParamInfo `json:"params,omitempty"`
+	// Middlewares are the names of the middlewares of the routers and the
+	// route, from the root router to the route.
+	Middlewares []string `json:"middlewares,omitempty"`
+	// OperationID is the operationId of the route in OpenAPI.
+	OperationID string `json:"operationId"`
+	// Route is the described route.
+	Route *Route `json:"-"`
+}
+
+// RouteParamInfo describes an input parameter of a route.
+type RouteParamInfo struct {
+	Name     string `json:"name"`
+	In       string `json:"in"`
+	Required bool   `json:"required"`
+}
+
+// Routes returns the metadata of every route registered on the application,
+// in registration order, without walking Router.Routers manually.
+func (a *PuffApp) Routes() []RouteInfo {
+	var infos []RouteInfo
+	// routes with invalid fields are listed without params; SelfCheck reports them.
+	a.resolveParams()
+	a.routesMu.RLock()
+	defer a.routesMu.RUnlock()
+	for _, route := range a.AllRoutes() {
+		info := RouteInfo{
+			Method:      route.Protocol,
+			Path:        route.fullPath,
+			WebSocket:   route.WebSocket,
+			OperationID: generateOperationId(*route),
+			Route:       route,
+		}
+		if route.Router != nil {
+			info.Router = route.Router.Name
+			if hr := route.Router.hostRouter(); hr != nil {
+				info.Host = hr.Host
+			}
+			for _, m := range route.Router.middlewareChain() {
+				info.Middlewares = append(info.Middlewares, middlewareName(*m))
+			}
+		}
+		for _, m := range route.Middlewares {
+			info.Middlewares = append(info.Middlewares, middlewareName(*m))
+		}
+		for _, p := range route.params {
+			info.Params = append(info.Params, RouteParamInfo{Name: p.Name, In: p.In, Required: p.Required})
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// closureSuffix matches the suffix of the names of anonymous functions.
+var closureSuffix = regexp.MustCompile(`(\.func\d+)+$`)
+
+// middlewareName returns the name of the function m, without its import path
+// and closure suffix, e.g. "middleware.createCORSMiddleware".
+func middlewareName(m Middleware) string {
+	return funcName(m)
+}
+
+// funcName returns the name of the function fn, without its import path and
+// closure suffix.
+func funcName(fn any) string {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func || v.IsNil() {
+		return "unknown"
+	}
+	f := runtime.FuncForPC(v.Pointer())
+	if f == nil {
+		return "unknown"
+	}
+	name := closureSuffix.ReplaceAllString(f.Name(), "")
+	return name[strings.LastIndex(name, "/")+1:]
+}
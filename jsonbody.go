@@ -0,0 +1,79 @@
+package puff
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// malformedBodyError is an error decoding a JSON body that is not valid JSON
+// or does not fit the type of the body field. It is answered with 422
+// Unprocessable Entity instead of 400.
+type malformedBodyError struct {
+	err error
+}
+
+func (e *malformedBodyError) Error() string {
+	return e.err.Error()
+}
+
+func (e *malformedBodyError) Unwrap() error {
+	return e.err
+}
+
+// malformedBody marks err as an error decoding a JSON body.
+func malformedBody(err error) error {
+	return &malformedBodyError{err: err}
+}
+
+// isJSONBodyField reports whether a body field of type t is decoded from JSON:
+// structs, slices and maps, or pointers to them.
+func isJSONBodyField(t reflect.Type) bool {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == timeType || t == reflect.TypeOf(File{}) {
+		return false
+	}
+	switch t.Kind() {
+	case reflect.Struct, reflect.Slice, reflect.Map:
+		return true
+	}
+	return false
+}
+
+// populateBodyField decodes the JSON body value straight into field. The keys
+// of struct bodies are checked like before decoding, so a missing required
+// key or a value of the wrong type is reported with its key.
+func populateBodyField(value string, field reflect.Value) error {
+	var raw any
+	if err := json.Unmarshal([]byte(value), &raw); err != nil {
+		return malformedBody(fmt.Errorf("%w: %s", InvalidJSONError(value), err.Error()))
+	}
+	t := field.Type()
+	st := t
+	for st.Kind() == reflect.Pointer {
+		st = st.Elem()
+	}
+	if m, ok := raw.(map[string]any); ok && st.Kind() == reflect.Struct {
+		if ok, err := validate(m, st); !ok {
+			return err
+		}
+	}
+	target := reflect.New(t)
+	if err := json.Unmarshal([]byte(value), target.Interface()); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			key := typeErr.Field
+			if key == "" {
+				key = "(root)"
+			}
+			return malformedBody(BadFieldType(key, typeErr.Value, strings.TrimPrefix(typeErr.Type.String(), "*")))
+		}
+		return malformedBody(err)
+	}
+	field.Set(target.Elem())
+	return nil
+}
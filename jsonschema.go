@@ -0,0 +1,264 @@
+package puff
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// JSONSchemaDialect is the JSON Schema version of the documents returned by
+// PuffApp.JSONSchemas.
+const JSONSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// RouteJSONSchema holds standalone JSON Schema documents for the request and
+// the responses of a route, for API gateways and message validators that do
+// not read OpenAPI. Referenced types are inlined under $defs.
+type RouteJSONSchema struct {
+	// Method is the HTTP method of the route.
+	Method string `json:"method"`
+	// Path is the full path of the route.
+	Path string `json:"path"`
+	// OperationID is the operationId of the route in OpenAPI.
+	OperationID string `json:"operationId"`
+	// Request describes the request as an object with one property per parameter
+	// location ("path", "host", "query", "header", "cookie", "form" and "body").
+	Request map[string]any `json:"request"`
+	// Responses describe the JSON response bodies by status code.
+	Responses map[string]map[string]any `json:"responses,omitempty"`
+}
+
+// JSONSchemas returns the JSON Schema documents of every route registered on
+// the application, derived from the same fields and response types as the
+// OpenAPI spec. It returns an error if the fields of a route are not a valid
+// input schema.
+func (a *PuffApp) JSONSchemas() ([]RouteJSONSchema, error) {
+	if err := a.resolveParams(); err != nil {
+		return nil, err
+	}
+	var schemas []RouteJSONSchema
+	a.routesMu.RLock()
+	defer a.routesMu.RUnlock()
+	for _, route := range a.AllRoutes() {
+		schemas = append(schemas, RouteJSONSchema{
+			Method:      route.Protocol,
+			Path:        route.fullPath,
+			OperationID: generateOperationId(*route),
+			Request:     requestJSONSchema(route),
+			Responses:   responseJSONSchemas(a, route),
+		})
+	}
+	return schemas, nil
+}
+
+// resolveParams resolves the full path and the params of the routes not
+// prepared yet, which is normally done by SelfCheck or when serving. It
+// returns the error of the first route whose fields are not a valid input
+// schema.
+func (a *PuffApp) resolveParams() error {
+	a.routesMu.Lock()
+	defer a.routesMu.Unlock()
+	for _, route := range a.AllRoutes() {
+		if route.fullPath == "" {
+			route.getCompletePath()
+		}
+		if route.params == nil && route.Fields != nil {
+			if err := route.handleInputSchema(); err != nil {
+				return &RegistrationError{Kind: RegistrationBadFields, Router: route.Router.Name, Method: route.Protocol, Path: route.Path, Source: route.source, Err: err}
+			}
+		}
+	}
+	return nil
+}
+
+// WriteJSONSchemas writes the JSON Schema documents of every route to dir,
+// one file per route named after its operationId, e.g. "getUsers_id.json".
+func (a *PuffApp) WriteJSONSchemas(dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	schemas, err := a.JSONSchemas()
+	if err != nil {
+		return err
+	}
+	for _, s := range schemas {
+		b, err := json.MarshalIndent(s, "", "  ")
+		if err != nil {
+			return fmt.Errorf("encoding JSON schema of %s %s failed: %w", s.Method, s.Path, err)
+		}
+		name := schemaFileNameReplacer.Replace(strings.Trim(s.OperationID, "/"))
+		if err := os.WriteFile(filepath.Join(dir, name+".json"), b, 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// schemaFileNameReplacer turns operationIds into file names.
+var schemaFileNameReplacer = strings.NewReplacer("/", "_", "{", "", "}", "")
+
+// requestJSONSchema returns the JSON Schema document of the request of route.
+func requestJSONSchema(route *Route) map[string]any {
+	locations := map[string]*Schema{}
+	var required []string
+	for _, p := range route.params {
+		in := p.In
+		if in == "file" {
+			in = "form"
+		}
+		if in == "body" || (in == "form" && p.formStruct) {
+			if location, ok := locations[in]; ok {
+				// the files of the form, extended by the form struct.
+				merged := objectSchemaOf(location)
+				merged.AllOf = append(merged.AllOf, p.Schema)
+				locations[in] = merged
+			} else {
+				locations[in] = p.Schema
+			}
+			if p.Required && !slices.Contains(required, in) {
+				required = append(required, in)
+			}
+			continue
+		}
+		s := p.Schema
+		if p.In == "file" {
+			s = &Schema{Type: "string", Format: "binary"}
+			if p.Schema != nil && p.Schema.Type == "array" {
+				s = &Schema{Type: "array", Items: s}
+			}
+		}
+		locations[in] = withProperty(locations[in], p.Name, s, p.Required)
+		if p.Required {
+			if !slices.Contains(required, in) {
+				required = append(required, in)
+			}
+		}
+	}
+	return newJSONSchemaDocument(&Schema{Type: "object", Properties: locations, Required: required})
+}
+
+// responseJSONSchemas returns the JSON Schema documents of the responses of
+// route by status code, including the errors documented with Route.Errors.
+func responseJSONSchemas(a *PuffApp, route *Route) map[string]map[string]any {
+	responses := map[string]map[string]any{}
+	for statusCode, res := range route.effectiveResponses() {
+		responses[strconv.Itoa(statusCode)] = newJSONSchemaDocument(newDefinition(route, reflect.New(res()).Interface()))
+	}
+	for statusCode := range route.documentedErrors {
+		responses[strconv.Itoa(statusCode)] = newJSONSchemaDocument(a.errorConfig().schema())
+	}
+	if len(responses) == 0 {
+		return nil
+	}
+	return responses
+}
+
+// newJSONSchemaDocument converts the OpenAPI schema s into a standalone JSON
+// Schema document: references to components are rewritten to $defs, which
+// holds every schema they reach.
+func newJSONSchemaDocument(s *Schema) map[string]any {
+	defs := map[string]any{}
+	doc := toJSONSchema(s, defs)
+	doc["$schema"] = JSONSchemaDialect
+	if len(defs) > 0 {
+		doc["$defs"] = defs
+	}
+	return doc
+}
+
+// formatJSONTypes are the JSON types of the formats of schemas generated from
+// Go types, which carry no type of their own.
+var formatJSONTypes = map[string]string{
+	"string": "string",
+	"int":    "integer",
+	"int8":   "integer",
+	"int16":  "integer",
+	"int32":  "integer",
+	"int64":  "integer",
+	"float":  "number",
+	"double": "number",
+	"bool":   "boolean",
+}
+
+// toJSONSchema converts s into a JSON Schema object, adding the schemas it
+// references to defs.
+func toJSONSchema(s *Schema, defs map[string]any) map[string]any {
+	if s == nil {
+		return map[string]any{}
+	}
+	if s.Ref == "$FILE" {
+		return map[string]any{"type": "string", "format": "binary"}
+	}
+	if name, ok := strings.CutPrefix(s.Ref, "#/components/schemas/"); ok {
+		if _, seen := defs[name]; !seen {
+			// set before converting so recursive types terminate.
+			defs[name] = map[string]any{}
+			defs[name] = toJSONSchema(Schemas[name], defs)
+		}
+		return map[string]any{"$ref": "#/$defs/" + name}
+	}
+	out := map[string]any{}
+	examples, format := s.Examples, s.Format
+	if s.Type != "" {
+		out["type"] = s.Type
+	} else if t, ok := formatJSONTypes[s.Format]; ok {
+		out["type"] = t
+		if t == "integer" || t == "number" {
+			// the examples of numbers generated from Go types are strings.
+			examples = nil
+		}
+		if format == "string" || format == "int" || format == "bool" {
+			// not formats, only the names of the Go types.
+			format = ""
+		}
+	}
+	if format != "" {
+		out["format"] = format
+	}
+	if s.Description != "" {
+		out["description"] = s.Description
+	}
+	if s.Pattern != "" {
+		out["pattern"] = s.Pattern
+	}
+	if len(s.Enum) > 0 {
+		out["enum"] = s.Enum
+	}
+	if s.Minimum != "" {
+		if min, err := strconv.ParseFloat(s.Minimum, 64); err == nil {
+			out["minimum"] = min
+		}
+	}
+	if len(examples) > 0 {
+		out["examples"] = examples
+	}
+	if s.Items != nil {
+		out["items"] = toJSONSchema(s.Items, defs)
+	}
+	if s.AdditionalProperties != nil {
+		out["type"] = "object"
+		out["additionalProperties"] = toJSONSchema(s.AdditionalProperties, defs)
+	}
+	if len(s.Properties) > 0 {
+		properties := map[string]any{}
+		for name, p := range s.Properties {
+			properties[name] = toJSONSchema(p, defs)
+		}
+		out["properties"] = properties
+	}
+	if len(s.Required) > 0 {
+		out["required"] = s.Required
+	}
+	if len(s.AllOf) > 0 {
+		var allOf []any
+		for _, sub := range s.AllOf {
+			allOf = append(allOf, toJSONSchema(sub, defs))
+		}
+		out["allOf"] = allOf
+	}
+	return out
+}
@@ -0,0 +1,155 @@
+package puff
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+const (
+	// ListenerFDEnv names the environment variable holding the file descriptor
+	// of a listener inherited from the previous process during a Handoff.
+	ListenerFDEnv = "PUFF_LISTENER_FD"
+	// ReadyFDEnv names the environment variable holding the file descriptor the
+	// new process writes to once it serves requests.
+	ReadyFDEnv = "PUFF_READY_FD"
+)
+
+// listen returns the listener the server accepts connections on. A listener
+// inherited through ListenerFDEnv or systemd socket activation (LISTEN_FDS)
+// is used if present; otherwise a new one is opened on addr, with
+// SO_REUSEPORT if AppConfig.ReusePort is set.
+func (a *PuffApp) listen(addr string) (net.Listener, error) {
+	if l, err := inheritedListener(); l != nil || err != nil {
+		return l, err
+	}
+	if addr == "" {
+		addr = ":http"
+	}
+	if a.Config.ReusePort {
+		lc := net.ListenConfig{Control: reusePortControl}
+		return lc.Listen(context.Background(), "tcp", addr)
+	}
+	return net.Listen("tcp", addr)
+}
+
+// inheritedListener returns the listener passed by the parent process, or nil
+// if there is none. The environment variables are cleared so processes
+// started later do not inherit them.
+func inheritedListener() (net.Listener, error) {
+	fd := 0
+	if v := os.Getenv(ListenerFDEnv); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q: %w", ListenerFDEnv, v, err)
+		}
+		fd = n
+		os.Unsetenv(ListenerFDEnv)
+	} else if os.Getenv("LISTEN_FDS") != "" {
+		if pid := os.Getenv("LISTEN_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+			return nil, nil
+		}
+		// systemd passes the first socket as file descriptor 3.
+		fd = 3
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_PID")
+	} else {
+		return nil, nil
+	}
+	f := os.NewFile(uintptr(fd), "puff-listener")
+	defer f.Close()
+	l, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("inheriting listener from file descriptor %d failed: %w", fd, err)
+	}
+	return l, nil
+}
+
+// signalReady tells the parent process of a Handoff that this process serves
+// requests, so the parent can shut down.
+func signalReady() {
+	v := os.Getenv(ReadyFDEnv)
+	if v == "" {
+		return
+	}
+	os.Unsetenv(ReadyFDEnv)
+	fd, err := strconv.Atoi(v)
+	if err != nil {
+		return
+	}
+	f := os.NewFile(uintptr(fd), "puff-ready")
+	f.Write([]byte{1})
+	f.Close()
+}
+
+// Handoff restarts the application without dropping connections: it starts
+// a new instance of the running executable with the same arguments, passing
+// it the listener, waits until the new process serves requests and then
+// gracefully shuts down this server, finishing in-flight requests within ctx.
+// If the new process exits or ctx ends before it is ready, this server keeps
+// serving and the error is returned.
+//
+// Handoff is usually called from a SIGHUP or SIGUSR2 handler during deployments.
+func (a *PuffApp) Handoff(ctx context.Context) error {
+	filer, ok := a.listener.(interface{ File() (*os.File, error) })
+	if !ok {
+		return errors.New("handoff requires a running server with a TCP or unix listener")
+	}
+	lf, err := filer.File()
+	if err != nil {
+		return err
+	}
+	defer lf.Close()
+	readyR, readyW, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer readyR.Close()
+
+	executable, err := os.Executable()
+	if err != nil {
+		readyW.Close()
+		return err
+	}
+	cmd := exec.Command(executable, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	// ExtraFiles[i] becomes file descriptor 3+i in the new process.
+	cmd.ExtraFiles = []*os.File{lf, readyW}
+	cmd.Env = append(os.Environ(), ListenerFDEnv+"=3", ReadyFDEnv+"=4")
+	err = cmd.Start()
+	readyW.Close()
+	if err != nil {
+		return err
+	}
+
+	ready := make(chan error, 1)
+	go func() {
+		b := make([]byte, 1)
+		if _, err := readyR.Read(b); err != nil {
+			ready <- fmt.Errorf("new process exited before it was ready: %w", err)
+			return
+		}
+		ready <- nil
+	}()
+	select {
+	case err := <-ready:
+		if err != nil {
+			return err
+		}
+	case <-ctx.Done():
+		cmd.Process.Kill()
+		return ctx.Err()
+	}
+	go cmd.Wait()
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, 30*time.Second)
+		defer cancel()
+	}
+	return a.Shutdown(ctx)
+}
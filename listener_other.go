@@ -0,0 +1,13 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd)
+
+package puff
+
+import (
+	"errors"
+	"syscall"
+)
+
+// reusePortControl fails since SO_REUSEPORT is not supported on this platform.
+func reusePortControl(network, address string, c syscall.RawConn) error {
+	return errors.New("AppConfig.ReusePort is not supported on this platform")
+}
@@ -0,0 +1,4 @@
+package puff
+
+// soReusePort is SO_REUSEPORT, which the syscall package does not define on Linux.
+const soReusePort = 0xf
@@ -0,0 +1,51 @@
+//go:build linux || darwin
+
+package puff_test
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"testing"
+
+	"github.com/ThePuffProject/puff"
+)
+
+func TestApp_InheritedListener(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := l.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the app takes ownership of the duplicated descriptor and closes it.
+	fd, err := syscall.Dup(int(f.Fd()))
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(puff.ListenerFDEnv, strconv.Itoa(fd))
+
+	app := puff.DefaultApp("InheritedListenerTest")
+	app.Config.DisableSelfCheck = true
+	app.Get("/ping", nil, func(c *puff.Context) {
+		c.SendResponse(puff.GenericResponse{Content: "pong"})
+	})
+	app.Server = &http.Server{Addr: "127.0.0.1:1", Handler: app.RootRouter}
+	go app.ListenAndServe("127.0.0.1:1")
+	defer app.Close()
+
+	res, err := http.Get("http://" + l.Addr().String() + "/ping")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, _ := io.ReadAll(res.Body)
+	if string(body) != "pong" {
+		t.Errorf("Expected the inherited listener to serve pong, got %s", body)
+	}
+}
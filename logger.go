@@ -8,6 +8,7 @@ import (
 	"log/slog"
 	"path"
 	"runtime"
+	"slices"
 	"time"
 
 	"github.com/ThePuffProject/puff/color"
@@ -48,6 +49,10 @@ var DefaultJSONLoggerConfig = LoggerConfig{
 type SlogHandler struct {
 	slog.Handler
 	config LoggerConfig
+	// attrs are the attributes added with WithAttrs, already qualified by group.
+	attrs []slog.Attr
+	// group is the prefix of attribute keys added with WithGroup, e.g. "request.".
+	group string
 }
 
 // NewSlogHandler returns a new puff.SlogHandler given a LoggerConfig and slog.Handler
@@ -58,6 +63,26 @@ func NewSlogHandler(config LoggerConfig) *SlogHandler {
 	}
 }
 
+// WithAttrs returns a handler writing attrs with every record, as used by slog.Logger.With.
+func (h *SlogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h2 := *h
+	h2.attrs = slices.Clip(h.attrs)
+	for _, a := range attrs {
+		h2.attrs = append(h2.attrs, slog.Attr{Key: h.group + a.Key, Value: a.Value})
+	}
+	return &h2
+}
+
+// WithGroup returns a handler prefixing the keys of subsequent attributes with name.
+func (h *SlogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := *h
+	h2.group = h.group + name + "."
+	return &h2
+}
+
 // Enabled will check if a log needs to be written to stdout.
 func (h *SlogHandler) Enabled(c context.Context, level slog.Level) bool {
 	return level >= h.config.Level
@@ -82,10 +107,13 @@ func (h *SlogHandler) Handle(c context.Context, r slog.Record) error {
 		}
 	}
 
-	fields := make(map[string]any, r.NumAttrs())
+	fields := make(map[string]any, len(h.attrs)+r.NumAttrs())
 	// populate fields
-	r.Attrs(func(a slog.Attr) bool {
+	for _, a := range h.attrs {
 		fields[a.Key] = a.Value.Any()
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		fields[h.group+a.Key] = a.Value.Any()
 		return true
 	})
 	if h.config.AddSource {
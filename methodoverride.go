@@ -0,0 +1,54 @@
+package puff
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// maxMethodOverrideFormBytes is the largest form body read to find a _method field.
+const maxMethodOverrideFormBytes = 1 << 20
+
+// overridableMethods are the methods a POST request may be overridden to.
+var overridableMethods = []string{http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+// applyMethodOverride changes the method of a POST request to the method in
+// its X-HTTP-Method-Override header or, for urlencoded forms, its _method
+// field. Only PUT, PATCH and DELETE are accepted; other values are ignored.
+func applyMethodOverride(req *http.Request) *http.Request {
+	if req.Method != http.MethodPost {
+		return req
+	}
+	method := strings.ToUpper(req.Header.Get("X-HTTP-Method-Override"))
+	if method == "" {
+		method = strings.ToUpper(formMethod(req))
+	}
+	if !isAnyOfThese(method, overridableMethods...) {
+		return req
+	}
+	req = req.Clone(req.Context())
+	req.Method = method
+	return req
+}
+
+// formMethod returns the _method field of an urlencoded form body. The body
+// is restored so handlers can still read it.
+func formMethod(req *http.Request) string {
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if mediaType != "application/x-www-form-urlencoded" || req.Body == nil {
+		return ""
+	}
+	body, err := io.ReadAll(io.LimitReader(req.Body, maxMethodOverrideFormBytes))
+	req.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), req.Body))
+	if err != nil {
+		return ""
+	}
+	values, err := url.ParseQuery(string(body))
+	if err != nil {
+		return ""
+	}
+	return values.Get("_method")
+}
@@ -0,0 +1,165 @@
+package middleware
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/ThePuffProject/puff"
+)
+
+// AccessRequest is what an AccessPolicy decides on: may Subject perform
+// Action on Resource?
+type AccessRequest struct {
+	// Subject is the authenticated caller, as stored on Context by an authentication middleware.
+	// It is nil for anonymous requests.
+	Subject any
+	// Action is the operation requested. Default: the HTTP method.
+	Action string
+	// Resource describes what the request acts on.
+	Resource AccessResource
+}
+
+// AccessResource describes the resource of an AccessRequest.
+type AccessResource struct {
+	// Route is the route serving the request, giving access to its metadata.
+	Route *puff.Route
+	// Path is the route path template, e.g. "/users/{id}".
+	Path string
+	// Params are the path parameters of the request.
+	Params map[string]string
+}
+
+// AccessDecision is the result of an AccessPolicy.
+type AccessDecision struct {
+	// Allowed reports whether the request may proceed.
+	Allowed bool
+	// Reason explains the decision. The reason of a denial is sent to the client.
+	Reason string
+}
+
+// Allow returns a decision allowing the request.
+func Allow(reason string) AccessDecision {
+	return AccessDecision{Allowed: true, Reason: reason}
+}
+
+// Deny returns a decision denying the request.
+func Deny(reason string) AccessDecision {
+	return AccessDecision{Reason: reason}
+}
+
+// AccessPolicy decides whether a request is allowed. It can wrap a local rule
+// set or call out to a policy engine. An error denies the request with a 500
+// response, so the middleware fails closed.
+type AccessPolicy func(c *puff.Context, req AccessRequest) (AccessDecision, error)
+
+// AccessControlConfig is a struct to configure the AccessControl middleware.
+type AccessControlConfig struct {
+	// Skip allows skipping the middleware for specific requests.
+	// The function receives the request context and should return true if the middleware should be skipped.
+	Skip func(*puff.Context) bool
+	// Policy decides on every request. Requests are denied if it is nil.
+	Policy AccessPolicy
+	// SubjectKey is the key the authentication middleware stores the subject under on Context.
+	// Default: "Subject".
+	SubjectKey string
+	// Action returns the action of a request. Default: the HTTP method.
+	Action func(*puff.Context) string
+	// LogDecisions logs every decision, not only denials.
+	LogDecisions bool
+}
+
+// DefaultAccessControlConfig is an AccessControlConfig with specified default values.
+// Its Policy must be set before use.
+var DefaultAccessControlConfig AccessControlConfig = AccessControlConfig{
+	SubjectKey: puff.SubjectKey,
+	Action:     func(c *puff.Context) string { return c.Request.Method },
+	Skip:       DefaultSkipper,
+}
+
+// createAccessControlMiddleware is used to create an AccessControl middleware with a config.
+func createAccessControlMiddleware(config AccessControlConfig) puff.Middleware {
+	if config.SubjectKey == "" {
+		config.SubjectKey = DefaultAccessControlConfig.SubjectKey
+	}
+	if config.Action == nil {
+		config.Action = DefaultAccessControlConfig.Action
+	}
+	return func(next puff.HandlerFunc) puff.HandlerFunc {
+		return func(c *puff.Context) {
+			if config.Skip != nil && config.Skip(c) {
+				next(c)
+				return
+			}
+			req := AccessRequest{
+				Subject: c.Get(config.SubjectKey),
+				Action:  config.Action(c),
+				Resource: AccessResource{
+					Route:  c.Route(),
+					Params: c.PathParams(),
+				},
+			}
+			if req.Resource.Route != nil {
+				req.Resource.Path = req.Resource.Route.GetFullPath()
+			}
+
+			decision := Deny("no access policy configured")
+			var err error
+			if config.Policy != nil {
+				decision, err = config.Policy(c, req)
+			}
+			attrs := []any{
+				slog.String("request_id", c.GetRequestID()),
+				slog.Any("subject", req.Subject),
+				slog.String("action", req.Action),
+				slog.String("resource", req.Resource.Path),
+				slog.Bool("allowed", decision.Allowed && err == nil),
+				slog.String("reason", decision.Reason),
+			}
+			if err != nil {
+				slog.Error("Access policy failed", append(attrs, slog.String("error", err.Error()))...)
+				c.InternalServerError("An unexpected error occured.")
+				return
+			}
+			if !decision.Allowed {
+				slog.Warn("Access denied", attrs...)
+				writeAccessDenied(c, decision.Reason)
+				return
+			}
+			if config.LogDecisions {
+				slog.Info("Access allowed", attrs...)
+			}
+			next(c)
+		}
+	}
+}
+
+// writeAccessDenied sends a 403 RFC 9457 problem response carrying reason.
+func writeAccessDenied(c *puff.Context, reason string) {
+	problem, _ := json.Marshal(map[string]any{
+		"type":   "about:blank",
+		"title":  http.StatusText(http.StatusForbidden),
+		"status": http.StatusForbidden,
+		"detail": reason,
+	})
+	c.SendResponse(puff.GenericResponse{
+		StatusCode:  http.StatusForbidden,
+		Content:     string(problem),
+		ContentType: "application/problem+json",
+	})
+}
+
+// AccessControl returns a middleware that authorizes every request with policy.
+// The subject is read from Context under "Subject", the action is the HTTP method
+// and the resource is the matched route with its path parameters. Denied requests
+// are rejected with a 403 problem response carrying the reason of the decision.
+func AccessControl(policy AccessPolicy) puff.Middleware {
+	config := DefaultAccessControlConfig
+	config.Policy = policy
+	return createAccessControlMiddleware(config)
+}
+
+// AccessControlWithConfig returns an AccessControl middleware with your configuration.
+func AccessControlWithConfig(config AccessControlConfig) puff.Middleware {
+	return createAccessControlMiddleware(config)
+}
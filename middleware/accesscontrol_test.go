@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ThePuffProject/puff"
+)
+
+func TestAccessControl(t *testing.T) {
+	app := puff.DefaultApp("AccessControl Test")
+	var seen AccessRequest
+	app.Use(AccessControlWithConfig(AccessControlConfig{
+		Policy: func(c *puff.Context, req AccessRequest) (AccessDecision, error) {
+			seen = req
+			switch req.Subject {
+			case "owner":
+				if req.Resource.Params["id"] == "1" {
+					return Allow("owns the pizza"), nil
+				}
+			case "broken":
+				return AccessDecision{}, errors.New("policy engine unreachable")
+			}
+			return Deny("not your pizza"), nil
+		},
+		Skip: func(c *puff.Context) bool { return c.GetRequestHeader("X-User") == "internal" },
+	}))
+	// app middlewares added later run first.
+	app.Use(func(next puff.HandlerFunc) puff.HandlerFunc {
+		return func(c *puff.Context) {
+			c.Set(puff.SubjectKey, c.GetRequestHeader("X-User"))
+			next(c)
+		}
+	})
+	app.Get("/pizzas/{id}", nil, func(c *puff.Context) {
+		c.SendResponse(puff.GenericResponse{Content: "pizza"})
+	})
+	app.SelfCheck()
+	handler := app.Handler()
+
+	for _, tc := range []struct {
+		user, target string
+		status       int
+		body         string
+	}{
+		{"owner", "/pizzas/1", http.StatusOK, "pizza"},
+		{"owner", "/pizzas/2", http.StatusForbidden, `"detail":"not your pizza"`},
+		{"broken", "/pizzas/1", http.StatusInternalServerError, ""},
+		{"internal", "/pizzas/2", http.StatusOK, "pizza"},
+	} {
+		req := httptest.NewRequest(http.MethodGet, tc.target, nil)
+		req.Header.Set("X-User", tc.user)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != tc.status || !strings.Contains(rec.Body.String(), tc.body) {
+			t.Errorf("Expected %d %q for %s on %s, got %d %s", tc.status, tc.body, tc.user, tc.target, rec.Code, rec.Body.String())
+		}
+		if tc.status == http.StatusForbidden && rec.Header().Get("Content-Type") != "application/problem+json" {
+			t.Errorf("Expected a problem response, got %s", rec.Header().Get("Content-Type"))
+		}
+	}
+	if seen.Action != http.MethodGet || seen.Resource.Path != "/pizzas/{id}" {
+		t.Errorf("Expected the method and route path in the request, got %+v", seen)
+	}
+}
+
+func TestAccessControl_NoPolicy(t *testing.T) {
+	app := puff.DefaultApp("AccessControl Test")
+	app.Use(AccessControlWithConfig(AccessControlConfig{}))
+	app.Get("/", nil, func(c *puff.Context) {
+		c.SendResponse(puff.GenericResponse{Content: "ok"})
+	})
+	app.SelfCheck()
+	rec := httptest.NewRecorder()
+	app.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Expected requests to be denied without a policy, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,231 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ThePuffProject/puff"
+)
+
+// CapturedRequest is a request serialized by the Capture middleware so it can
+// be replayed later with Replay.
+type CapturedRequest struct {
+	ID         string      `json:"id"`
+	Time       time.Time   `json:"time"`
+	Method     string      `json:"method"`
+	URL        string      `json:"url"`
+	Header     http.Header `json:"header"`
+	Body       []byte      `json:"body"`
+	RemoteAddr string      `json:"remote_addr"`
+	// StatusCode is the status code the request was answered with.
+	StatusCode int `json:"status_code"`
+	// Truncated reports whether the body was cut off at CaptureConfig.MaxBodyBytes.
+	Truncated bool `json:"truncated"`
+}
+
+// CaptureStore persists captured requests.
+type CaptureStore interface {
+	SaveCapture(req *CapturedRequest) error
+}
+
+// DirCaptureStore stores every captured request as a JSON file named after its ID in Dir.
+type DirCaptureStore struct {
+	Dir string
+}
+
+// SaveCapture writes req to Dir.
+func (d DirCaptureStore) SaveCapture(req *CapturedRequest) error {
+	if err := os.MkdirAll(d.Dir, 0o700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(req, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(d.Dir, filepath.Base(req.ID)+".json"), data, 0o600)
+}
+
+// CaptureConfig is a struct to configure the Capture middleware.
+type CaptureConfig struct {
+	// Skip allows skipping the middleware for specific requests.
+	// The function receives the request context and should return true if the middleware should be skipped.
+	Skip func(*puff.Context) bool
+	// Store persists the captured requests. Default: DirCaptureStore in "captures".
+	Store CaptureStore
+	// Capture decides whether a request is captured. Use it to capture every request
+	// of a route. Default: requests sending the Header that are allowed by Authorize.
+	Capture func(*puff.Context) bool
+	// Header is the request header asking for a capture. Default: "X-Puff-Capture".
+	Header string
+	// Authorize guards capturing through Header, since captures contain request bodies.
+	// If nil, Header is ignored.
+	Authorize func(*puff.Context) bool
+	// OnlyFailures only stores captured requests answered with a 5xx status code.
+	OnlyFailures bool
+	// MaxBodyBytes is the maximum size of a captured body. Default: 1 MiB.
+	MaxBodyBytes int64
+	// RedactHeaders are request headers replaced by "REDACTED" in captures.
+	// Default: Authorization, Cookie and Proxy-Authorization.
+	RedactHeaders []string
+}
+
+// DefaultCaptureConfig is a CaptureConfig with specified default values.
+var DefaultCaptureConfig CaptureConfig = CaptureConfig{
+	Store:         DirCaptureStore{Dir: "captures"},
+	Header:        "X-Puff-Capture",
+	MaxBodyBytes:  1 << 20,
+	RedactHeaders: []string{"Authorization", "Cookie", "Proxy-Authorization"},
+	Skip:          DefaultSkipper,
+}
+
+// createCaptureMiddleware is used to create a Capture middleware with a config.
+func createCaptureMiddleware(config CaptureConfig) puff.Middleware {
+	if config.Store == nil {
+		config.Store = DefaultCaptureConfig.Store
+	}
+	if config.Header == "" {
+		config.Header = DefaultCaptureConfig.Header
+	}
+	if config.MaxBodyBytes <= 0 {
+		config.MaxBodyBytes = DefaultCaptureConfig.MaxBodyBytes
+	}
+	if config.RedactHeaders == nil {
+		config.RedactHeaders = DefaultCaptureConfig.RedactHeaders
+	}
+	if config.Capture == nil {
+		config.Capture = func(c *puff.Context) bool {
+			return c.GetRequestHeader(config.Header) != "" && config.Authorize != nil && config.Authorize(c)
+		}
+	}
+	return func(next puff.HandlerFunc) puff.HandlerFunc {
+		return func(c *puff.Context) {
+			if config.Skip != nil && config.Skip(c) || !config.Capture(c) {
+				next(c)
+				return
+			}
+			captured, err := captureRequest(c, config)
+			if err != nil {
+				slog.Error("Request capture failed", slog.String("error", err.Error()))
+				next(c)
+				return
+			}
+			if !config.OnlyFailures {
+				c.SetResponseHeader("X-Capture-ID", captured.ID)
+			}
+			defer func() {
+				captured.StatusCode = c.GetStatusCode()
+				if config.OnlyFailures && captured.StatusCode < http.StatusInternalServerError {
+					return
+				}
+				if err := config.Store.SaveCapture(captured); err != nil {
+					slog.Error("Saving captured request failed", slog.String("id", captured.ID), slog.String("error", err.Error()))
+				}
+			}()
+			next(c)
+		}
+	}
+}
+
+// captureRequest copies the request and restores its body for the handler.
+func captureRequest(c *puff.Context, config CaptureConfig) (*CapturedRequest, error) {
+	id := c.GetRequestID()
+	if id == "" {
+		id = puff.RandomToken(16)
+	}
+	captured := &CapturedRequest{
+		ID:         id,
+		Time:       time.Now(),
+		Method:     c.Request.Method,
+		URL:        c.Request.URL.RequestURI(),
+		Header:     c.Request.Header.Clone(),
+		RemoteAddr: c.Request.RemoteAddr,
+	}
+	for _, h := range config.RedactHeaders {
+		if captured.Header.Get(h) != "" {
+			captured.Header.Set(h, "REDACTED")
+		}
+	}
+	captured.Header.Del(config.Header)
+	if c.Request.Body == nil {
+		return captured, nil
+	}
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, config.MaxBodyBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	// the handler reads the captured part followed by whatever was not captured.
+	c.Request.Body = readCloser{io.MultiReader(bytes.NewReader(body), c.Request.Body), c.Request.Body}
+	if int64(len(body)) > config.MaxBodyBytes {
+		body = body[:config.MaxBodyBytes]
+		captured.Truncated = true
+	}
+	captured.Body = body
+	return captured, nil
+}
+
+// readCloser combines a reader with the closer of the original body.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// Capture returns a middleware that serializes requests to DefaultCaptureConfig.Store
+// so failing requests can be replayed locally with Replay. Requests are only
+// captured if they send the X-Puff-Capture header and pass authorize.
+func Capture(authorize func(*puff.Context) bool) puff.Middleware {
+	config := DefaultCaptureConfig
+	config.Authorize = authorize
+	return createCaptureMiddleware(config)
+}
+
+// CaptureWithConfig returns a Capture middleware with your configuration.
+func CaptureWithConfig(config CaptureConfig) puff.Middleware {
+	return createCaptureMiddleware(config)
+}
+
+// LoadCapture reads a captured request written by DirCaptureStore.
+func LoadCapture(path string) (*CapturedRequest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	captured := new(CapturedRequest)
+	if err := json.Unmarshal(data, captured); err != nil {
+		return nil, fmt.Errorf("capture %s: %w", path, err)
+	}
+	return captured, nil
+}
+
+// Request rebuilds the captured request against baseURL, e.g. "http://localhost:8000".
+// Redacted headers are dropped.
+func (cr *CapturedRequest) Request(baseURL string) (*http.Request, error) {
+	req, err := http.NewRequest(cr.Method, strings.TrimSuffix(baseURL, "/")+cr.URL, bytes.NewReader(cr.Body))
+	if err != nil {
+		return nil, err
+	}
+	for k, values := range cr.Header {
+		for _, v := range values {
+			if v != "REDACTED" {
+				req.Header.Add(k, v)
+			}
+		}
+	}
+	return req, nil
+}
+
+// Replay sends the captured request to the server at baseURL, such as a local dev server.
+func Replay(cr *CapturedRequest, baseURL string) (*http.Response, error) {
+	req, err := cr.Request(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	return http.DefaultClient.Do(req)
+}
@@ -0,0 +1,132 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ThePuffProject/puff"
+)
+
+type memoryCaptureStore struct {
+	mu       sync.Mutex
+	captures []*CapturedRequest
+}
+
+func (m *memoryCaptureStore) SaveCapture(req *CapturedRequest) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.captures = append(m.captures, req)
+	return nil
+}
+
+func newCaptureApp(config CaptureConfig) *puff.PuffApp {
+	app := puff.DefaultApp("Capture Test")
+	app.Use(CaptureWithConfig(config))
+	input := &struct {
+		Body struct {
+			Name string `json:"name"`
+		}
+	}{}
+	app.Post("/pizzas", input, func(c *puff.Context) {
+		if input.Body.Name == "pineapple" {
+			c.InternalServerError("No pineapple.")
+			return
+		}
+		c.SendResponse(puff.GenericResponse{Content: "created " + input.Body.Name})
+	})
+	app.SelfCheck()
+	return app
+}
+
+func postPizza(handler http.Handler, body string, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/pizzas?size=large", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestCapture(t *testing.T) {
+	store := &memoryCaptureStore{}
+	handler := newCaptureApp(CaptureConfig{
+		Store:     store,
+		Authorize: func(c *puff.Context) bool { return c.GetRequestHeader("Authorization") == "Bearer admin" },
+	}).Handler()
+
+	body := `{"name":"margherita"}`
+	// the input is bound after the middleware captured the body.
+	rec := postPizza(handler, body, map[string]string{"X-Puff-Capture": "1", "Authorization": "Bearer admin"})
+	if rec.Code != http.StatusOK || rec.Body.String() != "created margherita" {
+		t.Fatalf("Expected the captured body to be bound, got %d %s", rec.Code, rec.Body.String())
+	}
+	if len(store.captures) != 1 {
+		t.Fatalf("Expected 1 capture, got %d", len(store.captures))
+	}
+	captured := store.captures[0]
+	if rec.Header().Get("X-Capture-ID") != captured.ID {
+		t.Errorf("Expected the capture ID %q in the response, got %q", captured.ID, rec.Header().Get("X-Capture-ID"))
+	}
+	if string(captured.Body) != body || captured.URL != "/pizzas?size=large" || captured.StatusCode != http.StatusOK {
+		t.Errorf("Unexpected capture %+v", captured)
+	}
+	if captured.Header.Get("Authorization") != "REDACTED" || captured.Header.Get("X-Puff-Capture") != "" {
+		t.Errorf("Expected redacted headers without the capture header, got %v", captured.Header)
+	}
+
+	// unauthorized or unrequested captures are ignored.
+	postPizza(handler, body, map[string]string{"X-Puff-Capture": "1"})
+	postPizza(handler, body, map[string]string{"Authorization": "Bearer admin"})
+	if len(store.captures) != 1 {
+		t.Errorf("Expected unauthorized requests not to be captured, got %d captures", len(store.captures))
+	}
+
+	// the captured request is replayed with the same body and without redacted headers.
+	var replayed *http.Request
+	var replayedBody []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		replayed = r
+		replayedBody, _ = io.ReadAll(r.Body)
+	}))
+	defer server.Close()
+	resp, err := Replay(captured, server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if replayed.URL.RequestURI() != "/pizzas?size=large" || string(replayedBody) != body || replayed.Header.Get("Authorization") != "" {
+		t.Errorf("Unexpected replayed request %s %s %v", replayed.URL, replayedBody, replayed.Header)
+	}
+}
+
+func TestCapture_OnlyFailuresAndTruncation(t *testing.T) {
+	store := &memoryCaptureStore{}
+	handler := newCaptureApp(CaptureConfig{
+		Store:        store,
+		Capture:      func(*puff.Context) bool { return true },
+		OnlyFailures: true,
+		MaxBodyBytes: 10,
+	}).Handler()
+
+	if rec := postPizza(handler, `{"name":"margherita"}`, nil); rec.Code != http.StatusOK || rec.Header().Get("X-Capture-ID") != "" {
+		t.Fatalf("Expected 200 without a capture ID, got %d %v", rec.Code, rec.Header())
+	}
+	body := `{"name":"pineapple"}`
+	// the handler reads the whole body even though only a part is captured.
+	if rec := postPizza(handler, body, nil); rec.Code != http.StatusInternalServerError {
+		t.Fatalf("Expected 500, got %d %s", rec.Code, rec.Body.String())
+	}
+	if len(store.captures) != 1 {
+		t.Fatalf("Expected only the failure to be captured, got %d captures", len(store.captures))
+	}
+	captured := store.captures[0]
+	if !captured.Truncated || string(captured.Body) != body[:10] || captured.StatusCode != http.StatusInternalServerError {
+		t.Errorf("Unexpected capture %+v", captured)
+	}
+}
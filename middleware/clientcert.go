@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"crypto/x509"
+	"log/slog"
+	"net/http"
+
+	"github.com/ThePuffProject/puff"
+)
+
+// ClientCertAuthConfig is a struct to configure the ClientCertAuth middleware.
+type ClientCertAuthConfig struct {
+	// Skip allows skipping the middleware for specific requests.
+	// The function receives the request context and should return true if the middleware should be skipped.
+	Skip func(*puff.Context) bool
+	// Principal maps the verified client certificate to the principal stored on Context,
+	// e.g. a service account looked up by the certificate's URI SAN. An error rejects the
+	// request with a 403 response. Default: the certificate's subject common name.
+	Principal func(c *puff.Context, cert *x509.Certificate) (any, error)
+	// SubjectKey is the key the principal is stored under on Context.
+	// Default: "Subject".
+	SubjectKey string
+	// Optional lets requests without a verified client certificate through without a
+	// principal, e.g. with tls.VerifyClientCertIfGiven. Otherwise they are rejected with
+	// a 401 response.
+	Optional bool
+}
+
+// DefaultClientCertAuthConfig is a ClientCertAuthConfig with specified default values.
+var DefaultClientCertAuthConfig ClientCertAuthConfig = ClientCertAuthConfig{
+	Principal: func(_ *puff.Context, cert *x509.Certificate) (any, error) {
+		return cert.Subject.CommonName, nil
+	},
+	SubjectKey: puff.SubjectKey,
+	Skip:       DefaultSkipper,
+}
+
+// createClientCertAuthMiddleware is used to create a ClientCertAuth middleware with a config.
+func createClientCertAuthMiddleware(config ClientCertAuthConfig) puff.Middleware {
+	if config.Principal == nil {
+		config.Principal = DefaultClientCertAuthConfig.Principal
+	}
+	if config.SubjectKey == "" {
+		config.SubjectKey = DefaultClientCertAuthConfig.SubjectKey
+	}
+	return func(next puff.HandlerFunc) puff.HandlerFunc {
+		return func(c *puff.Context) {
+			if config.Skip != nil && config.Skip(c) {
+				next(c)
+				return
+			}
+			cert := c.ClientCertificate()
+			if cert == nil {
+				if config.Optional {
+					next(c)
+					return
+				}
+				c.Error(http.StatusUnauthorized, "A verified client certificate is required.")
+				return
+			}
+			principal, err := config.Principal(c, cert)
+			if err != nil {
+				slog.Warn("Client certificate rejected",
+					slog.String("request_id", c.GetRequestID()),
+					slog.String("subject", cert.Subject.String()),
+					slog.String("serial", cert.SerialNumber.String()),
+					slog.String("error", err.Error()),
+				)
+				c.Forbidden("The client certificate is not allowed.")
+				return
+			}
+			c.Set(config.SubjectKey, principal)
+			next(c)
+		}
+	}
+}
+
+// ClientCertAuth returns a middleware that authenticates requests by the client
+// certificate verified during the mutual TLS handshake (see AppConfig.TLSClientCAs)
+// and stores its subject common name on Context under "Subject".
+func ClientCertAuth() puff.Middleware {
+	return createClientCertAuthMiddleware(DefaultClientCertAuthConfig)
+}
+
+// ClientCertAuthWithConfig returns a ClientCertAuth middleware with your configuration.
+func ClientCertAuthWithConfig(config ClientCertAuthConfig) puff.Middleware {
+	return createClientCertAuthMiddleware(config)
+}
@@ -4,6 +4,7 @@ package middleware
 
 import (
 	"net/http"
+	"slices"
 	"strings"
 
 	"github.com/ThePuffProject/puff"
@@ -18,6 +19,11 @@ type CORSConfig struct {
 	// AllowedOrigin specifies the allowed origin for CORS.
 	AllowedOrigin string
 
+	// OriginsFromSettings allows the origins listed in the CORSOrigins of the application's
+	// RuntimeSettings instead of AllowedOrigin, so they can be changed without a restart.
+	// The Origin of the request is sent back if it is listed.
+	OriginsFromSettings bool
+
 	// AllowedMethods specifies the allowed HTTP methods for CORS.
 	AllowedMethods []string
 
@@ -55,7 +61,17 @@ func createCORSMiddleware(c CORSConfig) puff.Middleware {
 				return
 			}
 
-			ctx.SetResponseHeader("Access-Control-Allow-Origin", c.AllowedOrigin)
+			if c.OriginsFromSettings {
+				origin := ctx.GetRequestHeader("Origin")
+				ctx.SetResponseHeader("Vary", "Origin")
+				if origin == "" || !slices.Contains(ctx.Settings().CORSOrigins, origin) {
+					next(ctx)
+					return
+				}
+				ctx.SetResponseHeader("Access-Control-Allow-Origin", origin)
+			} else {
+				ctx.SetResponseHeader("Access-Control-Allow-Origin", c.AllowedOrigin)
+			}
 			ctx.SetResponseHeader("Access-Control-Allow-Methods", allowedMethods)
 			ctx.SetResponseHeader("Access-Control-Allow-Headers", allowedHeaders)
 			next(ctx)
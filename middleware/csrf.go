@@ -1,8 +1,6 @@
 package middleware
 
 import (
-	"net/http"
-
 	"github.com/ThePuffProject/puff"
 )
 
@@ -19,6 +17,9 @@ type CSRFMiddlewareConfig struct {
 	ExpectedHeader string
 	// ProtectedMethods declares what http methods CSRF should secure.
 	ProtectedMethods []string
+	// FormField is the form field the token is accepted in if ExpectedHeader is not sent,
+	// e.g. from HTML forms rendered with the csrfField template function.
+	FormField string
 }
 
 // DefaultCSRFMiddleware is a CSRFMiddlewareConfig with specified default values.
@@ -27,40 +28,52 @@ var DefaultCSRFMiddleware *CSRFMiddlewareConfig = &CSRFMiddlewareConfig{
 	MaxAge:           31449600,
 	ExpectedHeader:   "X-CSRFMiddlewareToken",
 	ProtectedMethods: []string{},
+	FormField:        puff.CSRFFormField,
 	Skip:             DefaultSkipper,
 }
 
 // createCSRFMiddleware is used to create a CSRF middleware with a config.
 func createCSRFMiddleware(config *CSRFMiddlewareConfig) puff.Middleware {
-	cookie_name := "CSRFMiddlewareToken"
+	cookie_name := puff.CSRFCookieName
 	return func(next puff.HandlerFunc) puff.HandlerFunc {
 		return func(c *puff.Context) {
 			if config.Skip != nil && config.Skip(c) {
 				next(c)
 				return
 			}
+			token := c.GetCookie(cookie_name)
+			issue := token == ""
 			for _, m := range config.ProtectedMethods {
 				if c.Request.Method != m {
 					continue
 				}
-				if c.GetCookie(cookie_name) != c.GetRequestHeader(config.ExpectedHeader) {
+				submitted := c.GetRequestHeader(config.ExpectedHeader)
+				if submitted == "" && config.FormField != "" {
+					submitted = c.GetFormValue(config.FormField)
+				}
+				if token == "" || submitted != token {
 					c.Forbidden("CSRFMiddlewareToken missing or incorrect.")
 					return
 				}
-				c.SetCookie(&http.Cookie{
-					Name:   cookie_name,
-					Value:  puff.RandomToken(config.CookieLength),
-					MaxAge: config.MaxAge, //expires after hour or session whichever comes first
-				})
+				issue = true
 				break
 			}
+			if issue {
+				token = puff.RandomToken(config.CookieLength)
+				// the token is read by JavaScript to send it in ExpectedHeader, so
+				// the cookie is never HttpOnly regardless of the cookie defaults.
+				c.Cookie(cookie_name, token).MaxAge(config.MaxAge).HttpOnly(false).Set()
+			}
+			// the token is available to templates through the csrfToken function.
+			c.Set(puff.CSRFTokenKey, token)
 			next(c)
 		}
 	}
 }
 
 // CSRF middleware automatically injects a cookie with a unique token
-// and requires the request to provide the csrf token in the response header.
+// and requires the request to provide the csrf token in the response header,
+// or in the form field for HTML forms.
 // If the CSRF Token is not present in the response header, the request is rejected
 // with a 403 error.
 // The function returns a middleware with the default configuration.
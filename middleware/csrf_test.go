@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ThePuffProject/puff"
+)
+
+func TestCSRF_CookieReadableByScripts(t *testing.T) {
+	app := puff.DefaultApp("CSRF Test")
+	app.Config.CookieDefaults = &puff.CookieDefaults{Secure: true, HttpOnly: true, Path: "/"}
+	config := *DefaultCSRFMiddleware
+	config.ProtectedMethods = []string{http.MethodPost}
+	app.Use(CSRFWithConfig(&config))
+	app.Get("/form", nil, func(c *puff.Context) {
+		c.SendResponse(puff.GenericResponse{Content: "form"})
+	})
+	app.Post("/form", nil, func(c *puff.Context) {
+		c.SendResponse(puff.GenericResponse{Content: "submitted"})
+	})
+	handler := app.Handler()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/form", nil))
+	var token *http.Cookie
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == puff.CSRFCookieName {
+			token = cookie
+		}
+	}
+	if token == nil {
+		t.Fatal("Expected a CSRF cookie")
+	}
+	// the token is sent back in a header by scripts, so the cookie cannot be HttpOnly.
+	if token.HttpOnly || !token.Secure {
+		t.Errorf("Expected a Secure cookie readable by scripts, got %s", token)
+	}
+
+	for _, tc := range []struct {
+		header string
+		status int
+	}{
+		{token.Value, http.StatusOK},
+		{"wrong", http.StatusForbidden},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/form", nil)
+		req.AddCookie(&http.Cookie{Name: token.Name, Value: token.Value})
+		req.Header.Set(config.ExpectedHeader, tc.header)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != tc.status {
+			t.Errorf("Expected %d for the header %q, got %d", tc.status, tc.header, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/ThePuffProject/puff"
+)
+
+// digestAlgorithms are the Content-Digest algorithms understood by the Digest middleware.
+var digestAlgorithms = map[string]func() hash.Hash{
+	"sha-256": sha256.New,
+	"sha-512": sha512.New,
+}
+
+// DigestConfig is a struct to configure the Digest middleware.
+type DigestConfig struct {
+	// Skip allows skipping the middleware for specific requests.
+	// The function receives the request context and should return true if the middleware should be skipped.
+	Skip func(*puff.Context) bool
+	// Required rejects requests with a body but without a Content-MD5 or Content-Digest header.
+	Required bool
+	// MaxBodyBytes is the largest body that is verified. Larger bodies are rejected with
+	// 413 Request Entity Too Large. Default: 32 MiB.
+	MaxBodyBytes int64
+	// ResponseDigest emits a Content-Digest header for responses. The response is buffered
+	// to compute it; a flushed (streaming) response is sent without a digest.
+	ResponseDigest bool
+	// ResponseAlgorithm is the algorithm of the response digest, "sha-256" or "sha-512".
+	// Default: "sha-256".
+	ResponseAlgorithm string
+}
+
+// DefaultDigestConfig is a DigestConfig with specified default values.
+var DefaultDigestConfig DigestConfig = DigestConfig{
+	MaxBodyBytes:      32 << 20,
+	ResponseAlgorithm: "sha-256",
+	Skip:              DefaultSkipper,
+}
+
+// createDigestMiddleware is used to create a Digest middleware with a config.
+func createDigestMiddleware(config DigestConfig) puff.Middleware {
+	if config.MaxBodyBytes <= 0 {
+		config.MaxBodyBytes = DefaultDigestConfig.MaxBodyBytes
+	}
+	if _, ok := digestAlgorithms[config.ResponseAlgorithm]; !ok {
+		config.ResponseAlgorithm = DefaultDigestConfig.ResponseAlgorithm
+	}
+	return func(next puff.HandlerFunc) puff.HandlerFunc {
+		return func(c *puff.Context) {
+			if config.Skip != nil && config.Skip(c) {
+				next(c)
+				return
+			}
+			if !verifyRequestDigest(c, config) {
+				return
+			}
+			if config.ResponseDigest {
+				dw := &digestResponseWriter{ResponseWriter: c.ResponseWriter, algorithm: config.ResponseAlgorithm}
+				c.ResponseWriter = dw
+				defer dw.commit()
+			}
+			next(c)
+		}
+	}
+}
+
+// verifyRequestDigest checks the request body against its Content-MD5 or
+// Content-Digest header and restores the body for binding. It responds and
+// returns false if the request is rejected.
+func verifyRequestDigest(c *puff.Context, config DigestConfig) bool {
+	contentMD5 := c.GetRequestHeader("Content-MD5")
+	contentDigest := c.GetRequestHeader("Content-Digest")
+	if contentMD5 == "" && contentDigest == "" {
+		if config.Required && c.Request.ContentLength != 0 && c.Request.Body != nil && c.Request.Body != http.NoBody {
+			c.BadRequest("Content-Digest or Content-MD5 header required.")
+			return false
+		}
+		return true
+	}
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, config.MaxBodyBytes+1))
+	c.Request.Body.Close()
+	if err != nil {
+		c.BadRequest("Request body could not be read.")
+		return false
+	}
+	if int64(len(body)) > config.MaxBodyBytes {
+		c.Error(http.StatusRequestEntityTooLarge, "Request body too large to verify.")
+		return false
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	if contentMD5 != "" {
+		sum := md5.Sum(body)
+		if !digestEqual(contentMD5, sum[:]) {
+			c.BadRequest("Content-MD5 does not match the request body.")
+			return false
+		}
+	}
+	if contentDigest != "" {
+		verified := false
+		for _, member := range strings.Split(contentDigest, ",") {
+			algorithm, value, ok := strings.Cut(strings.TrimSpace(member), "=")
+			newHash, known := digestAlgorithms[strings.ToLower(algorithm)]
+			if !ok || !known {
+				continue
+			}
+			h := newHash()
+			h.Write(body)
+			if !digestEqual(strings.Trim(value, ":"), h.Sum(nil)) {
+				c.BadRequest("Content-Digest %s does not match the request body.", algorithm)
+				return false
+			}
+			verified = true
+		}
+		if !verified {
+			c.BadRequest("Content-Digest uses no supported algorithm (sha-256, sha-512).")
+			return false
+		}
+	}
+	return true
+}
+
+// digestEqual compares a base64 encoded digest with sum in constant time.
+func digestEqual(encoded string, sum []byte) bool {
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	return err == nil && subtle.ConstantTimeCompare(decoded, sum) == 1
+}
+
+// digestResponseWriter buffers the response to send its Content-Digest
+// header. Flushing sends the response without a digest.
+type digestResponseWriter struct {
+	http.ResponseWriter
+	algorithm  string
+	buf        bytes.Buffer
+	statusCode int
+	committed  bool
+}
+
+func (w *digestResponseWriter) WriteHeader(statusCode int) {
+	if statusCode < 200 {
+		w.ResponseWriter.WriteHeader(statusCode)
+		return
+	}
+	if w.statusCode == 0 {
+		w.statusCode = statusCode
+	}
+}
+
+func (w *digestResponseWriter) Write(b []byte) (int, error) {
+	if w.statusCode == 0 {
+		w.statusCode = http.StatusOK
+	}
+	if w.committed {
+		return w.ResponseWriter.Write(b)
+	}
+	return w.buf.Write(b)
+}
+
+// commit sets the Content-Digest header and writes the buffered response.
+func (w *digestResponseWriter) commit() {
+	if w.committed {
+		return
+	}
+	w.committed = true
+	if w.statusCode == 0 {
+		return
+	}
+	h := digestAlgorithms[w.algorithm]()
+	h.Write(w.buf.Bytes())
+	w.Header().Set("Content-Digest", w.algorithm+"=:"+base64.StdEncoding.EncodeToString(h.Sum(nil))+":")
+	w.ResponseWriter.WriteHeader(w.statusCode)
+	w.ResponseWriter.Write(w.buf.Bytes())
+	w.buf.Reset()
+}
+
+// Flush sends the response so far without a digest and flushes the underlying writer.
+func (w *digestResponseWriter) Flush() {
+	if !w.committed {
+		w.committed = true
+		if w.statusCode == 0 {
+			w.statusCode = http.StatusOK
+		}
+		w.ResponseWriter.WriteHeader(w.statusCode)
+		w.ResponseWriter.Write(w.buf.Bytes())
+		w.buf.Reset()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap allows http.ResponseController to reach the underlying writer.
+func (w *digestResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Digest returns a middleware that verifies the Content-MD5 and RFC 9530
+// Content-Digest headers of requests against the received body before it is
+// bound, rejecting corrupted uploads with 400 Bad Request.
+func Digest() puff.Middleware {
+	return createDigestMiddleware(DefaultDigestConfig)
+}
+
+// DigestWithConfig returns a Digest middleware with your configuration.
+func DigestWithConfig(config DigestConfig) puff.Middleware {
+	return createDigestMiddleware(config)
+}
@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ThePuffProject/puff"
+)
+
+func sha256Digest(body string) string {
+	sum := sha256.Sum256([]byte(body))
+	return "sha-256=:" + base64.StdEncoding.EncodeToString(sum[:]) + ":"
+}
+
+func TestDigest(t *testing.T) {
+	app := puff.DefaultApp("Digest Test")
+	app.Use(DigestWithConfig(DigestConfig{Required: true, MaxBodyBytes: 64, ResponseDigest: true}))
+	input := &struct {
+		Body struct {
+			Name string `json:"name"`
+		}
+	}{}
+	app.Post("/pizzas", input, func(c *puff.Context) {
+		c.SendResponse(puff.GenericResponse{Content: "created " + input.Body.Name})
+	})
+	app.SelfCheck()
+	handler := app.Handler()
+
+	body := `{"name":"margherita"}`
+	md5Sum := md5.Sum([]byte(body))
+	for _, tc := range []struct {
+		name    string
+		headers map[string]string
+		body    string
+		status  int
+	}{
+		{"valid", map[string]string{"Content-Digest": sha256Digest(body)}, body, http.StatusOK},
+		{"valid md5", map[string]string{"Content-MD5": base64.StdEncoding.EncodeToString(md5Sum[:])}, body, http.StatusOK},
+		{"invalid", map[string]string{"Content-Digest": sha256Digest(`{"name":"hawaii"}`)}, body, http.StatusBadRequest},
+		{"unsupported", map[string]string{"Content-Digest": "md5=:abc=:"}, body, http.StatusBadRequest},
+		{"missing", nil, body, http.StatusBadRequest},
+		{"too large", map[string]string{"Content-Digest": sha256Digest(strings.Repeat("a", 65))}, strings.Repeat("a", 65), http.StatusRequestEntityTooLarge},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/pizzas", strings.NewReader(tc.body))
+		req.Header.Set("Content-Type", "application/json")
+		for k, v := range tc.headers {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != tc.status {
+			t.Errorf("Expected %d for the %s digest, got %d %s", tc.status, tc.name, rec.Code, rec.Body.String())
+			continue
+		}
+		if tc.status != http.StatusOK {
+			continue
+		}
+		// the verified body is replayed to the binding of the handler.
+		if rec.Body.String() != "created margherita" {
+			t.Errorf("Expected the body to be replayed to the handler for the %s digest, got %s", tc.name, rec.Body.String())
+		}
+		if got := rec.Header().Get("Content-Digest"); got != sha256Digest(rec.Body.String()) {
+			t.Errorf("Expected the digest of the response, got %s", got)
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package middleware
+
+import (
+	"container/heap"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ThePuffProject/puff"
+)
+
+// FairQueueConfig is a struct to configure the FairQueue middleware.
+type FairQueueConfig struct {
+	// Skip allows skipping the middleware for specific requests.
+	// The function receives the request context and should return true if the middleware should be skipped.
+	Skip func(*puff.Context) bool
+	// Key identifies the client a request belongs to. Return an authenticated identity, e.g. a
+	// validated API key: a key taken straight from the request lets a client pick a new one for
+	// every request and escape its share.
+	// Default: the client IP without the port, namespaced by tenant.
+	Key func(*puff.Context) string
+	// Cost returns the relative cost of a request. Expensive route classes should return a higher cost.
+	// Default: 1 for every request.
+	Cost func(*puff.Context) int
+	// Weight returns the share of a client relative to other clients. A client with weight 2 is served
+	// twice as much as a client with weight 1. Default: 1 for every client.
+	Weight func(key string) int
+	// Concurrency is the number of requests handled at the same time. Default: 8.
+	Concurrency int
+	// MaxQueuePerClient is the number of requests a single client may have waiting. Requests beyond
+	// it are rejected with 429 Too Many Requests. Default: 32.
+	MaxQueuePerClient int
+	// MaxWait is the longest a request may wait for its turn before it is rejected with
+	// 503 Service Unavailable. Default: 30 seconds.
+	MaxWait time.Duration
+}
+
+// DefaultFairQueueConfig is a FairQueueConfig with specified default values.
+var DefaultFairQueueConfig FairQueueConfig = FairQueueConfig{
+	Key:               defaultFairQueueKey,
+	Cost:              func(*puff.Context) int { return 1 },
+	Weight:            func(string) int { return 1 },
+	Concurrency:       8,
+	MaxQueuePerClient: 32,
+	MaxWait:           30 * time.Second,
+	Skip:              DefaultSkipper,
+}
+
+func defaultFairQueueKey(c *puff.Context) string {
+	key := c.ClientIP()
+	if host, _, err := net.SplitHostPort(key); err == nil {
+		key = host
+	}
+	return c.Tenant().Key(key)
+}
+
+// fairQueueItem is a request waiting for its turn.
+type fairQueueItem struct {
+	client *fairQueueClient
+	finish float64
+	ready  chan struct{}
+	index  int
+}
+
+// fairQueueClient tracks the virtual finish time, queue length and requests
+// in flight of a client.
+type fairQueueClient struct {
+	key        string
+	lastFinish float64
+	queued     int
+	inFlight   int
+}
+
+// fairQueueHeap orders waiting requests by virtual finish time.
+type fairQueueHeap []*fairQueueItem
+
+func (h fairQueueHeap) Len() int           { return len(h) }
+func (h fairQueueHeap) Less(i, j int) bool { return h[i].finish < h[j].finish }
+func (h fairQueueHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+func (h *fairQueueHeap) Push(x any) {
+	item := x.(*fairQueueItem)
+	item.index = len(*h)
+	*h = append(*h, item)
+}
+func (h *fairQueueHeap) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	item.index = -1
+	return item
+}
+
+// fairQueue is a weighted fair queue (start-time fair queuing): each request
+// is tagged with a virtual finish time of max(virtual time, the client's last
+// finish) + cost/weight, and waiting requests are admitted in tag order. A
+// client sending many requests accumulates later tags and cannot starve
+// clients sending few.
+type fairQueue struct {
+	mu          sync.Mutex
+	config      FairQueueConfig
+	virtualTime float64
+	inFlight    int
+	clients     map[string]*fairQueueClient
+	waiting     fairQueueHeap
+}
+
+// acquire waits for the request's turn. It returns the client and the status
+// code to reject the request with, or 0 once the request may proceed.
+func (q *fairQueue) acquire(c *puff.Context) (*fairQueueClient, int) {
+	key := q.config.Key(c)
+	cost := max(q.config.Cost(c), 1)
+	weight := max(q.config.Weight(key), 1)
+
+	q.mu.Lock()
+	client, ok := q.clients[key]
+	if !ok {
+		client = &fairQueueClient{key: key}
+		q.clients[key] = client
+	}
+	start := max(q.virtualTime, client.lastFinish)
+	finish := start + float64(cost)/float64(weight)
+
+	if q.inFlight < q.config.Concurrency && q.waiting.Len() == 0 {
+		client.lastFinish = finish
+		client.inFlight++
+		q.virtualTime = start
+		q.inFlight++
+		q.mu.Unlock()
+		return client, 0
+	}
+	if client.queued >= q.config.MaxQueuePerClient {
+		q.mu.Unlock()
+		return client, http.StatusTooManyRequests
+	}
+	client.lastFinish = finish
+	client.queued++
+	item := &fairQueueItem{client: client, finish: finish, ready: make(chan struct{})}
+	heap.Push(&q.waiting, item)
+	q.mu.Unlock()
+
+	timer := time.NewTimer(q.config.MaxWait)
+	defer timer.Stop()
+	select {
+	case <-item.ready:
+		return client, 0
+	case <-c.Request.Context().Done():
+	case <-timer.C:
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if item.index == -1 {
+		// admitted while giving up; the slot has to be released by the caller.
+		return client, 0
+	}
+	heap.Remove(&q.waiting, item.index)
+	client.queued--
+	q.forgetIdle(client)
+	return client, http.StatusServiceUnavailable
+}
+
+// forgetIdle removes a client without queued or in-flight requests, so that
+// the clients map only holds active clients. q.mu must be held.
+func (q *fairQueue) forgetIdle(client *fairQueueClient) {
+	if client.queued == 0 && client.inFlight == 0 && q.clients[client.key] == client {
+		delete(q.clients, client.key)
+	}
+}
+
+// release frees the slot of a finished request of client and admits the next one.
+func (q *fairQueue) release(client *fairQueueClient) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.inFlight--
+	client.inFlight--
+	q.forgetIdle(client)
+	for q.inFlight < q.config.Concurrency && q.waiting.Len() > 0 {
+		item := heap.Pop(&q.waiting).(*fairQueueItem)
+		item.client.queued--
+		item.client.inFlight++
+		q.virtualTime = max(q.virtualTime, item.finish)
+		q.inFlight++
+		close(item.ready)
+	}
+	if q.inFlight == 0 {
+		// idle: virtual finish times are no longer relevant.
+		q.virtualTime = 0
+	}
+}
+
+// createFairQueueMiddleware is used to create a FairQueue middleware with a config.
+func createFairQueueMiddleware(config FairQueueConfig) puff.Middleware {
+	if config.Key == nil {
+		config.Key = DefaultFairQueueConfig.Key
+	}
+	if config.Cost == nil {
+		config.Cost = DefaultFairQueueConfig.Cost
+	}
+	if config.Weight == nil {
+		config.Weight = DefaultFairQueueConfig.Weight
+	}
+	if config.Concurrency <= 0 {
+		config.Concurrency = DefaultFairQueueConfig.Concurrency
+	}
+	if config.MaxQueuePerClient <= 0 {
+		config.MaxQueuePerClient = DefaultFairQueueConfig.MaxQueuePerClient
+	}
+	if config.MaxWait <= 0 {
+		config.MaxWait = DefaultFairQueueConfig.MaxWait
+	}
+	q := &fairQueue{config: config, clients: map[string]*fairQueueClient{}}
+
+	return func(next puff.HandlerFunc) puff.HandlerFunc {
+		return func(c *puff.Context) {
+			if config.Skip != nil && config.Skip(c) {
+				next(c)
+				return
+			}
+			client, status := q.acquire(c)
+			switch status {
+			case http.StatusTooManyRequests:
+				c.SetResponseHeader("Retry-After", "1")
+				c.Error(http.StatusTooManyRequests, "Too many queued requests.")
+				return
+			case http.StatusServiceUnavailable:
+				c.Error(http.StatusServiceUnavailable, "Timed out waiting for capacity.")
+				return
+			}
+			defer q.release(client)
+			next(c)
+		}
+	}
+}
+
+// FairQueue returns a FairQueue middleware with the default configuration.
+// Use one FairQueue per class of shared, expensive routes.
+func FairQueue() puff.Middleware {
+	return createFairQueueMiddleware(DefaultFairQueueConfig)
+}
+
+// FairQueueWithConfig returns a FairQueue middleware with the specified configuration.
+func FairQueueWithConfig(config FairQueueConfig) puff.Middleware {
+	return createFairQueueMiddleware(config)
+}
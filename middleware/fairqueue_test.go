@@ -0,0 +1,108 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ThePuffProject/puff"
+)
+
+func TestFairQueue(t *testing.T) {
+	app := puff.DefaultApp("FairQueue Test")
+	app.Use(FairQueueWithConfig(FairQueueConfig{Concurrency: 1, MaxQueuePerClient: 1, MaxWait: time.Second}))
+	started := make(chan struct{}, 2)
+	unblock := make(chan struct{})
+	app.Get("/", nil, func(c *puff.Context) {
+		started <- struct{}{}
+		<-unblock
+		c.SendResponse(puff.GenericResponse{Content: "ok"})
+	})
+	handler := app.Handler()
+	send := func(remoteAddr, token string) int {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = remoteAddr
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	var wg sync.WaitGroup
+	codes := make([]int, 2)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		codes[0] = send("192.0.2.1:1000", "")
+	}()
+	<-started
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		codes[1] = send("192.0.2.1:2000", "")
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	// the queued request fills the client's queue whatever the port or token.
+	if code := send("192.0.2.1:3000", ""); code != http.StatusTooManyRequests {
+		t.Errorf("Expected another port of the same client to be rejected with 429, got %d", code)
+	}
+	if code := send("192.0.2.1:4000", "made-up"); code != http.StatusTooManyRequests {
+		t.Errorf("Expected an unvalidated bearer token not to escape the client's queue, got %d", code)
+	}
+
+	close(unblock)
+	wg.Wait()
+	if codes[0] != http.StatusOK || codes[1] != http.StatusOK {
+		t.Errorf("Expected both admitted requests to succeed, got %v", codes)
+	}
+}
+
+func TestFairQueue_ForgetsIdleClients(t *testing.T) {
+	q := &fairQueue{config: FairQueueConfig{
+		Key:               defaultFairQueueKey,
+		Cost:              DefaultFairQueueConfig.Cost,
+		Weight:            DefaultFairQueueConfig.Weight,
+		Concurrency:       2,
+		MaxQueuePerClient: 1,
+		MaxWait:           time.Millisecond,
+	}, clients: map[string]*fairQueueClient{}}
+	app := puff.DefaultApp("FairQueue Test")
+	context := func(remoteAddr string) *puff.Context {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = remoteAddr
+		return puff.NewContext(httptest.NewRecorder(), req, app)
+	}
+
+	// a long-lived client keeps the queue busy while others come and go.
+	busy, _ := q.acquire(context("192.0.2.1:1000"))
+	for i := range 100 {
+		client, status := q.acquire(context(fmt.Sprintf("198.51.100.%d:%d", i%10, 1000+i)))
+		if status != 0 {
+			t.Fatalf("Expected request %d to be admitted, got %d", i, status)
+		}
+		q.release(client)
+	}
+	if len(q.clients) != 1 {
+		t.Errorf("Expected only the busy client to be tracked, got %d clients", len(q.clients))
+	}
+
+	// clients giving up in the queue are forgotten as well.
+	other, _ := q.acquire(context("192.0.2.2:1000"))
+	if _, status := q.acquire(context("192.0.2.3:1000")); status != http.StatusServiceUnavailable {
+		t.Errorf("Expected the queued request to time out with 503, got %d", status)
+	}
+	if len(q.clients) != 2 {
+		t.Errorf("Expected the timed out client to be forgotten, got %d clients", len(q.clients))
+	}
+	q.release(other)
+	q.release(busy)
+	if len(q.clients) != 0 {
+		t.Errorf("Expected no clients to be tracked once idle, got %d", len(q.clients))
+	}
+}
@@ -0,0 +1,176 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/ThePuffProject/puff"
+)
+
+// HeaderViolation names why the HeaderHygiene middleware rejected a request.
+type HeaderViolation string
+
+const (
+	// ViolationAmbiguousLength is used for requests whose body length is ambiguous: both
+	// Transfer-Encoding and Content-Length, several Content-Length values, or a
+	// Transfer-Encoding other than chunked. Such requests can smuggle a second request
+	// past a proxy that frames the body differently. net/http already rejects or
+	// normalizes them (see HeaderHygiene), so it is only reported for requests
+	// reaching the middleware through another server or built by hand.
+	ViolationAmbiguousLength HeaderViolation = "ambiguous_length"
+	// ViolationObsFold is used for header names or values containing line breaks or other
+	// control characters, as left by obsolete line folding (obs-fold). net/http joins
+	// folded lines with a space and rejects control characters itself, so, like
+	// ViolationAmbiguousLength, it is not reported behind net/http.
+	ViolationObsFold HeaderViolation = "obs_fold"
+	// ViolationTooManyHeaders is used for requests with more header fields than allowed.
+	ViolationTooManyHeaders HeaderViolation = "too_many_headers"
+)
+
+// HeaderHygieneMetrics counts the requests rejected by HeaderHygiene by violation.
+// It is safe for concurrent use; share one between middlewares to aggregate counts.
+type HeaderHygieneMetrics struct {
+	mu     sync.Mutex
+	counts map[HeaderViolation]uint64
+}
+
+// NewHeaderHygieneMetrics creates an empty HeaderHygieneMetrics.
+func NewHeaderHygieneMetrics() *HeaderHygieneMetrics {
+	return &HeaderHygieneMetrics{counts: map[HeaderViolation]uint64{}}
+}
+
+// Inc increments the count of violation.
+func (m *HeaderHygieneMetrics) Inc(violation HeaderViolation) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.counts[violation]++
+}
+
+// Counts returns a snapshot of the rejected requests by violation, e.g. to export them as metrics.
+func (m *HeaderHygieneMetrics) Counts() map[HeaderViolation]uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	counts := make(map[HeaderViolation]uint64, len(m.counts))
+	for violation, n := range m.counts {
+		counts[violation] = n
+	}
+	return counts
+}
+
+// HeaderHygieneConfig is a struct to configure the HeaderHygiene middleware.
+type HeaderHygieneConfig struct {
+	// Skip allows skipping the middleware for specific requests.
+	// The function receives the request context and should return true if the middleware should be skipped.
+	Skip func(*puff.Context) bool
+	// MaxHeaders is the maximum number of header fields of a request, counting every value
+	// of a repeated header. Default: 100.
+	MaxHeaders int
+	// Metrics counts the rejected requests. Default: a new HeaderHygieneMetrics.
+	Metrics *HeaderHygieneMetrics
+	// OnViolation is called for every rejected request, e.g. to increment a counter of
+	// your metrics system or to block the client.
+	OnViolation func(c *puff.Context, violation HeaderViolation)
+}
+
+// DefaultHeaderHygieneConfig is a HeaderHygieneConfig with specified default values.
+var DefaultHeaderHygieneConfig HeaderHygieneConfig = HeaderHygieneConfig{
+	MaxHeaders: 100,
+	Skip:       DefaultSkipper,
+}
+
+// checkHeaders returns the first violation of req, or "" if there is none.
+func checkHeaders(req *http.Request, maxHeaders int) HeaderViolation {
+	contentLengths := req.Header.Values("Content-Length")
+	if len(contentLengths) > 1 || (len(contentLengths) == 1 && len(req.TransferEncoding) > 0) {
+		return ViolationAmbiguousLength
+	}
+	if len(req.TransferEncoding) > 1 || (len(req.TransferEncoding) == 1 && req.TransferEncoding[0] != "chunked") {
+		return ViolationAmbiguousLength
+	}
+	if req.Header.Get("Transfer-Encoding") != "" && len(contentLengths) > 0 {
+		return ViolationAmbiguousLength
+	}
+	count := 0
+	for name, values := range req.Header {
+		if hasControlChars(name) || strings.ContainsAny(name, " \t") {
+			return ViolationObsFold
+		}
+		for _, v := range values {
+			if hasControlChars(v) {
+				return ViolationObsFold
+			}
+		}
+		count += len(values)
+	}
+	if count > maxHeaders {
+		return ViolationTooManyHeaders
+	}
+	return ""
+}
+
+// hasControlChars reports whether s contains control characters other than horizontal tab.
+func hasControlChars(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if (s[i] < ' ' && s[i] != '\t') || s[i] == 0x7f {
+			return true
+		}
+	}
+	return false
+}
+
+// createHeaderHygieneMiddleware is used to create a HeaderHygiene middleware with a config.
+func createHeaderHygieneMiddleware(config HeaderHygieneConfig) puff.Middleware {
+	if config.MaxHeaders <= 0 {
+		config.MaxHeaders = DefaultHeaderHygieneConfig.MaxHeaders
+	}
+	if config.Metrics == nil {
+		config.Metrics = NewHeaderHygieneMetrics()
+	}
+	return func(next puff.HandlerFunc) puff.HandlerFunc {
+		return func(c *puff.Context) {
+			if config.Skip != nil && config.Skip(c) {
+				next(c)
+				return
+			}
+			violation := checkHeaders(c.Request, config.MaxHeaders)
+			if violation == "" {
+				next(c)
+				return
+			}
+			config.Metrics.Inc(violation)
+			if config.OnViolation != nil {
+				config.OnViolation(c, violation)
+			}
+			slog.Warn("Request rejected by header hygiene",
+				slog.String("request_id", c.GetRequestID()),
+				slog.String("violation", string(violation)),
+				slog.String("client_ip", c.ClientIP()),
+			)
+			// the rest of the connection cannot be trusted to be framed correctly.
+			c.SetResponseHeader("Connection", "close")
+			c.BadRequest("Malformed request headers.")
+		}
+	}
+}
+
+// HeaderHygiene returns a middleware rejecting requests with ambiguous body
+// framing, folded headers or too many headers with 400 Bad Request, for
+// applications receiving untrusted traffic without a proxy in front.
+//
+// The framing and folding checks cannot fire behind net/http, which handles
+// these requests before any handler runs: it rejects differing Content-Length
+// values with 400 and transfer codings other than chunked with 501, drops
+// Content-Length when Transfer-Encoding is chunked, and joins folded header
+// lines with a space. Served by net/http, the middleware therefore only limits
+// the number of headers; the other checks apply to requests reaching it
+// through other servers or adapters.
+func HeaderHygiene() puff.Middleware {
+	return createHeaderHygieneMiddleware(DefaultHeaderHygieneConfig)
+}
+
+// HeaderHygieneWithConfig returns a HeaderHygiene middleware with your configuration.
+func HeaderHygieneWithConfig(config HeaderHygieneConfig) puff.Middleware {
+	return createHeaderHygieneMiddleware(config)
+}
@@ -0,0 +1,140 @@
+package middleware
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ThePuffProject/puff"
+)
+
+func TestCheckHeaders(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		header    http.Header
+		encoding  []string
+		violation HeaderViolation
+	}{
+		{"clean", http.Header{"Content-Length": {"3"}}, nil, ""},
+		{"chunked", nil, []string{"chunked"}, ""},
+		{"several content lengths", http.Header{"Content-Length": {"3", "4"}}, nil, ViolationAmbiguousLength},
+		{"content length and chunked", http.Header{"Content-Length": {"3"}}, []string{"chunked"}, ViolationAmbiguousLength},
+		{"several transfer encodings", nil, []string{"gzip", "chunked"}, ViolationAmbiguousLength},
+		{"unknown transfer encoding", nil, []string{"gzip"}, ViolationAmbiguousLength},
+		{"transfer encoding header and content length", http.Header{"Transfer-Encoding": {"chunked"}, "Content-Length": {"3"}}, nil, ViolationAmbiguousLength},
+		{"folded value", http.Header{"X-Pizza": {"margherita\r\n hawaii"}}, nil, ViolationObsFold},
+		{"control character in value", http.Header{"X-Pizza": {"margherita\x7f"}}, nil, ViolationObsFold},
+		{"space in name", http.Header{"X Pizza": {"margherita"}}, nil, ViolationObsFold},
+		{"tab in value", http.Header{"X-Pizza": {"margherita\thawaii"}}, nil, ""},
+		{"too many headers", http.Header{"X-Pizza": {"1", "2", "3"}}, nil, ViolationTooManyHeaders},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		req.Header = tc.header
+		if req.Header == nil {
+			req.Header = http.Header{}
+		}
+		req.TransferEncoding = tc.encoding
+		if violation := checkHeaders(req, 2); violation != tc.violation {
+			t.Errorf("Expected violation %q for %s, got %q", tc.violation, tc.name, violation)
+		}
+	}
+}
+
+func TestHeaderHygiene(t *testing.T) {
+	app := puff.DefaultApp("Header Hygiene Test")
+	metrics := NewHeaderHygieneMetrics()
+	var violations []HeaderViolation
+	app.Use(HeaderHygieneWithConfig(HeaderHygieneConfig{
+		MaxHeaders: 5,
+		Metrics:    metrics,
+		OnViolation: func(c *puff.Context, violation HeaderViolation) {
+			violations = append(violations, violation)
+		},
+	}))
+	app.Get("/", nil, func(c *puff.Context) {
+		c.SendResponse(puff.GenericResponse{Content: "ok"})
+	})
+	app.SelfCheck()
+	handler := app.Handler()
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 for clean headers, got %d", rec.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	for i := range 6 {
+		req.Header.Add("X-Pizza", fmt.Sprint(i))
+	}
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("Expected 400 for too many headers, got %d", rec.Code)
+	}
+	if rec.Header().Get("Connection") != "close" {
+		t.Error("Expected the connection to be closed after a violation")
+	}
+	if n := metrics.Counts()[ViolationTooManyHeaders]; n != 1 {
+		t.Errorf("Expected 1 counted violation, got %d", n)
+	}
+	if len(violations) != 1 || violations[0] != ViolationTooManyHeaders {
+		t.Errorf("Expected OnViolation to be called once, got %v", violations)
+	}
+}
+
+func TestHeaderHygiene_Server(t *testing.T) {
+	app := puff.DefaultApp("Header Hygiene Server Test")
+	metrics := NewHeaderHygieneMetrics()
+	app.Use(HeaderHygieneWithConfig(HeaderHygieneConfig{MaxHeaders: 5, Metrics: metrics}))
+	app.Post("/", nil, func(c *puff.Context) {
+		body, _ := c.GetBody()
+		c.SendResponse(puff.GenericResponse{Content: c.GetRequestHeader("X-Folded") + string(body)})
+	})
+	server := httptest.NewServer(app.Handler())
+	defer server.Close()
+
+	send := func(raw string) (int, string) {
+		conn, err := net.Dial("tcp", server.Listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		fmt.Fprint(conn, raw)
+		res, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		body, _ := io.ReadAll(res.Body)
+		return res.StatusCode, string(body)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		raw    string
+		status int
+		body   string
+	}{
+		{"too many headers", "POST / HTTP/1.1\r\nHost: x\r\nX-A: 1\r\nX-A: 2\r\nX-A: 3\r\nX-A: 4\r\nX-A: 5\r\nX-A: 6\r\nContent-Length: 0\r\n\r\n", http.StatusBadRequest, ""},
+		// net/http handles these before the middleware runs.
+		{"differing content lengths", "POST / HTTP/1.1\r\nHost: x\r\nContent-Length: 3\r\nContent-Length: 4\r\n\r\nabcd", http.StatusBadRequest, ""},
+		{"unknown transfer encoding", "POST / HTTP/1.1\r\nHost: x\r\nTransfer-Encoding: gzip\r\n\r\n", http.StatusNotImplemented, ""},
+		{"content length and chunked", "POST / HTTP/1.1\r\nHost: x\r\nTransfer-Encoding: chunked\r\nContent-Length: 3\r\n\r\n2\r\nok\r\n0\r\n\r\n", http.StatusOK, "ok"},
+		{"folded header", "POST / HTTP/1.1\r\nHost: x\r\nX-Folded: a\r\n b\r\nContent-Length: 0\r\n\r\n", http.StatusOK, "a b"},
+	} {
+		status, body := send(tc.raw)
+		if status != tc.status || (tc.body != "" && body != tc.body) {
+			t.Errorf("Expected %d %q for %s, got %d %q", tc.status, tc.body, tc.name, status, body)
+		}
+	}
+	counts := metrics.Counts()
+	if counts[ViolationTooManyHeaders] != 1 || counts[ViolationAmbiguousLength] != 0 || counts[ViolationObsFold] != 0 {
+		t.Errorf("Expected only the header count to be enforced behind net/http, got %v", counts)
+	}
+}
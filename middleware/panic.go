@@ -40,6 +40,7 @@ func createPanicMiddleware(pc PanicConfig) puff.Middleware {
 			defer func() {
 				a := recover()
 				if a != nil {
+					c.RecordPanic(a)
 					res := pc.FormatErrorResponse(*c, a)
 					c.SendResponse(res)
 				}
@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/ThePuffProject/puff"
+)
+
+// UnitOfWork is a resource opened for the lifetime of a single request,
+// such as a database transaction. It is committed if the request succeeds
+// and rolled back otherwise.
+type UnitOfWork interface {
+	Commit() error
+	Rollback() error
+}
+
+// UnitOfWorkConfig is a struct to configure the UnitOfWork middleware.
+type UnitOfWorkConfig[T UnitOfWork] struct {
+	// Skip allows skipping the middleware for specific requests.
+	// The function receives the request context and should return true if the middleware should be skipped.
+	Skip func(*puff.Context) bool
+	// Begin opens the unit of work for the request. If it returns an error, the handler
+	// is not called and a 500 response is sent.
+	Begin func(*puff.Context) (T, error)
+	// ShouldCommit decides, after the handler has run, whether the unit of work is committed.
+	// Default: commit if the response status code is below 400.
+	ShouldCommit func(*puff.Context) bool
+	// ContextKey is the key the unit of work is stored under on Context. Default: "UnitOfWork".
+	ContextKey string
+}
+
+// DefaultShouldCommit commits the unit of work if the response status code is below 400.
+func DefaultShouldCommit(c *puff.Context) bool {
+	return c.GetStatusCode() < http.StatusBadRequest
+}
+
+// createUnitOfWorkMiddleware is used to create a UnitOfWork middleware with a config.
+func createUnitOfWorkMiddleware[T UnitOfWork](config UnitOfWorkConfig[T]) puff.Middleware {
+	if config.ShouldCommit == nil {
+		config.ShouldCommit = DefaultShouldCommit
+	}
+	if config.ContextKey == "" {
+		config.ContextKey = "UnitOfWork"
+	}
+	return func(next puff.HandlerFunc) puff.HandlerFunc {
+		return func(c *puff.Context) {
+			if config.Skip != nil && config.Skip(c) {
+				next(c)
+				return
+			}
+			uow, err := config.Begin(c)
+			if err != nil {
+				slog.Error("UnitOfWork could not be started", slog.String("error", err.Error()))
+				c.InternalServerError("An unexpected error occured.")
+				return
+			}
+			c.Set(config.ContextKey, uow)
+
+			defer func() {
+				if a := recover(); a != nil {
+					// the handler panicked: roll back and let the panic continue to the panic middleware.
+					if err := uow.Rollback(); err != nil {
+						slog.Error("UnitOfWork rollback failed", slog.String("error", err.Error()))
+					}
+					panic(a)
+				}
+				if config.ShouldCommit(c) {
+					if err := uow.Commit(); err != nil {
+						slog.Error("UnitOfWork commit failed", slog.String("error", err.Error()))
+					}
+					return
+				}
+				if err := uow.Rollback(); err != nil {
+					slog.Error("UnitOfWork rollback failed", slog.String("error", err.Error()))
+				}
+			}()
+			next(c)
+		}
+	}
+}
+
+// UnitOfWorkWithConfig returns a middleware that opens a unit of work per request using
+// config.Begin, places it on Context and commits or rolls it back once the handler returns.
+// A panicking handler always results in a rollback.
+func UnitOfWorkWithConfig[T UnitOfWork](config UnitOfWorkConfig[T]) puff.Middleware {
+	return createUnitOfWorkMiddleware(config)
+}
+
+// GetUnitOfWork returns the unit of work stored on Context under key (use "" for the default key).
+// The boolean is false if no unit of work of type T is present.
+func GetUnitOfWork[T UnitOfWork](c *puff.Context, key string) (T, bool) {
+	if key == "" {
+		key = "UnitOfWork"
+	}
+	uow, ok := c.Get(key).(T)
+	return uow, ok
+}
@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ThePuffProject/puff"
+)
+
+// fakeTx is a UnitOfWork recording how it was finished.
+type fakeTx struct {
+	committed  bool
+	rolledBack bool
+}
+
+func (tx *fakeTx) Commit() error {
+	tx.committed = true
+	return nil
+}
+
+func (tx *fakeTx) Rollback() error {
+	tx.rolledBack = true
+	return nil
+}
+
+func TestUnitOfWork(t *testing.T) {
+	app := puff.DefaultApp("UnitOfWork Test")
+	var tx *fakeTx
+	app.Use(UnitOfWorkWithConfig(UnitOfWorkConfig[*fakeTx]{
+		Begin: func(c *puff.Context) (*fakeTx, error) {
+			if c.GetRequestHeader("X-Database") == "down" {
+				return nil, errors.New("connection refused")
+			}
+			tx = &fakeTx{}
+			return tx, nil
+		},
+	}))
+	app.Use(Panic())
+	handled := false
+	app.Get("/{status}", &struct {
+		Status int `kind:"path"`
+	}{}, func(c *puff.Context) {
+		handled = true
+		current, ok := GetUnitOfWork[*fakeTx](c, "")
+		if !ok || current != tx {
+			t.Error("Expected the unit of work to be available on the context")
+		}
+		status := c.PathParams()["status"]
+		if status == "0" {
+			panic("handler bug")
+		}
+		c.SendResponse(puff.GenericResponse{StatusCode: map[string]int{"200": 200, "201": 201, "409": 409}[status]})
+	})
+	handler := app.Handler()
+	send := func(path string, header string) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("X-Database", header)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	for _, tc := range []struct {
+		path      string
+		status    int
+		committed bool
+	}{
+		{"/200", http.StatusOK, true},
+		{"/201", http.StatusCreated, true},
+		{"/409", http.StatusConflict, false},
+		{"/0", http.StatusInternalServerError, false},
+	} {
+		tx = nil
+		if status := send(tc.path, ""); status != tc.status {
+			t.Errorf("Expected %d for %s, got %d", tc.status, tc.path, status)
+		}
+		if tx == nil || tx.committed != tc.committed || tx.rolledBack == tc.committed {
+			t.Errorf("Expected the unit of work for %s to be committed: %t, got %+v", tc.path, tc.committed, tx)
+		}
+	}
+
+	handled = false
+	if status := send("/200", "down"); status != http.StatusInternalServerError || handled {
+		t.Errorf("Expected a failing Begin to answer 500 without calling the handler, got %d (handled: %t)", status, handled)
+	}
+}
@@ -0,0 +1,163 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ThePuffProject/puff"
+)
+
+// DedupStore remembers the event IDs of webhook deliveries that were already received.
+type DedupStore interface {
+	// Claim records id for ttl. It reports false if id is already recorded,
+	// i.e. the delivery is a duplicate.
+	Claim(id string, ttl time.Duration) (bool, error)
+	// Release forgets id, so a redelivery of a failed event is processed again.
+	Release(id string) error
+}
+
+// MemoryDedupStore is a DedupStore keeping event IDs in memory. It only
+// deduplicates deliveries received by the same process; use a shared store,
+// e.g. backed by Redis, when running several instances.
+type MemoryDedupStore struct {
+	mu     sync.Mutex
+	seen   map[string]time.Time
+	claims int
+}
+
+// NewMemoryDedupStore creates an empty MemoryDedupStore.
+func NewMemoryDedupStore() *MemoryDedupStore {
+	return &MemoryDedupStore{seen: map[string]time.Time{}}
+}
+
+// Claim records id until ttl passes.
+func (m *MemoryDedupStore) Claim(id string, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	m.claims++
+	if m.claims%1024 == 0 {
+		for seenID, expires := range m.seen {
+			if now.After(expires) {
+				delete(m.seen, seenID)
+			}
+		}
+	}
+	if expires, ok := m.seen[id]; ok && now.Before(expires) {
+		return false, nil
+	}
+	m.seen[id] = now.Add(ttl)
+	return true, nil
+}
+
+// Release forgets id.
+func (m *MemoryDedupStore) Release(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.seen, id)
+	return nil
+}
+
+// WebhookDedupConfig is a struct to configure the WebhookDedup middleware.
+type WebhookDedupConfig struct {
+	// Skip allows skipping the middleware for specific requests.
+	// The function receives the request context and should return true if the middleware should be skipped.
+	Skip func(*puff.Context) bool
+	// Store remembers the received event IDs. Default: a new MemoryDedupStore.
+	Store DedupStore
+	// EventID returns the ID of the delivered event, or "" if it has none.
+	// Default: the first of Headers sent with the request.
+	EventID func(*puff.Context) string
+	// Headers are the request headers holding the event ID, in order of preference.
+	// Default: Webhook-Id, X-GitHub-Delivery, X-Shopify-Webhook-Id, X-Event-Id and Idempotency-Key.
+	Headers []string
+	// TTL is how long an event ID is remembered. Default: 24 hours.
+	TTL time.Duration
+	// KeepFailures keeps the event IDs of deliveries answered with a 5xx status code
+	// or whose handler panicked.
+	// By default they are released, so the provider's redelivery is processed again.
+	KeepFailures bool
+}
+
+// DefaultWebhookDedupConfig is a WebhookDedupConfig with specified default values.
+var DefaultWebhookDedupConfig WebhookDedupConfig = WebhookDedupConfig{
+	Headers: []string{"Webhook-Id", "X-GitHub-Delivery", "X-Shopify-Webhook-Id", "X-Event-Id", "Idempotency-Key"},
+	TTL:     24 * time.Hour,
+	Skip:    DefaultSkipper,
+}
+
+// createWebhookDedupMiddleware is used to create a WebhookDedup middleware with a config.
+func createWebhookDedupMiddleware(config WebhookDedupConfig) puff.Middleware {
+	if config.Store == nil {
+		config.Store = NewMemoryDedupStore()
+	}
+	if config.Headers == nil {
+		config.Headers = DefaultWebhookDedupConfig.Headers
+	}
+	if config.TTL <= 0 {
+		config.TTL = DefaultWebhookDedupConfig.TTL
+	}
+	if config.EventID == nil {
+		config.EventID = func(c *puff.Context) string {
+			for _, h := range config.Headers {
+				if id := c.GetRequestHeader(h); id != "" {
+					return id
+				}
+			}
+			return ""
+		}
+	}
+	return func(next puff.HandlerFunc) puff.HandlerFunc {
+		return func(c *puff.Context) {
+			if config.Skip != nil && config.Skip(c) {
+				next(c)
+				return
+			}
+			id := config.EventID(c)
+			if id == "" {
+				next(c)
+				return
+			}
+			claimed, err := config.Store.Claim(id, config.TTL)
+			if err != nil {
+				// processing a delivery twice is better than dropping it.
+				slog.Error("Webhook deduplication failed", slog.String("id", id), slog.String("error", err.Error()))
+				next(c)
+				return
+			}
+			if !claimed {
+				c.SetResponseHeader("X-Webhook-Duplicate", "true")
+				c.SendResponse(puff.JSONResponse{StatusCode: http.StatusOK, Content: map[string]any{"duplicate": true, "id": id}})
+				return
+			}
+			defer func() {
+				a := recover()
+				// a panicking handler failed the delivery, but its status is not written yet.
+				if !config.KeepFailures && (a != nil || c.GetStatusCode() >= http.StatusInternalServerError) {
+					if err := config.Store.Release(id); err != nil {
+						slog.Error("Releasing webhook event failed", slog.String("id", id), slog.String("error", err.Error()))
+					}
+				}
+				if a != nil {
+					panic(a)
+				}
+			}()
+			next(c)
+		}
+	}
+}
+
+// WebhookDedup returns a WebhookDedup middleware with the default configuration.
+// Deliveries whose event ID was already received within the TTL are answered
+// with 200 without running the handler, since webhook providers redeliver
+// events aggressively.
+func WebhookDedup() puff.Middleware {
+	return createWebhookDedupMiddleware(DefaultWebhookDedupConfig)
+}
+
+// WebhookDedupWithConfig returns a WebhookDedup middleware with the specified configuration.
+func WebhookDedupWithConfig(config WebhookDedupConfig) puff.Middleware {
+	return createWebhookDedupMiddleware(config)
+}
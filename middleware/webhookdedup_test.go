@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ThePuffProject/puff"
+)
+
+func TestWebhookDedup(t *testing.T) {
+	app := puff.DefaultApp("WebhookDedup Test")
+	app.Use(WebhookDedup())
+	processed := map[string]int{}
+	app.Post("/hooks", nil, func(c *puff.Context) {
+		id := c.GetRequestHeader("Webhook-Id")
+		processed[id]++
+		switch id {
+		case "fails":
+			c.SendResponse(puff.GenericResponse{StatusCode: http.StatusBadGateway, Content: "upstream down"})
+		case "panics":
+			panic("handler bug")
+		default:
+			c.SendResponse(puff.GenericResponse{Content: "ok"})
+		}
+	})
+	app.SelfCheck()
+	handler := app.Handler()
+	deliver := func(id string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/hooks", nil)
+		req.Header.Set("Webhook-Id", id)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	deliver("ok")
+	if rec := deliver("ok"); rec.Code != http.StatusOK || rec.Header().Get("X-Webhook-Duplicate") != "true" {
+		t.Errorf("Expected the redelivery to be answered as a duplicate, got %d %v", rec.Code, rec.Header())
+	}
+	if processed["ok"] != 1 {
+		t.Errorf("Expected the event to be processed once, got %d", processed["ok"])
+	}
+
+	for _, id := range []string{"fails", "panics"} {
+		if rec := deliver(id); rec.Code < http.StatusInternalServerError {
+			t.Errorf("Expected %s to fail, got %d", id, rec.Code)
+		}
+		deliver(id)
+		if processed[id] != 2 {
+			t.Errorf("Expected the redelivery of %s to be processed again, got %d", id, processed[id])
+		}
+	}
+}
+
+func TestWebhookDedup_KeepFailures(t *testing.T) {
+	app := puff.DefaultApp("WebhookDedup Test")
+	app.Use(WebhookDedupWithConfig(WebhookDedupConfig{KeepFailures: true}))
+	calls := 0
+	app.Post("/hooks", nil, func(c *puff.Context) {
+		calls++
+		panic("handler bug")
+	})
+	app.SelfCheck()
+	handler := app.Handler()
+	for range 2 {
+		req := httptest.NewRequest(http.MethodPost, "/hooks", nil)
+		req.Header.Set("X-GitHub-Delivery", "1")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	if calls != 1 {
+		t.Errorf("Expected the failed event to be kept, got %d calls", calls)
+	}
+}
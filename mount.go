@@ -0,0 +1,104 @@
+package puff
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// mountMethods are the methods routed to handlers mounted with MountHandler or Handle.
+var mountMethods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+	http.MethodOptions,
+}
+
+// MountHandler delegates every request under prefix to h with the prefix
+// (including the prefixes of the router and its parents) stripped from the
+// path, like http.StripPrefix. It lets handlers such as promhttp or those of
+// third-party libraries live inside the application while still running the
+// middlewares of the router. Use Handle for handlers expecting the full path.
+//
+// The routes are excluded from OpenAPI. Add route middlewares with Use on the
+// returned routes.
+func (r *Router) MountHandler(prefix string, h http.Handler) []*Route {
+	return r.mount(prefix, h, true)
+}
+
+// Handle delegates every request under prefix to h with the path unchanged,
+// e.g. for net/http/pprof, whose handlers expect the /debug/pprof/ path:
+//
+//	router.Handle("/debug/pprof", http.HandlerFunc(pprof.Index))
+//
+// See MountHandler.
+func (r *Router) Handle(prefix string, h http.Handler) []*Route {
+	return r.mount(prefix, h, false)
+}
+
+// MountApp serves child under prefix. Unlike IncludeRouter, the child keeps
+// its own middlewares, error config, path policy and OpenAPI document, which is
+// served at prefix + child's DocsURL, e.g. /admin/docs. Set the child's DocsURL
+// to "" to leave it undocumented. The middlewares of a's root router still run
+// around every request to the child.
+//
+// The routes of child are prefixed with prefix, so the URLs of its named
+// routes point under it. child is prepared together with a, and must not be
+// served on its own.
+func (a *PuffApp) MountApp(prefix string, child *PuffApp) []*Route {
+	prefix = strings.TrimSuffix(prefix, "/")
+	child.RootRouter.Prefix = a.RootRouter.Prefix + prefix + child.RootRouter.Prefix
+	a.mounted = append(a.mounted, child)
+	routes := a.RootRouter.mount(prefix, child.RootRouter, false)
+	if a.RootRouter.serving() {
+		child.prepare()
+	}
+	return routes
+}
+
+// mount registers the routes of MountHandler and Handle.
+func (r *Router) mount(prefix string, h http.Handler, strip bool) []*Route {
+	prefix = strings.TrimSuffix(prefix, "/")
+	handler := func(c *Context) {
+		w, req := c.Raw()
+		if strip {
+			req = stripMountPrefix(req, strings.TrimSuffix(c.route.fullPath, "/*path"))
+		}
+		h.ServeHTTP(w, req)
+	}
+	var routes []*Route
+	for _, method := range mountMethods {
+		for _, p := range []string{prefix, prefix + "/", prefix + "/*path"} {
+			if p == "" {
+				continue
+			}
+			route := r.registerRoute(method, p, handler, nil)
+			route.ExcludeFromOpenAPI = true
+			routes = append(routes, route)
+		}
+	}
+	return routes
+}
+
+// stripMountPrefix returns a shallow copy of req with prefix removed from
+// the path. The remaining path always starts with a slash.
+func stripMountPrefix(req *http.Request, prefix string) *http.Request {
+	prefix = strings.TrimSuffix(prefix, "/")
+	path := req.URL.Path
+	if len(path) >= len(prefix) && strings.EqualFold(path[:len(prefix)], prefix) {
+		path = path[len(prefix):]
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	r2 := new(http.Request)
+	*r2 = *req
+	r2.URL = new(url.URL)
+	*r2.URL = *req.URL
+	r2.URL.Path = path
+	r2.URL.RawPath = ""
+	return r2
+}
@@ -0,0 +1,113 @@
+package puff
+
+import (
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+)
+
+// MultipartPart is a single part of a MultipartResponse.
+type MultipartPart struct {
+	// ContentType is the Content-Type of the part.
+	ContentType string
+	// Header holds additional part headers, e.g. Content-ID or Content-Disposition.
+	Header http.Header
+	// Content is the body of the part. It is closed after writing if it is an io.Closer.
+	Content io.Reader
+}
+
+// ByteRangePart returns a part for a multipart/byteranges response holding the
+// bytes first to last (inclusive) of a representation of size bytes.
+func ByteRangePart(contentType string, first, last, size int64, content io.Reader) MultipartPart {
+	return MultipartPart{
+		ContentType: contentType,
+		Header:      http.Header{"Content-Range": {fmt.Sprintf("bytes %d-%d/%d", first, last, size)}},
+		Content:     content,
+	}
+}
+
+// MultipartResponse represents a multipart/mixed, multipart/byteranges or other
+// multipart response, e.g. a batch API returning several documents at once.
+// Parts are streamed to the client one after another.
+type MultipartResponse struct {
+	StatusCode int
+	// Subtype is the multipart subtype. Default: "mixed".
+	Subtype string
+	// Boundary is the part boundary. Default: a random boundary.
+	Boundary string
+	// Parts are written first.
+	Parts []MultipartPart
+	// Stream, if set, is called after Parts are written to write further parts
+	// as they are produced. Every call to write sends and flushes one part.
+	Stream func(write func(MultipartPart) error) error
+}
+
+// GetStatusCode returns 0 since the status code is written by WriteContent,
+// after the Content-Type with the boundary is set.
+func (m MultipartResponse) GetStatusCode() int {
+	return 0
+}
+
+// GetContentType returns the Content-Type without the boundary, which is set by WriteContent.
+func (m MultipartResponse) GetContentType() string {
+	return "multipart/" + m.subtype()
+}
+
+func (m MultipartResponse) subtype() string {
+	if m.Subtype == "" {
+		return "mixed"
+	}
+	return m.Subtype
+}
+
+// WriteContent writes the parts of the multipart response.
+func (m MultipartResponse) WriteContent(c *Context) error {
+	mw := multipart.NewWriter(c.ResponseWriter)
+	if m.Boundary != "" {
+		if err := mw.SetBoundary(m.Boundary); err != nil {
+			return err
+		}
+	}
+	c.SetContentType(m.GetContentType() + "; boundary=" + mw.Boundary())
+	c.SetStatusCode(resolveStatusCode(m.StatusCode, 200))
+
+	flusher, _ := c.ResponseWriter.(http.Flusher)
+	write := func(part MultipartPart) error {
+		header := textproto.MIMEHeader{}
+		for k, v := range part.Header {
+			header[textproto.CanonicalMIMEHeaderKey(k)] = v
+		}
+		if part.ContentType != "" {
+			header.Set("Content-Type", part.ContentType)
+		}
+		w, err := mw.CreatePart(header)
+		if err != nil {
+			return err
+		}
+		if part.Content != nil {
+			if closer, ok := part.Content.(io.Closer); ok {
+				defer closer.Close()
+			}
+			if _, err := io.Copy(w, part.Content); err != nil {
+				return err
+			}
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	}
+	for _, part := range m.Parts {
+		if err := write(part); err != nil {
+			return fmt.Errorf("writing MultipartResponse part failed with: %s", err.Error())
+		}
+	}
+	if m.Stream != nil {
+		if err := m.Stream(write); err != nil {
+			return fmt.Errorf("streaming MultipartResponse failed with: %s", err.Error())
+		}
+	}
+	return mw.Close()
+}
@@ -1,13 +1,22 @@
 package puff
 
 import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
 	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
 	"net/http"
 	"reflect"
 	"regexp"
 	"slices"
 	"strconv"
 	"strings"
+	"time"
 )
 
 //go:embed static/openAPI.html
@@ -22,8 +31,14 @@ func parameterToRequestBodyOrReference(p Parameter) RequestBodyOrReference {
 		s = &Schema{Ref: p.Schema.Ref}
 	}
 
-	m["application/json"] = MediaType{
-		Schema: s, // schema with just ref or entire schema
+	media := p.media
+	if len(media) == 0 {
+		media = []string{defaultBodyMedia}
+	}
+	for _, mediaType := range media {
+		m[mediaType] = MediaType{
+			Schema: s, // schema with just ref or entire schema
+		}
 	}
 	requestBody := RequestBodyOrReference{
 		Reference:   "",
@@ -34,6 +49,63 @@ func parameterToRequestBodyOrReference(p Parameter) RequestBodyOrReference {
 	return requestBody
 }
 
+// addFileToRequestBody documents the file param p as a property of the
+// multipart/form-data requestBody, an array of binary strings for slices.
+// The schemas of requestBody are copied, not modified.
+func addFileToRequestBody(requestBody RequestBodyOrReference, p Parameter) RequestBodyOrReference {
+	media := requestBody.Content["multipart/form-data"]
+	property := &Schema{Type: "string", Format: "binary"}
+	if p.Schema != nil && p.Schema.Type == "array" {
+		property = &Schema{Type: "array", Items: property}
+	}
+	if p.upload != nil {
+		property.Description = p.upload.describe()
+		if len(p.upload.accept) > 0 {
+			media.Encoding = maps.Clone(media.Encoding)
+			if media.Encoding == nil {
+				media.Encoding = map[string]Encoding{}
+			}
+			media.Encoding[p.Name] = Encoding{ContentType: strings.Join(p.upload.accept, ", ")}
+		}
+	}
+	media.Schema = withProperty(media.Schema, p.Name, property, p.Required)
+	content := maps.Clone(requestBody.Content)
+	if content == nil {
+		content = map[string]MediaType{}
+	}
+	content["multipart/form-data"] = media
+	requestBody.Content = content
+	requestBody.Required = requestBody.Required || p.Required
+	return requestBody
+}
+
+// objectSchemaOf returns a new object schema with the properties of s. A
+// referenced schema is included with allOf, so it is never modified.
+func objectSchemaOf(s *Schema) *Schema {
+	object := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	switch {
+	case s == nil:
+	case s.Ref != "":
+		object.AllOf = []*Schema{s}
+	default:
+		object.Description = s.Description
+		maps.Copy(object.Properties, s.Properties)
+		object.Required = slices.Clone(s.Required)
+		object.AllOf = slices.Clone(s.AllOf)
+	}
+	return object
+}
+
+// withProperty returns a copy of the object schema s with the property name.
+func withProperty(s *Schema, name string, property *Schema, required bool) *Schema {
+	object := objectSchemaOf(s)
+	object.Properties[name] = property
+	if required {
+		object.Required = append(object.Required, name)
+	}
+	return object
+}
+
 func addRoute(route *Route, tags *[]Tag, tagNames *[]string, paths *Paths) *Paths {
 	tag := route.Router.Tag //FIXME: tag on route should not just be tag on router
 	if tag == "" {
@@ -45,28 +117,23 @@ func addRoute(route *Route, tags *[]Tag, tagNames *[]string, paths *Paths) *Path
 	}
 	parameters := []Parameter{}
 	var requestBody RequestBodyOrReference
+	var files []Parameter
 	for _, p := range route.params {
+		if p.In == "host" {
+			// host labels are not OpenAPI parameters; they are part of the server URL.
+			continue
+		}
 		if p.In == "body" {
 			requestBody = parameterToRequestBodyOrReference(p)
 			continue
 		}
+		if p.In == "form" && p.formStruct {
+			requestBody = formStructRequestBody(p)
+			continue
+		}
 		if p.In == "file" {
-			requestBody = RequestBodyOrReference{
-				Content: map[string]MediaType{
-					"multipart/form-data": {
-						Schema: &Schema{
-							Type:     "object",
-							Required: []string{p.Name},
-							Properties: map[string]*Schema{
-								p.Name: {
-									Type:   "string",
-									Format: "binary",
-								},
-							},
-						},
-					},
-				},
-			}
+			// added once the body of a form struct is known.
+			files = append(files, p)
 			continue
 		}
 		np := Parameter{
@@ -75,10 +142,18 @@ func addRoute(route *Route, tags *[]Tag, tagNames *[]string, paths *Paths) *Path
 			Required:    p.Required,
 			In:          p.In,
 			Deprecated:  p.Deprecated,
+			Style:       p.Style,
+			Explode:     p.Explode,
 		}
 		np.Schema = p.Schema
 		parameters = append(parameters, np)
 	}
+	for _, p := range files {
+		requestBody = addFileToRequestBody(requestBody, p)
+	}
+	parameters = append(parameters, route.implicitPathParameters()...)
+	parameters = append(parameters, route.fieldSelectionParameter()...)
+	parameters = append(parameters, route.ifMatchParameter()...)
 
 	pathMethod := &Operation{
 		Summary:     generateSummary(*route),
@@ -87,35 +162,118 @@ func addRoute(route *Route, tags *[]Tag, tagNames *[]string, paths *Paths) *Path
 		Parameters:  parameters, //NOTE: check json struct tag on ParameterOrReference
 		RequestBody: &requestBody,
 		Responses:   convertRouteResponsestoOpenAPIResponses(*route),
-		Description: route.Description,
+		Description: route.description(),
 		Callbacks:   map[string]Callback{},
+		CodeSamples: codeSamples(route),
+	}
+
+	if d := route.timeout(); d > 0 {
+		pathMethod.Timeout = d.String()
+	}
+
+	if route.deprecation != nil {
+		route.deprecation.document(pathMethod)
+	}
+
+	if route.rpc != nil {
+		pathMethod.RPCMethods = route.rpc.describe(route)
 	}
 
-	pathItem := (*paths)[route.fullPath]
+	for _, key := range sortedQueryConstraintKeys(route) {
+		pathMethod.Parameters = append(pathMethod.Parameters, queryConstraintParameter(route, key))
+	}
+
+	pathItem := (*paths)[route.openAPIPath()]
+	var slot **Operation
 	switch route.Protocol {
 	// TODO: handle other protocols
 	case http.MethodGet:
-		pathItem.Get = pathMethod
+		slot = &pathItem.Get
 		// explicity remove request body for GET requests
-		pathItem.Get.RequestBody = nil
+		pathMethod.RequestBody = nil
 	case http.MethodPost:
-		pathItem.Post = pathMethod
+		slot = &pathItem.Post
 	case http.MethodPut:
-		pathItem.Put = pathMethod
+		slot = &pathItem.Put
 	case http.MethodPatch:
-		pathItem.Patch = pathMethod
+		slot = &pathItem.Patch
 	case http.MethodDelete:
-		pathItem.Delete = pathMethod
+		slot = &pathItem.Delete
+	case http.MethodHead:
+		slot = &pathItem.Head
+		pathMethod.RequestBody = nil
+	case http.MethodOptions:
+		slot = &pathItem.Options
+	case http.MethodTrace:
+		slot = &pathItem.Trace
+		pathMethod.RequestBody = nil
+	}
+	if slot != nil {
+		if *slot != nil && len(route.queryConstraints) > 0 {
+			mergeQueryVariant(*slot, pathMethod, route)
+		} else {
+			*slot = pathMethod
+		}
+		(*paths)[route.openAPIPath()] = pathItem
 	}
-	(*paths)[route.fullPath] = pathItem
 
 	return paths
 }
 
+// sortedQueryConstraintKeys returns the query constraint keys of route in order.
+func sortedQueryConstraintKeys(route *Route) []string {
+	keys := make([]string, 0, len(route.queryConstraints))
+	for key := range route.queryConstraints {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// queryConstraintParameter documents a query constraint of route as an
+// optional query parameter selecting the variant.
+func queryConstraintParameter(route *Route, key string) Parameter {
+	schema := &Schema{Type: "string"}
+	if value := route.queryConstraints[key]; value != "" {
+		schema.Examples = []any{value}
+	}
+	return Parameter{
+		Name:        key,
+		In:          "query",
+		Description: "Selects a variant of this operation.",
+		Schema:      schema,
+	}
+}
+
+// mergeQueryVariant documents the query variant variant of route under the
+// existing operation for the same method and path.
+func mergeQueryVariant(existing *Operation, variant *Operation, route *Route) {
+	desc := fmt.Sprintf("**Variant %s**", route.queryConstraintString())
+	if variant.Description != "" {
+		desc += ": " + variant.Description
+	}
+	if existing.Description != "" {
+		existing.Description += "\n\n"
+	}
+	existing.Description += desc
+
+	for _, p := range variant.Parameters {
+		if !slices.ContainsFunc(existing.Parameters, func(e Parameter) bool { return e.Name == p.Name && e.In == p.In }) {
+			p.Required = false
+			existing.Parameters = append(existing.Parameters, p)
+		}
+	}
+	for sc, res := range variant.Responses {
+		if _, ok := existing.Responses[sc]; !ok {
+			existing.Responses[sc] = res
+		}
+	}
+}
+
 func convertRouteResponsestoOpenAPIResponses(route Route) map[string]OpenAPIResponse {
 	// FIXME: description can potentially be pulled from a map
 	openAPIResponses := map[string]OpenAPIResponse{}
-	for statusCode, res := range route.Responses {
+	for statusCode, res := range route.effectiveResponses() {
 		sc := strconv.Itoa(statusCode)
 		realRes := reflect.New(res()).Interface()
 		schema := newDefinition(&route, realRes)
@@ -126,14 +284,33 @@ func convertRouteResponsestoOpenAPIResponses(route Route) map[string]OpenAPIResp
 			Description: http.StatusText(statusCode),
 		}
 	}
+	if route.redirect != nil {
+		sc, res := route.redirect.openAPIResponse()
+		openAPIResponses[sc] = res
+	}
+	for statusCode, err := range route.documentedErrors {
+		openAPIResponses[strconv.Itoa(statusCode)] = OpenAPIResponse{
+			Description: err.Message,
+			Content: map[string]MediaType{
+				"application/json": {Schema: &Schema{Ref: "#/components/schemas/Error"}},
+			},
+		}
+	}
+	openAPIResponses["default"] = OpenAPIResponse{
+		Description: "Error",
+		Content: map[string]MediaType{
+			"application/json": {Schema: &Schema{Ref: "#/components/schemas/Error"}},
+		},
+	}
 	return openAPIResponses
 }
 
-func generateOperationId(r Route) string {
-	path := r.fullPath
-	re := regexp.MustCompile(`/([a-zA-Z])`)
+// operationIdSegment matches the first letter of a path segment, capitalized in operationIds.
+var operationIdSegment = regexp.MustCompile(`/([a-zA-Z])`)
 
-	normalizedPath := re.ReplaceAllStringFunc(path, func(match string) string {
+func generateOperationId(r Route) string {
+	path := r.openAPIPath()
+	normalizedPath := operationIdSegment.ReplaceAllStringFunc(path, func(match string) string {
 		// Extract the character after "/"
 		char := match[1:]
 		// Capitalize the character and return it
@@ -143,9 +320,85 @@ func generateOperationId(r Route) string {
 }
 
 func generateSummary(r Route) string {
-	summary := r.Description
+	summary := r.description()
 	if len(summary) > 100 {
 		summary = summary[:97] + " ..."
 	}
 	return summary
 }
+
+// openAPISpecCache holds the OpenAPI document encoded at generation time,
+// along with its gzip pre-compressed form and validators.
+type openAPISpecCache struct {
+	body         []byte
+	gzipped      []byte
+	etag         string
+	lastModified time.Time
+}
+
+func newOpenAPISpecCache(spec *OpenAPI) (*openAPISpecCache, error) {
+	body, err := json.Marshal(spec)
+	if err != nil {
+		return nil, err
+	}
+	var gz bytes.Buffer
+	zw, _ := gzip.NewWriterLevel(&gz, gzip.BestCompression)
+	if _, err := zw.Write(body); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(body)
+	return &openAPISpecCache{
+		body:         body,
+		gzipped:      gz.Bytes(),
+		etag:         hex.EncodeToString(sum[:8]),
+		lastModified: time.Now().UTC().Truncate(time.Second),
+	}, nil
+}
+
+// routesChanged marks the served OpenAPI spec for regeneration after routes
+// were registered or removed while serving. A spec set in AppConfig.OpenAPI
+// is served unchanged. a.routesMu must be held.
+func (a *PuffApp) routesChanged() {
+	if a.openAPIGenerated {
+		a.openAPIStale.Store(true)
+	}
+}
+
+// serveOpenAPISpec serves the OpenAPI spec, regenerating it first if the
+// routes changed since it was encoded.
+func (a *PuffApp) serveOpenAPISpec(c *Context) {
+	a.openAPISpecMu.Lock()
+	if a.openAPIStale.Swap(false) {
+		var spec *openAPISpecCache
+		var err error
+		a.RootRouter.readRoutes(func() {
+			spec, err = newOpenAPISpecCache(a.newOpenAPISpec())
+		})
+		if err != nil {
+			slog.Error(fmt.Sprintf("puff: encoding OpenAPI spec failed: %s", err.Error()))
+		} else {
+			a.openAPISpec = spec
+		}
+	}
+	spec := a.openAPISpec
+	a.openAPISpecMu.Unlock()
+	spec.serve(c)
+}
+
+// serve writes the cached spec, honoring conditional and HEAD requests and
+// serving the gzip variant to clients that accept it.
+func (s *openAPISpecCache) serve(c *Context) {
+	w, req := c.Raw()
+	w.Header().Add("Vary", "Accept-Encoding")
+	body, etag := s.body, s.etag
+	if acceptsEncoding(req.Header.Get("Accept-Encoding"), "gzip") {
+		body, etag = s.gzipped, s.etag+"-gzip"
+		w.Header().Set("Content-Encoding", "gzip")
+	}
+	w.Header().Set("ETag", `"`+etag+`"`)
+	w.Header().Set("Content-Type", "application/json")
+	http.ServeContent(w, req, "", s.lastModified, bytes.NewReader(body))
+}
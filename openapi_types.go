@@ -25,7 +25,7 @@ func NewOpenAPI(a *PuffApp) *OpenAPI {
 			Contact: &Contact{},
 			License: &License{},
 		},
-		Servers:      &[]Server{},
+		Servers:      a.openAPIServers(),
 		Paths:        new(Paths),
 		Components:   NewComponents(a),
 		Webhooks:     make(map[string]any),
@@ -99,9 +99,17 @@ type Components struct {
 }
 
 func NewComponents(a *PuffApp) *Components {
+	Schemas["Error"] = a.errorConfig().schema()
 	return &Components{
-		Schemas:         &Schemas,
-		Responses:       make(map[string]any),
+		Schemas: &Schemas,
+		Responses: map[string]any{
+			"Error": OpenAPIResponse{
+				Description: "Error",
+				Content: map[string]MediaType{
+					"application/json": {Schema: &Schema{Ref: "#/components/schemas/Error"}},
+				},
+			},
+		},
 		Parameters:      make(map[string]any),
 		Examples:        make(map[string]any),
 		RequestBodies:   make(map[string]any),
@@ -159,6 +167,14 @@ type Operation struct {
 	Deprecated   bool                       `json:"deprecated"`
 	Security     *[]SecurityRequirement     `json:"security,omitempty"`
 	Servers      *[]Server                  `json:"servers,omitempty"`
+	// Timeout is the server-side timeout of the operation, e.g. "5s".
+	Timeout string `json:"x-timeout,omitempty"`
+	// Sunset is when a deprecated operation will be removed, in RFC 3339 format.
+	Sunset string `json:"x-sunset,omitempty"`
+	// CodeSamples are example invocations of the operation, e.g. with curl.
+	CodeSamples []CodeSample `json:"x-codeSamples,omitempty"`
+	// RPCMethods are the methods served by a WebSocket route registered with Router.RPC.
+	RPCMethods []RPCMethodInfo `json:"x-rpc-methods,omitempty"`
 }
 
 // Parameter struct describes a parameter in OpenAPI.
@@ -174,6 +190,19 @@ type Parameter struct {
 	Explode         bool    `json:"explode"`
 	AllowReserved   bool    `json:"allowReserved"`
 	Schema          *Schema `json:"schema"`
+
+	// strict rejects unknown keys in a JSON body. Set with the strict tag.
+	strict bool
+	// enum are the values the param is restricted to. Set with the enum tag.
+	enum []any
+	// layout is the time.Parse layout of a time.Time param. Set with the layout tag.
+	layout string
+	// media are the media types a body param is decoded from. Set with the media tag.
+	media []string
+	// formStruct binds a struct form param from the whole form body.
+	formStruct bool
+	// upload are the constraints of a file param. Set with the maxsize and accept tags.
+	upload *uploadConstraints
 }
 
 // RequestBodyOrReference is a union type representing either a Request Body Object or a Reference Object.
@@ -189,6 +218,9 @@ type MediaType struct {
 	Schema   *Schema        `json:"schema"`
 	Example  any            `json:"example,omitempty"`
 	Examples map[string]any `json:"examples,omitempty"`
+	// Encoding describes properties of multipart bodies, e.g. the accepted
+	// content types of files.
+	Encoding map[string]Encoding `json:"encoding,omitempty"`
 }
 
 // Schema struct represents a schema object in OpenAPI.
@@ -197,13 +229,17 @@ type Schema struct {
 	// Example fields could include type, format, properties, etc.
 	// This can be expanded based on the needs of your application.
 	Type                 string             `json:"type,omitempty"`
+	Description          string             `json:"description,omitempty"`
 	Format               string             `json:"format,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Enum                 []any              `json:"enum,omitempty"`
 	Minimum              string             `json:"minimum,omitempty"`
 	Items                *Schema            `json:"items,omitempty"`
 	Ref                  string             `json:"$ref,omitempty"`
 	Properties           map[string]*Schema `json:"properties,omitempty"`
 	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
 	Required             []string           `json:"required,omitempty"`
+	AllOf                []*Schema          `json:"allOf,omitempty"`
 	Examples             []any              `json:"examples,omitempty"`
 }
 
@@ -223,7 +259,8 @@ type Example struct {
 }
 
 type Header struct {
-	// TODO: Add header fields as needed
+	Description string  `json:"description,omitempty"`
+	Schema      *Schema `json:"schema,omitempty"`
 }
 
 type Link struct {
@@ -0,0 +1,299 @@
+package puff
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+)
+
+// OpenAPIChange is a difference between two OpenAPI specs found by DiffOpenAPI.
+type OpenAPIChange struct {
+	// Breaking reports whether clients written against the baseline may fail.
+	Breaking bool `json:"breaking"`
+	// Method is the HTTP method of the changed operation, if any.
+	Method string `json:"method,omitempty"`
+	// Path is the changed path.
+	Path string `json:"path"`
+	// Message describes the change.
+	Message string `json:"message"`
+}
+
+func (c OpenAPIChange) String() string {
+	kind := "change"
+	if c.Breaking {
+		kind = "breaking change"
+	}
+	operation := c.Path
+	if c.Method != "" {
+		operation = c.Method + " " + c.Path
+	}
+	return fmt.Sprintf("%s: %s: %s", kind, operation, c.Message)
+}
+
+// DiffOpenAPI compares the current spec against baseline and returns the
+// changes, breaking ones being removed paths and operations, removed
+// responses and response properties, narrowed parameter and property types,
+// and new required parameters and body properties.
+func DiffOpenAPI(baseline, current *OpenAPI) []OpenAPIChange {
+	d := openAPIDiff{baseline: baseline, current: current}
+	oldPaths, newPaths := pathsOf(baseline), pathsOf(current)
+	for _, path := range sortedKeys(oldPaths) {
+		newItem, ok := newPaths[path]
+		if !ok {
+			d.add(true, "", path, "path removed")
+			continue
+		}
+		oldOps, newOps := operationsOf(oldPaths[path]), operationsOf(newItem)
+		for _, method := range sortedKeys(oldOps) {
+			if newOp, ok := newOps[method]; ok {
+				d.diffOperation(method, path, oldOps[method], newOp)
+			} else {
+				d.add(true, method, path, "operation removed")
+			}
+		}
+		for _, method := range sortedKeys(newOps) {
+			if _, ok := oldOps[method]; !ok {
+				d.add(false, method, path, "operation added")
+			}
+		}
+	}
+	for _, path := range sortedKeys(newPaths) {
+		if _, ok := oldPaths[path]; !ok {
+			d.add(false, "", path, "path added")
+		}
+	}
+	return d.changes
+}
+
+// openAPIDiff collects the changes between two specs.
+type openAPIDiff struct {
+	baseline, current *OpenAPI
+	changes           []OpenAPIChange
+}
+
+func (d *openAPIDiff) add(breaking bool, method, path, message string, a ...any) {
+	d.changes = append(d.changes, OpenAPIChange{Breaking: breaking, Method: method, Path: path, Message: fmt.Sprintf(message, a...)})
+}
+
+func (d *openAPIDiff) diffOperation(method, path string, oldOp, newOp *Operation) {
+	type paramKey struct{ in, name string }
+	oldParams := map[paramKey]Parameter{}
+	for _, p := range oldOp.Parameters {
+		oldParams[paramKey{p.In, p.Name}] = p
+	}
+	for _, p := range newOp.Parameters {
+		old, ok := oldParams[paramKey{p.In, p.Name}]
+		switch {
+		case !ok && p.Required:
+			d.add(true, method, path, "new required %s param %s", p.In, p.Name)
+		case !ok:
+			d.add(false, method, path, "new optional %s param %s", p.In, p.Name)
+		case p.Required && !old.Required:
+			d.add(true, method, path, "%s param %s became required", p.In, p.Name)
+		default:
+			d.diffSchema(method, path, fmt.Sprintf("%s param %s", p.In, p.Name), old.Schema, p.Schema, true, 0)
+		}
+	}
+
+	oldBody, newBody := jsonBodySchema(oldOp.RequestBody), jsonBodySchema(newOp.RequestBody)
+	if newOp.RequestBody != nil && newOp.RequestBody.Required && (oldOp.RequestBody == nil || !oldOp.RequestBody.Required) {
+		d.add(true, method, path, "request body became required")
+	}
+	if oldBody != nil && newBody != nil {
+		d.diffSchema(method, path, "request body", oldBody, newBody, true, 0)
+	}
+
+	for _, status := range sortedKeys(oldOp.Responses) {
+		newRes, ok := newOp.Responses[status]
+		if !ok {
+			d.add(true, method, path, "response %s removed", status)
+			continue
+		}
+		if oldSchema, newSchema := mediaSchema(oldOp.Responses[status].Content), mediaSchema(newRes.Content); oldSchema != nil && newSchema != nil {
+			d.diffSchema(method, path, "response "+status, oldSchema, newSchema, false, 0)
+		}
+	}
+}
+
+// diffSchema compares the schemas of what. Requests are broken by narrowed
+// types and new required properties, responses by removed properties.
+func (d *openAPIDiff) diffSchema(method, path, what string, oldSchema, newSchema *Schema, request bool, depth int) {
+	oldSchema, newSchema = resolveSchema(d.baseline, oldSchema), resolveSchema(d.current, newSchema)
+	if oldSchema == nil || newSchema == nil || depth > 8 {
+		return
+	}
+	oldKind, newKind := schemaKind(oldSchema), schemaKind(newSchema)
+	if oldKind != newKind {
+		d.add(!(oldKind == "integer" && newKind == "number" && request), method, path, "%s type changed from %s to %s", what, oldKind, newKind)
+		return
+	}
+	if request {
+		if narrowedFormat(oldSchema.Format, newSchema.Format) {
+			d.add(true, method, path, "%s format narrowed from %q to %q", what, oldSchema.Format, newSchema.Format)
+		}
+		if newSchema.Pattern != "" && newSchema.Pattern != oldSchema.Pattern {
+			d.add(true, method, path, "%s pattern changed to %q", what, newSchema.Pattern)
+		}
+		for _, name := range newSchema.Required {
+			if !slices.Contains(oldSchema.Required, name) {
+				d.add(true, method, path, "%s has new required property %s", what, name)
+			}
+		}
+	}
+	for _, name := range sortedKeys(oldSchema.Properties) {
+		newProp, ok := newSchema.Properties[name]
+		if !ok {
+			if !request {
+				d.add(true, method, path, "%s property %s removed", what, name)
+			}
+			continue
+		}
+		d.diffSchema(method, path, what+" property "+name, oldSchema.Properties[name], newProp, request, depth+1)
+	}
+	if oldSchema.Items != nil && newSchema.Items != nil {
+		d.diffSchema(method, path, what+" items", oldSchema.Items, newSchema.Items, request, depth+1)
+	}
+}
+
+// schemaKind returns the JSON type described by s, deriving it from the
+// format of the schemas puff generates for basic types.
+func schemaKind(s *Schema) string {
+	switch {
+	case strings.HasPrefix(s.Format, "int") && (s.Type == "" || s.Type == "integer" || s.Type == "number"):
+		return "integer"
+	case s.Type != "":
+		return s.Type
+	case s.Format == "float" || s.Format == "double":
+		return "number"
+	case s.Format == "bool":
+		return "boolean"
+	case s.Properties != nil || s.AdditionalProperties != nil:
+		return "object"
+	case s.Items != nil:
+		return "array"
+	case s.Format != "":
+		return "string"
+	}
+	return ""
+}
+
+// formatWidths orders the numeric formats by the values they accept.
+var formatWidths = map[string]int{"int8": 8, "int16": 16, "int32": 32, "int": 64, "int64": 64, "float": 32, "double": 64}
+
+// narrowedFormat reports whether changing format from oldFormat to newFormat
+// rejects values accepted before.
+func narrowedFormat(oldFormat, newFormat string) bool {
+	if oldFormat == newFormat || newFormat == "" || newFormat == "string" {
+		return false
+	}
+	oldWidth, oldOK := formatWidths[oldFormat]
+	newWidth, newOK := formatWidths[newFormat]
+	if oldOK && newOK {
+		return newWidth < oldWidth
+	}
+	return true
+}
+
+// resolveSchema follows a reference to the component schemas of spec.
+func resolveSchema(spec *OpenAPI, s *Schema) *Schema {
+	for depth := 0; s != nil && s.Ref != "" && depth < 8; depth++ {
+		name, ok := strings.CutPrefix(s.Ref, "#/components/schemas/")
+		if !ok || spec == nil || spec.Components == nil || spec.Components.Schemas == nil {
+			return nil
+		}
+		s = (*spec.Components.Schemas)[name]
+	}
+	return s
+}
+
+func jsonBodySchema(body *RequestBodyOrReference) *Schema {
+	if body == nil {
+		return nil
+	}
+	return mediaSchema(body.Content)
+}
+
+func mediaSchema(content map[string]MediaType) *Schema {
+	if m, ok := content["application/json"]; ok {
+		return m.Schema
+	}
+	return nil
+}
+
+func pathsOf(spec *OpenAPI) Paths {
+	if spec == nil || spec.Paths == nil {
+		return Paths{}
+	}
+	return *spec.Paths
+}
+
+// operationsOf returns the operations of item by method.
+func operationsOf(item PathItem) map[string]*Operation {
+	ops := map[string]*Operation{}
+	for method, op := range map[string]*Operation{
+		http.MethodGet: item.Get, http.MethodPut: item.Put, http.MethodPost: item.Post,
+		http.MethodDelete: item.Delete, http.MethodOptions: item.Options, http.MethodHead: item.Head,
+		http.MethodPatch: item.Patch, http.MethodTrace: item.Trace,
+	} {
+		if op != nil {
+			ops[method] = op
+		}
+	}
+	return ops
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// DiffOpenAPI compares the spec generated for the application against the
+// JSON encoded baseline spec read from r. Use it as a CI gate by failing on
+// changes that are Breaking. See also AppConfig.OpenAPIBaseline.
+func (a *PuffApp) DiffOpenAPI(r io.Reader) ([]OpenAPIChange, error) {
+	baseline := new(OpenAPI)
+	if err := json.NewDecoder(r).Decode(baseline); err != nil {
+		return nil, fmt.Errorf("decoding baseline spec failed: %w", err)
+	}
+	if !a.RootRouter.serving() {
+		// routes are resolved when serving; resolve them here for tooling.
+		for _, route := range a.AllRoutes() {
+			if err := checkRoute(route); err != nil {
+				return nil, err
+			}
+		}
+	}
+	a.GenerateOpenAPISpec()
+	return DiffOpenAPI(baseline, a.Config.OpenAPI), nil
+}
+
+// diffOpenAPIBaseline diffs the spec against AppConfig.OpenAPIBaseline and
+// logs a warning for every breaking change.
+func (a *PuffApp) diffOpenAPIBaseline() []OpenAPIChange {
+	f, err := os.Open(a.Config.OpenAPIBaseline)
+	if err != nil {
+		slog.Error(fmt.Sprintf("puff: opening OpenAPI baseline failed: %s", err.Error()))
+		return nil
+	}
+	defer f.Close()
+	changes, err := a.DiffOpenAPI(f)
+	if err != nil {
+		slog.Error(fmt.Sprintf("puff: %s", err.Error()))
+		return nil
+	}
+	for _, change := range changes {
+		if change.Breaking {
+			slog.Warn(fmt.Sprintf("puff: OpenAPI %s", change))
+		}
+	}
+	return changes
+}
@@ -0,0 +1,105 @@
+package puff
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Page describes the position of a response within a paginated collection.
+type Page struct {
+	// Number is the 1-based page number.
+	Number int
+	// Size is the number of items per page.
+	Size int
+	// Total is the total number of items in the collection. If it is
+	// negative the total is unknown and no "last" link is generated.
+	Total int
+	// PageParam is the query parameter holding the page number. Default: "page".
+	PageParam string
+	// SizeParam is the query parameter holding the page size. Default: "per_page".
+	SizeParam string
+}
+
+// Offset returns the number of items before the page.
+func (p Page) Offset() int {
+	return (p.Number - 1) * p.Size
+}
+
+// LastPage returns the number of the last page, or 0 if Total is unknown.
+func (p Page) LastPage() int {
+	if p.Total < 0 || p.Size <= 0 {
+		return 0
+	}
+	if p.Total == 0 {
+		return 1
+	}
+	return (p.Total + p.Size - 1) / p.Size
+}
+
+func (p Page) pageParam() string {
+	if p.PageParam == "" {
+		return "page"
+	}
+	return p.PageParam
+}
+
+func (p Page) sizeParam() string {
+	if p.SizeParam == "" {
+		return "per_page"
+	}
+	return p.SizeParam
+}
+
+// Paginate reads the page number and size of the request from the "page"
+// and "per_page" query parameters. Missing or invalid values fall back to
+// page 1 and defaultSize, and the size is capped at maxSize. Total is left
+// unknown; set it once the collection has been counted.
+func (ctx *Context) Paginate(defaultSize, maxSize int) Page {
+	p := Page{Number: 1, Size: defaultSize, Total: -1}
+	query := ctx.Request.URL.Query()
+	if n, err := strconv.Atoi(query.Get(p.pageParam())); err == nil && n > 0 {
+		p.Number = n
+	}
+	if n, err := strconv.Atoi(query.Get(p.sizeParam())); err == nil && n > 0 {
+		p.Size = n
+	}
+	if maxSize > 0 && p.Size > maxSize {
+		p.Size = maxSize
+	}
+	return p
+}
+
+// SetPageLinks sets the RFC 5988 Link header for p with the first, prev,
+// next and last relations. The links point at the requested URL, keeping
+// every other query parameter. It must be called before the response is sent.
+//
+// If Total is unknown, a next link is always generated and no last link is.
+func (ctx *Context) SetPageLinks(p Page) {
+	last := p.LastPage()
+	links := []string{ctx.pageLink(p, 1, "first")}
+	if p.Number > 1 {
+		prev := p.Number - 1
+		if last > 0 && prev > last {
+			prev = last
+		}
+		links = append(links, ctx.pageLink(p, prev, "prev"))
+	}
+	if last == 0 || p.Number < last {
+		links = append(links, ctx.pageLink(p, p.Number+1, "next"))
+	}
+	if last > 0 {
+		links = append(links, ctx.pageLink(p, last, "last"))
+	}
+	ctx.ResponseWriter.Header().Set("Link", strings.Join(links, ", "))
+}
+
+// pageLink formats a Link header entry for page number n.
+func (ctx *Context) pageLink(p Page, n int, rel string) string {
+	query := ctx.Request.URL.Query()
+	query.Set(p.pageParam(), strconv.Itoa(n))
+	query.Set(p.sizeParam(), strconv.Itoa(p.Size))
+	u := url.URL{Path: ctx.Request.URL.Path, RawQuery: query.Encode()}
+	return fmt.Sprintf(`<%s>; rel="%s"`, ctx.URLFor(u.RequestURI()), rel)
+}
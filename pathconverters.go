@@ -0,0 +1,42 @@
+package puff
+
+// pathConverter is a named constraint of a path parameter, e.g. {id:int},
+// that also determines the OpenAPI schema of the parameter.
+type pathConverter struct {
+	pattern string
+	schema  Schema
+}
+
+// pathConverters are the converters usable in route paths. A constraint that
+// names one of them is replaced by its pattern; any other constraint is a
+// regular expression.
+var pathConverters = map[string]pathConverter{
+	"int":    {pattern: `-?[0-9]+`, schema: Schema{Type: "integer", Format: "int64"}},
+	"string": {pattern: `[^/]+`, schema: Schema{Type: "string"}},
+	"uuid":   {pattern: `[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`, schema: Schema{Type: "string", Format: "uuid"}},
+}
+
+// implicitPathParameters returns the OpenAPI parameters of the path
+// parameters of the route that are not bound to a field, typed by their
+// converter if they have one.
+func (route *Route) implicitPathParameters() []Parameter {
+	declared := 0
+	for _, p := range route.params {
+		if p.In == "path" {
+			declared++
+		}
+	}
+	params, _ := parsePathParams(route.fullPath)
+	var parameters []Parameter
+	for i, name := range route.pathParamNames() {
+		if i < declared {
+			continue
+		}
+		schema := Schema{Type: "string"}
+		if i < len(params) && params[i].converter != "" {
+			schema = pathConverters[params[i].converter].schema
+		}
+		parameters = append(parameters, Parameter{Name: name, In: "path", Required: true, Schema: &schema})
+	}
+	return parameters
+}
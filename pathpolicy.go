@@ -0,0 +1,117 @@
+package puff
+
+import (
+	"net/http"
+	"strings"
+)
+
+// PathPolicy configures how request paths are sanitized before matching.
+type PathPolicy struct {
+	// CollapseSlashes replaces runs of slashes with a single slash ("/a//b" becomes "/a/b").
+	CollapseSlashes bool
+	// RejectDotSegments rejects paths containing "." or ".." segments (including
+	// percent-encoded ones) with 400 Bad Request, preventing traversal.
+	RejectDotSegments bool
+	// ResolveDotSegments resolves "." and ".." segments instead ("/api/users/../admin"
+	// becomes "/api/admin"), so they cannot be used to reach routes outside of a router
+	// whose middlewares they passed. A ".." never goes above the root. Ignored if
+	// RejectDotSegments is set.
+	ResolveDotSegments bool
+	// StripNullBytes removes NUL bytes from the path. If false, paths containing
+	// NUL bytes are rejected with 400 Bad Request.
+	StripNullBytes bool
+	// RedirectCleaned redirects (308) the client to the sanitized path instead of
+	// silently serving it.
+	RedirectCleaned bool
+}
+
+// DefaultPathPolicy is the PathPolicy used if AppConfig.PathPolicy is nil. It
+// collapses slashes, strips NUL bytes and rejects "." and ".." segments with
+// 400 Bad Request. Set a PathPolicy without RejectDotSegments to serve such
+// paths, e.g. with ResolveDotSegments for clients sending unnormalized paths.
+var DefaultPathPolicy = PathPolicy{
+	CollapseSlashes:   true,
+	RejectDotSegments: true,
+	StripNullBytes:    true,
+}
+
+// sanitize returns the sanitized form of path, or ok false if the path must be rejected.
+func (p *PathPolicy) sanitize(path string) (string, bool) {
+	if strings.IndexByte(path, 0) != -1 {
+		if !p.StripNullBytes {
+			return "", false
+		}
+		path = strings.ReplaceAll(path, "\x00", "")
+	}
+	if p.RejectDotSegments {
+		for _, segment := range strings.Split(path, "/") {
+			if segment == "." || segment == ".." {
+				return "", false
+			}
+		}
+	}
+	if p.CollapseSlashes {
+		for strings.Contains(path, "//") {
+			path = strings.ReplaceAll(path, "//", "/")
+		}
+	}
+	if p.ResolveDotSegments {
+		path = resolveDotSegments(path)
+	}
+	return path, true
+}
+
+// resolveDotSegments removes the "." and ".." segments of path as described
+// in RFC 3986 section 5.2.4, keeping empty segments and a trailing slash.
+func resolveDotSegments(path string) string {
+	segments := strings.Split(path, "/")
+	resolved := make([]string, 0, len(segments))
+	for i, segment := range segments {
+		last := i == len(segments)-1
+		switch segment {
+		case ".":
+		case "..":
+			if len(resolved) > 1 {
+				resolved = resolved[:len(resolved)-1]
+			}
+		default:
+			resolved = append(resolved, segment)
+			continue
+		}
+		if last {
+			// "/a/.." and "/a/." end in a directory.
+			resolved = append(resolved, "")
+		}
+	}
+	return strings.Join(resolved, "/")
+}
+
+// applyPathPolicy sanitizes the path of req. It reports false if the request
+// was rejected or redirected and must not be routed.
+func (a *PuffApp) applyPathPolicy(w http.ResponseWriter, req *http.Request) (*http.Request, bool) {
+	policy := a.Config.PathPolicy
+	if policy == nil {
+		policy = &DefaultPathPolicy
+	}
+	path, ok := policy.sanitize(req.URL.Path)
+	if !ok {
+		a.writeErrorResponse(w, http.StatusBadRequest, "invalid request path")
+		return req, false
+	}
+	if path == req.URL.Path {
+		return req, true
+	}
+	if policy.RedirectCleaned {
+		// without CollapseSlashes the path can start with "//", which clients read as another host.
+		target := localRedirectTarget(path)
+		if req.URL.RawQuery != "" {
+			target += "?" + req.URL.RawQuery
+		}
+		http.Redirect(w, req, target, http.StatusPermanentRedirect)
+		return req, false
+	}
+	req = req.Clone(req.Context())
+	req.URL.Path = path
+	req.URL.RawPath = ""
+	return req, true
+}
@@ -0,0 +1,142 @@
+package puff
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Segment kinds ordered by precedence: a static segment beats a segment
+// mixing text and parameters, e.g. "{name}.json", which beats a parameter
+// taking the whole segment, which beats a catch-all.
+const (
+	staticSegment = iota
+	partialSegment
+	paramSegment
+	catchAllSegmentKind
+)
+
+// precedence returns the kind of every segment of the route path. They are
+// resolved when the path regexp is compiled.
+func (route *Route) precedence() []int {
+	return route.segmentKinds
+}
+
+// segmentKindsOf returns the kind of every segment of path.
+func segmentKindsOf(path string) []int {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	kinds := make([]int, len(segments))
+	for i, segment := range segments {
+		switch {
+		case strings.HasPrefix(segment, "*"):
+			kinds[i] = catchAllSegmentKind
+		case strings.Contains(segment, "{"):
+			kinds[i] = paramSegment
+			if params, _ := parsePathParams(segment); len(params) != 1 || params[0].start != 0 || params[0].end != len(segment) {
+				kinds[i] = partialSegment
+			}
+		default:
+			kinds[i] = staticSegment
+		}
+	}
+	return kinds
+}
+
+// comparePrecedence reports whether a route with segment kinds a takes
+// precedence over one with b (-1), the reverse (1), or neither (0). The first
+// segment that differs decides.
+func comparePrecedence(a, b []int) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			if a[i] < b[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// bestMatch returns the segment kinds of the route with the highest
+// precedence in the router or its sub-routers matching the path of req, and
+// its method too if method is true, and the router it belongs to. ok is false
+// if no route matches.
+func (r *Router) bestMatch(req *http.Request, method bool) (best []int, owner *Router, ok bool) {
+	if !r.matchesHost(req.Host) || !r.hasPrefix(req.URL.Path) {
+		return nil, nil, false
+	}
+	return r.bestMatchWithin(req, method)
+}
+
+// bestMatchWithin is bestMatch without matching the host and prefix of r
+// itself. Routes of sub-routers win ties with the routes of r.
+func (r *Router) bestMatchWithin(req *http.Request, method bool) (best []int, owner *Router, ok bool) {
+	for _, router := range r.Routers {
+		if kinds, router, found := router.bestMatch(req, method); found && (!ok || comparePrecedence(kinds, best) < 0) {
+			best, owner, ok = kinds, router, true
+		}
+	}
+	for _, route := range r.Routes {
+		if method && req.Method != route.Protocol {
+			continue
+		}
+		if !route.matchesPath(req.URL.Path) {
+			continue
+		}
+		if kinds := route.precedence(); !ok || comparePrecedence(kinds, best) < 0 {
+			best, owner, ok = kinds, r, true
+		}
+	}
+	return best, owner, ok
+}
+
+// subRouterFor returns the router below r that serves req, or nil if a route
+// of r itself takes precedence. The router owning the best route is found in
+// one pass over the tree, so the routers in between are not searched again.
+// Routes matching the method are preferred over routes only matching the
+// path, so a request backtracks to a less specific route of another router
+// instead of failing with 405. If no route matches at all, the deepest router
+// whose prefix matches, following the first match at every level, serves the 404.
+func (r *Router) subRouterFor(req *http.Request) *Router {
+	if len(r.Routers) == 0 {
+		return nil
+	}
+	for _, method := range []bool{true, false} {
+		if _, owner, ok := r.bestMatchWithin(req, method); ok {
+			if owner == r {
+				return nil
+			}
+			return owner
+		}
+	}
+	var deepest *Router
+	for current := r; current != nil; {
+		var next *Router
+		for _, router := range current.Routers {
+			if router.matchesHost(req.Host) && router.hasPrefix(req.URL.Path) {
+				next = router
+				break
+			}
+		}
+		if next != nil {
+			deepest = next
+		}
+		current = next
+	}
+	return deepest
+}
+
+// compileRoutes resolves the full paths and path regexps of the routes of the
+// router and its sub-routers, and their full prefixes, so matching requests
+// only reads them. It must be called before serving or with the write lock.
+func (r *Router) compileRoutes() {
+	if prefix := r.fullPrefix(); !r.prefixResolved || prefix != r.prefix {
+		r.prefix, r.prefixResolved = prefix, true
+	}
+	for _, route := range r.Routes {
+		route.getCompletePath()
+		route.createRegexMatch()
+	}
+	for _, router := range r.Routers {
+		router.compileRoutes()
+	}
+}
@@ -0,0 +1,103 @@
+package puff
+
+import (
+	"net/http"
+	"strings"
+)
+
+// ifMatchMessages are the messages of the precondition errors documented by
+// WithIfMatch and sent by RequireIfMatch.
+var ifMatchMessages = map[int]string{
+	http.StatusPreconditionFailed:   "resource was modified, If-Match does not match the current ETag",
+	http.StatusPreconditionRequired: "If-Match header is required",
+}
+
+// WithIfMatch documents that the route requires an If-Match header checked
+// with Context.RequireIfMatch: the header is listed as a required parameter
+// and the 412 Precondition Failed and 428 Precondition Required responses are
+// added to the OpenAPI entry. Errors documented before for these status codes
+// are kept.
+func (r *Route) WithIfMatch() *Route {
+	r.ifMatch = true
+	for statusCode, message := range ifMatchMessages {
+		if _, ok := r.documentedErrors[statusCode]; !ok {
+			r.Errors(ErrStatus(statusCode, message))
+		}
+	}
+	return r
+}
+
+// RequireIfMatch enforces optimistic concurrency on updates of a resource
+// whose current version is currentETag, e.g.
+//
+//	if !c.RequireIfMatch(pizza.ETag()) {
+//		return
+//	}
+//
+// It responds with 428 Precondition Required if the request has no If-Match
+// header and with 412 Precondition Failed, carrying the current ETag, if no
+// tag of the header matches currentETag using strong comparison. An empty
+// currentETag means the resource does not exist and fails even "*". It
+// returns false if a response was sent.
+func (ctx *Context) RequireIfMatch(currentETag string) bool {
+	ifMatch := ctx.GetRequestHeader("If-Match")
+	if ifMatch == "" {
+		ctx.failPrecondition(http.StatusPreconditionRequired)
+		return false
+	}
+	if currentETag != "" && !strings.HasPrefix(currentETag, `"`) && !strings.HasPrefix(currentETag, `W/"`) {
+		currentETag = `"` + currentETag + `"`
+	}
+	if ifMatchMatches(ifMatch, currentETag) {
+		return true
+	}
+	if currentETag != "" {
+		ctx.SetResponseHeader("ETag", currentETag)
+	}
+	ctx.failPrecondition(http.StatusPreconditionFailed)
+	return false
+}
+
+// failPrecondition sends the precondition error statusCode, with the message
+// documented on the route if any.
+func (ctx *Context) failPrecondition(statusCode int) {
+	if ctx.route != nil {
+		if _, ok := ctx.route.documentedErrors[statusCode]; ok {
+			ctx.Fail(statusCode)
+			return
+		}
+	}
+	ctx.sendError(statusCode, ifMatchMessages[statusCode], nil)
+}
+
+// ifMatchMatches reports whether the If-Match header value matches etag using
+// strong comparison (RFC 9110 section 13.1.1): weak tags never match.
+func ifMatchMatches(ifMatch string, etag string) bool {
+	if etag == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(ifMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if !strings.HasPrefix(candidate, "W/") && !strings.HasPrefix(etag, "W/") && candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// ifMatchParameter documents the If-Match header of routes with WithIfMatch.
+func (route *Route) ifMatchParameter() []Parameter {
+	if !route.ifMatch {
+		return nil
+	}
+	return []Parameter{{
+		Name:        "If-Match",
+		In:          "header",
+		Description: "ETag of the version of the resource the request was based on.",
+		Required:    true,
+		Schema:      &Schema{Type: "string"},
+	}}
+}
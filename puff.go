@@ -1,7 +1,12 @@
 // Package puff provides primitives for implementing a Puff Server
 package puff
 
-import "log/slog"
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"log/slog"
+	"time"
+)
 
 type HandlerFunc func(*Context)
 type Middleware func(next HandlerFunc) HandlerFunc
@@ -12,20 +17,147 @@ type AppConfig struct {
 	Name string
 	// Version is the application version.
 	Version string
+	// Dev enables development mode. In dev mode, errors not rendered by an ErrorHandler, e.g. 404,
+	// 405 and 500 or those sent with Context.HandleError, render a rich HTML page
+	// with the stack trace, route suggestions and a dump of the request. Never enable it in production.
+	Dev bool
+	// EnforceResponseSchemas compares the content of JSON responses with the types declared
+	// with Route.WithResponse and logs a warning for every mismatch, catching documentation
+	// drift. Only effective in Dev mode.
+	EnforceResponseSchemas bool
+	// ServerHeader is the Server header of every response, e.g. "api". It replaces the Server
+	// header set by handlers, mounted handlers and proxied upstreams. If empty, the Server
+	// header is left as set by the handler.
+	ServerHeader string
+	// HideServerHeader removes the Server header and version banners such as X-Powered-By
+	// from every response, so the server software and its version are not disclosed. Takes
+	// precedence over ServerHeader.
+	HideServerHeader bool
 	// DocsURL is the Router prefix for Swagger documentation. Can be "" to disable Swagger documentation.
 	DocsURL string
+	// BaseURL is the absolute URL (scheme and host, e.g. "https://api.example.com") the application
+	// is publicly reachable at. It is used by URLFor, the Location header of 201 responses, and the
+	// OpenAPI servers list. If empty, Context.URLFor derives absolute URLs from the incoming
+	// request and relative Location headers are sent unchanged.
+	BaseURL string
+	// TrustedProxies are the IP addresses or CIDR ranges (e.g. "10.0.0.0/8") of the reverse
+	// proxies in front of the application. The X-Forwarded-Proto and X-Forwarded-Host headers
+	// are only used to derive absolute URLs for requests coming from them, since any client
+	// can send these headers.
+	TrustedProxies []string
+	// Servers are additional OpenAPI server entries listed after BaseURL.
+	Servers []Server
+	// ReusePort opens the listener with SO_REUSEPORT, so a new process can listen on the same
+	// address while the old one drains during a restart. See also PuffApp.Handoff.
+	ReusePort bool
 	// TLSPublicCertFile specifies the file for the TLS certificate (usually .pem or .crt).
 	TLSPublicCertFile string
 	// TLSPrivateKeyFile specifies the file for the TLS private key (usually .key).
 	TLSPrivateKeyFile string
+	// TLSCertificateSecret is the PEM encoded TLS certificate loaded from a SecretProvider.
+	// Takes precedence over TLSPublicCertFile and supports rotation through RotateSecrets.
+	// The rest of Server.TLSConfig, if set, is kept.
+	TLSCertificateSecret *Secret
+	// TLSPrivateKeySecret is the PEM encoded TLS private key loaded from a SecretProvider.
+	// Takes precedence over TLSPrivateKeyFile and supports rotation through RotateSecrets.
+	TLSPrivateKeySecret *Secret
+	// TLSClientCAs are the certificate authorities client certificates are verified against
+	// for mutual TLS. Takes precedence over TLSClientCAFile.
+	TLSClientCAs *x509.CertPool
+	// TLSClientCAFile specifies a PEM file of the certificate authorities client certificates
+	// are verified against for mutual TLS.
+	TLSClientCAFile string
+	// TLSClientAuth is the client certificate policy of TLS connections. If client CAs are set,
+	// it defaults to tls.RequireAndVerifyClientCert; use tls.VerifyClientCertIfGiven to also
+	// accept clients without a certificate. Modes verifying certificates require client CAs.
+	// See Context.ClientCertificate.
+	TLSClientAuth tls.ClientAuthType
+	// Secrets are application secrets (cookie signing keys, JWT keys, ...) loaded from
+	// SecretProviders when the server starts. Access them with PuffApp.Secret.
+	Secrets map[string]*Secret
 	// OpenAPI configuration. Gives users access to the OpenAPI spec generated. Can be manipulated by the user.
 	OpenAPI *OpenAPI
 	// SwaggerUIConfig is the UI specific configuration.
 	SwaggerUIConfig *SwaggerUIConfig
 	// LoggerConfig is the application logger config.
 	LoggerConfig *LoggerConfig
+	// Tenancy enables tenant resolution for every request. The resolved tenant is available
+	// through Context.Tenant. Can be nil to disable multi-tenancy.
+	Tenancy *TenancyConfig
+	// Settings are the initial runtime settings, e.g. maintenance mode, that can be changed
+	// while serving with PuffApp.UpdateSettings. Can be nil.
+	Settings *RuntimeSettings
+	// SettingsFile is a JSON file of RuntimeSettings loaded when the server starts and again
+	// on PuffApp.ReloadSettings, e.g. triggered by SIGHUP with ReloadSettingsOnSignal.
+	SettingsFile string
+	// Audit configures the audit log written with Context.Audit. Can be nil to discard audit records.
+	Audit *AuditConfig
+	// PropagatedKeys are the Context keys (see Context.Set) copied into background task contexts
+	// created with Context.BackgroundContext or Context.Go, e.g. the authenticated principal.
+	PropagatedKeys []string
+	// IgnoreTimeoutBudget disables shrinking the request context deadline to the time budget
+	// sent by clients in the X-Request-Timeout or grpc-timeout headers.
+	IgnoreTimeoutBudget bool
+	// PathPolicy configures how request paths are sanitized before matching.
+	// If nil, DefaultPathPolicy is used, which rejects paths containing "." or ".."
+	// segments with 400 Bad Request.
+	PathPolicy *PathPolicy
+	// PanicCircuit trips routes that panic repeatedly into a 503 state for a cooldown period.
+	// Can be nil to disable.
+	PanicCircuit *PanicCircuitConfig
+	// CookieDefaults are the security attributes applied to response cookies set with
+	// Context.SetCookie and Context.Cookie. If nil, Context.Cookie uses DefaultCookieDefaults
+	// and Context.SetCookie writes cookies as given.
+	CookieDefaults *CookieDefaults
+	// Features reports which feature flags are enabled for routes gated with Route.Feature.
+	// If nil, every flag is disabled.
+	Features FeatureProvider
+	// DisabledFeatureStatus is the status code of routes whose feature flag is disabled,
+	// usually 404 or 403. Default: 404.
+	DisabledFeatureStatus int
+	// JSONParamNames names input fields without a name tag after their json tag, e.g. a
+	// field tagged `json:"user_id"` is sent as ?user_id=. Off by default, since it renames
+	// the parameters of existing fields with json tags. Set it before registering routes.
+	JSONParamNames bool
+	// CaseInsensitiveRouting matches route paths regardless of case, e.g. for clients of
+	// legacy systems sending mixed-case paths. Can also be enabled per Router.
+	CaseInsensitiveRouting bool
+	// RedirectCanonicalCase redirects requests matched case-insensitively to the path in the
+	// casing the route was registered with.
+	RedirectCanonicalCase bool
+	// MethodOverride lets POST requests be routed as PUT, PATCH or DELETE, as given by the
+	// X-HTTP-Method-Override header or the _method field of an urlencoded form, so HTML
+	// forms and legacy clients can use these methods.
+	MethodOverride bool
+	// IgnoredQueryParams are the query parameters left out of Context.CacheKey, e.g. tracking
+	// parameters. A trailing "*" matches by prefix. If nil, DefaultTrackingParams is used; set
+	// it to an empty slice to keep every parameter.
+	IgnoredQueryParams []string
+	// Rules are redirect and rewrite rules evaluated in order before routing.
+	// They can be loaded from a JSON file with LoadRules.
+	Rules []Rule
+	// ErrorConfig defines the JSON body of errors generated by puff and is documented as the
+	// Error component in OpenAPI. If nil, errors are sent as {"error": "message"}.
+	ErrorConfig *ErrorConfig
 	// DisableOpenAPIGeneration controls whether an OpenAPI schema will be generated.
 	DisableOpenAPIGeneration bool
+	// OpenAPIBaseline is the path of a previously generated OpenAPI spec. If set, the spec is
+	// diffed against it when the server starts, breaking changes are logged as warnings, and
+	// the changes are served as JSON at DocsURL + ".diff".
+	OpenAPIBaseline string
+	// DeferRegistrationErrors records errors of routes and routers registered on the app, e.g.
+	// malformed paths, instead of panicking at the first one. SelfCheck reports them together
+	// with route conflicts, each with the file:line it was registered at, so they can all be
+	// fixed at once. Routers not yet included into the app still panic.
+	DeferRegistrationErrors bool
+	// DisableSelfCheck skips running SelfCheck in ListenAndServe.
+	DisableSelfCheck bool
+	// HealthCheckTimeout is the time a single health check may take during SelfCheck. Default: 5 seconds.
+	HealthCheckTimeout time.Duration
+	// MaxDecodedBodyBytes is the maximum size of a request body sent with a gzip or deflate
+	// Content-Encoding once decompressed. Larger bodies are rejected with 413 Request Entity
+	// Too Large, so a small compressed body cannot exhaust memory. Default: 10 MiB.
+	MaxDecodedBodyBytes int64
 }
 
 func App(c *AppConfig) *PuffApp {
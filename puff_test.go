@@ -1,14 +1,42 @@
 package puff_test
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/sha1"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"database/sql"
 	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"math"
+	"math/big"
+	"mime"
+	"mime/multipart"
+	"net"
 	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"sync"
+	"syscall"
 	"testing"
+	"testing/fstest"
 	"time"
 
 	"github.com/ThePuffProject/puff"
@@ -81,6 +109,4516 @@ func TestDefaultApp(t *testing.T) {
 	}
 }
 
+func TestIncludeRouter_RegistrationError(t *testing.T) {
+	app := puff.DefaultApp("RegistrationErrorTest")
+	router := puff.NewRouter("Pizza", "/pizza")
+	app.IncludeRouter(router)
+
+	defer func() {
+		var regErr *puff.RegistrationError
+		err, _ := recover().(error)
+		if !errors.As(err, &regErr) {
+			t.Fatalf("Expected panic with *puff.RegistrationError, got %v", err)
+		}
+		if regErr.Kind != puff.RegistrationRouterAttached {
+			t.Errorf("Expected kind '%s', got '%s'", puff.RegistrationRouterAttached, regErr.Kind)
+		}
+	}()
+	app.IncludeRouter(router)
+}
+
+func TestJSONResponse_ETag(t *testing.T) {
+	app := puff.DefaultApp("ETagTest")
+	app.Get("/large", nil, func(c *puff.Context) {
+		c.SendResponse(puff.JSONResponse{Content: map[string]any{"pizza": "margherita"}, ETag: true})
+	})
+
+	rec := httptest.NewRecorder()
+	app.RootRouter.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/large", nil))
+	etag := rec.Header().Get("ETag")
+	if rec.Code != http.StatusOK || etag == "" {
+		t.Fatalf("Expected status 200 with an ETag, got %d and '%s'", rec.Code, etag)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/large", nil)
+	req.Header.Set("If-None-Match", etag)
+	rec = httptest.NewRecorder()
+	app.RootRouter.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("Expected status 304, got %d", rec.Code)
+	}
+	if rec.Body.Len() != 0 {
+		t.Errorf("Expected empty body, got '%s'", rec.Body.String())
+	}
+}
+
+func TestRoute_WithQuery(t *testing.T) {
+	app := puff.DefaultApp("WithQueryTest")
+	app.Get("/orders", nil, func(c *puff.Context) {
+		c.SendResponse(puff.GenericResponse{Content: "list"})
+	})
+	app.Get("/orders", nil, func(c *puff.Context) {
+		c.SendResponse(puff.GenericResponse{Content: "csv"})
+	}).WithQuery("export", "csv")
+
+	for target, expected := range map[string]string{
+		"/orders":             "list",
+		"/orders?export=csv":  "csv",
+		"/orders?export=json": "list",
+	} {
+		rec := httptest.NewRecorder()
+		app.RootRouter.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Body.String() != expected {
+			t.Errorf("Expected '%s' for %s, got '%s'", expected, target, rec.Body.String())
+		}
+	}
+}
+
+func TestRoute_CatchAll(t *testing.T) {
+	app := puff.DefaultApp("CatchAllTest")
+	type StaticInput struct {
+		Filepath string `kind:"path"`
+	}
+	input := new(StaticInput)
+	app.Get("/static/*filepath", input, func(c *puff.Context) {
+		c.SendResponse(puff.GenericResponse{Content: input.Filepath})
+	})
+	if err := app.SelfCheck(); err != nil {
+		t.Fatal(err)
+	}
+
+	for target, expected := range map[string]string{
+		"/static/app.js":         "app.js",
+		"/static/css/site/a.css": "css/site/a.css",
+	} {
+		rec := httptest.NewRecorder()
+		app.RootRouter.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != http.StatusOK || rec.Body.String() != expected {
+			t.Errorf("Expected 200 '%s' for %s, got %d '%s'", expected, target, rec.Code, rec.Body.String())
+		}
+	}
+	for _, target := range []string{"/static", "/static/"} {
+		rec := httptest.NewRecorder()
+		app.RootRouter.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("Expected 404 for %s, got %d", target, rec.Code)
+		}
+	}
+}
+
+func TestJSONResponse_PageLinks(t *testing.T) {
+	app := puff.DefaultApp("PageLinksTest")
+	app.Get("/pizzas", nil, func(c *puff.Context) {
+		page := c.Paginate(10, 50)
+		page.Total = 45
+		c.SendResponse(puff.JSONResponse{Content: []string{}, Page: &page})
+	})
+
+	rec := httptest.NewRecorder()
+	app.RootRouter.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://example.com/pizzas?page=2&sort=name", nil))
+	expected := `<http://example.com/pizzas?page=1&per_page=10&sort=name>; rel="first", ` +
+		`<http://example.com/pizzas?page=1&per_page=10&sort=name>; rel="prev", ` +
+		`<http://example.com/pizzas?page=3&per_page=10&sort=name>; rel="next", ` +
+		`<http://example.com/pizzas?page=5&per_page=10&sort=name>; rel="last"`
+	if link := rec.Header().Get("Link"); link != expected {
+		t.Errorf("Expected Link '%s', got '%s'", expected, link)
+	}
+}
+
+func TestRoute_PathConstraints(t *testing.T) {
+	app := puff.DefaultApp("PathConstraintsTest")
+	type CodeInput struct {
+		Code string `kind:"path" pattern:"^[A-Z]{3}$"`
+	}
+	app.Get("/users/{id:[0-9]+}", nil, func(c *puff.Context) {
+		c.SendResponse(puff.GenericResponse{Content: "user"})
+	})
+	app.Get("/users/me", nil, func(c *puff.Context) {
+		c.SendResponse(puff.GenericResponse{Content: "me"})
+	})
+	app.Get("/currencies/{code}", new(CodeInput), func(c *puff.Context) {
+		c.SendResponse(puff.GenericResponse{Content: "currency"})
+	})
+	if err := app.SelfCheck(); err != nil {
+		t.Fatal(err)
+	}
+
+	for target, expected := range map[string]int{
+		"/users/42":       http.StatusOK,
+		"/users/me":       http.StatusOK,
+		"/users/abc":      http.StatusNotFound,
+		"/currencies/EUR": http.StatusOK,
+		"/currencies/eur": http.StatusNotFound,
+	} {
+		rec := httptest.NewRecorder()
+		app.RootRouter.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != expected {
+			t.Errorf("Expected %d for %s, got %d", expected, target, rec.Code)
+		}
+	}
+}
+
+func TestRoute_Feature(t *testing.T) {
+	features := puff.StaticFeatures{}
+	app := puff.App(&puff.AppConfig{Name: "FeatureTest", Features: features})
+	app.Get("/billing", nil, func(c *puff.Context) {
+		c.SendResponse(puff.GenericResponse{Content: "billing"})
+	}).Feature("new-billing")
+
+	rec := httptest.NewRecorder()
+	app.RootRouter.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/billing", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 while the feature is disabled, got %d", rec.Code)
+	}
+	if paths, _ := app.GeneratePathsTags(); len(*paths) != 0 {
+		t.Errorf("Expected no OpenAPI paths while the feature is disabled, got %d", len(*paths))
+	}
+
+	features["new-billing"] = true
+	rec = httptest.NewRecorder()
+	app.RootRouter.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/billing", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected 200 once the feature is enabled, got %d", rec.Code)
+	}
+}
+
+func TestRouter_CaseInsensitive(t *testing.T) {
+	app := puff.App(&puff.AppConfig{Name: "CaseInsensitiveTest", RedirectCanonicalCase: true})
+	router := puff.NewRouter("Legacy", "/Legacy")
+	router.CaseInsensitive = true
+	app.IncludeRouter(router)
+	router.Get("/Orders/{id}", nil, func(c *puff.Context) {
+		c.SendResponse(puff.GenericResponse{Content: c.PathParams()["id"]})
+	})
+
+	rec := httptest.NewRecorder()
+	app.RootRouter.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/Legacy/Orders/AbC", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "AbC" {
+		t.Errorf("Expected 200 'AbC', got %d '%s'", rec.Code, rec.Body.String())
+	}
+	rec = httptest.NewRecorder()
+	app.RootRouter.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/legacy/ORDERS/AbC?x=1", nil))
+	if rec.Code != http.StatusPermanentRedirect || rec.Header().Get("Location") != "/Legacy/Orders/AbC?x=1" {
+		t.Errorf("Expected redirect to canonical casing, got %d '%s'", rec.Code, rec.Header().Get("Location"))
+	}
+}
+
+func TestRouter_Disable(t *testing.T) {
+	app := puff.DefaultApp("DisableTest")
+	router := puff.NewRouter("Billing", "/billing")
+	app.IncludeRouter(router)
+	router.Get("/invoices", nil, func(c *puff.Context) {
+		c.SendResponse(puff.GenericResponse{Content: "invoices"})
+	})
+
+	router.Disable(http.StatusServiceUnavailable, "120")
+	rec := httptest.NewRecorder()
+	app.RootRouter.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/billing/invoices", nil))
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") != "120" {
+		t.Errorf("Expected 503 with Retry-After while disabled, got %d '%s'", rec.Code, rec.Header().Get("Retry-After"))
+	}
+
+	router.Enable()
+	rec = httptest.NewRecorder()
+	app.RootRouter.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/billing/invoices", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected 200 once enabled, got %d", rec.Code)
+	}
+}
+
+func TestApp_RouterControl(t *testing.T) {
+	app := puff.DefaultApp("RouterControlTest")
+	router := puff.NewRouter("Billing", "/billing")
+	app.IncludeRouter(router)
+	router.Get("/invoices", nil, func(c *puff.Context) {
+		c.SendResponse(puff.GenericResponse{Content: "invoices"})
+	})
+	app.RouterControl("/admin")
+	handler := app.Handler()
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(method, target, strings.NewReader(body)))
+		return rec
+	}
+
+	if rec := do(http.MethodPost, "/admin/routers/Billing/disable", `{"status":404}`); rec.Code != http.StatusOK {
+		t.Fatalf("Expected the router to be disabled, got %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := do(http.MethodGet, "/billing/invoices", ""); rec.Code != http.StatusNotFound || !router.Disabled() {
+		t.Errorf("Expected 404 while disabled, got %d", rec.Code)
+	}
+	var states []puff.RouterState
+	json.Unmarshal(do(http.MethodGet, "/admin/routers", "").Body.Bytes(), &states)
+	if !slices.Contains(states, puff.RouterState{Name: "Billing", Prefix: "/billing", Disabled: true, StatusCode: http.StatusNotFound}) {
+		t.Errorf("Expected the disabled router to be listed, got %+v", states)
+	}
+
+	do(http.MethodPost, "/admin/routers/Billing/enable", "")
+	if rec := do(http.MethodGet, "/billing/invoices", ""); rec.Code != http.StatusOK {
+		t.Errorf("Expected 200 once enabled, got %d", rec.Code)
+	}
+
+	for target, status := range map[string]int{
+		"/admin/routers/Missing/disable":                     http.StatusNotFound,
+		"/admin/routers/RouterControl/disable":               http.StatusNotFound,
+		"/admin/routers/" + app.RootRouter.Name + "/disable": http.StatusNotFound,
+	} {
+		if rec := do(http.MethodPost, target, ""); rec.Code != status {
+			t.Errorf("Expected %d for %s, got %d %s", status, target, rec.Code, rec.Body.String())
+		}
+	}
+	if rec := do(http.MethodPost, "/admin/routers/Billing/disable", `{"status":200}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected a non-error status to be rejected, got %d", rec.Code)
+	}
+}
+
+func TestRouter_Static(t *testing.T) {
+	app := puff.DefaultApp("StaticTest")
+	app.RootRouter.StaticFS("/ui", fstest.MapFS{
+		"dist/index.html":  {Data: []byte("<h1>ui</h1>")},
+		"dist/css/app.css": {Data: []byte("body{}")},
+	}, "dist")
+
+	for target, expected := range map[string]string{
+		"/ui/":            "text/html; charset=utf-8",
+		"/ui/css/app.css": "text/css; charset=utf-8",
+	} {
+		rec := httptest.NewRecorder()
+		app.RootRouter.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != expected {
+			t.Errorf("Expected 200 %s for %s, got %d %s", expected, target, rec.Code, rec.Header().Get("Content-Type"))
+		}
+	}
+	rec := httptest.NewRecorder()
+	app.RootRouter.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ui/missing.js", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a missing file, got %d", rec.Code)
+	}
+	if paths, _ := app.GeneratePathsTags(); len(*paths) != 0 {
+		t.Errorf("Expected static routes to be excluded from OpenAPI, got %d paths", len(*paths))
+	}
+}
+
+func TestMultipartResponse(t *testing.T) {
+	app := puff.DefaultApp("MultipartTest")
+	app.Get("/batch", nil, func(c *puff.Context) {
+		c.SendResponse(puff.MultipartResponse{
+			Parts: []puff.MultipartPart{{ContentType: "application/json", Content: strings.NewReader(`{"id":1}`)}},
+			Stream: func(write func(puff.MultipartPart) error) error {
+				return write(puff.MultipartPart{ContentType: "text/plain", Content: strings.NewReader("second")})
+			},
+		})
+	})
+
+	rec := httptest.NewRecorder()
+	app.RootRouter.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/batch", nil))
+	mediaType, params, err := mime.ParseMediaType(rec.Header().Get("Content-Type"))
+	if err != nil || mediaType != "multipart/mixed" {
+		t.Fatalf("Expected multipart/mixed, got '%s'", rec.Header().Get("Content-Type"))
+	}
+	reader := multipart.NewReader(rec.Body, params["boundary"])
+	for _, expected := range []string{`{"id":1}`, "second"} {
+		part, err := reader.NextPart()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if body, _ := io.ReadAll(part); string(body) != expected {
+			t.Errorf("Expected part '%s', got '%s'", expected, body)
+		}
+	}
+}
+
+func TestApp_Batch(t *testing.T) {
+	app := puff.DefaultApp("BatchTest")
+	app.Get("/pizza/{name}", nil, func(c *puff.Context) {
+		c.SendResponse(puff.JSONResponse{Content: map[string]string{"name": c.PathParams()["name"]}})
+	})
+	app.Get("/panic", nil, func(c *puff.Context) {
+		panic("boom")
+	})
+	app.Batch("/batch", puff.DefaultBatchConfig)
+
+	rec := httptest.NewRecorder()
+	body := `[{"id":"a","path":"/pizza/margherita"},{"id":"b","path":"/panic"},{"id":"c","path":"/missing"}]`
+	app.RootRouter.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/batch", strings.NewReader(body)))
+	var responses []puff.BatchResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &responses); err != nil {
+		t.Fatalf("Expected a JSON array of responses, got '%s'", rec.Body.String())
+	}
+	for i, expected := range []int{http.StatusOK, http.StatusInternalServerError, http.StatusNotFound} {
+		if responses[i].Status != expected {
+			t.Errorf("Expected status %d for request %s, got %d", expected, responses[i].ID, responses[i].Status)
+		}
+	}
+	if string(responses[0].Body) != `{"name":"margherita"}` {
+		t.Errorf("Expected body of the first request, got '%s'", responses[0].Body)
+	}
+}
+
+func TestApp_BatchNestedAndErrors(t *testing.T) {
+	app := puff.DefaultApp("BatchTest")
+	app.Config.ErrorConfig = &puff.ErrorConfig{MessageKey: "message", IncludeStatus: true}
+	app.Batch("/batch", puff.DefaultBatchConfig)
+	app.Batch("/other-batch", puff.DefaultBatchConfig)
+
+	rec := httptest.NewRecorder()
+	body := `[{"id":"a","method":"POST","path":"/other-batch","body":[{"id":"x","path":"/other-batch"}]},{"id":"b","path":"relative"}]`
+	app.RootRouter.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/batch", strings.NewReader(body)))
+	var responses []puff.BatchResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &responses); err != nil || len(responses) != 2 {
+		t.Fatalf("Expected a JSON array of two responses, got '%s'", rec.Body.String())
+	}
+	if responses[0].Status != http.StatusBadRequest || !strings.Contains(string(responses[0].Body), "cannot be nested") {
+		t.Errorf("Expected a batch reached under another path to be rejected, got %d %s", responses[0].Status, responses[0].Body)
+	}
+	if string(responses[1].Body) != `{"message":"path must start with /","status":400}` {
+		t.Errorf("Expected the error body of ErrorConfig, got %s", responses[1].Body)
+	}
+}
+
+func TestApp_Host(t *testing.T) {
+	app := puff.DefaultApp("HostTest")
+	type TenantInput struct {
+		Tenant string `kind:"host" name:"tenant"`
+	}
+	tenants := puff.NewRouter("Tenants", "")
+	input := new(TenantInput)
+	tenants.Get("/home", input, func(c *puff.Context) {
+		c.SendResponse(puff.GenericResponse{Content: input.Tenant})
+	})
+	app.Host("{tenant}.example.com", tenants)
+	app.Get("/home", nil, func(c *puff.Context) {
+		c.SendResponse(puff.GenericResponse{Content: "root"})
+	})
+	if err := app.SelfCheck(); err != nil {
+		t.Fatal(err)
+	}
+
+	for host, expected := range map[string]string{
+		"acme.example.com:8000": "acme",
+		"example.com":           "root",
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/home", nil)
+		req.Host = host
+		rec := httptest.NewRecorder()
+		app.RootRouter.ServeHTTP(rec, req)
+		if rec.Body.String() != expected {
+			t.Errorf("Expected '%s' for host %s, got '%s'", expected, host, rec.Body.String())
+		}
+	}
+}
+
+type testUser struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+type testUserInput struct {
+	ID int `kind:"path" name:"id"`
+}
+
+type testUserController struct {
+	_ puff.ControllerRoutes `GetUser:"/users/{id}"`
+}
+
+func (uc *testUserController) GetUser(c *puff.Context, input *testUserInput) (*testUser, error) {
+	if input.ID != 1 {
+		return nil, &puff.HTTPError{StatusCode: http.StatusNotFound, Message: "user not found"}
+	}
+	return &testUser{ID: 1, Name: "Ada"}, nil
+}
+
+func (uc *testUserController) GetUserCount(c *puff.Context) (int, error) {
+	return 1, nil
+}
+
+func TestRouter_Controller(t *testing.T) {
+	app := puff.DefaultApp("ControllerTest")
+	routes := app.RootRouter.Controller(new(testUserController))
+	if len(routes) != 2 {
+		t.Fatalf("Expected 2 routes, got %d", len(routes))
+	}
+	if err := app.SelfCheck(); err != nil {
+		t.Fatal(err)
+	}
+
+	for target, expected := range map[string]string{
+		"/users/1":    `{"id":1,"name":"Ada"}`,
+		"/users/2":    `{"error":"user not found"}`,
+		"/user-count": "1",
+	} {
+		rec := httptest.NewRecorder()
+		app.RootRouter.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if strings.TrimSpace(rec.Body.String()) != expected {
+			t.Errorf("Expected '%s' for %s, got '%s'", expected, target, rec.Body.String())
+		}
+	}
+}
+
+func TestApp_ErrorConfig(t *testing.T) {
+	app := puff.DefaultApp("ErrorConfigTest")
+	app.Config.ErrorConfig = &puff.ErrorConfig{
+		Naming:             puff.CamelCase,
+		MessageKey:         "message",
+		IncludeStatus:      true,
+		IncludeFieldErrors: true,
+	}
+	app.Get("/items", &struct {
+		Limit int `kind:"query"`
+	}{}, func(c *puff.Context) {})
+	if err := app.SelfCheck(); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	app.RootRouter.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/items?limit=many", nil))
+	var body map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	fieldErrors, _ := body["fieldErrors"].([]any)
+	if rec.Code != http.StatusBadRequest || body["status"] != 400.0 || body["message"] == nil || len(fieldErrors) != 1 {
+		t.Errorf("Expected a 400 error body with one field error, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	app.RootRouter.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/missing", nil))
+	if strings.TrimSpace(rec.Body.String()) != `{"fieldErrors":[],"message":"not found","status":404}` {
+		t.Errorf("Unexpected 404 error body %s", rec.Body.String())
+	}
+}
+
+func TestApp_MethodOverride(t *testing.T) {
+	app := puff.DefaultApp("MethodOverrideTest")
+	app.Config.MethodOverride = true
+	app.Delete("/items/{id}", nil, func(c *puff.Context) {
+		c.SendResponse(puff.GenericResponse{Content: "deleted"})
+	})
+	app.Put("/items/{id}", nil, func(c *puff.Context) {
+		body, _ := c.GetBody()
+		c.SendResponse(puff.GenericResponse{Content: string(body)})
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/items/1", nil)
+	req.Header.Set("X-HTTP-Method-Override", "delete")
+	rec := httptest.NewRecorder()
+	app.RootRouter.ServeHTTP(rec, req)
+	if rec.Body.String() != "deleted" {
+		t.Errorf("Expected header override to DELETE, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/items/1", strings.NewReader("_method=PUT&name=a"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec = httptest.NewRecorder()
+	app.RootRouter.ServeHTTP(rec, req)
+	if rec.Body.String() != "_method=PUT&name=a" {
+		t.Errorf("Expected form override to PUT with the body intact, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/items/1", nil)
+	req.Header.Set("X-HTTP-Method-Override", "GET")
+	rec = httptest.NewRecorder()
+	app.RootRouter.ServeHTTP(rec, req)
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected override to GET to be ignored, got %d", rec.Code)
+	}
+}
+
+func TestRouter_Precedence(t *testing.T) {
+	app := puff.DefaultApp("PrecedenceTest")
+	handler := func(name string) func(*puff.Context) {
+		return func(c *puff.Context) {
+			c.SendResponse(puff.GenericResponse{Content: name})
+		}
+	}
+	app.Get("/files/*path", nil, handler("catch-all"))
+	app.Get("/users/{id}", nil, handler("param"))
+	app.Get("/users/new", nil, handler("static"))
+	app.Get("/files/{name}", nil, handler("file"))
+
+	admin := &puff.Router{Prefix: "/users"}
+	admin.Delete("/{id}", nil, handler("delete"))
+	app.IncludeRouter(admin)
+	usersettings := &puff.Router{Prefix: "/user"}
+	usersettings.Get("/settings", nil, handler("settings"))
+	app.IncludeRouter(usersettings)
+
+	for request, expected := range map[string]string{
+		"GET /users/new":       "static",
+		"GET /users/1":         "param",
+		"DELETE /users/new":    "delete",
+		"GET /files/a.txt":     "file",
+		"GET /files/a/b.txt":   "catch-all",
+		"GET /user/settings":   "settings",
+		"GET /users/1/unknown": "",
+	} {
+		method, target, _ := strings.Cut(request, " ")
+		rec := httptest.NewRecorder()
+		app.RootRouter.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+		if expected == "" {
+			if rec.Code != http.StatusNotFound {
+				t.Errorf("Expected 404 for %s, got %d", request, rec.Code)
+			}
+			continue
+		}
+		if rec.Body.String() != expected {
+			t.Errorf("Expected %s to be served by the %s route, got %d %s", request, expected, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestRoute_WithTimeout(t *testing.T) {
+	app := puff.DefaultApp("TimeoutTest")
+	slow := &puff.Router{Prefix: "/slow", Timeout: 10 * time.Millisecond}
+	slow.Get("/wait", nil, func(c *puff.Context) {
+		time.Sleep(100 * time.Millisecond)
+		c.SendResponse(puff.GenericResponse{Content: "too late"})
+	})
+	slow.Get("/fast", nil, func(c *puff.Context) {
+		c.SendResponse(puff.GenericResponse{Content: "fast"})
+	})
+	slow.Get("/extended", nil, func(c *puff.Context) {
+		time.Sleep(20 * time.Millisecond)
+		c.SendResponse(puff.GenericResponse{Content: "extended"})
+	}).WithTimeout(time.Second)
+	finished := make(chan struct{})
+	slow.Get("/headers", nil, func(c *puff.Context) {
+		defer close(finished)
+		c.SetResponseHeader("X-Partial", "1")
+		<-c.Request.Context().Done()
+		for i := range 100 {
+			c.SetResponseHeader("X-Late", fmt.Sprint(i))
+		}
+		c.SendResponse(puff.GenericResponse{Content: "too late"})
+	})
+	app.IncludeRouter(slow)
+
+	for target, expected := range map[string]int{
+		"/slow/wait":     http.StatusGatewayTimeout,
+		"/slow/fast":     http.StatusOK,
+		"/slow/extended": http.StatusOK,
+		"/slow/headers":  http.StatusGatewayTimeout,
+	} {
+		rec := httptest.NewRecorder()
+		app.RootRouter.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != expected {
+			t.Errorf("Expected %d for %s, got %d %s", expected, target, rec.Code, rec.Body.String())
+		}
+		if target == "/slow/headers" && (rec.Header().Get("X-Partial") != "" || strings.Contains(rec.Body.String(), "too late")) {
+			t.Errorf("Expected the headers and body of the timed out handler to be discarded, got %v %s", rec.Header(), rec.Body.String())
+		}
+	}
+	<-finished
+}
+
+func TestGenericResponse_Range(t *testing.T) {
+	app := puff.DefaultApp("RangeTest")
+	app.Get("/report", nil, func(c *puff.Context) {
+		c.SendResponse(puff.GenericResponse{Reader: strings.NewReader("0123456789")})
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/report", nil)
+	req.Header.Set("Range", "bytes=2-5")
+	rec := httptest.NewRecorder()
+	app.RootRouter.ServeHTTP(rec, req)
+	if rec.Code != http.StatusPartialContent || rec.Body.String() != "2345" {
+		t.Errorf("Expected 206 with 2345, got %d %s", rec.Code, rec.Body.String())
+	}
+	if rec.Header().Get("Content-Range") != "bytes 2-5/10" {
+		t.Errorf("Expected Content-Range bytes 2-5/10, got %s", rec.Header().Get("Content-Range"))
+	}
+
+	rec = httptest.NewRecorder()
+	app.RootRouter.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/report", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "0123456789" || rec.Header().Get("Accept-Ranges") != "bytes" {
+		t.Errorf("Expected the full content with Accept-Ranges, got %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestRouter_StaticCompressed(t *testing.T) {
+	app := puff.DefaultApp("StaticCompressedTest")
+	fsys := fstest.MapFS{
+		"app.js":    {Data: []byte("console.log('app');")},
+		"app.js.br": {Data: []byte("brotli")},
+		"style.css": {Data: []byte(strings.Repeat("body { color: red; }\n", 50))},
+	}
+	config := puff.DefaultStaticConfig
+	config.FS = fsys
+	config.Precompressed = true
+	config.CompressOnce = true
+	app.RootRouter.StaticWithConfig("/assets", config)
+
+	for _, tc := range []struct {
+		target, accept, encoding string
+	}{
+		{"/assets/app.js", "gzip, br", "br"},
+		{"/assets/app.js", "gzip, br;q=0", ""},
+		{"/assets/style.css", "gzip", "gzip"},
+		{"/assets/style.css", "", ""},
+	} {
+		req := httptest.NewRequest(http.MethodGet, tc.target, nil)
+		req.Header.Set("Accept-Encoding", tc.accept)
+		rec := httptest.NewRecorder()
+		app.RootRouter.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK || rec.Header().Get("Content-Encoding") != tc.encoding {
+			t.Errorf("Expected %s with Accept-Encoding %q to be encoded as %q, got %d %q", tc.target, tc.accept, tc.encoding, rec.Code, rec.Header().Get("Content-Encoding"))
+		}
+		if tc.encoding == "br" && rec.Body.String() != "brotli" {
+			t.Errorf("Expected the precompressed variant, got %s", rec.Body.String())
+		}
+	}
+}
+
+func TestRoute_Errors(t *testing.T) {
+	app := puff.DefaultApp("RouteErrorsTest")
+	app.Get("/users/{id}", &struct {
+		ID int `kind:"path"`
+	}{}, func(c *puff.Context) {
+		c.Fail(http.StatusNotFound)
+	}).Errors(puff.Err400("validation failed"), puff.Err404("user not found"))
+	if err := app.SelfCheck(); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	app.RootRouter.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/users/1", nil))
+	if rec.Code != http.StatusNotFound || strings.TrimSpace(rec.Body.String()) != `{"error":"user not found"}` {
+		t.Errorf("Expected the documented 404, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	paths, _ := app.GeneratePathsTags()
+	operation := (*paths)["/users/{id}"].Get
+	if operation == nil || operation.Responses["404"].Description != "user not found" || operation.Responses["400"].Description != "validation failed" {
+		t.Errorf("Expected the documented errors in OpenAPI, got %+v", operation)
+	}
+}
+
+func TestContext_RequireIfMatch(t *testing.T) {
+	app := puff.DefaultApp("RequireIfMatchTest")
+	app.Put("/pizzas/{id}", &struct {
+		ID int `kind:"path"`
+	}{}, func(c *puff.Context) {
+		if !c.RequireIfMatch("v2") {
+			return
+		}
+		c.SendResponse(puff.GenericResponse{Content: "updated"})
+	}).WithIfMatch()
+	if err := app.SelfCheck(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		ifMatch string
+		status  int
+	}{
+		{"", http.StatusPreconditionRequired},
+		{`"v1"`, http.StatusPreconditionFailed},
+		{`W/"v2"`, http.StatusPreconditionFailed},
+		{`"v1", "v2"`, http.StatusOK},
+		{"*", http.StatusOK},
+	} {
+		req := httptest.NewRequest(http.MethodPut, "/pizzas/1", nil)
+		if tc.ifMatch != "" {
+			req.Header.Set("If-Match", tc.ifMatch)
+		}
+		rec := httptest.NewRecorder()
+		app.RootRouter.ServeHTTP(rec, req)
+		if rec.Code != tc.status {
+			t.Errorf("Expected %d for If-Match %q, got %d %s", tc.status, tc.ifMatch, rec.Code, rec.Body.String())
+		}
+		if tc.status == http.StatusPreconditionFailed && rec.Header().Get("ETag") != `"v2"` {
+			t.Errorf("Expected the current ETag with 412, got %q", rec.Header().Get("ETag"))
+		}
+	}
+
+	paths, _ := app.GeneratePathsTags()
+	operation := (*paths)["/pizzas/{id}"].Put
+	if operation == nil || operation.Responses["412"].Description == "" || operation.Responses["428"].Description == "" {
+		t.Fatalf("Expected 412 and 428 in OpenAPI, got %+v", operation)
+	}
+	var documented bool
+	for _, p := range operation.Parameters {
+		if p.Name == "If-Match" && p.In == "header" && p.Required {
+			documented = true
+		}
+	}
+	if !documented {
+		t.Errorf("Expected the required If-Match header in OpenAPI, got %+v", operation.Parameters)
+	}
+}
+
+type conflictError struct{ key string }
+
+func (e *conflictError) Error() string { return "duplicate key " + e.key }
+
+func TestContext_HandleError(t *testing.T) {
+	app := puff.DefaultApp("HandleErrorTest")
+	app.MapError(sql.ErrNoRows, http.StatusNotFound)
+	puff.MapErrorType[*conflictError](app, http.StatusConflict)
+	input := &struct {
+		Case string `kind:"query"`
+	}{}
+	app.Get("/pizzas", input, func(c *puff.Context) {
+		c.HandleError(map[string]error{
+			"missing":  fmt.Errorf("loading pizza: %w", sql.ErrNoRows),
+			"conflict": fmt.Errorf("saving pizza: %w", &conflictError{key: "name"}),
+			"http":     puff.Err403("not your pizza"),
+			"other":    errors.New("connection refused"),
+		}[input.Case])
+	})
+	if err := app.SelfCheck(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		value, message string
+		status         int
+	}{
+		{"missing", "Not Found", http.StatusNotFound},
+		{"conflict", "Conflict", http.StatusConflict},
+		{"http", "not your pizza", http.StatusForbidden},
+		{"other", "An unexpected error occured.", http.StatusInternalServerError},
+	} {
+		rec := httptest.NewRecorder()
+		app.RootRouter.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/pizzas?Case="+tc.value, nil))
+		if rec.Code != tc.status || !strings.Contains(rec.Body.String(), tc.message) {
+			t.Errorf("Expected %d %q for %s, got %d %s", tc.status, tc.message, tc.value, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestContext_HandleErrorUsesErrorHandler(t *testing.T) {
+	app := puff.DefaultApp("HandleErrorTest")
+	app.MapError(sql.ErrNoRows, http.StatusNotFound)
+	api := puff.NewRouter("API", "/api")
+	api.ErrorHandler = func(c *puff.Context, err *puff.HTTPError) {
+		c.SendResponse(puff.GenericResponse{
+			StatusCode: err.StatusCode,
+			Content:    fmt.Sprintf("api: %s, no rows: %v", err.Message, errors.Is(err, sql.ErrNoRows)),
+		})
+	}
+	api.Get("/handled", nil, func(c *puff.Context) {
+		c.HandleError(fmt.Errorf("loading pizza: %w", sql.ErrNoRows))
+	})
+	api.Get("/panicked", nil, func(c *puff.Context) {
+		panic(sql.ErrNoRows)
+	})
+	app.IncludeRouter(api)
+	app.Get("/panicked", nil, func(c *puff.Context) {
+		panic(fmt.Errorf("loading pizza: %w", sql.ErrNoRows))
+	})
+	if err := app.SelfCheck(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		path, body string
+	}{
+		{"/api/handled", "api: Not Found, no rows: true"},
+		{"/api/panicked", "api: Not Found, no rows: true"},
+		{"/panicked", `"error":"Not Found"`},
+	} {
+		rec := httptest.NewRecorder()
+		app.RootRouter.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.path, nil))
+		if rec.Code != http.StatusNotFound || !strings.Contains(rec.Body.String(), tc.body) {
+			t.Errorf("Expected 404 %q for %s, got %d %s", tc.body, tc.path, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestApp_Routes(t *testing.T) {
+	app := puff.DefaultApp("RoutesTest")
+	api := puff.NewRouter("API", "/api")
+	api.Use(func(next puff.HandlerFunc) puff.HandlerFunc { return next })
+	api.Get("/users/{id}", &struct {
+		ID int `kind:"path"`
+	}{}, func(c *puff.Context) {})
+	app.IncludeRouter(api)
+
+	routes := app.Routes()
+	if len(routes) != 1 {
+		t.Fatalf("Expected 1 route, got %d", len(routes))
+	}
+	info := routes[0]
+	if info.Method != http.MethodGet || info.Path != "/api/users/{id}" || info.Router != "API" || info.OperationID != "getApiUsers/{id}" {
+		t.Errorf("Unexpected route info %+v", info)
+	}
+	if len(info.Params) != 1 || info.Params[0].Name != "ID" || info.Params[0].In != "path" {
+		t.Errorf("Expected the id path param, got %+v", info.Params)
+	}
+	if len(info.Middlewares) != 1 || !strings.HasPrefix(info.Middlewares[0], "puff_test.TestApp_Routes") {
+		t.Errorf("Expected the router middleware, got %v", info.Middlewares)
+	}
+}
+
+func TestRouter_ClearInherited(t *testing.T) {
+	auth := func(next puff.HandlerFunc) puff.HandlerFunc {
+		return func(c *puff.Context) {
+			if c.GetRequestHeader("Authorization") == "" {
+				c.Fail(http.StatusUnauthorized)
+				return
+			}
+			next(c)
+		}
+	}
+	signature := func(next puff.HandlerFunc) puff.HandlerFunc {
+		return func(c *puff.Context) {
+			c.SetResponseHeader("X-Signature-Checked", "yes")
+			next(c)
+		}
+	}
+	app := puff.DefaultApp("ClearInheritedTest")
+	api := puff.NewRouter("API", "/api")
+	api.Use(auth)
+	api.Get("/orders", nil, func(c *puff.Context) {
+		c.SendResponse(puff.GenericResponse{Content: "orders"})
+	})
+	webhooks := puff.NewRouter("Webhooks", "/webhooks").ClearInherited()
+	webhooks.Use(signature)
+	stripe := puff.NewRouter("Stripe", "/stripe")
+	stripe.Post("/events", nil, func(c *puff.Context) {
+		c.SendResponse(puff.GenericResponse{Content: "received"})
+	})
+	app.IncludeRouter(api)
+	api.IncludeRouter(webhooks)
+	webhooks.IncludeRouter(stripe)
+	if err := app.SelfCheck(); err != nil {
+		t.Fatal(err)
+	}
+	handler := app.Handler()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/orders", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the API to require auth, got %d %s", rec.Code, rec.Body.String())
+	}
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/webhooks/stripe/events", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("X-Signature-Checked") != "yes" {
+		t.Errorf("Expected the webhook without auth but with its own middleware, got %d %v", rec.Code, rec.Header())
+	}
+
+	for _, info := range app.Routes() {
+		if info.Router == "Stripe" && len(info.Middlewares) != 1 {
+			t.Errorf("Expected only the webhooks middleware, got %v", info.Middlewares)
+		}
+	}
+}
+
+type schemaPizza struct {
+	Name     string   `json:"name"`
+	Toppings []string `json:"toppings"`
+}
+
+func TestApp_JSONSchemas(t *testing.T) {
+	app := puff.DefaultApp("JSONSchemasTest")
+	app.RootRouter.Post("/pizzas/{id}", &struct {
+		ID   int         `kind:"path"`
+		Size string      `kind:"query" enum:"small,large"`
+		Body schemaPizza `kind:"body"`
+	}{}, func(c *puff.Context) {}).WithResponse(http.StatusCreated, puff.ResponseType[schemaPizza])
+
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			app.JSONSchemas()
+		}()
+	}
+	wg.Wait()
+	schemas, err := app.JSONSchemas()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(schemas) != 1 {
+		t.Fatalf("Expected 1 route, got %d", len(schemas))
+	}
+	s := schemas[0]
+	if s.Method != http.MethodPost || s.Path != "/pizzas/{id}" {
+		t.Errorf("Unexpected route %s %s", s.Method, s.Path)
+	}
+	b, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := string(b)
+	for _, want := range []string{
+		`"$schema":"https://json-schema.org/draft/2020-12/schema"`,
+		`"path":{"properties":{"ID":{"type":"integer"}},"required":["ID"],"type":"object"}`,
+		`"enum":["small","large"]`,
+		`"body":{"$ref":"#/$defs/schemaPizza"}`,
+		`"201":{"$defs":{"schemaPizza":`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected %s in the JSON schema, got %s", want, body)
+		}
+	}
+	if strings.Contains(body, "#/components/schemas") {
+		t.Errorf("Expected no OpenAPI references, got %s", body)
+	}
+
+	dir := t.TempDir()
+	if err := app.WriteJSONSchemas(dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "postPizzas_id.json")); err != nil {
+		t.Errorf("Expected the route schema file: %v", err)
+	}
+
+	app = puff.DefaultApp("JSONSchemasBadFieldsTest")
+	app.Post("/pizzas", &struct {
+		Size string `kind:"somewhere"`
+	}{}, func(c *puff.Context) {})
+	var regErr *puff.RegistrationError
+	if _, err := app.JSONSchemas(); !errors.As(err, &regErr) || regErr.Kind != puff.RegistrationBadFields {
+		t.Errorf("Expected the invalid fields to be reported, got %v", err)
+	}
+}
+
+func TestRouter_Redirect(t *testing.T) {
+	app := puff.DefaultApp("RedirectTest")
+	app.RootRouter.Redirect("/old", "/new", http.StatusMovedPermanently)
+	app.RootRouter.Redirect("/users/{id}/profile", "/profiles/{id}", http.StatusPermanentRedirect)
+
+	for _, tc := range []struct {
+		method, target, location string
+		status                   int
+	}{
+		{http.MethodGet, "/old?page=2", "/new?page=2", http.StatusMovedPermanently},
+		{http.MethodPost, "/old", "", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/users/a%20b/profile", "/profiles/a%20b", http.StatusPermanentRedirect},
+	} {
+		rec := httptest.NewRecorder()
+		app.RootRouter.ServeHTTP(rec, httptest.NewRequest(tc.method, tc.target, nil))
+		if rec.Code != tc.status || rec.Header().Get("Location") != tc.location {
+			t.Errorf("Expected %s %s to respond %d to %q, got %d to %q", tc.method, tc.target, tc.status, tc.location, rec.Code, rec.Header().Get("Location"))
+		}
+	}
+
+	paths, _ := app.GeneratePathsTags()
+	if res, ok := (*paths)["/old"].Get.Responses["301"]; !ok || res.Headers["Location"].Schema == nil {
+		t.Errorf("Expected the redirect to be documented, got %+v", (*paths)["/old"].Get.Responses)
+	}
+
+	// 300, 304, 305 and 306 do not redirect to a Location.
+	for _, status := range []int{http.StatusMultipleChoices, http.StatusNotModified, http.StatusUseProxy, 306, http.StatusOK} {
+		func() {
+			defer func() {
+				var regErr *puff.RegistrationError
+				if err, _ := recover().(error); !errors.As(err, &regErr) {
+					t.Errorf("Expected a registration error for status %d, got %v", status, err)
+				}
+			}()
+			app.RootRouter.Redirect(fmt.Sprintf("/status/%d", status), "/new", status)
+		}()
+	}
+}
+
+func TestApp_ServerHeader(t *testing.T) {
+	legacy := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "Apache/2.4.41 (Ubuntu)")
+		w.Header().Set("X-Powered-By", "PHP/7.4.3")
+		fmt.Fprint(w, "legacy")
+	})
+	for _, tc := range []struct {
+		config        func(*puff.AppConfig)
+		server, power string
+	}{
+		{func(*puff.AppConfig) {}, "Apache/2.4.41 (Ubuntu)", "PHP/7.4.3"},
+		{func(c *puff.AppConfig) { c.ServerHeader = "api" }, "api", "PHP/7.4.3"},
+		{func(c *puff.AppConfig) { c.ServerHeader, c.HideServerHeader = "api", true }, "", ""},
+	} {
+		app := puff.DefaultApp("ServerHeaderTest")
+		tc.config(app.Config)
+		app.RootRouter.MountHandler("/legacy", legacy)
+		app.Get("/pizzas", nil, func(c *puff.Context) {
+			c.SendResponse(puff.JSONResponse{Content: []string{"margherita"}})
+		})
+		app.SelfCheck()
+
+		rec := httptest.NewRecorder()
+		app.RootRouter.ServeHTTP(rec, httptest.NewRequest("GET", "/legacy", nil))
+		if rec.Header().Get("Server") != tc.server || rec.Header().Get("X-Powered-By") != tc.power {
+			t.Errorf("Expected Server %q and X-Powered-By %q, got %v", tc.server, tc.power, rec.Header())
+		}
+		for _, target := range []string{"/pizzas", "/missing"} {
+			rec = httptest.NewRecorder()
+			app.RootRouter.ServeHTTP(rec, httptest.NewRequest("GET", target, nil))
+			if expected := app.Config.ServerHeader; app.Config.HideServerHeader || expected == "" {
+				if _, ok := rec.Header()["Server"]; ok {
+					t.Errorf("Expected no Server header on %s, got %q", target, rec.Header().Get("Server"))
+				}
+			} else if rec.Header().Get("Server") != expected {
+				t.Errorf("Expected Server %q on %s, got %q", expected, target, rec.Header().Get("Server"))
+			}
+		}
+	}
+}
+
+func TestRouter_MountHandler(t *testing.T) {
+	app := puff.DefaultApp("MountHandlerTest")
+	echoPath := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s %s", r.Method, r.URL.Path)
+	})
+	api := puff.NewRouter("API", "/api")
+	api.MountHandler("/legacy", echoPath)
+	api.Handle("/debug", echoPath)
+	app.IncludeRouter(api)
+
+	for request, expected := range map[string]string{
+		"GET /api/legacy":           "GET /",
+		"POST /api/legacy/users/1":  "POST /users/1",
+		"DELETE /api/legacy/":       "DELETE /",
+		"GET /api/debug/pprof/heap": "GET /api/debug/pprof/heap",
+		"OPTIONS /api/debug/pprof/": "OPTIONS /api/debug/pprof/",
+	} {
+		method, target, _ := strings.Cut(request, " ")
+		rec := httptest.NewRecorder()
+		app.RootRouter.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+		if rec.Body.String() != expected {
+			t.Errorf("Expected %s to be served as %q, got %d %q", request, expected, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestRoute_StrictQuery(t *testing.T) {
+	app := puff.DefaultApp("StrictQueryTest")
+	app.Config.ErrorConfig = &puff.ErrorConfig{IncludeFieldErrors: true}
+	app.Get("/items", &struct {
+		PageSize int `kind:"query" name:"page_size" required:"false"`
+	}{}, func(c *puff.Context) {
+		c.SendResponse(puff.GenericResponse{Content: "ok"})
+	}).StrictQuery().AllowQuery("utm_source")
+	if err := app.SelfCheck(); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	app.RootRouter.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/items?page_size=10&utm_source=mail", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected declared query params to be accepted, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	app.RootRouter.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/items?pageSize=10&sort=asc", nil))
+	var body struct {
+		Error       string
+		FieldErrors []puff.FieldError `json:"field_errors"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &body)
+	if rec.Code != http.StatusBadRequest || body.Error != "unknown query params: pageSize, sort" || len(body.FieldErrors) != 2 {
+		t.Errorf("Expected 400 listing the unknown query params, got %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestRouter_RuntimeRegistration(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	app := puff.DefaultApp("RuntimeRegistrationTest")
+	app.Config.DisableSelfCheck = true
+	app.Use(func(next puff.HandlerFunc) puff.HandlerFunc {
+		return func(c *puff.Context) {
+			c.SetResponseHeader("X-Middleware", "applied")
+			next(c)
+		}
+	})
+	hooks := puff.NewRouter("Hooks", "/hooks")
+	app.IncludeRouter(hooks)
+	app.Post("/admin/hooks/{name}", &struct {
+		Name string `kind:"path"`
+	}{}, func(c *puff.Context) {
+		name := c.PathParams()["name"]
+		hooks.Get("/"+name, nil, func(c *puff.Context) {
+			c.SendResponse(puff.GenericResponse{Content: name})
+		})
+		c.SendResponse(puff.GenericResponse{StatusCode: http.StatusCreated})
+	})
+	app.Server = &http.Server{Addr: addr, Handler: app.RootRouter}
+	go app.ListenAndServe(addr)
+	defer app.Close()
+
+	var res *http.Response
+	for i := 0; i < 50; i++ {
+		if res, err = http.Post("http://"+addr+"/admin/hooks/deploy", "", nil); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	res, err = http.Get("http://" + addr + "/hooks/deploy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	if string(body) != "deploy" || res.Header.Get("X-Middleware") != "applied" {
+		t.Errorf("Expected the route registered at runtime with middlewares, got %d %s", res.StatusCode, body)
+	}
+
+	hooks.RemoveRoute(hooks.Routes[0])
+	res, err = http.Get("http://" + addr + "/hooks/deploy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 after removing the route, got %d", res.StatusCode)
+	}
+}
+
+func TestRoute_StrictBody(t *testing.T) {
+	type Address struct {
+		City string `json:"city"`
+	}
+	type Customer struct {
+		Name    string  `json:"name"`
+		Address Address `json:"address"`
+	}
+	app := puff.DefaultApp("StrictBodyTest")
+	app.Config.ErrorConfig = &puff.ErrorConfig{IncludeFieldErrors: true}
+	app.Post("/customers", &struct {
+		Body Customer `kind:"body" strict:"true"`
+	}{}, func(c *puff.Context) {
+		c.SendResponse(puff.GenericResponse{Content: "ok"})
+	})
+	if err := app.SelfCheck(); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	app.RootRouter.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/customers", strings.NewReader(`{"name":"Ada","address":{"city":"London"}}`)))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected known fields to be accepted, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	app.RootRouter.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/customers", strings.NewReader(`{"name":"Ada","nickname":"A","address":{"city":"London","zip":"N1"}}`)))
+	var body struct {
+		Error       string
+		FieldErrors []puff.FieldError `json:"field_errors"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &body)
+	if rec.Code != http.StatusBadRequest || body.Error != "unknown body fields: address.zip, nickname" || len(body.FieldErrors) != 2 {
+		t.Errorf("Expected 400 listing the unknown body fields, got %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestRoute_WithBulkhead(t *testing.T) {
+	app := puff.DefaultApp("BulkheadTest")
+	reports, err := puff.NewBulkhead("reports", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := puff.NewBulkhead("empty", 0); err == nil {
+		t.Error("Expected a bulkhead without slots to be rejected")
+	}
+	entered, unblock := make(chan struct{}), make(chan struct{})
+	app.Get("/reports/slow", nil, func(c *puff.Context) {
+		close(entered)
+		<-unblock
+		c.SendResponse(puff.GenericResponse{Content: "slow"})
+	}).WithBulkhead(reports)
+	timedOutEntered, timedOutUnblock := make(chan struct{}), make(chan struct{})
+	app.Get("/reports/timeout", nil, func(c *puff.Context) {
+		close(timedOutEntered)
+		<-timedOutUnblock
+	}).WithBulkhead(reports).WithTimeout(10 * time.Millisecond)
+	app.Get("/reports/fast", nil, func(c *puff.Context) {
+		c.SendResponse(puff.GenericResponse{Content: "fast"})
+	}).WithBulkhead(reports)
+	app.Get("/health", nil, func(c *puff.Context) {
+		c.SendResponse(puff.GenericResponse{Content: "ok"})
+	})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		app.RootRouter.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/reports/slow", nil))
+	}()
+	<-entered
+
+	rec := httptest.NewRecorder()
+	app.RootRouter.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/reports/fast", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 while the bulkhead is full, got %d %s", rec.Code, rec.Body.String())
+	}
+	rec = httptest.NewRecorder()
+	app.RootRouter.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected routes outside the bulkhead to be served, got %d", rec.Code)
+	}
+	stats := app.Bulkheads()
+	if len(stats) != 1 || stats[0].Name != "reports" || stats[0].InFlight != 1 || stats[0].Saturation != 1 || stats[0].Rejected != 1 {
+		t.Errorf("Unexpected bulkhead stats %+v", stats)
+	}
+
+	close(unblock)
+	<-done
+	rec = httptest.NewRecorder()
+	app.RootRouter.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/reports/fast", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected the freed bulkhead to serve requests, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	app.RootRouter.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/reports/timeout", nil))
+	<-timedOutEntered
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Errorf("Expected the slow handler to time out, got %d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	app.RootRouter.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/reports/fast", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected the slot to be held until the timed out handler returns, got %d", rec.Code)
+	}
+	close(timedOutUnblock)
+	for range 100 {
+		if app.Bulkheads()[0].InFlight == 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	rec = httptest.NewRecorder()
+	app.RootRouter.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/reports/fast", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected the slot to be freed once the timed out handler returned, got %d", rec.Code)
+	}
+}
+
+func TestRoute_WithBulkheadLiteral(t *testing.T) {
+	app := puff.DefaultApp("BulkheadLiteralTest")
+	exports := &puff.Bulkhead{Name: "exports", RetryAfter: 200 * time.Millisecond}
+	entered, unblock := make(chan struct{}), make(chan struct{})
+	app.Get("/exports", nil, func(c *puff.Context) {
+		if c.GetQueryParam("block") != "" {
+			close(entered)
+			<-unblock
+		}
+		c.SendResponse(puff.GenericResponse{Content: "export"})
+	}).WithBulkhead(exports)
+
+	if stats := app.Bulkheads(); len(stats) != 1 || stats[0].MaxConcurrent != 1 || stats[0].Saturation != 0 {
+		t.Errorf("Expected a struct literal to default to one slot, got %+v", stats)
+	}
+	rec := httptest.NewRecorder()
+	app.RootRouter.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/exports", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected a struct literal bulkhead to serve requests, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		app.RootRouter.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/exports?block=1", nil))
+	}()
+	<-entered
+	rec = httptest.NewRecorder()
+	app.RootRouter.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/exports", nil))
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") != "1" {
+		t.Errorf("Expected 503 with Retry-After rounded up to 1, got %d %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if strings.Contains(rec.Body.String(), "exports") {
+		t.Errorf("Expected the bulkhead name not to be sent to clients, got %s", rec.Body.String())
+	}
+	close(unblock)
+	<-done
+}
+
+func TestRoute_Deprecate(t *testing.T) {
+	app := puff.DefaultApp("DeprecateTest")
+	sunset := time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC)
+	app.Get("/v1/users", nil, func(c *puff.Context) {
+		c.SendResponse(puff.GenericResponse{Content: "ok"})
+	}).Deprecate(sunset, "https://example.com/migrate")
+	if err := app.SelfCheck(); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	app.RootRouter.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/users", nil))
+	if rec.Header().Get("Deprecation") != "true" || rec.Header().Get("Sunset") != "Tue, 01 Jan 2030 00:00:00 GMT" || rec.Header().Get("Link") != `<https://example.com/migrate>; rel="deprecation"` {
+		t.Errorf("Expected deprecation headers, got %v", rec.Header())
+	}
+
+	paths, _ := app.GeneratePathsTags()
+	operation := (*paths)["/v1/users"].Get
+	if operation == nil || !operation.Deprecated || operation.Sunset != "2030-01-01T00:00:00Z" {
+		t.Errorf("Expected the operation to be deprecated in OpenAPI, got %+v", operation)
+	}
+}
+
+func TestOperation_CodeSamples(t *testing.T) {
+	type NewUser struct {
+		Name string `json:"name"`
+		Age  int    `json:"age"`
+	}
+	app := puff.DefaultApp("CodeSamplesTest")
+	app.Config.BaseURL = "https://api.example.com"
+	app.Post("/teams/{team}/users", &struct {
+		Team  string  `kind:"path"`
+		Token string  `kind:"header" name:"X-Token"`
+		Body  NewUser `kind:"body"`
+	}{}, func(c *puff.Context) {})
+	if err := app.SelfCheck(); err != nil {
+		t.Fatal(err)
+	}
+
+	paths, _ := app.GeneratePathsTags()
+	operation := (*paths)["/teams/{team}/users"].Post
+	if operation == nil || len(operation.CodeSamples) != 2 {
+		t.Fatalf("Expected curl and HTTPie code samples, got %+v", operation)
+	}
+	curl := `curl -X POST https://api.example.com/teams/string/users -H 'X-Token: string' -H 'Content-Type: application/json' -d '{"age":255,"name":"string"}'`
+	if operation.CodeSamples[0].Source != curl {
+		t.Errorf("Expected curl sample %s, got %s", curl, operation.CodeSamples[0].Source)
+	}
+	httpie := `echo '{"age":255,"name":"string"}' | http POST https://api.example.com/teams/string/users X-Token:string`
+	if operation.CodeSamples[1].Source != httpie {
+		t.Errorf("Expected HTTPie sample %s, got %s", httpie, operation.CodeSamples[1].Source)
+	}
+}
+
+func TestRouter_PathConverters(t *testing.T) {
+	app := puff.DefaultApp("PathConvertersTest")
+	app.Get("/items/{id:int}", nil, func(c *puff.Context) {
+		c.SendResponse(puff.GenericResponse{Content: "item " + c.PathParams()["id"]})
+	})
+	app.Get("/objects/{uid:uuid}", &struct {
+		UID string `kind:"path"`
+	}{}, func(c *puff.Context) {
+		c.SendResponse(puff.GenericResponse{Content: "object"})
+	})
+	if err := app.SelfCheck(); err != nil {
+		t.Fatal(err)
+	}
+
+	for request, expected := range map[string]int{
+		"/items/42":  http.StatusOK,
+		"/items/-1":  http.StatusOK,
+		"/items/abc": http.StatusNotFound,
+		"/objects/6f1c2a4e-8b3d-4c5e-9f60-7a8b9c0d1e2f": http.StatusOK,
+		"/objects/not-a-uuid":                           http.StatusNotFound,
+	} {
+		rec := httptest.NewRecorder()
+		app.RootRouter.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, request, nil))
+		if rec.Code != expected {
+			t.Errorf("Expected %s to respond with %d, got %d", request, expected, rec.Code)
+		}
+	}
+
+	paths, _ := app.GeneratePathsTags()
+	items := (*paths)["/items/{id}"].Get
+	if items == nil || len(items.Parameters) != 1 || items.Parameters[0].Name != "id" || items.Parameters[0].Schema.Type != "integer" {
+		t.Errorf("Expected an integer path parameter, got %+v", items)
+	}
+	objects := (*paths)["/objects/{uid}"].Get
+	if objects == nil || len(objects.Parameters) != 1 || objects.Parameters[0].Schema.Format != "uuid" {
+		t.Errorf("Expected a uuid path parameter, got %+v", objects)
+	}
+}
+
+func TestHTMLResponse_TemplateFuncs(t *testing.T) {
+	app := puff.DefaultApp("TemplateFuncsTest")
+	app.Get("/users/{id}", &struct {
+		ID int `kind:"path"`
+	}{}, func(c *puff.Context) {}).WithName("user")
+	app.Get("/form", nil, func(c *puff.Context) {
+		c.Set(puff.SubjectKey, "ada")
+		c.SendResponse(puff.HTMLResponse{
+			Template: `{{csrfToken}}|{{urlFor "user" "id" 7}}|{{currentUser}}|{{range flash}}{{.}};{{end}}`,
+		})
+	})
+	app.Post("/save", nil, func(c *puff.Context) {
+		c.Flash("Saved.")
+		c.Flash("Welcome back.")
+		c.SendResponse(puff.GenericResponse{StatusCode: http.StatusSeeOther})
+	})
+	app.Get("/profile", nil, func(c *puff.Context) {
+		c.Set(puff.SubjectKey, "<b>eve</b>")
+		c.SendResponse(puff.HTMLResponse{Template: `{{currentUser}}|{{range flash}}{{.}}{{end}}|{{.}}`, Data: `"><img src=x>`})
+	})
+	app.Post("/comment", nil, func(c *puff.Context) {
+		c.Flash("<script>alert(1)</script>")
+		c.SendResponse(puff.GenericResponse{StatusCode: http.StatusSeeOther})
+	})
+	if err := app.SelfCheck(); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	app.RootRouter.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/save", nil))
+	var flash *http.Cookie
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == puff.FlashCookieName {
+			if flash != nil {
+				t.Errorf("Expected a single flash cookie, got %v", rec.Header().Values("Set-Cookie"))
+			}
+			flash = c
+		}
+	}
+	if flash == nil {
+		t.Fatal("Expected a flash cookie")
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/form", nil)
+	req.AddCookie(&http.Cookie{Name: puff.CSRFCookieName, Value: "token123"})
+	req.AddCookie(flash)
+	rec = httptest.NewRecorder()
+	app.RootRouter.ServeHTTP(rec, req)
+	expected := "token123|http://example.com/users/7|ada|Saved.;Welcome back.;"
+	if rec.Body.String() != expected {
+		t.Errorf("Expected template output %q, got %q", expected, rec.Body.String())
+	}
+	if cookies := rec.Result().Cookies(); len(cookies) != 1 || cookies[0].Name != puff.FlashCookieName || cookies[0].MaxAge >= 0 {
+		t.Errorf("Expected the flash cookie to be cleared, got %v", rec.Header().Values("Set-Cookie"))
+	}
+
+	rec = httptest.NewRecorder()
+	app.RootRouter.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/comment", nil))
+	req = httptest.NewRequest(http.MethodGet, "/profile", nil)
+	for _, c := range rec.Result().Cookies() {
+		req.AddCookie(c)
+	}
+	rec = httptest.NewRecorder()
+	app.RootRouter.ServeHTTP(rec, req)
+	expected = "&lt;b&gt;eve&lt;/b&gt;|&lt;script&gt;alert(1)&lt;/script&gt;|&#34;&gt;&lt;img src=x&gt;"
+	if rec.Body.String() != expected {
+		t.Errorf("Expected template output to be escaped as %q, got %q", expected, rec.Body.String())
+	}
+}
+
+func TestRouter_PartialSegmentParams(t *testing.T) {
+	app := puff.DefaultApp("PartialSegmentTest")
+	app.Get("/files/{name}.{ext}", nil, func(c *puff.Context) {
+		params := c.PathParams()
+		c.SendResponse(puff.GenericResponse{Content: params["name"] + " " + params["ext"]})
+	})
+	app.Get("/files/{name}", nil, func(c *puff.Context) {
+		c.SendResponse(puff.GenericResponse{Content: "plain " + c.PathParams()["name"]})
+	})
+	app.Get("/v{version:int}/users", nil, func(c *puff.Context) {
+		c.SendResponse(puff.GenericResponse{Content: "v" + c.PathParams()["version"]})
+	})
+	if err := app.SelfCheck(); err != nil {
+		t.Fatal(err)
+	}
+
+	for request, expected := range map[string]string{
+		"/files/report.pdf":     "report pdf",
+		"/files/archive.tar.gz": "archive.tar gz",
+		"/files/README":         "plain README",
+		"/v2/users":             "v2",
+	} {
+		rec := httptest.NewRecorder()
+		app.RootRouter.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, request, nil))
+		if rec.Body.String() != expected {
+			t.Errorf("Expected %s to be served as %q, got %d %q", request, expected, rec.Code, rec.Body.String())
+		}
+	}
+	rec := httptest.NewRecorder()
+	app.RootRouter.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/vx/users", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected a non-integer version to be rejected, got %d", rec.Code)
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("Expected adjacent path parameters to be rejected")
+			}
+		}()
+		app.Get("/{a}{b}", nil, func(c *puff.Context) {})
+	}()
+}
+
+func TestDiffOpenAPI(t *testing.T) {
+	type User struct {
+		Name  string `json:"name"`
+		Email string `json:"email"`
+	}
+	baselineApp := puff.DefaultApp("DiffBaseline")
+	baselineApp.Get("/users/{id}", &struct {
+		ID int `kind:"path"`
+	}{}, func(c *puff.Context) {}).WithResponse(http.StatusOK, puff.ResponseType[User])
+	baselineApp.Get("/health", nil, func(c *puff.Context) {})
+	if err := baselineApp.SelfCheck(); err != nil {
+		t.Fatal(err)
+	}
+	baseline, err := json.Marshal(baselineApp.Config.OpenAPI)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type UserV2 struct {
+		Name string `json:"name"`
+	}
+	app := puff.DefaultApp("DiffCurrent")
+	app.Get("/users/{id}", &struct {
+		ID     string `kind:"path"`
+		Fields string `kind:"query" name:"fields"`
+	}{}, func(c *puff.Context) {}).WithResponse(http.StatusOK, puff.ResponseType[UserV2])
+	app.Get("/status", nil, func(c *puff.Context) {})
+	changes, err := app.DiffOpenAPI(strings.NewReader(string(baseline)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var breaking []string
+	for _, change := range changes {
+		if change.Breaking {
+			breaking = append(breaking, change.String())
+		}
+	}
+	expected := []string{
+		"breaking change: GET /users/{id}: path param ID type changed from integer to string",
+		"breaking change: GET /users/{id}: new required query param fields",
+		"breaking change: GET /users/{id}: response 200 property email removed",
+		"breaking change: /health: path removed",
+	}
+	for _, e := range expected {
+		if !slices.Contains(breaking, e) {
+			t.Errorf("Expected %q among the breaking changes %q", e, breaking)
+		}
+	}
+	if len(breaking) != len(expected) {
+		t.Errorf("Expected %d breaking changes, got %q", len(expected), breaking)
+	}
+}
+
+func TestPathPolicy_DotSegments(t *testing.T) {
+	newApp := func(policy *puff.PathPolicy) *puff.PuffApp {
+		app := puff.DefaultApp("PathPolicyTest")
+		app.Config.PathPolicy = policy
+		api := puff.NewRouter("API", "/api")
+		app.IncludeRouter(api)
+		api.Get("/users", nil, func(c *puff.Context) {
+			c.SendResponse(puff.GenericResponse{Content: "users"})
+		})
+		app.Get("/admin", nil, func(c *puff.Context) {
+			c.SendResponse(puff.GenericResponse{Content: "admin"})
+		})
+		if err := app.SelfCheck(); err != nil {
+			t.Fatal(err)
+		}
+		return app
+	}
+	serve := func(app *puff.PuffApp, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.URL.Path = path
+		rec := httptest.NewRecorder()
+		app.RootRouter.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := serve(newApp(nil), "/api//users/../../admin")
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected dot segments to be rejected by default, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	app := newApp(&puff.PathPolicy{CollapseSlashes: true, ResolveDotSegments: true})
+	for path, expected := range map[string]string{
+		"/api//users/../../admin": "admin",
+		"/api/./users":            "users",
+		"/../../api/users":        "users",
+	} {
+		if rec := serve(app, path); rec.Body.String() != expected {
+			t.Errorf("Expected %s to resolve to %q, got %d %q", path, expected, rec.Code, rec.Body.String())
+		}
+	}
+
+	// without CollapseSlashes, resolving can leave leading slashes, which must not redirect to another host.
+	app = newApp(&puff.PathPolicy{ResolveDotSegments: true, RedirectCleaned: true})
+	for path, expected := range map[string]string{
+		"/api/./users":         "/api/users",
+		"/a/..//evil.example":  "/evil.example",
+		"/a/..///evil.example": "/evil.example",
+	} {
+		rec := serve(app, path)
+		if rec.Code != http.StatusPermanentRedirect || rec.Header().Get("Location") != expected {
+			t.Errorf("Expected %s to redirect to %s, got %d %q", path, expected, rec.Code, rec.Header().Get("Location"))
+		}
+	}
+}
+
+func TestPathPolicy(t *testing.T) {
+	newApp := func(policy *puff.PathPolicy) http.Handler {
+		app := puff.DefaultApp("PathPolicyTest")
+		app.Config.PathPolicy = policy
+		app.Get("/api/users", nil, func(c *puff.Context) {
+			c.SendResponse(puff.GenericResponse{Content: "users"})
+		})
+		return app.Handler()
+	}
+	serve := func(handler http.Handler, target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec
+	}
+
+	defaults := newApp(nil)
+	for _, tc := range []struct {
+		target string
+		status int
+	}{
+		{"/api//users", http.StatusOK},
+		{"/api/users%00", http.StatusOK},
+		{"/api/./users", http.StatusBadRequest},
+		{"/api/users/..", http.StatusBadRequest},
+		// percent-encoded dot segments are decoded before they are checked.
+		{"/api/%2e%2e/api/users", http.StatusBadRequest},
+		// dots within a segment are not dot segments.
+		{"/api/..users", http.StatusNotFound},
+	} {
+		if rec := serve(defaults, tc.target); rec.Code != tc.status {
+			t.Errorf("Expected %d for %s with the default policy, got %d %s", tc.status, tc.target, rec.Code, rec.Body.String())
+		}
+	}
+
+	if rec := serve(newApp(&puff.PathPolicy{}), "/api/users%00"); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected NUL bytes to be rejected without StripNullBytes, got %d", rec.Code)
+	}
+	if rec := serve(newApp(&puff.PathPolicy{}), "/api/./users"); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected dot segments to be served unchanged without RejectDotSegments, got %d", rec.Code)
+	}
+
+	rec := serve(newApp(&puff.PathPolicy{CollapseSlashes: true, ResolveDotSegments: true, RedirectCleaned: true}), "/api//x/../users?page=2")
+	if rec.Code != http.StatusPermanentRedirect || rec.Header().Get("Location") != "/api/users?page=2" {
+		t.Errorf("Expected a redirect to the cleaned path, got %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+}
+
+func listUsersHandler(c *puff.Context) {}
+
+func TestRouter_Tree(t *testing.T) {
+	app := puff.DefaultApp("TreeTest")
+	app.Config.DisableOpenAPIGeneration = true
+	api := puff.NewRouter("API", "/api")
+	app.IncludeRouter(api)
+	api.Use(func(next puff.HandlerFunc) puff.HandlerFunc { return next })
+	api.Get("/users", nil, listUsersHandler)
+
+	tree := app.RootRouter.Tree()
+	if len(tree.Routers) != 1 {
+		t.Fatalf("Expected one sub-router, got %+v", tree)
+	}
+	sub := tree.Routers[0]
+	if sub.Name != "API" || sub.Prefix != "/api" || len(sub.Middlewares) != 1 || len(sub.Routes) != 1 {
+		t.Fatalf("Unexpected sub-router %+v", sub)
+	}
+	if route := sub.Routes[0]; route.Method != http.MethodGet || route.Path != "/api/users" || route.Handler != "puff_test.listUsersHandler" {
+		t.Errorf("Unexpected route %+v", route)
+	}
+
+	b, err := app.RootRouter.TreeJSON()
+	if err != nil || !strings.Contains(string(b), `"handler": "puff_test.listUsersHandler"`) {
+		t.Errorf("Expected the handler in the JSON tree, got %s %v", b, err)
+	}
+	dot := app.RootRouter.TreeDOT()
+	if !strings.HasPrefix(dot, "digraph routes {") || !strings.Contains(dot, `GET /api/users\npuff_test.listUsersHandler`) {
+		t.Errorf("Unexpected DOT tree %s", dot)
+	}
+}
+
+func TestRouter_RPC(t *testing.T) {
+	type AddParams struct {
+		A int `json:"a"`
+		B int `json:"b"`
+	}
+	rpc := puff.NewRPC()
+	puff.RPCMethod(rpc, "add", "Adds two numbers.", func(c *puff.Context, p AddParams) (int, error) {
+		return p.A + p.B, nil
+	})
+	puff.RPCMethod(rpc, "fail", "", func(c *puff.Context, p struct{}) (int, error) {
+		return 0, &puff.RPCError{Code: 4, Message: "nope"}
+	})
+	if err := puff.RPCMethod(rpc, "add", "", func(c *puff.Context, p AddParams) (int, error) { return 0, nil }); err == nil {
+		t.Error("Expected an error registering a method twice")
+	}
+
+	app := puff.DefaultApp("RPCTest")
+	route := app.RPC("/rpc", rpc)
+
+	server, client := net.Pipe()
+	defer client.Close()
+	c := puff.NewContext(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/rpc", nil), app)
+	c.WebSocket = websocket.From(server)
+	go route.Handler(c)
+
+	conn := websocket.From(client)
+	for frame, expected := range map[string]string{
+		`{"id":1,"method":"add","params":{"a":2,"b":3}}`: `{"id":1,"result":5}`,
+		`{"id":2,"method":"fail"}`:                       `{"id":2,"error":{"code":4,"message":"nope"}}`,
+		`{"id":3,"method":"missing"}`:                    `{"id":3,"error":{"code":-32601,"message":"method not found: missing"}}`,
+		`{"id":4,"method":"add","params":"x"}`:           `{"id":4,"error":{"code":-32602,"message":"json: cannot unmarshal string into Go value of type puff_test.AddParams"}}`,
+	} {
+		if err := conn.Write(&websocket.Message{Type: websocket.MessageText, Data: []byte(frame)}); err != nil {
+			t.Fatal(err)
+		}
+		message, err := conn.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(message.Data) != expected {
+			t.Errorf("Expected %s for %s, got %s", expected, frame, message.Data)
+		}
+	}
+
+	methods := rpc.Methods()
+	if len(methods) != 2 || methods[0].Name != "add" || methods[0].Description != "Adds two numbers." || methods[0].Params == nil {
+		t.Errorf("Unexpected methods %+v", methods)
+	}
+}
+
+func TestRouter_HandleMethodsAndAny(t *testing.T) {
+	app := puff.DefaultApp("HandleTest")
+	routes := app.HandleMethods([]string{"get", "POST", "GET"}, "/items", nil, func(c *puff.Context) {
+		c.SendResponse(puff.GenericResponse{Content: c.Request.Method})
+	})
+	if len(routes) != 2 || routes[0].Protocol != http.MethodGet || routes[1].Protocol != http.MethodPost {
+		t.Fatalf("Expected GET and POST routes, got %+v", routes)
+	}
+	if routes := app.Any("/anything", nil, func(c *puff.Context) {}); len(routes) != 5 {
+		t.Errorf("Expected Any to register five routes, got %d", len(routes))
+	}
+	app.SelfCheck()
+
+	for _, method := range []string{http.MethodGet, http.MethodPost} {
+		rec := httptest.NewRecorder()
+		app.RootRouter.ServeHTTP(rec, httptest.NewRequest(method, "/items", nil))
+		if rec.Body.String() != method {
+			t.Errorf("Expected %s to be served, got %d %q", method, rec.Code, rec.Body.String())
+		}
+	}
+	rec := httptest.NewRecorder()
+	app.RootRouter.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/items", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 for DELETE, got %d", rec.Code)
+	}
+
+	paths, _ := app.GeneratePathsTags()
+	item := (*paths)["/items"]
+	if item.Get == nil || item.Post == nil || item.Put != nil {
+		t.Errorf("Expected GET and POST operations, got %+v", item)
+	}
+	if any := (*paths)["/anything"]; any.Get == nil || any.Post == nil || any.Put == nil || any.Patch == nil || any.Delete == nil {
+		t.Errorf("Expected all operations for Any, got %+v", any)
+	}
+
+	defer func() {
+		var regErr *puff.RegistrationError
+		if err, _ := recover().(error); !errors.As(err, &regErr) || regErr.Kind != puff.RegistrationBadMethod {
+			t.Errorf("Expected a bad method registration error, got %v", err)
+		}
+	}()
+	app.HandleMethods(nil, "/none", nil, func(c *puff.Context) {})
+}
+
+func TestKeyedLimiter(t *testing.T) {
+	if _, err := puff.NewKeyedLimiter(0, time.Second, 0); !errors.Is(err, puff.ErrInvalidRate) {
+		t.Errorf("Expected ErrInvalidRate for a zero burst, got %v", err)
+	}
+	limiter, err := puff.NewKeyedLimiter(2, 20*time.Millisecond, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !limiter.Allow("alice") || !limiter.Allow("alice") {
+		t.Fatal("Expected the burst to be allowed")
+	}
+	wait, ok := limiter.AllowN("alice", 1)
+	if ok || wait <= 0 || wait > 20*time.Millisecond {
+		t.Errorf("Expected alice to wait up to 20ms, got %v %v", wait, ok)
+	}
+	if !limiter.Allow("bob") {
+		t.Error("Expected bob to have a separate bucket")
+	}
+	if _, ok := limiter.AllowN("bob", 3); ok {
+		t.Error("Expected more than the burst to be rejected")
+	}
+
+	time.Sleep(25 * time.Millisecond)
+	if !limiter.Allow("alice") {
+		t.Error("Expected alice to be allowed after a refill")
+	}
+	limiter.Reset("alice")
+	if limiter.Len() != 1 || !limiter.Allow("alice") || !limiter.Allow("alice") {
+		t.Errorf("Expected a reset to refill the bucket, %d keys", limiter.Len())
+	}
+
+	if err := limiter.SetRate(2, 0); !errors.Is(err, puff.ErrInvalidRate) {
+		t.Errorf("Expected ErrInvalidRate for a zero refill, got %v", err)
+	}
+
+	bucket, err := puff.NewTokenBucket(1, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bucket.Allow() || bucket.Allow() || bucket.Tokens() != 0 {
+		t.Error("Expected the bucket to hold a single token")
+	}
+	if err := bucket.SetRate(-1, time.Hour); !errors.Is(err, puff.ErrInvalidRate) || bucket.Tokens() != 0 {
+		t.Errorf("Expected ErrInvalidRate keeping the rate, got %v", err)
+	}
+}
+
+func TestRouter_HeadOptionsTraceConnect(t *testing.T) {
+	app := puff.DefaultApp("MethodsTest")
+	echo := func(c *puff.Context) {
+		c.SetResponseHeader("X-Method", c.Request.Method)
+		c.SendResponse(puff.GenericResponse{StatusCode: http.StatusNoContent})
+	}
+	app.Head("/things", nil, echo)
+	app.Options("/things", nil, echo)
+	app.Trace("/things", nil, echo)
+	app.Connect("/tunnel", nil, echo)
+	app.SelfCheck()
+
+	for method, path := range map[string]string{
+		http.MethodHead:    "/things",
+		http.MethodOptions: "/things",
+		http.MethodTrace:   "/things",
+		http.MethodConnect: "/tunnel",
+	} {
+		rec := httptest.NewRecorder()
+		app.RootRouter.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+		if rec.Code != http.StatusNoContent || rec.Header().Get("X-Method") != method {
+			t.Errorf("Expected %s %s to be served, got %d", method, path, rec.Code)
+		}
+	}
+
+	paths, _ := app.GeneratePathsTags()
+	item := (*paths)["/things"]
+	if item.Head == nil || item.Options == nil || item.Trace == nil {
+		t.Errorf("Expected HEAD, OPTIONS and TRACE operations, got %+v", item)
+	}
+	if item.Head != nil && item.Head.CodeSamples[0].Source != "curl -I http://localhost:8000/things" {
+		t.Errorf("Unexpected HEAD code sample %q", item.Head.CodeSamples[0].Source)
+	}
+	if _, ok := (*paths)["/tunnel"]; ok {
+		t.Error("Expected CONNECT routes to be left out of OpenAPI")
+	}
+}
+
+func TestHealthCheckConstructors(t *testing.T) {
+	status := http.StatusOK
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if status == http.StatusOK {
+			time.Sleep(20 * time.Millisecond)
+		}
+		w.WriteHeader(status)
+	}))
+	defer upstream.Close()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed := listener.Addr().String()
+	listener.Close()
+
+	app := puff.DefaultApp("HealthTest")
+	app.Config.DisableOpenAPIGeneration = true
+	app.AddHealthCheck("upstream", puff.HTTPHealthCheck(upstream.URL, puff.HealthCheckConfig{SlowThreshold: 5 * time.Millisecond}))
+	app.AddHealthCheck("tcp", puff.TCPHealthCheck(upstream.Listener.Addr().String(), puff.HealthCheckConfig{Timeout: time.Second}))
+	app.AddHealthCheck("disk", puff.DiskSpaceHealthCheck(".", math.MaxUint64, 0, puff.HealthCheckConfig{}))
+	if err := app.SelfCheck(); err != nil {
+		t.Errorf("Expected degraded checks not to fail the self-check, got %v", err)
+	}
+
+	results := app.CheckHealth(context.Background())
+	for i, expected := range []puff.HealthStatus{puff.HealthDegraded, puff.HealthUp, puff.HealthDegraded} {
+		if results[i].Status != expected {
+			t.Errorf("Expected %s to be %s, got %+v", results[i].Name, expected, results[i])
+		}
+	}
+
+	status = http.StatusTooManyRequests
+	if err := puff.HTTPHealthCheck(upstream.URL, puff.HealthCheckConfig{})(context.Background()); !errors.As(err, new(*puff.DegradedError)) {
+		t.Errorf("Expected 429 to be degraded, got %v", err)
+	}
+	status = http.StatusInternalServerError
+	if err := puff.HTTPHealthCheck(upstream.URL, puff.HealthCheckConfig{})(context.Background()); err == nil || errors.As(err, new(*puff.DegradedError)) {
+		t.Errorf("Expected 500 to be down, got %v", err)
+	}
+
+	app.AddHealthCheck("closed", puff.TCPHealthCheck(closed, puff.HealthCheckConfig{Timeout: time.Second}))
+	var selfCheckErr *puff.SelfCheckError
+	if err := app.SelfCheck(); !errors.As(err, &selfCheckErr) || len(selfCheckErr.Problems) != 2 {
+		t.Errorf("Expected the upstream and closed checks to fail, got %v", err)
+	}
+}
+
+func TestContext_Audit(t *testing.T) {
+	var buf strings.Builder
+	app := puff.DefaultApp("AuditTest")
+	app.Config.Audit = &puff.AuditConfig{Sink: puff.NewJSONAuditSink(&buf)}
+	app.Delete("/users/{id}", &struct {
+		ID int `kind:"path"`
+	}{}, func(c *puff.Context) {
+		c.Set(puff.SubjectKey, "admin@example.com")
+		c.SetResponseHeader("X-Request-ID", "req-1")
+		if err := c.Audit("user.delete", "user:7", puff.AuditSuccess, "reason", "spam", "dangling"); err != nil {
+			t.Error(err)
+		}
+	})
+	app.SelfCheck()
+
+	req := httptest.NewRequest(http.MethodDelete, "/users/7", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	app.RootRouter.ServeHTTP(httptest.NewRecorder(), req)
+
+	var record puff.AuditRecord
+	if err := json.Unmarshal([]byte(buf.String()), &record); err != nil {
+		t.Fatalf("Expected a JSON audit record, got %q: %v", buf.String(), err)
+	}
+	if record.Action != "user.delete" || record.Target != "user:7" || record.Outcome != puff.AuditSuccess ||
+		record.Actor != "admin@example.com" || record.RequestID != "req-1" || record.IP != "10.0.0.1:1234" ||
+		record.Method != http.MethodDelete || record.Path != "/users/7" || record.Time.IsZero() {
+		t.Errorf("Unexpected audit record %+v", record)
+	}
+	if record.Fields["reason"] != "spam" || record.Fields["!BADKEY"] != "dangling" {
+		t.Errorf("Unexpected audit fields %v", record.Fields)
+	}
+
+	app.Config.Audit.Sink = puff.AuditSinkFunc(func(puff.AuditRecord) error { return errors.New("disk full") })
+	c := puff.NewContext(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", nil), app)
+	if err := c.Audit("user.create", "user:8", puff.AuditFailure); err == nil || !strings.Contains(err.Error(), "disk full") {
+		t.Errorf("Expected the sink error, got %v", err)
+	}
+}
+
+func TestResponses_Inheritance(t *testing.T) {
+	type AppError struct {
+		App string `json:"app"`
+	}
+	type RouterError struct {
+		Router string `json:"router"`
+	}
+	type Item struct {
+		Name string `json:"name"`
+	}
+	app := puff.DefaultApp("ResponsesTest")
+	app.WithDefaultResponses(
+		puff.DefineResponse(http.StatusUnauthorized, puff.ResponseType[AppError]),
+		puff.DefineResponse(http.StatusNotFound, puff.ResponseType[AppError]),
+	)
+	api := puff.NewRouter("API", "/api")
+	app.IncludeRouter(api)
+	api.WithResponses(puff.DefineResponse(http.StatusNotFound, puff.ResponseType[RouterError]))
+	api.Get("/items", nil, func(c *puff.Context) {}).WithResponse(http.StatusOK, puff.ResponseType[Item])
+	api.Get("/override", nil, func(c *puff.Context) {}).WithResponse(http.StatusUnauthorized, puff.ResponseType[Item])
+	app.SelfCheck()
+
+	paths, _ := app.GeneratePathsTags()
+	properties := func(path string, status string) map[string]*puff.Schema {
+		res, ok := (*paths)[path].Get.Responses[status]
+		if !ok {
+			t.Fatalf("Expected a %s response for %s", status, path)
+		}
+		schema := res.Content["application/json"].Schema
+		if schema.Ref != "" {
+			schema = puff.Schemas[strings.TrimPrefix(schema.Ref, "#/components/schemas/")]
+		}
+		return schema.Properties
+	}
+	if _, ok := properties("/api/items", "200")["name"]; !ok {
+		t.Error("Expected the route's own response")
+	}
+	if _, ok := properties("/api/items", "401")["app"]; !ok {
+		t.Error("Expected the app default response")
+	}
+	if _, ok := properties("/api/items", "404")["router"]; !ok {
+		t.Error("Expected the router response to take precedence over the app")
+	}
+	if _, ok := properties("/api/override", "401")["name"]; !ok {
+		t.Error("Expected the route response to take precedence over the app")
+	}
+}
+
+func TestContext_EnforceResponseSchemas(t *testing.T) {
+	type Pet struct {
+		Name string   `json:"name"`
+		Age  int      `json:"age"`
+		Tags []string `json:"tags,omitempty"`
+	}
+	app := puff.DefaultApp("DriftTest")
+	app.Config.Dev = true
+	app.Config.EnforceResponseSchemas = true
+	app.Get("/ok", nil, func(c *puff.Context) {
+		c.SendResponse(puff.JSONResponse{Content: Pet{Name: "Rex", Age: 3}})
+	}).WithResponse(http.StatusOK, puff.ResponseType[Pet])
+	app.Get("/drift", nil, func(c *puff.Context) {
+		c.SendResponse(puff.JSONResponse{Content: map[string]any{"name": 5, "color": "brown"}})
+	}).WithResponse(http.StatusOK, puff.ResponseType[Pet])
+	app.Get("/created", nil, func(c *puff.Context) {
+		c.SendResponse(puff.JSONResponse{StatusCode: http.StatusCreated, Content: Pet{}})
+	}).WithResponse(http.StatusOK, puff.ResponseType[Pet])
+	app.SelfCheck()
+
+	var logs strings.Builder
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+
+	serve := func(path string) string {
+		logs.Reset()
+		app.RootRouter.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+		return logs.String()
+	}
+	if out := serve("/ok"); out != "" {
+		t.Errorf("Expected no warnings for a matching response, got %s", out)
+	}
+	out := serve("/drift")
+	for _, expected := range []string{
+		"$.name is declared as string but sent as number",
+		"$.age is declared but missing",
+		"$.color is sent but not declared",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("Expected a warning %q, got %s", expected, out)
+		}
+	}
+	if strings.Contains(out, "$.tags") {
+		t.Errorf("Expected omitempty fields to be optional, got %s", out)
+	}
+	if out := serve("/created"); !strings.Contains(out, "status 201 is not declared") {
+		t.Errorf("Expected a warning for an undeclared status, got %s", out)
+	}
+
+	app.Config.Dev = false
+	if out := serve("/drift"); out != "" {
+		t.Errorf("Expected no checks outside dev mode, got %s", out)
+	}
+}
+
+func TestPuffApp_MountApp(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	header := func(key, value string) puff.Middleware {
+		return func(next puff.HandlerFunc) puff.HandlerFunc {
+			return func(c *puff.Context) {
+				c.SetResponseHeader(key, value)
+				next(c)
+			}
+		}
+	}
+	app := puff.DefaultApp("MainApp")
+	app.Config.DisableSelfCheck = true
+	app.Use(header("X-Main", "yes"))
+	app.Get("/hello", nil, func(c *puff.Context) {
+		c.SendResponse(puff.GenericResponse{Content: "main"})
+	})
+
+	admin := puff.DefaultApp("AdminApp")
+	admin.Config.ErrorConfig = &puff.ErrorConfig{MessageKey: "message"}
+	admin.Use(header("X-Admin", "yes"))
+	admin.Get("/hello", nil, func(c *puff.Context) {
+		c.SendResponse(puff.GenericResponse{Content: "admin"})
+	})
+	app.MountApp("/admin", admin)
+
+	app.Server = &http.Server{Addr: addr, Handler: app.RootRouter}
+	go app.ListenAndServe(addr)
+	defer app.Close()
+
+	get := func(path string) (*http.Response, string) {
+		var res *http.Response
+		for i := 0; i < 50; i++ {
+			if res, err = http.Get("http://" + addr + path); err == nil {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		return res, string(body)
+	}
+
+	if res, body := get("/hello"); body != "main" || res.Header.Get("X-Admin") != "" {
+		t.Errorf("Expected the main route without admin middlewares, got %s %v", body, res.Header)
+	}
+	if res, body := get("/admin/hello"); body != "admin" || res.Header.Get("X-Admin") != "yes" || res.Header.Get("X-Main") != "yes" {
+		t.Errorf("Expected the admin route with both middlewares, got %s %v", body, res.Header)
+	}
+	if res, body := get("/admin/missing"); res.StatusCode != http.StatusNotFound || !strings.Contains(body, `"message"`) {
+		t.Errorf("Expected a 404 shaped by the admin error config, got %d %s", res.StatusCode, body)
+	}
+
+	res, body := get("/admin/docs.json")
+	if res.StatusCode != http.StatusOK || !strings.Contains(body, `"/admin/hello"`) || !strings.Contains(body, `"title":"AdminApp"`) {
+		t.Errorf("Expected the admin OpenAPI document, got %d %s", res.StatusCode, body)
+	}
+	if res, body := get("/docs.json"); res.StatusCode != http.StatusOK || strings.Contains(body, "/admin/hello") {
+		t.Errorf("Expected the admin routes to be left out of the main document, got %s", body)
+	}
+	if _, body := get("/admin/docs"); !strings.Contains(body, `url: "\/admin\/docs.json"`) {
+		t.Errorf("Expected the admin Swagger UI to load the admin document, got %s", body)
+	}
+}
+
+func TestRoute_PathParamMisconfiguration(t *testing.T) {
+	registrationError := func(register func()) (regErr *puff.RegistrationError) {
+		defer func() {
+			err, _ := recover().(error)
+			errors.As(err, &regErr)
+		}()
+		register()
+		return nil
+	}
+
+	app := puff.DefaultApp("ParamsTest")
+	for _, path := range []string{"/a/{id}/b/{id}", "/files/{path}/*path"} {
+		err := registrationError(func() { app.Get(path, nil, func(c *puff.Context) {}) })
+		if err == nil || err.Kind != puff.RegistrationBadPath || !strings.Contains(err.Error(), "declared more than once") {
+			t.Errorf("Expected %s to be rejected as a duplicate, got %v", path, err)
+		}
+	}
+
+	users := puff.NewRouter("Users", "/users/{id}")
+	app.IncludeRouter(users)
+	users.Get("/posts/{id}", nil, func(c *puff.Context) {})
+	app.Get("/items/{id}", &struct {
+		ID    int `kind:"path"`
+		Extra int `kind:"path"`
+	}{}, func(c *puff.Context) {})
+	app.Get("/orders/{order_id}", &struct {
+		ID int `kind:"path"`
+	}{}, func(c *puff.Context) {})
+
+	var selfCheckErr *puff.SelfCheckError
+	if err := app.SelfCheck(); !errors.As(err, &selfCheckErr) || len(selfCheckErr.Problems) != 3 {
+		t.Fatalf("Expected three problems, got %v", err)
+	}
+	messages := selfCheckErr.Error()
+	for _, expected := range []string{
+		"path parameter id is declared more than once",
+		"field Extra is of kind path, but path /items/{id} only declares 1 path parameter(s)",
+		"field ID is bound to path parameter order_id of /orders/{order_id}, but is named ID",
+	} {
+		if !strings.Contains(messages, expected) {
+			t.Errorf("Expected %q in %s", expected, messages)
+		}
+	}
+}
+
+func TestCanonicalQuery(t *testing.T) {
+	for raw, expected := range map[string]string{
+		"b=2&a=1":                        "a=1&b=2",
+		"a=2&b=1&a=1":                    "a=2&a=1&b=1",
+		"q=hello%20world&x=%7Euser":      "q=hello+world&x=~user",
+		"flag&utm_source=x&UTM_Medium=y": "flag=",
+		"gclid=abc&page=2;sort=name":     "page=2&sort=name",
+		"bad=%zz":                        "bad=%25zz",
+		"":                               "",
+	} {
+		if actual := puff.CanonicalQuery(raw, puff.DefaultTrackingParams); actual != expected {
+			t.Errorf("Expected %q to canonicalize to %q, got %q", raw, expected, actual)
+		}
+	}
+
+	app := puff.DefaultApp("CacheKeyTest")
+	keys := map[string]bool{}
+	for _, target := range []string{"/products?size=m&color=red", "/products?color=red&size=m&utm_campaign=fall", "/products?color=red&fbclid=1&size=m"} {
+		c := puff.NewContext(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, target, nil), app)
+		keys[c.CacheKey()] = true
+	}
+	if len(keys) != 1 || !keys["GET /products?color=red&size=m"] {
+		t.Errorf("Expected a single cache key, got %v", keys)
+	}
+
+	app.Config.IgnoredQueryParams = []string{}
+	c := puff.NewContext(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/products?utm_source=x", nil), app)
+	if key := c.CacheKey(); key != "GET /products?utm_source=x" {
+		t.Errorf("Expected tracking params to be kept, got %q", key)
+	}
+}
+
+func TestPuffApp_DeferRegistrationErrors(t *testing.T) {
+	app := puff.DefaultApp("DeferTest")
+	app.Config.DeferRegistrationErrors = true
+	app.Get("/a/{id", nil, func(c *puff.Context) {})
+	app.Get("/users", nil, func(c *puff.Context) {})
+	app.Get("/users", nil, func(c *puff.Context) {})
+	app.HandleMethods(nil, "/none", nil, func(c *puff.Context) {})
+
+	var selfCheckErr *puff.SelfCheckError
+	if err := app.SelfCheck(); !errors.As(err, &selfCheckErr) || len(selfCheckErr.Problems) != 3 {
+		t.Fatalf("Expected three problems, got %v", err)
+	}
+	kinds := []puff.RegistrationErrorKind{puff.RegistrationBadPath, puff.RegistrationBadMethod, puff.RegistrationConflict}
+	for i, problem := range selfCheckErr.Problems {
+		var regErr *puff.RegistrationError
+		if !errors.As(problem, &regErr) || regErr.Kind != kinds[i] || !strings.Contains(regErr.Source, "puff_test.go:") {
+			t.Errorf("Expected a %s error with its source, got %v", kinds[i], problem)
+		}
+	}
+	if conflict := selfCheckErr.Problems[2].Error(); strings.Count(conflict, "puff_test.go:") != 2 {
+		t.Errorf("Expected the conflict to name both registrations, got %s", conflict)
+	}
+}
+
+func TestPuffApp_Handler(t *testing.T) {
+	app := puff.DefaultApp("HandlerTest")
+	app.Config.DocsURL = "/api/docs"
+	app.Use(func(next puff.HandlerFunc) puff.HandlerFunc {
+		return func(c *puff.Context) {
+			c.SetResponseHeader("X-Puff", "yes")
+			next(c)
+		}
+	})
+	api := puff.NewRouter("API", "/api")
+	app.IncludeRouter(api)
+	api.Get("/items/{id}", &struct {
+		ID int `kind:"path"`
+	}{}, func(c *puff.Context) {
+		c.SendResponse(puff.GenericResponse{Content: c.PathParams()["id"]})
+	})
+
+	mux := http.NewServeMux()
+	mux.Handle("/api/", app.Handler())
+	mux.HandleFunc("/legacy", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("legacy"))
+	})
+	if app.Handler() != app.Handler() {
+		t.Error("Expected Handler to return the same handler")
+	}
+
+	for path, expected := range map[string]string{"/api/items/7": "7", "/legacy": "legacy"} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Body.String() != expected {
+			t.Errorf("Expected %s to be served, got %d %q", path, rec.Code, rec.Body.String())
+		}
+		if path == "/api/items/7" && rec.Header().Get("X-Puff") != "yes" {
+			t.Error("Expected the puff middlewares to run")
+		}
+	}
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/docs.json", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"/api/items/{id}"`) {
+		t.Errorf("Expected the OpenAPI document, got %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestContext_ClientCertificate(t *testing.T) {
+	app := puff.DefaultApp("ClientCertTest")
+	app.Get("/whoami", nil, func(c *puff.Context) {
+		cert := c.ClientCertificate()
+		if cert == nil {
+			c.SendResponse(puff.GenericResponse{Content: "anonymous"})
+			return
+		}
+		c.SendResponse(puff.GenericResponse{Content: cert.Subject.CommonName})
+	})
+	handler := app.Handler()
+
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "billing-service"}}
+	for name, tc := range map[string]struct {
+		state    *tls.ConnectionState
+		expected string
+	}{
+		"plain":      {nil, "anonymous"},
+		"unverified": {&tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}, "anonymous"},
+		"verified": {&tls.ConnectionState{
+			PeerCertificates: []*x509.Certificate{cert},
+			VerifiedChains:   [][]*x509.Certificate{{cert}},
+		}, "billing-service"},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/whoami", nil)
+		req.TLS = tc.state
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Body.String() != tc.expected {
+			t.Errorf("%s: expected %q, got %q", name, tc.expected, rec.Body.String())
+		}
+	}
+}
+
+func TestRoute_Enum(t *testing.T) {
+	type Topping struct {
+		Name   string  `json:"name" enum:"cheese,ham"`
+		Amount float64 `json:"amount" enum:"1,2,3"`
+	}
+	app := puff.DefaultApp("EnumTest")
+	app.Post("/pizzas", &struct {
+		Size string  `kind:"query" enum:"small,medium,large"`
+		Body Topping `kind:"body"`
+	}{}, func(c *puff.Context) {
+		c.SendResponse(puff.GenericResponse{Content: "ok"})
+	})
+	if err := app.SelfCheck(); err != nil {
+		t.Fatal(err)
+	}
+
+	for target, body := range map[string]string{
+		"/pizzas?Size=medium": `{"name":"ham","amount":2}`,
+		"/pizzas?Size=huge":   `{"name":"ham","amount":2}`,
+		"/pizzas?Size=small":  `{"name":"olives","amount":2}`,
+		"/pizzas?Size=large":  `{"name":"cheese","amount":4}`,
+	} {
+		rec := httptest.NewRecorder()
+		app.RootRouter.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, target, strings.NewReader(body)))
+		valid := strings.HasSuffix(target, "medium")
+		if valid && rec.Code != http.StatusOK {
+			t.Errorf("Expected %s %s to be accepted, got %d %s", target, body, rec.Code, rec.Body.String())
+		}
+		if !valid && (rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "not one of the allowed values")) {
+			t.Errorf("Expected %s %s to be rejected, got %d %s", target, body, rec.Code, rec.Body.String())
+		}
+	}
+
+	app.GenerateOpenAPISpec()
+	spec, _ := json.Marshal(app.Config.OpenAPI)
+	if !strings.Contains(string(spec), `"enum":["small","medium","large"]`) || !strings.Contains(string(spec), `"enum":[1,2,3]`) {
+		t.Errorf("Expected the enum values in the OpenAPI spec, got %s", spec)
+	}
+
+	bad := puff.DefaultApp("BadEnumTest")
+	bad.Get("/bad", &struct {
+		Count int `kind:"query" enum:"one,two"`
+	}{}, func(c *puff.Context) {})
+	if err := bad.SelfCheck(); err == nil || !strings.Contains(err.Error(), "invalid enum on field Count") {
+		t.Errorf("Expected an invalid enum to be reported, got %v", err)
+	}
+
+	// enums of nested bodies and of responses are reported as registration errors.
+	type size struct {
+		Inches int `json:"inches" enum:"ten,twelve"`
+	}
+	nested := puff.DefaultApp("NestedBadEnumTest")
+	nested.Post("/bad", &struct {
+		Body struct {
+			Sizes []size `json:"sizes"`
+		}
+	}{}, func(c *puff.Context) {})
+	nested.Get("/bad-response", nil, func(c *puff.Context) {}).WithResponse(http.StatusOK, puff.ResponseType[size])
+	var regErr *puff.RegistrationError
+	err := nested.SelfCheck()
+	if !errors.As(err, &regErr) || regErr.Kind != puff.RegistrationBadFields || !strings.Contains(err.Error(), "invalid enum on field Inches") {
+		t.Errorf("Expected the invalid nested enum to be a registration error, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "/bad-response") {
+		t.Errorf("Expected the invalid response enum to be reported, got %v", err)
+	}
+}
+
+type bookingInput struct {
+	From int `kind:"query"`
+	To   int `kind:"query"`
+}
+
+func (b *bookingInput) Validate() error {
+	if b.From >= b.To {
+		return errors.Join(
+			&puff.FieldError{Field: "From", In: "query", Message: "must be before To"},
+			&puff.FieldError{Field: "To", In: "query", Message: "must be after From"},
+		)
+	}
+	return nil
+}
+
+type ownedInput struct {
+	Owner string `kind:"query"`
+}
+
+func (o *ownedInput) Validate(c *puff.Context) error {
+	if o.Owner != c.GetRequestHeader("X-User") {
+		return puff.Err403("not your resource")
+	}
+	return nil
+}
+
+func TestRoute_FieldsValidator(t *testing.T) {
+	app := puff.DefaultApp("ValidatorTest")
+	app.Config.ErrorConfig = &puff.ErrorConfig{IncludeFieldErrors: true}
+	app.Get("/bookings", &bookingInput{}, func(c *puff.Context) {
+		c.SendResponse(puff.GenericResponse{Content: "ok"})
+	})
+	app.Get("/owned", &ownedInput{}, func(c *puff.Context) {
+		c.SendResponse(puff.GenericResponse{Content: "ok"})
+	})
+	if err := app.SelfCheck(); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	app.RootRouter.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/bookings?From=1&To=2", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected a valid booking to be accepted, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	app.RootRouter.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/bookings?From=3&To=2", nil))
+	var body struct {
+		FieldErrors []puff.FieldError `json:"field_errors"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &body)
+	if rec.Code != http.StatusUnprocessableEntity || len(body.FieldErrors) != 2 || body.FieldErrors[0].Message != "must be before To" {
+		t.Errorf("Expected 422 with both field errors, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/owned?Owner=ana", nil)
+	req.Header.Set("X-User", "bob")
+	rec = httptest.NewRecorder()
+	app.RootRouter.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), "not your resource") {
+		t.Errorf("Expected the status of the returned HTTPError, got %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestPuffApp_ReloadSettings(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "settings.json")
+	if err := os.WriteFile(file, []byte(`{"rate_limits": {"login": {"burst": 5, "refill": "1m"}}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	app := puff.DefaultApp("SettingsTest")
+	app.Config.SettingsFile = file
+	app.Get("/", nil, func(c *puff.Context) {
+		c.SendResponse(puff.GenericResponse{Content: "ok"})
+	})
+	var notified []puff.RuntimeSettings
+	app.OnSettingsChange(func(s puff.RuntimeSettings) { notified = append(notified, s) })
+	handler := app.Handler()
+
+	if got := app.Settings().RateLimits["login"]; got.Burst != 5 || got.Refill != time.Minute {
+		t.Errorf("Expected the settings file to be loaded, got %+v", got)
+	}
+
+	if err := os.WriteFile(file, []byte(`{"maintenance": true, "log_level": "DEBUG"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.ReloadSettings(); err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), "down for maintenance") {
+		t.Errorf("Expected 503 in maintenance mode, got %d %s", rec.Code, rec.Body.String())
+	}
+	s := app.Settings()
+	if s.LogLevel != slog.LevelDebug || s.RateLimits["login"].Burst != 5 {
+		t.Errorf("Expected the reload to keep settings missing from the file, got %+v", s)
+	}
+	if len(notified) != 2 || !notified[1].Maintenance {
+		t.Errorf("Expected subscribers to be notified of both loads, got %+v", notified)
+	}
+
+	if err := os.WriteFile(file, []byte(`{"maintenance": fals`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.ReloadSettings(); err == nil || !app.Settings().Maintenance {
+		t.Errorf("Expected a broken file to keep the current settings, got %v", err)
+	}
+	app.UpdateSettings(puff.RuntimeSettings{})
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected requests to be served after maintenance, got %d", rec.Code)
+	}
+}
+
+func TestRoute_TimeFields(t *testing.T) {
+	app := puff.DefaultApp("TimeTest")
+	input := &struct {
+		Day     time.Time     `kind:"query" layout:"2006-01-02"`
+		Since   time.Time     `kind:"header" name:"X-Since"`
+		Timeout time.Duration `kind:"query" required:"false"`
+	}{}
+	app.Get("/reports", input, func(c *puff.Context) {
+		c.SendResponse(puff.GenericResponse{Content: fmt.Sprintf("%s %s %s", input.Day.Format(time.DateOnly), input.Since.Format(time.RFC3339), input.Timeout)})
+	})
+	if err := app.SelfCheck(); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/reports?Day=2024-05-01&Timeout=1m30s", nil)
+	req.Header.Set("X-Since", "2024-04-01T08:00:00Z")
+	rec := httptest.NewRecorder()
+	app.RootRouter.ServeHTTP(rec, req)
+	if rec.Body.String() != "2024-05-01 2024-04-01T08:00:00Z 1m30s" {
+		t.Errorf("Expected the time fields to be parsed, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/reports?Day=01/05/2024", nil)
+	req.Header.Set("X-Since", "2024-04-01T08:00:00Z")
+	rec = httptest.NewRecorder()
+	app.RootRouter.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "formatted like 2024-03-14") {
+		t.Errorf("Expected a 400 naming the layout, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	app.GenerateOpenAPISpec()
+	spec, _ := json.Marshal(app.Config.OpenAPI)
+	for _, expected := range []string{`"format":"date"`, `"format":"date-time"`, `"format":"duration"`} {
+		if !strings.Contains(string(spec), expected) {
+			t.Errorf("Expected %s in the OpenAPI spec, got %s", expected, spec)
+		}
+	}
+}
+
+func TestRoute_QuerySlices(t *testing.T) {
+	app := puff.DefaultApp("QuerySlicesTest")
+	input := &struct {
+		Tags  []string `kind:"query" enum:"veggie,spicy,vegan"`
+		IDs   []int    `kind:"query" explode:"false" required:"false"`
+		Sizes []string `kind:"query" required:"false" pattern:"^[SML]$"`
+	}{}
+	app.Get("/pizzas", input, func(c *puff.Context) {
+		c.SendResponse(puff.GenericResponse{Content: fmt.Sprintf("%q %v %d", input.Tags, input.IDs, len(input.Sizes))})
+	})
+	if err := app.SelfCheck(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		target, expected string
+		status           int
+	}{
+		{"/pizzas?Tags=veggie&Tags=spicy&IDs=1,2,3", `["veggie" "spicy"] [1 2 3] 0`, http.StatusOK},
+		{"/pizzas?Tags=vegan&Sizes=S&Sizes=L", `["vegan"] [] 2`, http.StatusOK},
+		{"/pizzas", "", http.StatusBadRequest},
+		{"/pizzas?Tags=meaty", "", http.StatusBadRequest},
+		{"/pizzas?Tags=vegan&IDs=1,two", "", http.StatusBadRequest},
+		{"/pizzas?Tags=vegan&Sizes=XL", "", http.StatusBadRequest},
+	} {
+		rec := httptest.NewRecorder()
+		app.RootRouter.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.target, nil))
+		if rec.Code != tc.status || (tc.expected != "" && rec.Body.String() != tc.expected) {
+			t.Errorf("Expected %d %s for %s, got %d %s", tc.status, tc.expected, tc.target, rec.Code, rec.Body.String())
+		}
+	}
+
+	app.GenerateOpenAPISpec()
+	spec, _ := json.Marshal(app.Config.OpenAPI)
+	for _, expected := range []string{
+		`"name":"Tags","in":"query","description":"","required":true,"type":"","deprecated":false,"allowEmptyValue":false,"style":"form","explode":true`,
+		`"name":"IDs","in":"query","description":"","required":false,"type":"","deprecated":false,"allowEmptyValue":false,"style":"form","explode":false`,
+		`"items":{"format":"string","enum":["veggie","spicy","vegan"]`,
+	} {
+		if !strings.Contains(string(spec), expected) {
+			t.Errorf("Expected %s in the OpenAPI spec, got %s", expected, spec)
+		}
+	}
+}
+
+func TestRoute_WireNames(t *testing.T) {
+	app := puff.DefaultApp("WireNamesTest")
+	app.Config.JSONParamNames = true
+	input := &struct {
+		UserID int    `kind:"query" json:"user_id,omitempty"`
+		Tenant string `kind:"header" name:"X-Tenant" json:"tenant"`
+		Page   int    `kind:"query" json:"-" required:"false"`
+		Body   struct {
+			Bio string `json:"bio"`
+		} `json:"profile"`
+	}{}
+	app.Post("/users", input, func(c *puff.Context) {
+		c.SendResponse(puff.GenericResponse{Content: fmt.Sprintf("%d %s %d %s", input.UserID, input.Tenant, input.Page, input.Body.Bio)})
+	})
+	if err := app.SelfCheck(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		target, expected string
+		status           int
+	}{
+		{"/users?user_id=7&Page=2", "7 acme 2 pizza", http.StatusOK},
+		{"/users?UserID=7", "", http.StatusBadRequest},
+	} {
+		req := httptest.NewRequest(http.MethodPost, tc.target, strings.NewReader(`{"bio":"pizza"}`))
+		req.Header.Set("X-Tenant", "acme")
+		rec := httptest.NewRecorder()
+		app.RootRouter.ServeHTTP(rec, req)
+		if rec.Code != tc.status || (tc.expected != "" && rec.Body.String() != tc.expected) {
+			t.Errorf("Expected %d %s for %s, got %d %s", tc.status, tc.expected, tc.target, rec.Code, rec.Body.String())
+		}
+	}
+
+	app.GenerateOpenAPISpec()
+	spec, _ := json.Marshal(app.Config.OpenAPI)
+	for _, expected := range []string{`"name":"user_id","in":"query"`, `"name":"X-Tenant","in":"header"`, `"name":"Page","in":"query"`} {
+		if !strings.Contains(string(spec), expected) {
+			t.Errorf("Expected %s in the OpenAPI spec, got %s", expected, spec)
+		}
+	}
+
+	// without JSONParamNames, json tags do not rename parameters.
+	app = puff.DefaultApp("WireNamesTest")
+	legacy := &struct {
+		UserID int `kind:"query" json:"user_id"`
+	}{}
+	app.Get("/users", legacy, func(c *puff.Context) {
+		c.SendResponse(puff.GenericResponse{Content: fmt.Sprint(legacy.UserID)})
+	})
+	if err := app.SelfCheck(); err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	app.RootRouter.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/users?UserID=7", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "7" {
+		t.Errorf("Expected the Go name by default, got %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+type selectablePizza struct {
+	Name   string            `json:"name"`
+	Price  float64           `json:"price"`
+	Owner  map[string]string `json:"owner"`
+	Secret string            `json:"secret"`
+}
+
+func TestRoute_WithFieldSelection(t *testing.T) {
+	app := puff.DefaultApp("FieldSelectionTest")
+	pizzas := []selectablePizza{
+		{Name: "margherita", Price: 9.5, Owner: map[string]string{"name": "ana", "email": "ana@example.com"}, Secret: "s1"},
+		{Name: "diavola", Price: 11, Owner: map[string]string{"name": "bo", "email": "bo@example.com"}, Secret: "s2"},
+	}
+	app.Get("/pizzas", nil, func(c *puff.Context) {
+		c.SendResponse(puff.JSONResponse{Content: pizzas})
+	}).WithFieldSelection("name", "price", "owner").StrictQuery()
+	if err := app.SelfCheck(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		target, expected string
+		status           int
+	}{
+		{"/pizzas?fields=name,price", `[{"name":"margherita","price":9.5},{"name":"diavola","price":11}]`, http.StatusOK},
+		{"/pizzas?select=owner.name", `[{"owner":{"name":"ana"}},{"owner":{"name":"bo"}}]`, http.StatusOK},
+		{"/pizzas?fields=name,secret", "", http.StatusBadRequest},
+	} {
+		rec := httptest.NewRecorder()
+		app.RootRouter.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.target, nil))
+		if rec.Code != tc.status || (tc.expected != "" && strings.TrimSpace(rec.Body.String()) != tc.expected) {
+			t.Errorf("Expected %d %s for %s, got %d %s", tc.status, tc.expected, tc.target, rec.Code, rec.Body.String())
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	app.RootRouter.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/pizzas", nil))
+	if !strings.Contains(rec.Body.String(), `"secret":"s1"`) {
+		t.Errorf("Expected the whole response without a selection, got %s", rec.Body.String())
+	}
+
+	paths, _ := app.GeneratePathsTags()
+	if params := (*paths)["/pizzas"].Get.Parameters; len(params) != 1 || params[0].Name != "fields" {
+		t.Errorf("Expected the fields param to be documented, got %+v", params)
+	}
+}
+
+type createOrderRequest struct {
+	Customer string         `json:"customer"`
+	Quantity int            `json:"quantity"`
+	Items    []orderItem    `json:"items"`
+	Notes    map[string]int `json:"notes" required:"false"`
+}
+
+type orderItem struct {
+	SKU   string `json:"sku"`
+	Count uint   `json:"count"`
+}
+
+func TestRoute_JSONBody(t *testing.T) {
+	app := puff.DefaultApp("JSONBodyTest")
+	order := &struct {
+		Payload createOrderRequest `kind:"body"`
+	}{}
+	app.Post("/orders", order, func(c *puff.Context) {
+		c.SendResponse(puff.GenericResponse{Content: fmt.Sprintf("%s %d %+v %v", order.Payload.Customer, order.Payload.Quantity, order.Payload.Items, order.Payload.Notes)})
+	})
+	batch := &struct {
+		Payload []orderItem `kind:"body"`
+	}{}
+	app.Post("/items", batch, func(c *puff.Context) {
+		c.SendResponse(puff.GenericResponse{Content: fmt.Sprint(len(batch.Payload))})
+	})
+	if err := app.SelfCheck(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		target, body, expected string
+		status                 int
+	}{
+		{"/orders", `{"customer":"ana","quantity":2,"items":[{"sku":"p1","count":3}],"notes":{"extra cheese":1}}`, "ana 2 [{SKU:p1 Count:3}] map[extra cheese:1]", http.StatusOK},
+		{"/items", `[{"sku":"p1","count":1},{"sku":"p2","count":2}]`, "2", http.StatusOK},
+		{"/orders", `{"customer":"ana",`, "invalid json", http.StatusUnprocessableEntity},
+		{"/orders", `{"customer":"ana","quantity":2.5,"items":[]}`, "quantity", http.StatusUnprocessableEntity},
+		{"/orders", `{"customer":"ana","quantity":2,"items":[{"sku":"p1","count":-1}]}`, "count: number -1", http.StatusUnprocessableEntity},
+		{"/orders", `{"customer":"ana","items":[]}`, "expected key quantity", http.StatusUnprocessableEntity},
+		{"/items", `{"sku":"p1"}`, "(root)", http.StatusUnprocessableEntity},
+	} {
+		rec := httptest.NewRecorder()
+		app.RootRouter.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, tc.target, strings.NewReader(tc.body)))
+		if rec.Code != tc.status || !strings.Contains(rec.Body.String(), tc.expected) {
+			t.Errorf("Expected %d %q for %s, got %d %s", tc.status, tc.expected, tc.body, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+type signupForm struct {
+	Email      string     `name:"email"`
+	Age        int        `json:"age"`
+	Interests  []string   `name:"interests" required:"false"`
+	Newsletter *bool      `name:"newsletter"`
+	Plan       string     `name:"plan" enum:"free,pro"`
+	Avatar     *puff.File `name:"avatar" required:"false"`
+}
+
+func TestRoute_FormStruct(t *testing.T) {
+	app := puff.DefaultApp("FormStructTest")
+	input := &struct {
+		Signup signupForm `kind:"form"`
+	}{}
+	app.Post("/signup", input, func(c *puff.Context) {
+		s := input.Signup
+		avatar := ""
+		if s.Avatar != nil {
+			avatar = s.Avatar.Name
+		}
+		c.SendResponse(puff.GenericResponse{Content: fmt.Sprintf("%s %d %v %v %s %s", s.Email, s.Age, s.Interests, s.Newsletter != nil && *s.Newsletter, s.Plan, avatar)})
+	})
+	if err := app.SelfCheck(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		form, expected string
+		status         int
+	}{
+		{"email=ana@example.com&age=31&interests=pizza&interests=pasta&newsletter=true&plan=pro", "ana@example.com 31 [pizza pasta] true pro", http.StatusOK},
+		{"email=ana@example.com&age=31&plan=free", "ana@example.com 31 [] false free", http.StatusOK},
+		{"email=ana@example.com&plan=free", "required form value age not provided", http.StatusBadRequest},
+		{"email=ana@example.com&age=old&plan=free", "form value age", http.StatusBadRequest},
+		{"email=ana@example.com&age=31&plan=gold", "form value plan", http.StatusBadRequest},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/signup", strings.NewReader(tc.form))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		app.RootRouter.ServeHTTP(rec, req)
+		if rec.Code != tc.status || !strings.Contains(rec.Body.String(), tc.expected) {
+			t.Errorf("Expected %d %q for %s, got %d %s", tc.status, tc.expected, tc.form, rec.Code, rec.Body.String())
+		}
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("email", "bo@example.com")
+	mw.WriteField("age", "40")
+	mw.WriteField("plan", "free")
+	fw, _ := mw.CreateFormFile("avatar", "bo.png")
+	fw.Write([]byte("png"))
+	mw.Close()
+	req := httptest.NewRequest(http.MethodPost, "/signup", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	rec := httptest.NewRecorder()
+	app.RootRouter.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || rec.Body.String() != "bo@example.com 40 [] false free bo.png" {
+		t.Errorf("Expected the multipart form to be bound, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	paths, _ := app.GeneratePathsTags()
+	operation := (*paths)["/signup"].Post
+	if operation == nil || operation.RequestBody == nil {
+		t.Fatalf("Expected a request body in OpenAPI, got %+v", operation)
+	}
+	if _, ok := operation.RequestBody.Content["application/x-www-form-urlencoded"]; !ok {
+		t.Errorf("Expected the form body to be documented, got %+v", operation.RequestBody.Content)
+	}
+	for _, p := range operation.Parameters {
+		if p.In == "form" {
+			t.Errorf("Expected no form parameter, got %+v", p)
+		}
+	}
+}
+
+func TestRoute_MultipleFiles(t *testing.T) {
+	app := puff.DefaultApp("MultipleFilesTest")
+	input := &struct {
+		Photos []*puff.File `kind:"file" name:"photos"`
+		Cover  *puff.File   `kind:"file" name:"cover"`
+	}{}
+	app.Post("/albums", input, func(c *puff.Context) {
+		var names []string
+		for _, photo := range input.Photos {
+			b, _ := io.ReadAll(photo.MultipartFile)
+			names = append(names, photo.Name+"="+string(b))
+		}
+		c.SendResponse(puff.GenericResponse{Content: input.Cover.Name + " " + strings.Join(names, ",")})
+	})
+	if err := app.SelfCheck(); err != nil {
+		t.Fatal(err)
+	}
+
+	upload := func(photos ...string) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		fw, _ := mw.CreateFormFile("cover", "cover.png")
+		fw.Write([]byte("cover"))
+		for _, photo := range photos {
+			fw, _ := mw.CreateFormFile("photos", photo)
+			fw.Write([]byte(strings.TrimSuffix(photo, ".png")))
+		}
+		mw.Close()
+		req := httptest.NewRequest(http.MethodPost, "/albums", &body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		rec := httptest.NewRecorder()
+		app.RootRouter.ServeHTTP(rec, req)
+		return rec
+	}
+	if rec := upload("a.png", "b.png"); rec.Code != http.StatusOK || rec.Body.String() != "cover.png a.png=a,b.png=b" {
+		t.Errorf("Expected both photos to be bound, got %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := upload(); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "photos") {
+		t.Errorf("Expected the missing photos to be rejected, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	paths, _ := app.GeneratePathsTags()
+	operation := (*paths)["/albums"].Post
+	if operation == nil || operation.RequestBody == nil {
+		t.Fatalf("Expected a request body in OpenAPI, got %+v", operation)
+	}
+	schema := operation.RequestBody.Content["multipart/form-data"].Schema
+	if schema == nil || schema.Properties["photos"] == nil || schema.Properties["photos"].Type != "array" ||
+		schema.Properties["photos"].Items.Format != "binary" || schema.Properties["cover"] == nil {
+		t.Errorf("Expected photos as an array of binary strings next to cover, got %+v", schema)
+	}
+
+	app = puff.DefaultApp("FilesAndFormStructTest")
+	app.Post("/signups", &struct {
+		Photos []*puff.File `kind:"file" name:"photos"`
+		Form   signupForm   `kind:"form"`
+		Cover  *puff.File   `kind:"file" name:"cover" required:"false"`
+	}{}, func(c *puff.Context) {})
+	if err := app.SelfCheck(); err != nil {
+		t.Fatal(err)
+	}
+	app.Handler()
+	paths, _ = app.GeneratePathsTags()
+	content := (*paths)["/signups"].Post.RequestBody.Content
+	schema = content["multipart/form-data"].Schema
+	if schema == nil || schema.Properties["photos"] == nil || schema.Properties["cover"] == nil ||
+		len(schema.AllOf) != 1 || schema.AllOf[0].Ref != "#/components/schemas/signupForm" {
+		t.Errorf("Expected the files next to the form struct, got %+v", schema)
+	}
+	if form := content["application/x-www-form-urlencoded"].Schema; form == nil || form.Ref != "#/components/schemas/signupForm" {
+		t.Errorf("Expected the urlencoded body to be the form struct, got %+v", form)
+	}
+	if component := puff.Schemas["signupForm"]; component == nil || component.Properties["photos"] != nil || component.Properties["cover"] != nil {
+		t.Errorf("Expected the form struct component to be left untouched, got %+v", component)
+	}
+	jsonSchemas, err := app.JSONSchemas()
+	if err != nil {
+		t.Fatal(err)
+	}
+	request, _ := json.Marshal(jsonSchemas[0].Request)
+	if !strings.Contains(string(request), `"form":{"allOf":[{"$ref":"#/$defs/signupForm"}],"properties":{"cover"`) {
+		t.Errorf("Expected the files next to the form struct in the JSON Schema, got %s", request)
+	}
+}
+
+type getPizzaInput struct {
+	ID   int    `kind:"path" name:"id"`
+	Size string `kind:"query" required:"false"`
+}
+
+type getToppingInput struct {
+	PizzaID   int    `kind:"path" name:"pizza_id"`
+	ToppingID string `kind:"path" name:"topping_id"`
+}
+
+func TestGet_TypedPathParams(t *testing.T) {
+	app := puff.DefaultApp("TypedRoutesTest")
+	puff.Get(app, "/pizzas/{id:int}", func(c *puff.Context, input *getPizzaInput) {
+		c.SendResponse(puff.GenericResponse{Content: fmt.Sprintf("%d %s", input.ID, input.Size)})
+	})
+	puff.Get(app, "/pizzas/{pizza_id:int}/toppings/{topping_id}", func(c *puff.Context, input *getToppingInput) {
+		c.SendResponse(puff.GenericResponse{Content: fmt.Sprintf("%d %s", input.PizzaID, input.ToppingID)})
+	})
+	if err := app.SelfCheck(); err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	app.RootRouter.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/pizzas/7?Size=large", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "7 large" {
+		t.Errorf("Expected the typed input to be bound, got %d %s", rec.Code, rec.Body.String())
+	}
+	rec = httptest.NewRecorder()
+	app.RootRouter.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/pizzas/7/toppings/basil", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "7 basil" {
+		t.Errorf("Expected both path params to be bound, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	for path, expected := range map[string]string{
+		"/pizzas/{pizza}":           "is named id",
+		"/pizzas":                   "has no parameter id",
+		"/pizzas/{id:uuid}":         "cannot hold",
+		"/pizzas/{id:[a-z]+}":       "cannot hold",
+		"/pizzas/{id:[0-9]{1,4}}/x": "",
+	} {
+		app := puff.DefaultApp("TypedRoutesTest")
+		app.Config.DeferRegistrationErrors = true
+		puff.Get(app, path, func(c *puff.Context, input *getPizzaInput) {})
+		err := app.SelfCheck()
+		if expected == "" && err != nil {
+			t.Errorf("Expected %s to be registered, got %v", path, err)
+		}
+		if expected != "" && (err == nil || !strings.Contains(err.Error(), expected)) {
+			t.Errorf("Expected %s to be rejected with %q, got %v", path, expected, err)
+		}
+	}
+}
+
+func TestRoute_UploadConstraints(t *testing.T) {
+	app := puff.DefaultApp("UploadConstraintsTest")
+	input := &struct {
+		Avatar *puff.File `kind:"file" name:"avatar" maxsize:"1KB" accept:"image/png,image/jpeg"`
+	}{}
+	app.Post("/avatars", input, func(c *puff.Context) {
+		c.SendResponse(puff.GenericResponse{Content: input.Avatar.Name})
+	})
+	if err := app.SelfCheck(); err != nil {
+		t.Fatal(err)
+	}
+
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	for _, tc := range []struct {
+		content []byte
+		status  int
+	}{
+		{png, http.StatusOK},
+		{[]byte("#!/bin/sh\nrm -rf /"), http.StatusUnsupportedMediaType},
+		{append(png, make([]byte, 2048)...), http.StatusRequestEntityTooLarge},
+	} {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		// the declared type is ignored, the content is sniffed.
+		fw, _ := mw.CreatePart(map[string][]string{
+			"Content-Disposition": {`form-data; name="avatar"; filename="me.png"`},
+			"Content-Type":        {"image/png"},
+		})
+		fw.Write(tc.content)
+		mw.Close()
+		req := httptest.NewRequest(http.MethodPost, "/avatars", &body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		rec := httptest.NewRecorder()
+		app.RootRouter.ServeHTTP(rec, req)
+		if rec.Code != tc.status {
+			t.Errorf("Expected %d for %d bytes, got %d %s", tc.status, len(tc.content), rec.Code, rec.Body.String())
+		}
+	}
+
+	paths, _ := app.GeneratePathsTags()
+	operation := (*paths)["/avatars"].Post
+	if operation == nil || operation.Responses["413"].Description == "" || operation.Responses["415"].Description == "" {
+		t.Fatalf("Expected 413 and 415 in OpenAPI, got %+v", operation)
+	}
+	if encoding := operation.RequestBody.Content["multipart/form-data"].Encoding["avatar"]; encoding.ContentType != "image/png, image/jpeg" {
+		t.Errorf("Expected the accepted types in the encoding, got %+v", encoding)
+	}
+
+	app.Post("/bad", &struct {
+		Name string `kind:"query" maxsize:"1KB"`
+	}{}, func(c *puff.Context) {})
+	if err := app.SelfCheck(); err == nil {
+		t.Error("Expected maxsize on a query field to be rejected")
+	}
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// zeroReader reads zeros endlessly.
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+func TestRoute_UploadMaxSizeLimitsBody(t *testing.T) {
+	app := puff.DefaultApp("UploadConstraintsTest")
+	input := &struct {
+		Avatar *puff.File `kind:"file" name:"avatar" maxsize:"1KB"`
+	}{}
+	app.Post("/avatars", input, func(c *puff.Context) {
+		c.SendResponse(puff.GenericResponse{Content: input.Avatar.Name})
+	})
+	app.Post("/overflow", &struct {
+		Avatar *puff.File `kind:"file" name:"avatar" maxsize:"9999999999GB"`
+	}{}, func(c *puff.Context) {})
+	if err := app.SelfCheck(); err == nil || !strings.Contains(err.Error(), "too large") {
+		t.Errorf("Expected an overflowing maxsize to be rejected, got %v", err)
+	}
+
+	const size = 256 << 20
+	boundary := "puffboundary"
+	body := &countingReader{r: io.MultiReader(
+		strings.NewReader("--"+boundary+"\r\nContent-Disposition: form-data; name=\"avatar\"; filename=\"me.png\"\r\n\r\n"),
+		io.LimitReader(zeroReader{}, size),
+		strings.NewReader("\r\n--"+boundary+"--\r\n"),
+	)}
+	req := httptest.NewRequest(http.MethodPost, "/avatars", body)
+	req.Header.Set("Content-Type", "multipart/form-data; boundary="+boundary)
+	rec := httptest.NewRecorder()
+	app.RootRouter.ServeHTTP(rec, req)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413, got %d %s", rec.Code, rec.Body.String())
+	}
+	if body.n >= size {
+		t.Errorf("Expected the upload to be rejected before it was read, read %d bytes", body.n)
+	}
+}
+
+func TestApp_ConnectionStats(t *testing.T) {
+	app := puff.DefaultApp("ConnectionStatsTest")
+	app.WebSocket("/ws", nil, func(c *puff.Context) {
+		msg, err := c.WebSocket.Read()
+		if err != nil {
+			return
+		}
+		c.WebSocket.Write(&websocket.Message{Type: websocket.MessageText, Data: msg.Data})
+		c.WebSocket.Write(&websocket.Message{Type: websocket.MessageClose, Data: []byte{0x03, 0xE8}})
+		c.WebSocket.Close()
+	})
+	app.Get("/events", nil, func(c *puff.Context) {
+		c.SendResponse(puff.StreamingResponse{StreamHandler: func(events *chan puff.ServerSideEvent) {
+			for i := range 3 {
+				*events <- puff.ServerSideEvent{Data: fmt.Sprint(i)}
+			}
+		}})
+	})
+	server := httptest.NewServer(app.Handler())
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	fmt.Fprint(conn, "GET /ws HTTP/1.1\r\nHost: puff\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Version: 13\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n\r\n")
+	br := bufio.NewReader(conn)
+	res, err := http.ReadResponse(br, nil)
+	if err != nil || res.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("Expected the WebSocket handshake, got %v %v", res, err)
+	}
+	mask := []byte{1, 2, 3, 4}
+	frame := func(opcode byte, payload []byte) []byte {
+		b := append([]byte{0x80 | opcode, 0x80 | byte(len(payload))}, mask...)
+		for i, c := range payload {
+			b = append(b, c^mask[i%4])
+		}
+		return b
+	}
+	conn.Write(frame(0x1, []byte("hi")))
+	echo := make([]byte, 4)
+	if _, err := io.ReadFull(br, echo); err != nil || string(echo[2:]) != "hi" {
+		t.Fatalf("Expected the echo, got %q %v", echo, err)
+	}
+	closing := make([]byte, 4)
+	if _, err := io.ReadFull(br, closing); err != nil || closing[0] != 0x88 {
+		t.Fatalf("Expected a close frame, got %q %v", closing, err)
+	}
+
+	var stats puff.WebSocketStats
+	for range 100 {
+		if stats = app.ConnectionStats().WebSocket; stats.Active == 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if stats.Active != 0 || stats.MessagesIn != 1 || stats.MessagesOut != 1 || stats.CloseCodes[1000] != 1 {
+		t.Errorf("Expected one closed connection with a message each way, got %+v", stats)
+	}
+	if stats.BytesIn != 8 || stats.BytesOut != 8 {
+		t.Errorf("Expected the frame bytes to be counted, got %d in and %d out", stats.BytesIn, stats.BytesOut)
+	}
+
+	sse, err := http.Get(server.URL + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(sse.Body)
+	sse.Body.Close()
+	if stats := app.ConnectionStats().SSE; stats.Opened != 1 || stats.Active != 0 || stats.EventsOut != 3 || stats.BytesOut != uint64(len(body)) {
+		t.Errorf("Expected one stream of 3 events, got %+v for %q", stats, body)
+	}
+}
+
+type invoice struct {
+	Number string  `json:"number" xml:"number,attr"`
+	Total  float64 `json:"total" xml:"total"`
+}
+
+func TestRoute_XMLBody(t *testing.T) {
+	app := puff.DefaultApp("XMLBodyTest")
+	input := &struct {
+		Invoice invoice `kind:"body" media:"application/json,application/xml"`
+	}{}
+	app.Post("/invoices", input, func(c *puff.Context) {
+		c.SendResponse(puff.GenericResponse{Content: fmt.Sprintf("%s %.2f", input.Invoice.Number, input.Invoice.Total)})
+	})
+	if err := app.SelfCheck(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		contentType, body, expected string
+		status                      int
+	}{
+		{"application/xml", `<invoice number="A-1"><total>12.5</total></invoice>`, "A-1 12.50", http.StatusOK},
+		{"text/xml; charset=utf-8", `<invoice number="A-2"><total>3</total></invoice>`, "A-2 3.00", http.StatusOK},
+		{"application/json", `{"number":"A-3","total":7}`, "A-3 7.00", http.StatusOK},
+		{"application/xml", `<invoice number="A-4"><total>`, "invalid xml", http.StatusUnprocessableEntity},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/invoices", strings.NewReader(tc.body))
+		req.Header.Set("Content-Type", tc.contentType)
+		rec := httptest.NewRecorder()
+		app.RootRouter.ServeHTTP(rec, req)
+		if rec.Code != tc.status || !strings.Contains(rec.Body.String(), tc.expected) {
+			t.Errorf("Expected %d %q for %s, got %d %s", tc.status, tc.expected, tc.body, rec.Code, rec.Body.String())
+		}
+	}
+
+	paths, _ := app.GeneratePathsTags()
+	operation := (*paths)["/invoices"].Post
+	if operation == nil || operation.RequestBody == nil {
+		t.Fatalf("Expected a request body in OpenAPI, got %+v", operation)
+	}
+	if _, ok := operation.RequestBody.Content["application/xml"]; !ok {
+		t.Errorf("Expected the request body to be documented as application/xml, got %+v", operation.RequestBody.Content)
+	}
+
+	app.Post("/bad", &struct {
+		Name string `kind:"query" media:"application/xml"`
+	}{}, func(c *puff.Context) {})
+	if err := app.SelfCheck(); err == nil {
+		t.Error("Expected media on a query field to be rejected")
+	}
+}
+
+type optionalPizza struct {
+	Name  string   `json:"name"`
+	Price *float64 `json:"price"`
+}
+
+func TestRoute_OptionalPointerFields(t *testing.T) {
+	app := puff.DefaultApp("OptionalFieldsTest")
+	input := &struct {
+		Limit *int           `kind:"query"`
+		Since *time.Time     `kind:"query" layout:"2006-01-02"`
+		Owner *string        `kind:"header" name:"X-Owner"`
+		Body  *optionalPizza `kind:"body"`
+	}{}
+	app.Get("/search", input, func(c *puff.Context) {
+		limit, since, body := "nil", "nil", "nil"
+		if input.Limit != nil {
+			limit = fmt.Sprint(*input.Limit)
+		}
+		if input.Since != nil {
+			since = input.Since.Format(time.DateOnly)
+		}
+		if input.Body != nil {
+			body = input.Body.Name
+		}
+		c.SendResponse(puff.GenericResponse{Content: fmt.Sprintf("%s %s %v %s", limit, since, input.Owner == nil, body)})
+	})
+	if err := app.SelfCheck(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		target, body, expected string
+	}{
+		{"/search", "", "nil nil true nil"},
+		{"/search?Limit=0&Since=2024-05-01", `{"name":"margherita"}`, "0 2024-05-01 true margherita"},
+	} {
+		rec := httptest.NewRecorder()
+		app.RootRouter.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.target, strings.NewReader(tc.body)))
+		if rec.Body.String() != tc.expected {
+			t.Errorf("Expected %q for %s, got %d %s", tc.expected, tc.target, rec.Code, rec.Body.String())
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	app.RootRouter.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/search?Limit=ten", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected an invalid optional param to be rejected, got %d", rec.Code)
+	}
+
+	app.GenerateOpenAPISpec()
+	spec, _ := json.Marshal(app.Config.OpenAPI)
+	if strings.Contains(string(spec), `"required":true`) {
+		t.Errorf("Expected the pointer params to be optional, got %s", spec)
+	}
+	if !strings.Contains(string(spec), `"optionalPizza":{"type":"object","properties":{"name":`) || !strings.Contains(string(spec), `"required":["name"]`) {
+		t.Errorf("Expected only the non-pointer body field to be required, got %s", spec)
+	}
+}
+
+// registrationBudget is the startup time allowed for registering and
+// preparing 10,000 routes, with headroom for slow CI machines.
+const registrationBudget = 2 * time.Second
+
+type benchmarkUserInput struct {
+	ID   int    `kind:"path"`
+	Name string `kind:"query" required:"false"`
+}
+
+// registerRoutes registers and prepares routers*100 routes on a new app.
+func registerRoutes(routers int) *puff.PuffApp {
+	app := puff.App(&puff.AppConfig{Name: "RegisterBenchmark", Version: "0.0.0", DocsURL: "/docs", LoggerConfig: &puff.LoggerConfig{Level: slog.LevelWarn}})
+	for r := 0; r < routers; r++ {
+		router := puff.NewRouter(fmt.Sprintf("Router%d", r), fmt.Sprintf("/r%d", r))
+		for n := 0; n < 100; n++ {
+			// Gets a user.
+			router.Get(fmt.Sprintf("/users%d/{id}", n), &benchmarkUserInput{}, func(c *puff.Context) {})
+		}
+		app.IncludeRouter(router)
+	}
+	app.Handler()
+	return app
+}
+
+func BenchmarkApp_Register10kRoutes(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		registerRoutes(100)
+	}
+	if perRun := b.Elapsed() / time.Duration(b.N); perRun > registrationBudget {
+		b.Errorf("Registering 10k routes took %s, over the budget of %s", perRun, registrationBudget)
+	}
+}
+
+func TestApp_RegisterManyRoutes(t *testing.T) {
+	start := time.Now()
+	app := registerRoutes(10)
+	// a tenth of the routes of the benchmark, within its whole budget.
+	if elapsed := time.Since(start); elapsed > registrationBudget {
+		t.Errorf("Registering 1k routes took %s, over the budget of %s", elapsed, registrationBudget)
+	}
+	for _, route := range app.RootRouter.AllRoutes() {
+		if strings.HasPrefix(route.Router.Name, "Router") && route.Description != "Gets a user." {
+			t.Fatalf("Expected the description of %s to be read from its comment, got %q", route.Path, route.Description)
+		}
+	}
+}
+
+func TestRouter_MultiplePathFields(t *testing.T) {
+	app := puff.DefaultApp("MultiplePathFieldsTest")
+	file := &struct {
+		Name string `kind:"path"`
+		Ext  string `kind:"path"`
+	}{}
+	app.Get("/files/{name}.{ext}", file, func(c *puff.Context) {
+		c.SendResponse(puff.GenericResponse{Content: file.Name + "|" + file.Ext})
+	})
+	repo := &struct {
+		Org  string `kind:"path"`
+		Repo string `kind:"path"`
+		Path string `kind:"path"`
+	}{}
+	app.Get("/repos/{org}/{repo}/*path", repo, func(c *puff.Context) {
+		c.SendResponse(puff.GenericResponse{Content: repo.Org + "|" + repo.Repo + "|" + repo.Path})
+	})
+	if err := app.SelfCheck(); err != nil {
+		t.Fatal(err)
+	}
+
+	for request, expected := range map[string]string{
+		"/files/report.pdf":                "report|pdf",
+		"/repos/golang/go/src/net/http.go": "golang|go|src/net/http.go",
+	} {
+		rec := httptest.NewRecorder()
+		app.RootRouter.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, request, nil))
+		if rec.Body.String() != expected {
+			t.Errorf("Expected %s to bind %q, got %d %q", request, expected, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestStreamingResponse_Trailers(t *testing.T) {
+	app := puff.DefaultApp("Trailers Test")
+	app.Get("/events", nil, func(c *puff.Context) {
+		sent := 0
+		c.SendResponse(puff.StreamingResponse{
+			StatusCode: http.StatusAccepted,
+			StreamHandler: func(events *chan puff.ServerSideEvent) {
+				for i := range 3 {
+					*events <- puff.ServerSideEvent{Data: fmt.Sprint(i)}
+					sent++
+				}
+			},
+			Trailers: []string{"X-Event-Count"},
+			TrailerValues: func() map[string]string {
+				return map[string]string{"X-Event-Count": fmt.Sprint(sent), "X-Undeclared": "sent"}
+			},
+		})
+	})
+	app.SelfCheck()
+	server := httptest.NewServer(app.Handler())
+	defer server.Close()
+
+	res, err := http.Get(server.URL + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusAccepted {
+		t.Errorf("Expected status 202, got %d", res.StatusCode)
+	}
+	if _, err := io.ReadAll(res.Body); err != nil {
+		t.Fatal(err)
+	}
+	if got := res.Trailer.Get("X-Event-Count"); got != "3" {
+		t.Errorf("Expected the X-Event-Count trailer to be 3, got %q", got)
+	}
+	if got := res.Trailer.Get("X-Undeclared"); got != "sent" {
+		t.Errorf("Expected the undeclared trailer to be sent, got %q", got)
+	}
+}
+
+func TestRouter_NestedRouters(t *testing.T) {
+	app := puff.DefaultApp("NestedRoutersTest")
+	api := puff.NewRouter("API", "/api")
+	v1 := puff.NewRouter("V1", "/v1")
+	users := puff.NewRouter("Users", "/users")
+	users.ErrorHandler = func(c *puff.Context, err *puff.HTTPError) {
+		c.SendResponse(puff.GenericResponse{StatusCode: err.StatusCode, Content: "users: " + err.Message})
+	}
+	users.Get("/{id}", nil, func(c *puff.Context) {
+		c.SendResponse(puff.GenericResponse{Content: "user " + c.PathParams()["id"]})
+	})
+	app.IncludeRouter(api)
+	api.IncludeRouter(v1)
+	v1.IncludeRouter(users)
+	api.Get("/v1/users/me", nil, func(c *puff.Context) {
+		c.SendResponse(puff.GenericResponse{Content: "me"})
+	})
+	app.SelfCheck()
+	handler := app.Handler()
+
+	for path, expected := range map[string]string{
+		"/api/v1/users/42":      "user 42",
+		"/api/v1/users/me":      "me",
+		"/api/v1/users/42/more": "users: not found",
+	} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Body.String() != expected {
+			t.Errorf("Expected %q for %s, got %d %q", expected, path, rec.Code, rec.Body.String())
+		}
+	}
+
+	v1.Disable(http.StatusServiceUnavailable, "")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/users/42", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected the disabled router between the app and the route to reject the request, got %d", rec.Code)
+	}
+}
+
+func BenchmarkRouter_ServeNested(b *testing.B) {
+	app := puff.App(&puff.AppConfig{Name: "ServeBenchmark", Version: "0.0.0", LoggerConfig: &puff.LoggerConfig{Level: slog.LevelWarn}})
+	for r := 0; r < 10; r++ {
+		outer := puff.NewRouter(fmt.Sprintf("Outer%d", r), "")
+		app.IncludeRouter(outer)
+		for n := 0; n < 10; n++ {
+			inner := puff.NewRouter(fmt.Sprintf("Inner%d", n), fmt.Sprintf("/r%d/s%d", r, n))
+			outer.IncludeRouter(inner)
+			for m := 0; m < 10; m++ {
+				inner.Get(fmt.Sprintf("/users%d/{id}", m), nil, func(c *puff.Context) {})
+			}
+		}
+	}
+	handler := app.Handler()
+	req := httptest.NewRequest(http.MethodGet, "/r9/s9/users9/42", nil)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+}
+
+func TestRoute_BindingAfterMiddlewares(t *testing.T) {
+	app := puff.DefaultApp("BindingOrderTest")
+	input := &struct {
+		Body struct {
+			Name string `json:"name" required:"true"`
+		}
+	}{}
+	app.Post("/pizzas", input, func(c *puff.Context) {
+		c.SendResponse(puff.GenericResponse{Content: "created " + input.Body.Name})
+	})
+	// the middleware sees and may replace the raw body before it is bound.
+	app.Use(func(next puff.HandlerFunc) puff.HandlerFunc {
+		return func(c *puff.Context) {
+			if c.GetRequestHeader("Authorization") == "" {
+				c.Forbidden("Missing credentials.")
+				return
+			}
+			raw, _ := io.ReadAll(c.Request.Body)
+			c.Request.Body = io.NopCloser(strings.NewReader(strings.ReplaceAll(string(raw), "hawaii", "margherita")))
+			next(c)
+		}
+	})
+	app.SelfCheck()
+	handler := app.Handler()
+
+	for _, tc := range []struct {
+		body          string
+		authorization string
+		status        int
+		content       string
+	}{
+		{`{"name":"hawaii"}`, "Bearer pizza", http.StatusOK, "created margherita"},
+		// invalid input is rejected by the middleware before it fails binding.
+		{`{}`, "", http.StatusForbidden, ""},
+		{`{}`, "Bearer pizza", http.StatusUnprocessableEntity, ""},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/pizzas", strings.NewReader(tc.body))
+		req.Header.Set("Content-Type", "application/json")
+		if tc.authorization != "" {
+			req.Header.Set("Authorization", tc.authorization)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != tc.status {
+			t.Errorf("Expected %d for %s, got %d %s", tc.status, tc.body, rec.Code, rec.Body.String())
+		}
+		if tc.content != "" && rec.Body.String() != tc.content {
+			t.Errorf("Expected %q, got %q", tc.content, rec.Body.String())
+		}
+	}
+}
+
+func TestRoute_Use(t *testing.T) {
+	app := puff.DefaultApp("RouteUseTest")
+	var order []string
+	trace := func(name string) puff.Middleware {
+		return func(next puff.HandlerFunc) puff.HandlerFunc {
+			return func(c *puff.Context) {
+				order = append(order, name)
+				next(c)
+			}
+		}
+	}
+	handler := func(c *puff.Context) {
+		order = append(order, "handler")
+		c.SendResponse(puff.GenericResponse{Content: "ok"})
+	}
+	api := puff.NewRouter("API", "/api")
+	api.Use(trace("router"))
+	api.Get("/guarded", nil, handler).Use(trace("first"), trace("second")).Use(trace("third"))
+	api.Get("/open", nil, handler)
+	app.Use(trace("app"))
+	app.IncludeRouter(api)
+	app.SelfCheck()
+
+	for _, tc := range []struct {
+		path  string
+		order []string
+	}{
+		// route middlewares run in the order they were added, inside the router middlewares.
+		{"/api/guarded", []string{"router", "app", "first", "second", "third", "handler"}},
+		// route middlewares do not apply to the other routes of the router.
+		{"/api/open", []string{"router", "app", "handler"}},
+	} {
+		order = nil
+		rec := httptest.NewRecorder()
+		app.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.path, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected 200 for %s, got %d", tc.path, rec.Code)
+		}
+		if !slices.Equal(order, tc.order) {
+			t.Errorf("Expected %v for %s, got %v", tc.order, tc.path, order)
+		}
+	}
+}
+
+func TestRouter_AddRouteWhileServing(t *testing.T) {
+	app := puff.DefaultApp("AddRouteTest")
+	hooks := puff.NewRouter("Hooks", "/hooks")
+	app.IncludeRouter(hooks)
+	app.Post("/admin/hooks/{name}", &struct {
+		Name string `kind:"path"`
+	}{}, func(c *puff.Context) {
+		name := c.PathParams()["name"]
+		_, err := hooks.AddRoute(http.MethodGet, "/"+name, nil, func(c *puff.Context) {
+			c.SendResponse(puff.GenericResponse{Content: name})
+		})
+		var regErr *puff.RegistrationError
+		if errors.As(err, &regErr) && regErr.Kind == puff.RegistrationConflict {
+			c.SendResponse(puff.GenericResponse{StatusCode: http.StatusConflict, Content: err.Error()})
+			return
+		}
+		c.SendResponse(puff.GenericResponse{StatusCode: http.StatusCreated})
+	})
+	handler := app.Handler()
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+		return rec
+	}
+	specPaths := func() map[string]any {
+		var spec struct {
+			Paths map[string]any `json:"paths"`
+		}
+		if err := json.Unmarshal(serve(http.MethodGet, "/docs.json").Body.Bytes(), &spec); err != nil {
+			t.Fatal(err)
+		}
+		return spec.Paths
+	}
+	if _, ok := specPaths()["/hooks/deploy"]; ok {
+		t.Fatal("Expected the route not to be documented before it is registered")
+	}
+
+	if rec := serve(http.MethodPost, "/admin/hooks/deploy"); rec.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d %s", rec.Code, rec.Body.String())
+	}
+	// registering the route again is a conflict returned to the handler.
+	if rec := serve(http.MethodPost, "/admin/hooks/deploy"); rec.Code != http.StatusConflict {
+		t.Errorf("Expected 409 for a conflict, got %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := serve(http.MethodGet, "/hooks/deploy"); rec.Body.String() != "deploy" {
+		t.Errorf("Expected the registered route, got %d %s", rec.Code, rec.Body.String())
+	}
+	paths := specPaths()
+	if _, ok := paths["/hooks/deploy"]; !ok {
+		t.Errorf("Expected the registered route in the OpenAPI spec, got %v", paths)
+	}
+	if _, ok := paths["/docs.json"]; ok {
+		t.Error("Expected the docs routes to stay out of the OpenAPI spec")
+	}
+
+	_, err := hooks.AddRoute(http.MethodGet, "/bad", &struct {
+		Count int `kind:"query" enum:"one"`
+	}{}, func(c *puff.Context) {})
+	var regErr *puff.RegistrationError
+	if !errors.As(err, &regErr) || regErr.Kind != puff.RegistrationBadFields {
+		t.Errorf("Expected a bad fields error, got %v", err)
+	}
+
+	// a router with a conflicting route is not included.
+	extra := puff.NewRouter("Extra", "/hooks")
+	extra.Get("/status", nil, func(c *puff.Context) {})
+	extra.Get("/deploy", nil, func(c *puff.Context) {})
+	if err := app.RootRouter.AddRouter(extra); !errors.As(err, &regErr) || regErr.Kind != puff.RegistrationConflict {
+		t.Errorf("Expected a conflict including the router, got %v", err)
+	}
+	if rec := serve(http.MethodGet, "/hooks/status"); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected the router not to be included, got %d", rec.Code)
+	}
+
+	hooks.RemoveRoute(hooks.Routes[0])
+	if _, ok := specPaths()["/hooks/deploy"]; ok {
+		t.Error("Expected the removed route to be left out of the OpenAPI spec")
+	}
+}
+
+func TestRoute_CompressedBodyLimit(t *testing.T) {
+	app := puff.DefaultApp("CompressedBodyTest")
+	app.Config.MaxDecodedBodyBytes = 1 << 20
+	input := &struct {
+		Body struct {
+			Name    string `json:"name"`
+			Padding string `json:"padding" required:"false"`
+		}
+	}{}
+	app.Post("/pizzas", input, func(c *puff.Context) {
+		c.SendResponse(puff.GenericResponse{Content: "created " + input.Body.Name})
+	})
+	app.SelfCheck()
+
+	post := func(body string) *httptest.ResponseRecorder {
+		var gz bytes.Buffer
+		zw := gzip.NewWriter(&gz)
+		zw.Write([]byte(body))
+		zw.Close()
+		req := httptest.NewRequest(http.MethodPost, "/pizzas", &gz)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Content-Encoding", "gzip")
+		rec := httptest.NewRecorder()
+		app.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+	if rec := post(`{"name":"margherita"}`); rec.Code != http.StatusOK || rec.Body.String() != "created margherita" {
+		t.Errorf("Expected the gzip body to be decoded, got %d %s", rec.Code, rec.Body.String())
+	}
+	// a few KiB compressed expand beyond the limit.
+	bomb := `{"name":"margherita","padding":"` + strings.Repeat("0", 2<<20) + `"}`
+	if rec := post(bomb); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 for a body larger than the limit once decoded, got %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestRoute_MaxResponseSize(t *testing.T) {
+	app := puff.DefaultApp("ResponseSizeTest")
+	app.Config.ErrorConfig = &puff.ErrorConfig{MessageKey: "message"}
+	body := strings.Repeat("a", 100)
+	app.Get("/truncated", nil, func(c *puff.Context) {
+		c.SendResponse(puff.GenericResponse{Content: body})
+	}).WithMaxResponseSize(10, puff.TruncateResponse)
+	app.Get("/rejected", nil, func(c *puff.Context) {
+		c.SetResponseHeader("Content-Disposition", `attachment; filename="report.txt"`)
+		c.SetResponseHeader("ETag", `"v1"`)
+		c.SetResponseHeader("Cache-Control", "max-age=3600")
+		c.SendResponse(puff.GenericResponse{Content: body})
+	}).WithMaxResponseSize(10, puff.RejectResponse)
+	app.Get("/small", nil, func(c *puff.Context) {
+		c.SendResponse(puff.GenericResponse{Content: "ok"})
+	}).WithMaxResponseSize(10, puff.RejectResponse)
+	handler := app.Handler()
+	serve := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	if rec := serve("/small"); rec.Code != http.StatusOK || rec.Body.String() != "ok" {
+		t.Errorf("Expected a response within the limit to be sent, got %d %q", rec.Code, rec.Body.String())
+	}
+	rec := serve("/truncated")
+	if rec.Code != http.StatusOK || rec.Body.String() != body[:10] || rec.Header().Get("X-Response-Truncated") != "10" {
+		t.Errorf("Expected the response to be truncated, got %d %q", rec.Code, rec.Body.String())
+	}
+	// rejected responses use the error body of the app.
+	rec = serve("/rejected")
+	var res map[string]any
+	json.Unmarshal(rec.Body.Bytes(), &res)
+	if rec.Code != http.StatusInternalServerError || res["message"] != "response too large" {
+		t.Errorf("Expected the configured error body, got %d %s", rec.Code, rec.Body.String())
+	}
+	for _, header := range []string{"Content-Disposition", "ETag", "Cache-Control", "Content-Length"} {
+		if rec.Header().Get(header) != "" {
+			t.Errorf("Expected the %s header of the handler to be dropped, got %q", header, rec.Header().Get(header))
+		}
+	}
+}
+
+func TestApp_OpenAPISpecEncoding(t *testing.T) {
+	app := puff.DefaultApp("OpenAPIEncodingTest")
+	app.Get("/pizzas", nil, func(c *puff.Context) {})
+	handler := app.Handler()
+
+	for _, tc := range []struct {
+		accept string
+		gzip   bool
+	}{
+		{"", false},
+		{"gzip", true},
+		{"br, gzip;q=0.5", true},
+		{"gzip;q=0", false},
+		{"x-gzip", false},
+		{"*", true},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/docs.json", nil)
+		req.Header.Set("Accept-Encoding", tc.accept)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		body := rec.Body.Bytes()
+		if tc.gzip {
+			zr, err := gzip.NewReader(rec.Body)
+			if err != nil {
+				t.Fatalf("Expected a gzip spec for %q: %s", tc.accept, err)
+			}
+			body, _ = io.ReadAll(zr)
+		}
+		if encoded := rec.Header().Get("Content-Encoding") == "gzip"; encoded != tc.gzip {
+			t.Errorf("Expected gzip %v for Accept-Encoding %q, got %q", tc.gzip, tc.accept, rec.Header().Get("Content-Encoding"))
+		}
+		if !json.Valid(body) || !bytes.Contains(body, []byte("/pizzas")) {
+			t.Errorf("Expected the spec for Accept-Encoding %q, got %.50q", tc.accept, body)
+		}
+	}
+}
+
+func TestContext_URLForForwardedHeaders(t *testing.T) {
+	newApp := func(config func(*puff.AppConfig)) http.Handler {
+		app := puff.DefaultApp("URLForTest")
+		config(app.Config)
+		app.Get("/self", nil, func(c *puff.Context) {
+			c.SendResponse(puff.GenericResponse{Content: c.URLFor("/pizzas/1")})
+		})
+		app.Post("/pizzas", nil, func(c *puff.Context) {
+			c.SetResponseHeader("Location", "/pizzas/1")
+			c.SendResponse(puff.GenericResponse{StatusCode: http.StatusCreated})
+		})
+		return app.Handler()
+	}
+	serve := func(handler http.Handler, method, path, remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "http://api.local"+path, nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Forwarded-Proto", "https")
+		req.Header.Set("X-Forwarded-Host", "evil.example")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// forwarded headers are ignored unless the request comes from a trusted proxy.
+	untrusted := newApp(func(*puff.AppConfig) {})
+	if rec := serve(untrusted, http.MethodGet, "/self", "203.0.113.7:4000"); rec.Body.String() != "http://api.local/pizzas/1" {
+		t.Errorf("Expected the forwarded headers to be ignored, got %s", rec.Body.String())
+	}
+	if rec := serve(untrusted, http.MethodPost, "/pizzas", "203.0.113.7:4000"); rec.Header().Get("Location") != "/pizzas/1" {
+		t.Errorf("Expected a relative Location without BaseURL, got %s", rec.Header().Get("Location"))
+	}
+
+	proxied := newApp(func(c *puff.AppConfig) { c.TrustedProxies = []string{"10.0.0.0/8", "192.0.2.1"} })
+	for remoteAddr, expected := range map[string]string{
+		"10.1.2.3:4000":    "https://evil.example/pizzas/1",
+		"192.0.2.1:4000":   "https://evil.example/pizzas/1",
+		"203.0.113.7:4000": "http://api.local/pizzas/1",
+	} {
+		if rec := serve(proxied, http.MethodGet, "/self", remoteAddr); rec.Body.String() != expected {
+			t.Errorf("Expected %s from %s, got %s", expected, remoteAddr, rec.Body.String())
+		}
+	}
+
+	based := newApp(func(c *puff.AppConfig) { c.BaseURL = "https://api.example.com" })
+	if rec := serve(based, http.MethodPost, "/pizzas", "203.0.113.7:4000"); rec.Header().Get("Location") != "https://api.example.com/pizzas/1" {
+		t.Errorf("Expected the Location to use BaseURL, got %s", rec.Header().Get("Location"))
+	}
+}
+
+func TestContext_CookieDefaults(t *testing.T) {
+	setCookies := func(defaults *puff.CookieDefaults) []*http.Cookie {
+		app := puff.DefaultApp("CookieDefaultsTest")
+		app.Config.CookieDefaults = defaults
+		app.Get("/", nil, func(c *puff.Context) {
+			c.SetCookie(&http.Cookie{Name: "plain", Value: "1"})
+			c.SetCookie(&http.Cookie{Name: "scoped", Value: "1", Path: "/admin", SameSite: http.SameSiteStrictMode})
+			c.Cookie("built", "1").Set()
+			c.Cookie("script", "1").HttpOnly(false).Secure(false).Set()
+			c.SendResponse(puff.GenericResponse{})
+		})
+		rec := httptest.NewRecorder()
+		app.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rec.Result().Cookies()
+	}
+
+	// without CookieDefaults, SetCookie sends cookies unchanged and the builder is usable over plain HTTP.
+	for _, cookie := range setCookies(nil) {
+		if cookie.Secure || cookie.HttpOnly {
+			t.Errorf("Expected %s not to be Secure or HttpOnly by default, got %s", cookie.Name, cookie)
+		}
+		if cookie.Name == "plain" && (cookie.Path != "" || cookie.SameSite != 0) {
+			t.Errorf("Expected SetCookie to send the cookie unchanged, got %s", cookie)
+		}
+	}
+
+	cookies := setCookies(&puff.CookieDefaults{Secure: true, HttpOnly: true, SameSite: http.SameSiteLaxMode, Path: "/"})
+	for _, cookie := range cookies {
+		switch cookie.Name {
+		case "plain", "built":
+			if !cookie.Secure || !cookie.HttpOnly || cookie.Path != "/" || cookie.SameSite != http.SameSiteLaxMode {
+				t.Errorf("Expected the defaults on %s, got %s", cookie.Name, cookie)
+			}
+		case "scoped":
+			if cookie.Path != "/admin" || cookie.SameSite != http.SameSiteStrictMode {
+				t.Errorf("Expected the attributes set on the cookie to be kept, got %s", cookie)
+			}
+		case "script":
+			if cookie.Secure || cookie.HttpOnly {
+				t.Errorf("Expected the builder to opt the cookie out of the defaults, got %s", cookie)
+			}
+		}
+	}
+	if len(cookies) != 4 {
+		t.Errorf("Expected 4 cookies, got %d", len(cookies))
+	}
+}
+
+func TestContext_TimeoutBudget(t *testing.T) {
+	app := puff.DefaultApp("Timeout Budget Test")
+	app.Get("/", nil, func(c *puff.Context) {
+		remaining, ok := c.RemainingBudget()
+		if !ok {
+			c.SendResponse(puff.GenericResponse{Content: "none"})
+			return
+		}
+		c.SendResponse(puff.GenericResponse{Content: remaining.Round(time.Hour).String()})
+	})
+	for _, tc := range []struct {
+		header, value, expected string
+	}{
+		{"X-Request-Timeout", "3600", "1h0m0s"},
+		{"X-Request-Timeout", "2h", "2h0m0s"},
+		{"X-Request-Timeout", "1e12", "24h0m0s"},
+		{"X-Request-Timeout", "100h", "24h0m0s"},
+		{"X-Request-Timeout", "9999999999h", "none"},
+		{"X-Request-Timeout", "Inf", "none"},
+		{"X-Request-Timeout", "NaN", "none"},
+		{"X-Request-Timeout", "-5", "none"},
+		{"grpc-timeout", "3H", "3h0m0s"},
+		{"grpc-timeout", "99999999H", "24h0m0s"},
+		{"grpc-timeout", "999999999S", "none"},
+		{"grpc-timeout", "+5S", "none"},
+		{"grpc-timeout", "5X", "none"},
+		{"grpc-timeout", "0S", "none"},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(tc.header, tc.value)
+		w := httptest.NewRecorder()
+		app.Handler().ServeHTTP(w, req)
+		if got := w.Body.String(); got != tc.expected {
+			t.Errorf("Expected budget %s for %s: %s, got %s", tc.expected, tc.header, tc.value, got)
+		}
+	}
+}
+
+func TestApp_ClientAuthWithoutCAs(t *testing.T) {
+	for _, auth := range []tls.ClientAuthType{tls.VerifyClientCertIfGiven, tls.RequireAndVerifyClientCert} {
+		app := puff.App(&puff.AppConfig{
+			Name:              "Client Auth Test",
+			TLSPublicCertFile: "cert.pem",
+			TLSPrivateKeyFile: "key.pem",
+			TLSClientAuth:     auth,
+		})
+		err := app.ListenAndServe("127.0.0.1:0")
+		if err == nil || !strings.Contains(err.Error(), "TLSClientCAs") {
+			t.Errorf("Expected %s without client CAs to fail, got %v", auth, err)
+		}
+	}
+}
+
+func TestApp_Rules(t *testing.T) {
+	rules, err := puff.LoadRules(strings.NewReader(`[
+		{"match": "^/old/(.*)$", "action": "redirect", "to": "/new/$1", "status_code": 301},
+		{"match": "^/go/(.*)$", "action": "redirect", "to": "/$1"},
+		{"match": "^/v1/(.*)$", "action": "rewrite", "to": "/$1"}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := puff.App(&puff.AppConfig{Name: "Rules Test", Rules: rules})
+	app.Get("/items", nil, func(c *puff.Context) {
+		c.SendResponse(puff.GenericResponse{Content: "items"})
+	})
+	if err := app.SelfCheck(); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		path, location string
+		status         int
+	}{
+		{"/old/items?page=2", "/new/items?page=2", http.StatusMovedPermanently},
+		{"/go/items", "/items", http.StatusPermanentRedirect},
+		{"/go//evil.example", "/evil.example", http.StatusPermanentRedirect},
+		{`/go/\evil.example`, "/evil.example", http.StatusPermanentRedirect},
+		{"/v1/items", "", http.StatusOK},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.URL.Path, req.URL.RawQuery, _ = strings.Cut(tc.path, "?")
+		w := httptest.NewRecorder()
+		app.Handler().ServeHTTP(w, req)
+		if w.Code != tc.status || w.Header().Get("Location") != tc.location {
+			t.Errorf("Expected %d to %q for %s, got %d to %q", tc.status, tc.location, tc.path, w.Code, w.Header().Get("Location"))
+		}
+	}
+
+	for _, status := range []int{300, 304, 305} {
+		rules := fmt.Sprintf(`[{"match": "^/a$", "action": "redirect", "to": "/b", "status_code": %d}]`, status)
+		if _, err := puff.LoadRules(strings.NewReader(rules)); err == nil {
+			t.Errorf("Expected status code %d to be rejected", status)
+		}
+	}
+}
+
+func TestSecret_Providers(t *testing.T) {
+	t.Setenv("APP_DB_PASSWORD", "from-env")
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "db-password"), []byte("from-file"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	calls := 0
+	fn := puff.SecretProviderFunc(func(_ context.Context, name string) ([]byte, error) {
+		calls++
+		return []byte(fmt.Sprintf("%s-%d", name, calls)), nil
+	})
+
+	for _, tc := range []struct {
+		provider puff.SecretProvider
+		name     string
+		expected string
+	}{
+		{puff.EnvSecretProvider{Prefix: "APP_"}, "db-password", "from-env"},
+		{puff.EnvSecretProvider{Prefix: "APP_"}, "db.password", "from-env"},
+		{puff.FileSecretProvider{Dir: dir}, "db-password", "from-file"},
+		{fn, "token", "token-1"},
+	} {
+		secret := puff.NewSecret(tc.provider, tc.name)
+		if err := secret.Load(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if string(secret.Value()) != tc.expected {
+			t.Errorf("Expected %s for %s, got %s", tc.expected, tc.name, secret.Value())
+		}
+	}
+
+	for _, tc := range []struct {
+		provider puff.SecretProvider
+		name     string
+	}{
+		{puff.EnvSecretProvider{Prefix: "APP_"}, "missing"},
+		{puff.FileSecretProvider{Dir: dir}, "missing"},
+		{puff.FileSecretProvider{Dir: dir}, "../db-password"},
+	} {
+		if err := puff.NewSecret(tc.provider, tc.name).Load(context.Background()); err == nil {
+			t.Errorf("Expected loading %s from %T to fail", tc.name, tc.provider)
+		}
+	}
+}
+
+func TestSecret_Rotate(t *testing.T) {
+	calls := 0
+	secret := puff.NewSecret(puff.SecretProviderFunc(func(_ context.Context, name string) ([]byte, error) {
+		calls++
+		if calls == 3 {
+			return nil, errors.New("vault unavailable")
+		}
+		return []byte(fmt.Sprintf("v%d", calls)), nil
+	}), "key")
+	var rotated []string
+	secret.OnRotate(func(value []byte) {
+		rotated = append(rotated, string(value))
+	})
+
+	if secret.Value() != nil {
+		t.Errorf("Expected no value before loading, got %s", secret.Value())
+	}
+	for range 2 {
+		if err := secret.Load(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := secret.Rotate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if string(secret.Value()) != "v2" || calls != 2 {
+		t.Errorf("Expected Load to fetch once and Rotate to refresh the value, got %s after %d calls", secret.Value(), calls)
+	}
+	if err := secret.Rotate(context.Background()); err == nil {
+		t.Error("Expected the failing rotation to return its error")
+	}
+	if string(secret.Value()) != "v2" || !slices.Equal(rotated, []string{"v1", "v2"}) {
+		t.Errorf("Expected a failed rotation to keep the value and skip the hooks, got %s and hooks %v", secret.Value(), rotated)
+	}
+}
+
+func TestApp_TLSSecretsKeepTLSConfig(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secrets := map[string][]byte{
+		"cert": pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		"key":  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+	provider := puff.SecretProviderFunc(func(_ context.Context, name string) ([]byte, error) {
+		return secrets[name], nil
+	})
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	app := puff.App(&puff.AppConfig{
+		Name:                 "TLS Secrets Test",
+		TLSCertificateSecret: puff.NewSecret(provider, "cert"),
+		TLSPrivateKeySecret:  puff.NewSecret(provider, "key"),
+	})
+	app.Get("/", nil, func(c *puff.Context) {
+		c.SendResponse(puff.GenericResponse{Content: "ok"})
+	})
+	userConfig := &tls.Config{MinVersion: tls.VersionTLS13}
+	app.Server = &http.Server{Addr: addr, Handler: app.RootRouter, TLSConfig: userConfig}
+	go app.ListenAndServe(addr)
+	defer app.Close()
+
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(secrets["cert"])
+	dial := func(maxVersion uint16) (*tls.Conn, error) {
+		var conn *tls.Conn
+		for range 50 {
+			if conn, err = tls.Dial("tcp", addr, &tls.Config{RootCAs: pool, MaxVersion: maxVersion}); err == nil || !errors.Is(err, syscall.ECONNREFUSED) {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		return conn, err
+	}
+	conn, err := dial(tls.VersionTLS13)
+	if err != nil {
+		t.Fatalf("Expected the certificate from the secrets to be served, got %v", err)
+	}
+	conn.Close()
+	if conn, err := dial(tls.VersionTLS12); err == nil {
+		conn.Close()
+		t.Error("Expected MinVersion of Server.TLSConfig to be kept")
+	}
+	if userConfig.GetCertificate != nil {
+		t.Error("Expected Server.TLSConfig set by the user not to be modified")
+	}
+}
+
+func TestApp_Tenancy(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		config   puff.TenancyConfig
+		host     string
+		path     string
+		header   string
+		status   int
+		expected string
+	}{
+		{"header", puff.TenancyConfig{}, "example.com", "/pizza", "acme", http.StatusOK, "acme:pizza"},
+		{"custom header", puff.TenancyConfig{HeaderName: "X-Org"}, "example.com", "/pizza", "acme", http.StatusOK, "acme:pizza"},
+		{"no header", puff.TenancyConfig{}, "example.com", "/pizza", "", http.StatusOK, "pizza"},
+		{"required header", puff.TenancyConfig{Required: true}, "example.com", "/pizza", "", http.StatusBadRequest, ""},
+		{"subdomain", puff.TenancyConfig{Strategy: puff.TenantFromSubdomain}, "acme.example.com:8000", "/pizza", "", http.StatusOK, "acme:pizza"},
+		{"no subdomain", puff.TenancyConfig{Strategy: puff.TenantFromSubdomain, Required: true}, "example.com", "/pizza", "", http.StatusBadRequest, ""},
+		{"path prefix", puff.TenancyConfig{Strategy: puff.TenantFromPathPrefix}, "example.com", "/acme/pizza", "", http.StatusOK, "acme:pizza"},
+		{"resolve", puff.TenancyConfig{Resolve: func(req *http.Request) (string, bool) {
+			return strings.ToLower(req.Header.Get("X-Org")), true
+		}}, "example.com", "/pizza", "ACME", http.StatusOK, "acme:pizza"},
+	} {
+		config := tc.config
+		app := puff.App(&puff.AppConfig{Name: "Tenancy Test", Tenancy: &config})
+		app.Get("/pizza", nil, func(c *puff.Context) {
+			c.SendResponse(puff.GenericResponse{Content: c.Tenant().Key("pizza")})
+		})
+		req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+		req.Host = tc.host
+		if tc.config.HeaderName == "" {
+			req.Header.Set("X-Tenant-ID", tc.header)
+		}
+		req.Header.Set("X-Org", tc.header)
+		w := httptest.NewRecorder()
+		app.Handler().ServeHTTP(w, req)
+		if w.Code != tc.status || (tc.status == http.StatusOK && w.Body.String() != tc.expected) {
+			t.Errorf("Expected %d %s for %s, got %d %s", tc.status, tc.expected, tc.name, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestApp_SelfCheckReport(t *testing.T) {
+	app := puff.App(&puff.AppConfig{
+		Name:                    "Self Check Test",
+		DeferRegistrationErrors: true,
+		Rules:                   []puff.Rule{{Match: "^/old/(", Action: puff.RuleRedirect, To: "/new"}},
+	})
+	app.Get("/pizza", nil, func(c *puff.Context) {})
+	app.Get("/pizza", nil, func(c *puff.Context) {})
+	pinged := map[string]bool{}
+	app.AddHealthCheck("database", func(context.Context) error {
+		pinged["database"] = true
+		return errors.New("connection refused")
+	})
+	app.AddHealthCheck("cache", func(context.Context) error {
+		pinged["cache"] = true
+		return puff.Degraded(errors.New("slow"))
+	})
+
+	err := app.SelfCheck()
+	var report *puff.SelfCheckError
+	if !errors.As(err, &report) {
+		t.Fatalf("Expected a SelfCheckError, got %v", err)
+	}
+	if len(report.Problems) != 3 || !pinged["database"] || !pinged["cache"] {
+		t.Fatalf("Expected the duplicate route, the invalid rule and the failing health check, got %v", err)
+	}
+	for _, expected := range []string{"/pizza", "rule 0", "health check database failed"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected the report to mention %q, got %v", expected, err)
+		}
+	}
+	if strings.Contains(err.Error(), "cache") {
+		t.Errorf("Expected the degraded health check not to fail the self-check, got %v", err)
+	}
+	if err := app.ListenAndServe("127.0.0.1:0"); !errors.As(err, &report) {
+		t.Errorf("Expected ListenAndServe to fail with the self-check report, got %v", err)
+	}
+}
+
+func TestContext_Raw(t *testing.T) {
+	app := puff.DefaultApp("Raw Test")
+	var status int
+	var raw bool
+	app.Use(func(next puff.HandlerFunc) puff.HandlerFunc {
+		return func(c *puff.Context) {
+			next(c)
+			status, raw = c.GetStatusCode(), c.IsRaw()
+		}
+	})
+	app.Get("/teapot", nil, func(c *puff.Context) {
+		w, req := c.Raw()
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusTeapot)
+		fmt.Fprintf(w, "short and stout %s", req.URL.Path)
+		c.SendResponse(puff.GenericResponse{StatusCode: http.StatusOK, Content: "again"})
+	})
+	app.Get("/implicit", nil, func(c *puff.Context) {
+		w, _ := c.Raw()
+		w.Write([]byte("ok"))
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/teapot", nil)
+	w := httptest.NewRecorder()
+	app.Handler().ServeHTTP(w, req)
+	if w.Code != http.StatusTeapot || w.Body.String() != "short and stout /teapot" {
+		t.Errorf("Expected SendResponse after Raw to be ignored, got %d %s", w.Code, w.Body.String())
+	}
+	if status != http.StatusTeapot || !raw {
+		t.Errorf("Expected middlewares to see the raw status 418, got %d (raw: %t)", status, raw)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/implicit", nil)
+	w = httptest.NewRecorder()
+	app.Handler().ServeHTTP(w, req)
+	if w.Code != http.StatusOK || status != http.StatusOK {
+		t.Errorf("Expected a raw write to be recorded as 200, got %d and %d", w.Code, status)
+	}
+}
+
+func TestContext_BodyReader(t *testing.T) {
+	app := puff.DefaultApp("Body Reader Test")
+	upload := new(struct {
+		Body io.Reader `kind:"body"`
+	})
+	app.Post("/upload", upload, func(c *puff.Context) {
+		n, err := io.Copy(io.Discard, upload.Body)
+		c.SendResponse(puff.GenericResponse{Content: fmt.Sprintf("%d %v", n, err)})
+	})
+	app.Post("/limited", nil, func(c *puff.Context) {
+		body := c.BodyReader(4)
+		defer body.Close()
+		_, err := io.ReadAll(body)
+		var maxBytesErr *http.MaxBytesError
+		c.SendResponse(puff.GenericResponse{Content: fmt.Sprint(errors.As(err, &maxBytesErr))})
+	})
+	if err := app.SelfCheck(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		path, body, expected string
+	}{
+		{"/upload", strings.Repeat("x", 1<<20), fmt.Sprintf("%d <nil>", 1<<20)},
+		{"/limited", "abcd", "false"},
+		{"/limited", "abcde", "true"},
+	} {
+		req := httptest.NewRequest(http.MethodPost, tc.path, strings.NewReader(tc.body))
+		w := httptest.NewRecorder()
+		app.Handler().ServeHTTP(w, req)
+		if w.Body.String() != tc.expected {
+			t.Errorf("Expected %s for %s, got %d %s", tc.expected, tc.path, w.Code, w.Body.String())
+		}
+	}
+
+	app.GenerateOpenAPISpec()
+	spec, _ := json.Marshal(app.Config.OpenAPI)
+	if !strings.Contains(string(spec), `"format":"binary"`) {
+		t.Errorf("Expected the streamed body to be documented as binary, got %s", spec)
+	}
+
+	bad := puff.App(&puff.AppConfig{Name: "Body Reader Test", DeferRegistrationErrors: true})
+	bad.Get("/download", new(struct {
+		Data io.Reader `kind:"query"`
+	}), func(c *puff.Context) {})
+	if err := bad.SelfCheck(); err == nil || !strings.Contains(err.Error(), "must be of kind body") {
+		t.Errorf("Expected a reader outside the body to be rejected, got %v", err)
+	}
+}
+
+func TestApp_IncludeRegisteredRouters(t *testing.T) {
+	// the routes are registered by this test package, github.com/ThePuffProject/puff_test.
+	puff.RegisterRoutes(func(r *puff.Router) {
+		r.Get("/pizza", nil, func(c *puff.Context) {
+			c.SendResponse(puff.GenericResponse{Content: c.Request.URL.Path})
+		})
+	})
+
+	app := puff.DefaultApp("Convention Test")
+	app.IncludeRegisteredRouters("github.com/ThePuffProject")
+	if err := app.SelfCheck(); err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/puff_test/pizza", nil)
+	w := httptest.NewRecorder()
+	app.Handler().ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Body.String() != "/puff_test/pizza" {
+		t.Errorf("Expected the package router to be mounted at /puff_test, got %d %s", w.Code, w.Body.String())
+	}
+	for _, route := range app.AllRoutes() {
+		if route.Path == "/pizza" && (route.Router.Name != "puff_test" || route.Router.Tag != "puff_test") {
+			t.Errorf("Expected the router to be named and tagged after the package, got %s and %s", route.Router.Name, route.Router.Tag)
+		}
+	}
+
+	other := puff.DefaultApp("Convention Test")
+	other.IncludeRegisteredRouters("github.com/ThePuffProject/puff_test/handlers")
+	other.IncludeRegisteredRouters("github.com/ThePuffProject/puff_")
+	for _, route := range other.AllRoutes() {
+		if route.Path == "/pizza" {
+			t.Error("Expected packages outside the root not to be mounted")
+		}
+	}
+}
+
+func TestApp_DevErrorPages(t *testing.T) {
+	for _, dev := range []bool{true, false} {
+		app := puff.App(&puff.AppConfig{Name: "Error Pages Test", Dev: dev})
+		pizzas := puff.NewRouter("Pizzas", "/pizzas")
+		pizzas.Get("/{id}", nil, func(c *puff.Context) {
+			panic("oven on fire")
+		})
+		app.IncludeRouter(pizzas)
+		handler := app.Handler()
+
+		for _, tc := range []struct {
+			method, path string
+			status       int
+			devContent   []string
+		}{
+			{http.MethodGet, "/pizzas/1", http.StatusInternalServerError, []string{"oven on fire", "goroutine", "GET /pizzas/1 HTTP/1.1"}},
+			{http.MethodGet, "/pizzas/1/toppings", http.StatusNotFound, []string{"/pizzas/{id}"}},
+			{http.MethodDelete, "/pizzas/1", http.StatusMethodNotAllowed, []string{"Method Not Allowed"}},
+		} {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(tc.method, tc.path, nil))
+			body := w.Body.String()
+			if w.Code != tc.status {
+				t.Errorf("Expected %d for %s %s (dev: %t), got %d", tc.status, tc.method, tc.path, dev, w.Code)
+			}
+			isHTML := strings.HasPrefix(w.Header().Get("Content-Type"), "text/html")
+			if isHTML != dev {
+				t.Errorf("Expected an HTML page only in dev mode for %s %s (dev: %t), got %s", tc.method, tc.path, dev, w.Header().Get("Content-Type"))
+			}
+			for _, content := range tc.devContent {
+				if strings.Contains(body, content) != dev {
+					t.Errorf("Expected %q only in the dev page for %s %s (dev: %t), got %s", content, tc.method, tc.path, dev, body)
+				}
+			}
+		}
+	}
+}
+
+func TestContext_Go(t *testing.T) {
+	app := puff.App(&puff.AppConfig{
+		Name:           "Background Test",
+		Tenancy:        &puff.TenancyConfig{},
+		PropagatedKeys: []string{"principal"},
+		LoggerConfig:   &puff.LoggerConfig{UseJSON: true, Level: slog.LevelInfo, TimeFormat: time.RFC3339},
+	})
+	type result struct {
+		requestID, tenant string
+		principal, other  any
+		err               error
+	}
+	results := make(chan result, 1)
+	panicked := make(chan struct{})
+	app.Get("/", nil, func(c *puff.Context) {
+		c.SetResponseHeader("X-Request-ID", "req-1")
+		c.Set("principal", "alice")
+		c.Set("password", "hunter2")
+		c.Go(func(ctx context.Context) {
+			// the request has finished by the time the task runs.
+			time.Sleep(10 * time.Millisecond)
+			puff.LoggerFromContext(ctx).Info("task done")
+			results <- result{
+				requestID: puff.RequestIDFromContext(ctx),
+				tenant:    puff.TenantFromContext(ctx).ID,
+				principal: puff.ValueFromContext(ctx, "principal"),
+				other:     puff.ValueFromContext(ctx, "password"),
+				err:       ctx.Err(),
+			}
+		})
+		c.Go(func(ctx context.Context) {
+			defer close(panicked)
+			panic("task bug")
+		})
+		c.SendResponse(puff.GenericResponse{Content: "scheduled"})
+	})
+
+	// the puff logger writes to stdout.
+	stdout := os.Stdout
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Stdout = w
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Tenant-ID", "acme")
+	rec := httptest.NewRecorder()
+	app.Handler().ServeHTTP(rec, req)
+	got := <-results
+	<-panicked
+	time.Sleep(10 * time.Millisecond)
+	os.Stdout = stdout
+	w.Close()
+	logs, _ := io.ReadAll(r)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected the tasks to be scheduled, got %d %s", rec.Code, rec.Body.String())
+	}
+	if got.requestID != "req-1" || got.tenant != "acme" || got.principal != "alice" || got.other != nil || got.err != nil {
+		t.Errorf("Expected the request ID, tenant and propagated keys in a live context, got %+v", got)
+	}
+	for _, message := range []string{"task done", "Panic During Background Task"} {
+		found := false
+		for _, line := range strings.Split(string(logs), "\n") {
+			var record map[string]any
+			if json.Unmarshal([]byte(line), &record) == nil && record["message"] == message {
+				found = record["request_id"] == "req-1" && record["tenant"] == "acme"
+			}
+		}
+		if !found {
+			t.Errorf("Expected %q to be logged with the request ID and tenant, got %s", message, logs)
+		}
+	}
+}
+
+func TestRoute_PanicCircuit(t *testing.T) {
+	var tripped []any
+	app := puff.App(&puff.AppConfig{
+		Name: "Panic Circuit Test",
+		PanicCircuit: &puff.PanicCircuitConfig{
+			Threshold: 3,
+			Window:    time.Minute,
+			Cooldown:  100 * time.Millisecond,
+			OnTrip: func(route *puff.Route, lastPanic any) {
+				tripped = append(tripped, lastPanic)
+			},
+		},
+	})
+	broken := true
+	calls := 0
+	route := app.Get("/pizza", nil, func(c *puff.Context) {
+		calls++
+		if broken {
+			panic(fmt.Sprintf("oven %d on fire", calls))
+		}
+		c.SendResponse(puff.GenericResponse{Content: "pizza"})
+	})
+	handler := app.Handler()
+	send := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/pizza", nil))
+		return w
+	}
+
+	for i := range 3 {
+		if w := send(); w.Code != http.StatusInternalServerError {
+			t.Errorf("Expected panic %d to answer 500, got %d", i+1, w.Code)
+		}
+	}
+	if !route.CircuitOpen() || route.CircuitTrips() != 1 || !slices.Equal(tripped, []any{"oven 3 on fire"}) {
+		t.Fatalf("Expected the third panic to trip the route once, got open: %t, trips: %d, OnTrip: %v", route.CircuitOpen(), route.CircuitTrips(), tripped)
+	}
+	w := send()
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "1" || calls != 3 {
+		t.Errorf("Expected the tripped route to answer 503 with Retry-After without calling the handler, got %d %q after %d calls", w.Code, w.Header().Get("Retry-After"), calls)
+	}
+
+	broken = false
+	time.Sleep(150 * time.Millisecond)
+	if w := send(); w.Code != http.StatusOK || route.CircuitOpen() {
+		t.Errorf("Expected the route to recover after the cooldown, got %d", w.Code)
+	}
+}
+
+func TestContext_EarlyHints(t *testing.T) {
+	app := puff.DefaultApp("Early Hints Test")
+	app.Get("/", nil, func(c *puff.Context) {
+		c.EarlyHints("</style.css>; rel=preload; as=style", "</app.js>; rel=preload; as=script")
+		c.SendResponse(puff.GenericResponse{Content: "page"})
+	})
+	server := httptest.NewServer(app.Handler())
+	defer server.Close()
+
+	var hints []int
+	var links []string
+	trace := &httptrace.ClientTrace{
+		Got1xxResponse: func(code int, header textproto.MIMEHeader) error {
+			hints = append(hints, code)
+			links = append(links, header.Values("Link")...)
+			return nil
+		},
+	}
+	req, _ := http.NewRequestWithContext(httptrace.WithClientTrace(context.Background(), trace), http.MethodGet, server.URL, nil)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	if !slices.Equal(hints, []int{http.StatusEarlyHints}) || len(links) != 2 || !strings.Contains(links[0], "style.css") {
+		t.Errorf("Expected a 103 with both Link headers, got %v %v", hints, links)
+	}
+	if res.StatusCode != http.StatusOK || string(body) != "page" {
+		t.Errorf("Expected the final 200 after the hints, got %d %s", res.StatusCode, body)
+	}
+
+	// HTTP/1.0 clients do not support informational responses.
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	fmt.Fprint(conn, "GET / HTTP/1.0\r\nHost: x\r\n\r\n")
+	status, _ := bufio.NewReader(conn).ReadString('\n')
+	if !strings.HasPrefix(status, "HTTP/1.0 200") {
+		t.Errorf("Expected no 103 for an HTTP/1.0 client, got %q", status)
+	}
+}
+
 // testpuffserver starts a puff server for testing. It panics
 // if the server is unavailable.
 func testpuffserver() {
@@ -0,0 +1,112 @@
+package puff
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Redirect registers routes redirecting requests for from to to with
+// statusCode, e.g.
+//
+//	router.Redirect("/old", "/new", http.StatusMovedPermanently)
+//	router.Redirect("/users/{id}/profile", "/profiles/{id}", http.StatusPermanentRedirect)
+//
+// Path parameters of from can be used in to; the query string is kept.
+// statusCode must be 301, 302, 303, 307 or 308. 301, 302 and 303 redirect GET and HEAD requests, while 307 and 308, which
+// preserve the method, also redirect POST, PUT, PATCH and DELETE requests.
+// The redirect is documented in OpenAPI with its status code and Location
+// header. It returns the GET route.
+func (r *Router) Redirect(from, to string, statusCode int) *Route {
+	switch statusCode {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+	default:
+		panic(&RegistrationError{Kind: RegistrationBadPath, Router: r.Name, Method: http.MethodGet, Path: from, Err: fmt.Errorf("redirect status code must be 301, 302, 303, 307 or 308, got %d", statusCode)})
+	}
+	names := map[string]bool{}
+	for _, name := range pathParamNamesOf(from) {
+		names[name] = true
+	}
+	for _, name := range pathParamNamesOf(to) {
+		if !names[name] {
+			panic(&RegistrationError{Kind: RegistrationBadPath, Router: r.Name, Method: http.MethodGet, Path: from, Err: fmt.Errorf("redirect target %s uses unknown path param %s", to, name)})
+		}
+	}
+
+	methods := []string{http.MethodGet, http.MethodHead}
+	if statusCode == http.StatusTemporaryRedirect || statusCode == http.StatusPermanentRedirect {
+		methods = append(methods, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete)
+	}
+	handler := func(c *Context) {
+		target := expandRedirectTarget(to, c.PathParams())
+		if c.Request.URL.RawQuery != "" {
+			target += "?" + c.Request.URL.RawQuery
+		}
+		c.SendResponse(RedirectResponse{StatusCode: statusCode, To: target})
+	}
+	var get *Route
+	for _, method := range methods {
+		route := r.registerRoute(method, from, handler, nil)
+		route.redirect = &redirectInfo{to: to, statusCode: statusCode}
+		if method == http.MethodGet {
+			get = route
+		}
+	}
+	return get
+}
+
+// redirectInfo documents a route registered with Redirect.
+type redirectInfo struct {
+	to         string
+	statusCode int
+}
+
+// openAPIResponse returns the OpenAPI response of the redirect.
+func (ri *redirectInfo) openAPIResponse() (string, OpenAPIResponse) {
+	return strconv.Itoa(ri.statusCode), OpenAPIResponse{
+		Description: fmt.Sprintf("%s to %s", http.StatusText(ri.statusCode), ri.to),
+		Headers: map[string]Header{
+			"Location": {Description: "The URL redirected to.", Schema: &Schema{Type: "string"}},
+		},
+	}
+}
+
+// expandRedirectTarget replaces the path params of to with their escaped values.
+func expandRedirectTarget(to string, values map[string]string) string {
+	params, _ := parsePathParams(to)
+	var b strings.Builder
+	last := 0
+	for _, p := range params {
+		b.WriteString(to[last:p.start])
+		b.WriteString(escapePathValue(values[p.name]))
+		last = p.end
+	}
+	b.WriteString(to[last:])
+	target := b.String()
+	if loc := catchAllSegment.FindStringSubmatchIndex(target); loc != nil {
+		name := target[loc[2]:loc[3]]
+		target = target[:loc[0]] + "/" + escapePathValue(values[name])
+	}
+	return target
+}
+
+// localRedirectTarget collapses the leading slashes and backslashes of a
+// path-absolute redirect target into one, so that clients do not read it as a
+// protocol-relative URL pointing at another host.
+func localRedirectTarget(target string) string {
+	if len(target) < 2 || target[0] != '/' || (target[1] != '/' && target[1] != '\\') {
+		return target
+	}
+	return "/" + strings.TrimLeft(target, `/\`)
+}
+
+// escapePathValue escapes every segment of a path param value.
+func escapePathValue(value string) string {
+	segments := strings.Split(value, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
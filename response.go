@@ -1,13 +1,22 @@
 package puff
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"hash"
+	"hash/fnv"
+	"html"
+	"html/template"
+	"io"
 	"net/http"
 	"os"
+	"path/filepath"
 	"reflect"
-	"text/template"
+	"strings"
+	"sync"
+	"time"
 )
 
 func ResponseType[T any]() reflect.Type {
@@ -65,10 +74,21 @@ type Response interface {
 type JSONResponse struct {
 	StatusCode int
 	Content    any
+	// ETag enables computing a hash of the encoded content while encoding it. The hash is sent
+	// as the ETag header and a matching If-None-Match request header results in a 304 Not Modified
+	// response without a body.
+	ETag bool
+	// Page, if set, marks Content as one page of a paginated collection and
+	// emits the matching Link header (see Context.SetPageLinks).
+	Page *Page
 }
 
 // GetStatusCode returns the status code of the JSON response.
+// If ETag is enabled, the status code is written by WriteContent instead.
 func (j JSONResponse) GetStatusCode() int {
+	if j.ETag {
+		return 0
+	}
 	return resolveStatusCode(j.StatusCode, 200)
 }
 
@@ -78,6 +98,9 @@ func (j JSONResponse) GetContentType() string {
 
 // GetContent returns the content of the JSON response.
 func (j JSONResponse) WriteContent(c *Context) error {
+	if j.ETag {
+		return j.writeContentWithETag(c)
+	}
 	err := json.NewEncoder(c.ResponseWriter).Encode(j.Content)
 	if err != nil {
 		return fmt.Errorf("writing JSONResponse content failed with: %s", err.Error())
@@ -85,8 +108,67 @@ func (j JSONResponse) WriteContent(c *Context) error {
 	return nil
 }
 
+// jsonETagEncoder encodes JSON into buf while hashing it in the same pass.
+type jsonETagEncoder struct {
+	buf  bytes.Buffer
+	hash hash.Hash64
+	enc  *json.Encoder
+}
+
+var jsonETagEncoderPool = sync.Pool{
+	New: func() any {
+		e := &jsonETagEncoder{hash: fnv.New64a()}
+		e.enc = json.NewEncoder(io.MultiWriter(&e.buf, e.hash))
+		return e
+	},
+}
+
+func (j JSONResponse) writeContentWithETag(c *Context) error {
+	e := jsonETagEncoderPool.Get().(*jsonETagEncoder)
+	defer func() {
+		e.buf.Reset()
+		e.hash.Reset()
+		jsonETagEncoderPool.Put(e)
+	}()
+
+	if err := e.enc.Encode(j.Content); err != nil {
+		c.SetStatusCode(http.StatusInternalServerError)
+		return fmt.Errorf("writing JSONResponse content failed with: %s", err.Error())
+	}
+	etag := fmt.Sprintf(`"%x"`, e.hash.Sum64())
+	c.SetResponseHeader("ETag", etag)
+
+	statusCode := resolveStatusCode(j.StatusCode, 200)
+	if statusCode >= 200 && statusCode < 300 &&
+		isAnyOfThese(c.Request.Method, http.MethodGet, http.MethodHead) &&
+		etagMatches(c.GetRequestHeader("If-None-Match"), etag) {
+		c.ResponseWriter.Header().Del("Content-Type")
+		c.SetStatusCode(http.StatusNotModified)
+		return nil
+	}
+	c.SetStatusCode(statusCode)
+	_, err := c.ResponseWriter.Write(e.buf.Bytes())
+	return err
+}
+
+// etagMatches reports whether the If-None-Match header value matches etag
+// using weak comparison (RFC 9110 section 13.1.2).
+func etagMatches(ifNoneMatch string, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
 // HTMLResponse represents a response with HTML content.
-// It supports both file-based templates and inline string templates.
+// It supports both file-based templates and inline string templates, rendered
+// with html/template so their data is escaped.
 type HTMLResponse struct {
 	StatusCode int
 	// Content to render if TemplateFile is not used.
@@ -111,36 +193,49 @@ func (h HTMLResponse) GetContentType() string {
 // WriteContent writes the HTML content to the response.
 // It checks whether to use an inline template or a template file.
 func (h HTMLResponse) WriteContent(c *Context) error {
+	content, err := h.render(c)
+	if err != nil {
+		return err
+	}
+	fmt.Fprint(c.ResponseWriter, content)
+	return nil
+}
+
+// render returns the HTML content, executing the template if there is one.
+// Templates can use the functions of Context.templateFuncs, e.g. csrfToken.
+func (h HTMLResponse) render(c *Context) (string, error) {
 	var tmpl *template.Template
 	var err error
 
 	if h.TemplateFile != "" { // If TemplateFile is provided, use it.
-		tmpl, err = template.ParseFiles(h.TemplateFile)
+		tmpl, err = template.New(filepath.Base(h.TemplateFile)).Funcs(c.templateFuncs()).ParseFiles(h.TemplateFile)
 		if err != nil {
-			return fmt.Errorf("parsing template file failed: %s", err.Error())
+			return "", fmt.Errorf("parsing template file failed: %s", err.Error())
 		}
 	} else if h.Template != "" { // If Template string is provided, use it.
-		tmpl, err = template.New("inlineTemplate").Parse(h.Template)
+		tmpl, err = template.New("inlineTemplate").Funcs(c.templateFuncs()).Parse(h.Template)
 		if err != nil {
-			return fmt.Errorf("parsing inline template failed: %s", err.Error())
+			return "", fmt.Errorf("parsing inline template failed: %s", err.Error())
 		}
 	} else { // If no TemplateFile and Template, render the content as plain HTML.
-		fmt.Fprint(c.ResponseWriter, h.Content)
-		return nil
+		return h.Content, nil
 	}
 
 	// Execute the template with the provided data.
-	err = tmpl.Execute(c.ResponseWriter, h.Data)
+	var b strings.Builder
+	err = tmpl.Execute(&b, h.Data)
 	if err != nil {
-		return fmt.Errorf("executing template failed: %s", err.Error())
+		return "", fmt.Errorf("executing template failed: %s", err.Error())
 	}
-	return nil
+	return b.String(), nil
 }
 
 // FileResponse represents a response that sends a file.
 type FileResponse struct {
-	StatusCode  int
-	FilePath    string
+	StatusCode int
+	FilePath   string
+	// FileContent is sent instead of reading FilePath if FilePath is empty, e.g. for a
+	// file generated in memory. Range requests are honored either way.
 	FileContent []byte
 	ContentType string
 }
@@ -156,6 +251,10 @@ func (f FileResponse) GetContentType() string {
 
 // WriteContent serves the file from the provided path.
 func (f FileResponse) WriteContent(c *Context) error {
+	if f.FilePath == "" && f.FileContent != nil {
+		serveSeekable(c, time.Time{}, bytes.NewReader(f.FileContent))
+		return nil
+	}
 	if _, err := os.Stat(f.FilePath); errors.Is(err, os.ErrNotExist) {
 		c.InternalServerError("File %s was not found", f.FilePath)
 		return nil
@@ -184,6 +283,11 @@ type StreamingResponse struct {
 	// The channel should be written to with a ServerSideEvent to write
 	// to the response. It should be closed once done writing.
 	StreamHandler func(*chan ServerSideEvent)
+	// Trailers declares the names of the trailers sent after the stream.
+	Trailers []string
+	// TrailerValues is called once the stream is done and returns the value of
+	// every trailer in Trailers, e.g. the number of events sent.
+	TrailerValues func() map[string]string
 }
 
 type ServerSideEvent struct {
@@ -193,9 +297,10 @@ type ServerSideEvent struct {
 	Retry int
 }
 
-// GetStatusCode returns the status code of the streaming response.
+// GetStatusCode returns 0 since the status code is written by WriteContent,
+// after the trailers have been declared.
 func (s StreamingResponse) GetStatusCode() int {
-	return resolveStatusCode(s.StatusCode, 200)
+	return 0
 }
 
 func (s StreamingResponse) GetContentType() string {
@@ -206,6 +311,11 @@ func (s StreamingResponse) GetContentType() string {
 func (s StreamingResponse) WriteContent(c *Context) error {
 	c.ResponseWriter.Header().Set("Cache-Control", "no-cache")
 	c.ResponseWriter.Header().Set("Connection", "keep-alive")
+	c.DeclareTrailers(s.Trailers...)
+	c.SetStatusCode(resolveStatusCode(s.StatusCode, 200))
+
+	metrics := c.connectionMetrics()
+	defer metrics.sseStream()()
 
 	stream := make(chan ServerSideEvent)
 	go func() {
@@ -213,9 +323,15 @@ func (s StreamingResponse) WriteContent(c *Context) error {
 		s.StreamHandler(&stream)
 	}()
 	for value := range stream {
-		fmt.Fprint(c.ResponseWriter, constructSSE(value))
+		n, _ := fmt.Fprint(c.ResponseWriter, constructSSE(value))
+		metrics.sseEvent(n)
 		c.ResponseWriter.(http.Flusher).Flush()
 	}
+	if s.TrailerValues != nil {
+		for k, v := range s.TrailerValues() {
+			c.SetTrailer(k, v)
+		}
+	}
 	return nil
 }
 
@@ -272,6 +388,7 @@ func (r RedirectResponse) GetContentType() string {
 // WriteContent writes the header Location to redirect the client to.
 func (r RedirectResponse) WriteContent(c *Context) error {
 	c.SetResponseHeader("Location", r.To)
+	to := html.EscapeString(r.To)
 	fmt.Fprintf(c.ResponseWriter, `<!DOCTYPE HTML>
     <html lang='en-US'>
     <head>
@@ -285,7 +402,7 @@ func (r RedirectResponse) WriteContent(c *Context) error {
     <body>
         If you are not redirected automatically, follow this <a href='%s'>link to example</a>.
     </body>
-    </html>`, r.To, r.To, r.To)
+    </html>`, to, template.JSEscapeString(r.To), to)
 	return nil
 }
 
@@ -294,19 +411,55 @@ type GenericResponse struct {
 	StatusCode  int
 	Content     string
 	ContentType string
-}
-
-// GetStatusCode returns the status code of the generic response.
+	// Reader, if set, is sent instead of Content. Since it can seek, Range requests are
+	// honored with 206 Partial Content, so downloads of generated content (reports, media
+	// stitched in memory) can be resumed. Set an ETag response header or ModTime so
+	// clients can validate resumed downloads with If-Range.
+	Reader io.ReadSeeker
+	// ModTime is sent as Last-Modified and checked against If-Range and
+	// If-Modified-Since when Reader is set. Optional.
+	ModTime time.Time
+}
+
+// GetStatusCode returns the status code of the generic response. It is 0 for
+// responses with a Reader, whose status code depends on the Range header and
+// is written by WriteContent.
 func (g GenericResponse) GetStatusCode() int {
+	if g.servesRanges() {
+		return 0
+	}
 	return resolveStatusCode(g.StatusCode, 200)
 }
 
+// servesRanges reports whether Range requests are honored.
+func (g GenericResponse) servesRanges() bool {
+	return g.Reader != nil && (g.StatusCode == 0 || g.StatusCode == http.StatusOK)
+}
+
 func (g GenericResponse) GetContentType() string {
 	return resolveContentType(g.ContentType, "text/plain")
 }
 
 // GetContent returns the content of the generic response.
 func (g GenericResponse) WriteContent(c *Context) error {
+	if g.servesRanges() {
+		serveSeekable(c, g.ModTime, g.Reader)
+		return nil
+	}
+	if g.Reader != nil {
+		_, err := io.Copy(c.ResponseWriter, g.Reader)
+		return err
+	}
 	fmt.Fprint(c.ResponseWriter, g.Content)
 	return nil
 }
+
+// serveSeekable sends content, honoring Range and conditional request headers.
+func serveSeekable(c *Context, modTime time.Time, content io.ReadSeeker) {
+	if c.GetRequestHeader("Range") != "" {
+		c.statusCode = http.StatusPartialContent
+	} else {
+		c.statusCode = http.StatusOK
+	}
+	http.ServeContent(c.ResponseWriter, c.Request, "", modTime, content)
+}
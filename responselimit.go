@@ -0,0 +1,158 @@
+package puff
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+// ResponseSizePolicy is what happens when a response exceeds its size limit.
+type ResponseSizePolicy int
+
+const (
+	// TruncateResponse sends the first MaxBytes bytes of the body with an
+	// X-Response-Truncated header.
+	TruncateResponse ResponseSizePolicy = iota
+	// RejectResponse replaces the response with a 500 error and logs the route.
+	RejectResponse
+)
+
+// ResponseSizeLimit caps the size of response bodies, protecting against
+// accidentally serializing huge objects.
+type ResponseSizeLimit struct {
+	// MaxBytes is the maximum size of the response body.
+	MaxBytes int64
+	// Policy decides what happens to a response exceeding MaxBytes.
+	Policy ResponseSizePolicy
+}
+
+// WithMaxResponseSize caps the body of the route's responses at maxBytes
+// bytes, overriding the ResponseSizeLimit of its routers.
+func (r *Route) WithMaxResponseSize(maxBytes int64, policy ResponseSizePolicy) *Route {
+	r.ResponseSizeLimit = &ResponseSizeLimit{MaxBytes: maxBytes, Policy: policy}
+	return r
+}
+
+// responseSizeLimit returns the limit of the route, or of its closest router with one.
+func (r *Route) responseSizeLimit() *ResponseSizeLimit {
+	if r.ResponseSizeLimit != nil {
+		return r.ResponseSizeLimit
+	}
+	for current := r.Router; current != nil; current = current.parent {
+		if current.ResponseSizeLimit != nil {
+			return current.ResponseSizeLimit
+		}
+	}
+	return nil
+}
+
+// limitedResponseWriter buffers up to limit bytes of the response before
+// committing it, so an oversized response can still be truncated with a
+// header or replaced by an error. Flushing commits the response early, after
+// which an oversized body can only be cut off.
+type limitedResponseWriter struct {
+	http.ResponseWriter
+	limit      ResponseSizeLimit
+	route      *Route
+	buf        bytes.Buffer
+	statusCode int
+	written    int64
+	committed  bool
+	exceeded   bool
+	// header are the headers set before the handler ran, restored when the response is rejected.
+	header http.Header
+}
+
+func (w *limitedResponseWriter) WriteHeader(statusCode int) {
+	if statusCode < 200 {
+		// informational responses such as 103 Early Hints are not buffered.
+		w.ResponseWriter.WriteHeader(statusCode)
+		return
+	}
+	if w.statusCode == 0 {
+		w.statusCode = statusCode
+	}
+}
+
+func (w *limitedResponseWriter) Write(b []byte) (int, error) {
+	if w.statusCode == 0 {
+		w.statusCode = http.StatusOK
+	}
+	if w.exceeded {
+		return len(b), nil
+	}
+	remaining := w.limit.MaxBytes - w.written
+	if int64(len(b)) > remaining {
+		w.exceed(b[:remaining])
+		return len(b), nil
+	}
+	w.written += int64(len(b))
+	if w.committed {
+		return w.ResponseWriter.Write(b)
+	}
+	return w.buf.Write(b)
+}
+
+// exceed applies the policy once the body grows past the limit. head is the
+// part of the current write that still fits.
+func (w *limitedResponseWriter) exceed(head []byte) {
+	w.exceeded = true
+	slog.Error(fmt.Sprintf("response for route %s %s exceeded the limit of %d bytes", w.route.Protocol, w.route.fullPath, w.limit.MaxBytes))
+	if w.committed {
+		w.ResponseWriter.Write(head)
+		return
+	}
+	if w.limit.Policy == RejectResponse {
+		w.buf.Reset()
+		w.restoreHeaders()
+		w.route.Router.app().writeErrorResponse(w.ResponseWriter, http.StatusInternalServerError, "response too large")
+		w.committed = true
+		return
+	}
+	w.buf.Write(head)
+	w.Header().Set("X-Response-Truncated", strconv.FormatInt(w.limit.MaxBytes, 10))
+	w.Header().Del("Content-Length")
+	w.commit()
+}
+
+// restoreHeaders drops the headers written by the handler, e.g.
+// Content-Encoding or ETag, which do not describe the error response.
+func (w *limitedResponseWriter) restoreHeaders() {
+	dst := w.ResponseWriter.Header()
+	clear(dst)
+	for k, v := range w.header {
+		dst[k] = v
+	}
+}
+
+// commit writes the status code and the buffered body.
+func (w *limitedResponseWriter) commit() {
+	if w.committed {
+		return
+	}
+	w.committed = true
+	if w.statusCode == 0 {
+		return
+	}
+	w.ResponseWriter.WriteHeader(w.statusCode)
+	w.ResponseWriter.Write(w.buf.Bytes())
+	w.buf.Reset()
+}
+
+// Flush commits the response and flushes the underlying writer.
+func (w *limitedResponseWriter) Flush() {
+	if w.statusCode == 0 {
+		w.statusCode = http.StatusOK
+	}
+	w.commit()
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap allows http.ResponseController to reach the underlying writer.
+func (w *limitedResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,197 @@
+package puff
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+var (
+	jsonMarshalerType = reflect.TypeFor[json.Marshaler]()
+	textMarshalerType = reflect.TypeFor[encoding.TextMarshaler]()
+)
+
+// checkResponseSchema compares the JSON content sent by the route of c with
+// the response type declared for status (see Route.WithResponse) and logs a
+// warning for every mismatch. It is used when AppConfig.Dev and
+// AppConfig.EnforceResponseSchemas are set.
+func (c *Context) checkResponseSchema(status int, content any) {
+	route := c.route
+	if route == nil {
+		return
+	}
+	responses := route.effectiveResponses()
+	if len(responses) == 0 {
+		return
+	}
+	where := fmt.Sprintf("%s %s", route.Protocol, route.fullPath)
+	declared, ok := responses[status]
+	if !ok {
+		if status < 400 {
+			// error responses are documented by the default response.
+			slog.Warn(fmt.Sprintf("puff: response schema drift on %s: status %d is not declared with WithResponse", where, status))
+		}
+		return
+	}
+	b, err := json.Marshal(content)
+	if err != nil {
+		return
+	}
+	var actual any
+	if err := json.Unmarshal(b, &actual); err != nil {
+		return
+	}
+	for _, mismatch := range responseMismatches("$", declared(), actual) {
+		slog.Warn(fmt.Sprintf("puff: response schema drift on %s (status %d): %s", where, status, mismatch))
+	}
+}
+
+// responseMismatches compares the decoded JSON value actual at path with
+// what encoding t produces.
+func responseMismatches(path string, t reflect.Type, actual any) []string {
+	for t.Kind() == reflect.Pointer {
+		if actual == nil {
+			return nil
+		}
+		t = t.Elem()
+	}
+	if t.Implements(jsonMarshalerType) || reflect.PointerTo(t).Implements(jsonMarshalerType) {
+		return nil
+	}
+	if t.Implements(textMarshalerType) || reflect.PointerTo(t).Implements(textMarshalerType) {
+		return checkJSONKind(path, "string", actual)
+	}
+
+	switch t.Kind() {
+	case reflect.Interface:
+		return nil
+	case reflect.String:
+		return checkJSONKind(path, "string", actual)
+	case reflect.Bool:
+		return checkJSONKind(path, "boolean", actual)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return checkJSONKind(path, "number", actual)
+	case reflect.Slice, reflect.Array:
+		if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+			// []byte is encoded as a base64 string.
+			return checkJSONKind(path, "string", actual)
+		}
+		if actual == nil && t.Kind() == reflect.Slice {
+			return nil
+		}
+		items, ok := actual.([]any)
+		if !ok {
+			return checkJSONKind(path, "array", actual)
+		}
+		var mismatches []string
+		for i, item := range items {
+			mismatches = append(mismatches, responseMismatches(fmt.Sprintf("%s[%d]", path, i), t.Elem(), item)...)
+		}
+		return mismatches
+	case reflect.Map:
+		if actual == nil {
+			return nil
+		}
+		object, ok := actual.(map[string]any)
+		if !ok {
+			return checkJSONKind(path, "object", actual)
+		}
+		var mismatches []string
+		for _, key := range sortedKeys(object) {
+			mismatches = append(mismatches, responseMismatches(path+"."+key, t.Elem(), object[key])...)
+		}
+		return mismatches
+	case reflect.Struct:
+		object, ok := actual.(map[string]any)
+		if !ok {
+			return checkJSONKind(path, "object", actual)
+		}
+		fields := responseFields(t)
+		var mismatches []string
+		for _, key := range sortedKeys(fields) {
+			field := fields[key]
+			value, present := object[key]
+			if !present {
+				if !field.omitempty {
+					mismatches = append(mismatches, fmt.Sprintf("%s.%s is declared but missing", path, key))
+				}
+				continue
+			}
+			mismatches = append(mismatches, responseMismatches(path+"."+key, field.typ, value)...)
+		}
+		for _, key := range sortedKeys(object) {
+			if _, declared := fields[key]; !declared {
+				mismatches = append(mismatches, fmt.Sprintf("%s.%s is sent but not declared", path, key))
+			}
+		}
+		return mismatches
+	}
+	return nil
+}
+
+// checkJSONKind reports a mismatch if actual is not of the JSON kind expected.
+func checkJSONKind(path, expected string, actual any) []string {
+	kind := "null"
+	switch actual.(type) {
+	case string:
+		kind = "string"
+	case bool:
+		kind = "boolean"
+	case float64:
+		kind = "number"
+	case []any:
+		kind = "array"
+	case map[string]any:
+		kind = "object"
+	}
+	if kind == expected {
+		return nil
+	}
+	return []string{fmt.Sprintf("%s is declared as %s but sent as %s", path, expected, kind)}
+}
+
+type responseField struct {
+	typ       reflect.Type
+	omitempty bool
+}
+
+// responseFields returns the fields of struct type t by the name
+// encoding/json gives them, including the fields promoted from embedded structs.
+func responseFields(t reflect.Type) map[string]responseField {
+	fields := map[string]responseField{}
+	for i := range t.NumField() {
+		f := t.Field(i)
+		name, options, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" && options == "" {
+			continue
+		}
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				for k, v := range responseFields(ft) {
+					if _, ok := fields[k]; !ok {
+						fields[k] = v
+					}
+				}
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = responseField{typ: f.Type, omitempty: slices.Contains(strings.Split(options, ","), "omitempty")}
+	}
+	return fields
+}
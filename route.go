@@ -1,17 +1,34 @@
 package puff
 
 import (
+	"errors"
 	"fmt"
 	"maps"
+	"net/http"
 	"reflect"
 	"regexp"
 	"strings"
+	"time"
 )
 
 type Route struct {
-	fullPath    string
-	regexp      *regexp.Regexp
-	params      []Parameter
+	fullPath string
+	regexp   *regexp.Regexp
+	// regexpSource is the full path regexp was compiled from.
+	regexpSource string
+	// regexpFold is regexp matching regardless of case, used by case-insensitive routers.
+	regexpFold *regexp.Regexp
+	// segmentKinds are the kinds of the segments of the full path, compiled with regexp.
+	segmentKinds []int
+	// pathConstraints holds the inline {name:pattern} constraints by path parameter position.
+	pathConstraints []*regexp.Regexp
+	// paramPatterns holds the compiled pattern tags of the input fields by parameter index.
+	paramPatterns []*regexp.Regexp
+	params        []Parameter
+	// uploadLimit is the largest request body accepted if every uploaded file has a maxsize.
+	uploadLimit int64
+	// Description documents the route in OpenAPI. Default: the comment above the
+	// registration of the route, read when the route is prepared for serving.
 	Description string
 	WebSocket   bool
 	Protocol    string
@@ -23,6 +40,55 @@ type Route struct {
 	// Responses are the schemas associated with a specific route. Have preference over parent router defined routes.
 	// Preferably set Responses using the WithResponse/WithResponses method on Route.
 	Responses Responses
+	// ResponseSizeLimit caps the size of the route's response bodies. Overrides the limit of its routers.
+	// Preferably set using the WithMaxResponseSize method on Route.
+	ResponseSizeLimit *ResponseSizeLimit
+	// Timeout limits the time the handler may take. Overrides the Timeout of its routers.
+	// Preferably set using WithTimeout.
+	Timeout time.Duration
+	// Bulkhead limits how many requests to the route are served at once. Overrides the Bulkhead of its routers.
+	// Preferably set using WithBulkhead.
+	Bulkhead *Bulkhead
+	// ExcludeFromOpenAPI leaves the route out of the generated OpenAPI spec.
+	ExcludeFromOpenAPI bool
+	// Middlewares are applied to this route only, inside the middlewares of its routers.
+	// Preferably set using the Use method on Route.
+	Middlewares []*Middleware
+
+	// queryConstraints maps query keys to the value they must have for the route to match.
+	// An empty value only requires the key to be present. Set with WithQuery.
+	queryConstraints map[string]string
+	// comment is the comment above the registration of the route, the default Description.
+	comment *lazyDescription
+	// fieldSelection lets clients select the fields of responses. Set with WithFieldSelection.
+	fieldSelection *fieldSelection
+	// ifMatch documents the If-Match header of the route. Set with WithIfMatch.
+	ifMatch bool
+	// circuit tracks recent panics of the route for AppConfig.PanicCircuit.
+	circuit *panicCircuit
+	// strictQuery rejects undeclared query params. Set with StrictQuery.
+	strictQuery bool
+	// allowedQuery are the query params accepted besides the fields. Set with AllowQuery.
+	allowedQuery []string
+	// redirect is set for routes registered with Redirect.
+	redirect *redirectInfo
+	// documentedErrors are the error responses of the route by status code. Set with Errors.
+	documentedErrors map[int]*HTTPError
+	// source is the file:line the route was registered at, used in registration errors.
+	source string
+	// rpc is set for WebSocket routes registered with Router.RPC.
+	rpc *RPC
+	// handlerName is the name of the handler function the route was registered with.
+	handlerName string
+	// name identifies the route for urlFor in templates. Set with WithName.
+	name string
+	// deprecation is set for routes marked with Deprecate.
+	deprecation *deprecationInfo
+	// features are the feature flags gating the route. Set with Feature.
+	features []string
+	// bindsInput is set once the input binding is the innermost layer of Handler,
+	// so middlewares run before the request is bound.
+	bindsInput bool
 }
 
 func (r *Route) String() string {
@@ -42,16 +108,345 @@ func (route *Route) getCompletePath() {
 	}
 
 	parts = append(parts, route.Path)
-	route.fullPath = strings.Join(parts, "")
+	// only a changed path is written, as requests served meanwhile read it.
+	if fullPath := strings.Join(parts, ""); fullPath != route.fullPath {
+		route.fullPath = fullPath
+	}
+}
+
+// catchAllSegment matches a trailing catch-all segment such as "/*filepath".
+var catchAllSegment = regexp.MustCompile(`/\*([A-Za-z_][A-Za-z0-9_]*)$`)
+
+// pathParam is a {name} or {name:pattern} placeholder in a route path.
+type pathParam struct {
+	start, end int
+	name       string
+	pattern    string
+	// converter is the name of the converter the pattern was taken from, e.g. "int".
+	converter string
+}
+
+// parsePathParams returns the placeholders of path. Every "{" must be closed
+// by a "}" and name a non-empty parameter. Braces may only nest inside the
+// pattern of a constraint, e.g. {code:[a-z]{3}}. A constraint naming a path
+// converter, e.g. {id:int}, is replaced by the converter's pattern.
+func parsePathParams(path string) ([]pathParam, error) {
+	var params []pathParam
+	depth := 0
+	start := 0
+	colon := -1
+	for i, c := range path {
+		switch c {
+		case '{':
+			if depth > 0 && colon == -1 {
+				return nil, fmt.Errorf("nested '{' at index %d", i)
+			}
+			if depth == 0 {
+				start = i
+				colon = -1
+			}
+			depth++
+		case ':':
+			if depth == 1 && colon == -1 {
+				colon = i
+			}
+		case '}':
+			if depth == 0 {
+				return nil, fmt.Errorf("unexpected '}' at index %d", i)
+			}
+			depth--
+			if depth > 0 {
+				continue
+			}
+			param := pathParam{start: start, end: i + 1, name: path[start+1 : i]}
+			if colon != -1 {
+				param.name = path[start+1 : colon]
+				param.pattern = path[colon+1 : i]
+				if param.pattern == "" {
+					return nil, fmt.Errorf("empty constraint for path parameter %s at index %d", param.name, start)
+				}
+				if converter, ok := pathConverters[param.pattern]; ok {
+					param.converter = param.pattern
+					param.pattern = converter.pattern
+				}
+			}
+			if param.name == "" {
+				return nil, fmt.Errorf("empty path parameter name at index %d", start)
+			}
+			params = append(params, param)
+		}
+	}
+	if depth > 0 {
+		return nil, fmt.Errorf("unclosed '{' at index %d", start)
+	}
+	return params, nil
+}
+
+// validatePath reports whether path is a well-formed route path: its
+// placeholders must parse, constraints must be valid regular expressions,
+// and a "*" may only start a named catch-all segment at the end of the path.
+func validatePath(path string) error {
+	params, err := parsePathParams(path)
+	if err != nil {
+		return err
+	}
+	seen := map[string]bool{}
+	for i, param := range params {
+		if seen[param.name] {
+			return fmt.Errorf("path parameter %s is declared more than once", param.name)
+		}
+		seen[param.name] = true
+		if param.pattern != "" {
+			if _, err := regexp.Compile("^(?:" + param.pattern + ")$"); err != nil {
+				return fmt.Errorf("invalid constraint for path parameter %s: %w", param.name, err)
+			}
+		}
+		if i > 0 && params[i-1].end == param.start {
+			return fmt.Errorf("path parameters %s and %s must be separated by text", params[i-1].name, param.name)
+		}
+	}
+	// blank out the placeholders so a "*" inside a constraint is ignored.
+	stripped := []byte(path)
+	for _, param := range params {
+		for i := param.start; i < param.end; i++ {
+			stripped[i] = '_'
+		}
+	}
+	if i := strings.IndexByte(string(stripped), '*'); i != -1 {
+		loc := catchAllSegment.FindIndex(stripped)
+		if loc == nil || loc[0]+1 != i {
+			return fmt.Errorf("'*' at index %d must start a named catch-all segment at the end of the path", i)
+		}
+		if name := path[loc[0]+2:]; seen[name] {
+			return fmt.Errorf("path parameter %s is declared more than once", name)
+		}
+	}
+	return nil
+}
+
+// pathPattern converts a route path to the regular expression matching it.
+// Every {param} captures the non-empty part of a segment it occupies, e.g.
+// "/v{version}" or "/{name}.{ext}", and a trailing /*param captures the
+// non-empty rest of the path, including slashes. Where a segment is ambiguous,
+// earlier parameters take as much as they can, so "{name}.{ext}" splits
+// "archive.tar.gz" into "archive.tar" and "gz". Constraints are not part of
+// the pattern; see pathConstraints.
+func pathPattern(path string) string {
+	catchAll := ""
+	if loc := catchAllSegment.FindStringIndex(path); loc != nil {
+		path = path[:loc[0]]
+		catchAll = "\\/(.+)"
+	}
+	params, _ := parsePathParams(path)
+	var b strings.Builder
+	b.WriteString("^")
+	last := 0
+	for _, param := range params {
+		b.WriteString(regexp.QuoteMeta(path[last:param.start]))
+		b.WriteString("([^/]+)")
+		last = param.end
+	}
+	b.WriteString(regexp.QuoteMeta(path[last:]))
+	b.WriteString(catchAll + "$")
+	return b.String()
+}
+
+// openAPIPath returns the route path in OpenAPI form, without constraints
+// and with a catch-all segment written as a regular {param}.
+func (route *Route) openAPIPath() string {
+	path := route.fullPath
+	if params, err := parsePathParams(path); err == nil {
+		for i := len(params) - 1; i >= 0; i-- {
+			path = path[:params[i].start] + "{" + params[i].name + "}" + path[params[i].end:]
+		}
+	}
+	return catchAllSegment.ReplaceAllString(path, "/{$1}")
+}
+
+// pathParamNames returns the names of the route's path parameters in order,
+// including a trailing catch-all.
+func (route *Route) pathParamNames() []string {
+	return pathParamNamesOf(route.fullPath)
+}
+
+// pathParamNamesOf returns the names of the path parameters of path in order,
+// including a trailing catch-all.
+func pathParamNamesOf(path string) []string {
+	params, _ := parsePathParams(path)
+	names := make([]string, 0, len(params)+1)
+	for _, param := range params {
+		names = append(names, param.name)
+	}
+	if m := catchAllSegment.FindStringSubmatch(path); m != nil {
+		names = append(names, m[1])
+	}
+	return names
 }
 
 func (route *Route) createRegexMatch() {
-	escapedPath := strings.ReplaceAll(route.fullPath, "/", "\\/")
-	regexPattern := regexp.MustCompile(`\{[^}]+\}`).ReplaceAllString(escapedPath, "([^/]+)")
-	route.regexp = regexp.MustCompile("^" + regexPattern + "$")
+	if err := route.compileRegexMatch(); err != nil {
+		panic(err)
+	}
+}
+
+// compileRegexMatch compiles the regular expressions matching the route path.
+// They are kept while the full path does not change, so checking and then
+// preparing a route compiles them once.
+func (route *Route) compileRegexMatch() error {
+	fold := route.mayFoldCase()
+	if route.regexp != nil && route.regexpSource == route.fullPath && (route.regexpFold != nil || !fold) {
+		return nil
+	}
+	pattern := pathPattern(route.fullPath)
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return err
+	}
+	route.regexp, route.regexpSource = re, route.fullPath
+	route.segmentKinds = segmentKindsOf(route.fullPath)
+	route.regexpFold = nil
+	if fold {
+		route.regexpFold = regexp.MustCompile("(?i)" + pattern)
+	}
+	route.pathConstraints = nil
+	params, _ := parsePathParams(route.fullPath)
+	for i, param := range params {
+		if param.pattern == "" {
+			continue
+		}
+		if route.pathConstraints == nil {
+			route.pathConstraints = make([]*regexp.Regexp, len(params))
+		}
+		route.pathConstraints[i] = regexp.MustCompile("^(?:" + param.pattern + ")$")
+	}
+	return nil
+}
+
+// bindInput populates the input schema of the route from the request. It
+// responds with 400 and returns false if the request does not fit, or with
+// 422 if the Validate method of the fields rejects it.
+func (route *Route) bindInput(c *Context) bool {
+	if route.rejectUnknownQuery(c) {
+		return false
+	}
+	if route.uploadLimit > 0 {
+		// files larger than their maxsize are rejected before they are buffered.
+		c.Request.Body = http.MaxBytesReader(c.ResponseWriter, c.Request.Body, route.uploadLimit)
+	}
+	matches := route.matcher().FindStringSubmatch(c.Request.URL.Path)
+	err := populateInputSchema(c, route.Fields, route.params, route.paramPatterns, matches)
+	if err != nil {
+		status := http.StatusBadRequest
+		var malformed *malformedBodyError
+		var upload *uploadError
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &malformed) {
+			status = http.StatusUnprocessableEntity
+		} else if errors.As(err, &upload) {
+			status = upload.statusCode
+		} else if errors.As(err, &tooLarge) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		c.sendError(status, err.Error(), err)
+		return false
+	}
+	if err := validateFields(c, route.Fields); err != nil {
+		c.sendValidationError(err)
+		return false
+	}
+	return true
+}
+
+// withInputBinding wraps next so the input schema is bound right before it runs.
+func (route *Route) withInputBinding(next HandlerFunc) HandlerFunc {
+	return func(c *Context) {
+		if route.bindInput(c) {
+			next(c)
+		}
+	}
+}
+
+// mayFoldCase reports whether the route may be matched regardless of case,
+// so the case-insensitive regexp is only compiled for routes needing it.
+func (route *Route) mayFoldCase() bool {
+	if route.Router == nil {
+		return true
+	}
+	app := route.Router.app()
+	return app == nil || app.Config.CaseInsensitiveRouting || route.Router.caseInsensitive()
+}
+
+// matcher returns the regular expression matching the route path, ignoring
+// case if the route belongs to a case-insensitive router.
+func (route *Route) matcher() *regexp.Regexp {
+	if route.regexpFold != nil && route.Router.caseInsensitive() {
+		return route.regexpFold
+	}
+	return route.regexp
+}
+
+// canonicalPath returns path with the literal parts of the route path in
+// their registered casing. The values of path parameters are kept as sent.
+func (route *Route) canonicalPath(path string) string {
+	matches := route.matcher().FindStringSubmatch(path)
+	if matches == nil {
+		return path
+	}
+	template := route.fullPath
+	catchAll := false
+	if loc := catchAllSegment.FindStringIndex(template); loc != nil {
+		template = template[:loc[0]]
+		catchAll = true
+	}
+	params, _ := parsePathParams(template)
+	var b strings.Builder
+	last := 0
+	for i, param := range params {
+		b.WriteString(template[last:param.start])
+		b.WriteString(matches[i+1])
+		last = param.end
+	}
+	b.WriteString(template[last:])
+	if catchAll {
+		b.WriteString("/" + matches[len(params)+1])
+	}
+	return b.String()
+}
+
+// matchesPath reports whether path matches the route, including the
+// constraints of its path parameters.
+func (route *Route) matchesPath(path string) bool {
+	if len(route.pathConstraints) == 0 && len(route.paramPatterns) == 0 {
+		return route.matcher().MatchString(path)
+	}
+	matches := route.matcher().FindStringSubmatch(path)
+	if matches == nil {
+		return false
+	}
+	for i, re := range route.pathConstraints {
+		if re != nil && i+1 < len(matches) && !re.MatchString(matches[i+1]) {
+			return false
+		}
+	}
+	pathIndex := 0
+	for i, param := range route.params {
+		if param.In != "path" {
+			continue
+		}
+		if i < len(route.paramPatterns) && route.paramPatterns[i] != nil && pathIndex+1 < len(matches) && !route.paramPatterns[i].MatchString(matches[pathIndex+1]) {
+			return false
+		}
+		pathIndex++
+	}
+	return true
 }
 
 func (route *Route) handleInputSchema() error { // should this return an error or should it panic?
+	for _, res := range route.effectiveResponses() {
+		if err := checkEnumTags(res()); err != nil {
+			return err
+		}
+	}
 	if route.Fields == nil {
 		route.params = []Parameter{}
 		return nil
@@ -66,27 +461,41 @@ func (route *Route) handleInputSchema() error { // should this return an error o
 	if sve.Kind() != reflect.Struct {
 		return fmt.Errorf("fields must be pointer to STRUCT")
 	}
+	if err := checkEnumTags(svet); err != nil {
+		return err
+	}
 
+	pathParams, _ := parsePathParams(route.fullPath)
+	pathCaptures := len(pathParams)
+	if catchAllSegment.MatchString(route.fullPath) {
+		pathCaptures++
+	}
+	pathIndex := 0
 	newParams := []Parameter{}
+	var paramPatterns []*regexp.Regexp
 	for i := range svet.NumField() {
 		newParam := Parameter{}
 		svetf := svet.Field(i)
 
-		name := svetf.Tag.Get("name")
-		if name == "" {
-			name = svetf.Name
-		}
+		name := paramName(svetf, route.Router != nil && route.Router.jsonParamNames())
 
 		// param.Schema
-		newParam.Schema = newDefinition(route, sve.Field(i).Interface())
+		if isReaderField(svetf.Type) {
+			newParam.Schema = &Schema{Type: "string", Format: "binary"}
+		} else {
+			newParam.Schema = newDefinition(route, sve.Field(i).Interface())
+		}
 
 		//param.In
 		specified_kind := svetf.Tag.Get("kind") //ref: Parameters object/In
-		if name == "Body" && specified_kind == "" {
+		if (name == "Body" || svetf.Name == "Body") && specified_kind == "" {
 			specified_kind = "body"
 		}
 		if !isValidKind(specified_kind) {
-			return fmt.Errorf("specified kind on field %s in struct tag must be header, path, query, cookie, body, or formdata", svetf.Name)
+			return fmt.Errorf("specified kind on field %s in struct tag must be header, path, host, query, cookie, body, or formdata", svetf.Name)
+		}
+		if isReaderField(svetf.Type) && specified_kind != "body" {
+			return fmt.Errorf("field %s of type %s must be of kind body", svetf.Name, svetf.Type)
 		}
 
 		//param.Description
@@ -96,7 +505,8 @@ func (route *Route) handleInputSchema() error { // should this return an error o
 		specified_required := svetf.Tag.Get("required")
 		specified_deprecated := svetf.Tag.Get("deprecated")
 
-		required_def := true
+		// pointers are optional
+		required_def := !isOptionalField(svetf.Type)
 		if specified_kind == "cookie" { // cookies by default should never be required
 			required_def = false
 		}
@@ -109,6 +519,65 @@ func (route *Route) handleInputSchema() error { // should this return an error o
 		if err != nil {
 			return err
 		}
+		strict, err := resolveBool(svetf.Tag.Get("strict"), false)
+		if err != nil {
+			return err
+		}
+		if strict && specified_kind != "body" {
+			return fmt.Errorf("field %s must be of kind body to be strict", svetf.Name)
+		}
+
+		//param.formStruct of structs bound from the whole form
+		formStruct := specified_kind == "form" && isFormStructField(svetf.Type)
+		if formStruct {
+			uploads, err := checkFormStruct(svetf.Type)
+			if err != nil {
+				return fmt.Errorf("invalid form struct %s: %w", svetf.Name, err)
+			}
+			for _, upload := range uploads {
+				route.documentUploadErrors(upload)
+			}
+		}
+
+		//param.upload of files
+		upload, err := parseUploadConstraints(svetf)
+		if err != nil {
+			return err
+		}
+		if upload != nil {
+			if specified_kind != "file" {
+				return fmt.Errorf("field %s must be of kind file to have maxsize or accept", svetf.Name)
+			}
+			route.documentUploadErrors(upload)
+		}
+
+		//param.media of bodies
+		var media []string
+		if tag := svetf.Tag.Get("media"); tag != "" {
+			if specified_kind != "body" {
+				return fmt.Errorf("field %s must be of kind body to have a media type", svetf.Name)
+			}
+			media, err = parseMediaTag(tag, svetf.Type)
+			if err != nil {
+				return fmt.Errorf("invalid media on field %s: %w", svetf.Name, err)
+			}
+		}
+
+		//param.Style and param.Explode of repeated query params
+		if specified_kind == "query" && isSliceField(svetf.Type) {
+			explode, err := resolveBool(svetf.Tag.Get("explode"), true)
+			if err != nil {
+				return err
+			}
+			newParam.Style, newParam.Explode = "form", explode
+		} else if svetf.Tag.Get("explode") != "" {
+			return fmt.Errorf("field %s must be a slice of kind query to have explode", svetf.Name)
+		}
+		// the pattern and enum of repeated query params apply to each value.
+		valueSchema := newParam.Schema
+		if newParam.Style == "form" && valueSchema.Items != nil {
+			valueSchema = valueSchema.Items
+		}
 
 		//param.Schema.format
 		format := svetf.Tag.Get("format")
@@ -116,20 +585,148 @@ func (route *Route) handleInputSchema() error { // should this return an error o
 			newParam.Schema.Format = format
 		}
 
+		//param.Schema for time.Time layouts
+		layout := svetf.Tag.Get("layout")
+		if layout != "" {
+			if svetf.Type != timeType && svetf.Type != reflect.PointerTo(timeType) {
+				return fmt.Errorf("field %s must be a time.Time to have a layout", svetf.Name)
+			}
+			newParam.Schema = timeSchema(timeType, layout)
+			if format != "" {
+				newParam.Schema.Format = format
+			}
+		}
+
+		//param.Schema.pattern
+		pattern := svetf.Tag.Get("pattern")
+		var patternRe *regexp.Regexp
+		if pattern != "" {
+			patternRe, err = regexp.Compile(pattern)
+			if err != nil {
+				return fmt.Errorf("invalid pattern on field %s: %w", svetf.Name, err)
+			}
+		}
+		if specified_kind == "path" {
+			if pathIndex >= pathCaptures {
+				return fmt.Errorf("field %s is of kind path, but path %s only declares %d path parameter(s)", svetf.Name, route.fullPath, pathCaptures)
+			}
+			expected := ""
+			if pathIndex < len(pathParams) {
+				expected = pathParams[pathIndex].name
+			} else if m := catchAllSegment.FindStringSubmatch(route.fullPath); m != nil {
+				expected = m[1]
+			}
+			if !strings.EqualFold(name, expected) {
+				return fmt.Errorf("field %s is bound to path parameter %s of %s, but is named %s", svetf.Name, expected, route.fullPath, name)
+			}
+			if pathIndex < len(pathParams) {
+				if converter := pathParams[pathIndex].converter; converter != "" {
+					if format == "" {
+						newParam.Schema.Format = pathConverters[converter].schema.Format
+					}
+				} else if pattern == "" {
+					pattern = pathParams[pathIndex].pattern
+				}
+			}
+			pathIndex++
+		}
+		if pattern != "" {
+			valueSchema.Pattern = pattern
+		}
+		paramPatterns = append(paramPatterns, patternRe)
+
+		//param.Schema.enum
+		if tag := svetf.Tag.Get("enum"); tag != "" {
+			enum, err := parseEnum(tag, svetf.Type)
+			if err != nil {
+				return fmt.Errorf("invalid enum on field %s: %w", svetf.Name, err)
+			}
+			valueSchema.Enum = enum
+			newParam.enum = enum
+		}
+
 		newParam.Name = name
 		newParam.In = specified_kind
 		newParam.Description = description
 		newParam.Required = required
 		newParam.Deprecated = deprecated
+		newParam.strict = strict
+		newParam.layout = layout
+		newParam.media = media
+		newParam.formStruct = formStruct
+		newParam.upload = upload
 
 		newParams = append(newParams, newParam)
 	}
 	route.params = newParams
+	route.paramPatterns = paramPatterns
+	route.uploadLimit = uploadLimit(svet, newParams)
 	return nil
 }
 
+// Use adds middlewares to this route only, e.g. to require authentication or
+// rate limiting on a single endpoint without creating a dedicated router. They
+// run in the order they were added, after the middlewares of the route's routers.
+func (r *Route) Use(m ...Middleware) *Route {
+	for i := range m {
+		r.Middlewares = append(r.Middlewares, &m[i])
+	}
+	return r
+}
+
+// WithQuery restricts the route to requests whose query string has key set to
+// value, or merely contains key if value is empty. This allows registering
+// variants of the same method and path that dispatch on the query:
+//
+//	app.Get("/orders", nil, listOrders)
+//	app.Get("/orders", nil, exportOrdersCSV).WithQuery("export", "csv")
+//
+// Routes with query constraints are tried before the route without any,
+// regardless of registration order. Variants are documented together under
+// one path in OpenAPI.
+func (r *Route) WithQuery(key, value string) *Route {
+	if r.queryConstraints == nil {
+		r.queryConstraints = map[string]string{}
+	}
+	r.queryConstraints[key] = value
+	return r
+}
+
+// matchesQuery reports whether req satisfies every query constraint of the route.
+func (r *Route) matchesQuery(req *http.Request) bool {
+	query := req.URL.Query()
+	for key, value := range r.queryConstraints {
+		if !query.Has(key) {
+			return false
+		}
+		if value != "" && query.Get(key) != value {
+			return false
+		}
+	}
+	return true
+}
+
+// queryConstraintString returns the query constraints in a canonical form,
+// e.g. "?export=csv&verbose".
+func (r *Route) queryConstraintString() string {
+	if len(r.queryConstraints) == 0 {
+		return ""
+	}
+	keys := sortedQueryConstraintKeys(r)
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if value := r.queryConstraints[key]; value != "" {
+			parts = append(parts, key+"="+value)
+		} else {
+			parts = append(parts, key)
+		}
+	}
+	return "?" + strings.Join(parts, "&")
+}
+
 // GenerateResponses is responsible for generating the 'responses' attribute in the OpenAPI schema.
 // Since responses can be specified at multiple levels, responses at the route level will be given the most specificity.
+// It fills r.Responses with the responses inherited from the route's routers, see effectiveResponses.
 func (r *Route) GenerateResponses() {
 
 	if r.Router.puff.Config.DocsURL == "" {
@@ -137,17 +734,24 @@ func (r *Route) GenerateResponses() {
 		return
 	}
 
-	currentRouter := r.Router
+	r.Responses = r.effectiveResponses()
+}
 
-	for currentRouter != nil {
-		// avoid over-writing the original responses for the routers
-		clonedResponses := maps.Clone(currentRouter.Responses)
-		if clonedResponses == nil {
-			clonedResponses = make(Responses)
-		}
-		maps.Copy(clonedResponses, r.Responses)
-		currentRouter = currentRouter.parent
+// effectiveResponses returns the responses of the route merged with those of
+// its routers. The route takes precedence over its router, which takes
+// precedence over its parents up to the root router, where the app-wide
+// defaults set with PuffApp.WithDefaultResponses live.
+func (r *Route) effectiveResponses() Responses {
+	var chain []*Router
+	for current := r.Router; current != nil; current = current.parent {
+		chain = append(chain, current)
+	}
+	responses := Responses{}
+	for i := len(chain) - 1; i >= 0; i-- {
+		maps.Copy(responses, chain[i].Responses)
 	}
+	maps.Copy(responses, r.Responses)
+	return responses
 }
 
 // WithResponse registers a single response type for a specific HTTP status code
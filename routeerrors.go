@@ -0,0 +1,68 @@
+package puff
+
+import "net/http"
+
+// ErrStatus returns an error response with statusCode and message to document
+// on a route with Route.Errors, or to send with Context.Fail.
+func ErrStatus(statusCode int, message string) *HTTPError {
+	return &HTTPError{StatusCode: statusCode, Message: message}
+}
+
+// Err400 returns a 400 Bad Request error response with message.
+func Err400(message string) *HTTPError { return ErrStatus(http.StatusBadRequest, message) }
+
+// Err401 returns a 401 Unauthorized error response with message.
+func Err401(message string) *HTTPError { return ErrStatus(http.StatusUnauthorized, message) }
+
+// Err403 returns a 403 Forbidden error response with message.
+func Err403(message string) *HTTPError { return ErrStatus(http.StatusForbidden, message) }
+
+// Err404 returns a 404 Not Found error response with message.
+func Err404(message string) *HTTPError { return ErrStatus(http.StatusNotFound, message) }
+
+// Err409 returns a 409 Conflict error response with message.
+func Err409(message string) *HTTPError { return ErrStatus(http.StatusConflict, message) }
+
+// Err422 returns a 422 Unprocessable Entity error response with message.
+func Err422(message string) *HTTPError { return ErrStatus(http.StatusUnprocessableEntity, message) }
+
+// Err429 returns a 429 Too Many Requests error response with message.
+func Err429(message string) *HTTPError { return ErrStatus(http.StatusTooManyRequests, message) }
+
+// Err500 returns a 500 Internal Server Error error response with message.
+func Err500(message string) *HTTPError { return ErrStatus(http.StatusInternalServerError, message) }
+
+// Err503 returns a 503 Service Unavailable error response with message.
+func Err503(message string) *HTTPError { return ErrStatus(http.StatusServiceUnavailable, message) }
+
+// Errors documents the error responses the route sends, e.g.
+//
+//	app.Get("/users/{id}", input, handler).Errors(
+//		puff.Err400("validation failed"),
+//		puff.Err404("user not found"),
+//	)
+//
+// Each status code is listed in OpenAPI with the Error schema and its message
+// as the description. The handler sends them with Context.Fail.
+func (r *Route) Errors(errs ...*HTTPError) *Route {
+	if r.documentedErrors == nil {
+		r.documentedErrors = map[int]*HTTPError{}
+	}
+	for _, err := range errs {
+		r.documentedErrors[err.StatusCode] = err
+	}
+	return r
+}
+
+// Fail sends the error response documented with Route.Errors for statusCode,
+// so a route reports the same message wherever it fails. Undocumented status
+// codes are sent with their status text.
+func (ctx *Context) Fail(statusCode int) {
+	message := http.StatusText(statusCode)
+	if ctx.route != nil {
+		if err, ok := ctx.route.documentedErrors[statusCode]; ok {
+			message = err.Message
+		}
+	}
+	ctx.sendError(statusCode, message, nil)
+}
@@ -4,8 +4,12 @@ import (
 	"fmt"
 	"log/slog"
 	"net/http"
+	"regexp"
 	"runtime"
+	"slices"
 	"strings"
+	"sync/atomic"
+	"time"
 )
 
 // Router defines a group of routes that share the same prefix and middlewares.
@@ -20,11 +24,43 @@ type Router struct {
 	// Responses is a map of status code to puff.Response. Possible Responses for routes can be set at the Router (root as well),
 	// and Route level, however responses directly set on the route will have the highest specificity.
 	Responses Responses
+	// ErrorHandler overrides how 404, 405 and 500 errors are rendered for this router and its
+	// sub-routers. If nil, the parent router's ErrorHandler is used.
+	ErrorHandler ErrorHandler
+	// ResponseSizeLimit caps the size of response bodies for routes in this router and its
+	// sub-routers, unless a closer router or the route sets its own.
+	ResponseSizeLimit *ResponseSizeLimit
+	// Timeout limits the time handlers of routes in this router and its sub-routers may take,
+	// unless a closer router or the route sets its own. See Route.WithTimeout.
+	Timeout time.Duration
+	// Bulkhead limits how many requests to routes in this router and its sub-routers are
+	// served at once, shared between all of them, unless a closer router or the route sets
+	// its own. See Route.WithBulkhead.
+	Bulkhead *Bulkhead
+	// Host scopes the router to requests whose host matches the pattern, e.g. "{tenant}.example.com".
+	// Preferably set using PuffApp.Host.
+	Host string
+	// CaseInsensitive matches the paths of routes in this router and its sub-routers
+	// regardless of case. See also AppConfig.CaseInsensitiveRouting.
+	CaseInsensitive bool
 
 	// parent maps to the router's immediate parent. Will be nil for RootRouter
 	parent *Router
 	// puff maps to the original PuffApp
 	puff *PuffApp
+	// hostRegexp is the compiled Host pattern and hostRegexpSource the pattern it was compiled from.
+	hostRegexp       *regexp.Regexp
+	hostRegexpSource string
+	// partialPrefix lets Prefix end inside a path segment, e.g. "/docs" matching "/docs.json".
+	partialPrefix bool
+	// disabled is set while the router is taken offline with Disable.
+	disabled atomic.Pointer[routerDisabled]
+	// isolated skips the middlewares of the parent routers. Set with ClearInherited.
+	isolated bool
+	// prefix is the full prefix of the router, resolved with its routes when
+	// prefixResolved is set.
+	prefix         string
+	prefixResolved bool
 }
 
 // NewRouter creates a new router provided router name and path prefix.
@@ -43,18 +79,51 @@ func (r *Router) registerRoute(
 	fields any,
 ) *Route {
 	_, file, line, ok := runtime.Caller(2)
+	return r.newRoute(method, path, handleFunc, fields, newLazyDescription(file, line, ok), callerSource(file, line, ok))
+}
+
+func (r *Router) newRoute(
+	method string,
+	path string,
+	handleFunc func(*Context),
+	fields any,
+	comment *lazyDescription,
+	source string,
+) *Route {
+	route, err := r.tryNewRoute(method, path, handleFunc, fields, comment, source)
+	if err != nil {
+		// the route is returned unregistered if the error is deferred.
+		r.fail(err)
+	}
+	return route
+}
+
+// tryNewRoute is newRoute returning the registration error instead of
+// reporting it. The route is not registered if there is an error.
+func (r *Router) tryNewRoute(
+	method string,
+	path string,
+	handleFunc func(*Context),
+	fields any,
+	comment *lazyDescription,
+	source string,
+) (*Route, *RegistrationError) {
 	newRoute := Route{
-		Description: readDescription(file, line, ok),
+		comment:     comment,
+		source:      source,
 		Path:        path,
 		Handler:     handleFunc,
+		handlerName: funcName(handleFunc),
 		Protocol:    method,
 		Fields:      fields,
 		Router:      r,
 		Responses:   Responses{},
+		circuit:     &panicCircuit{},
 	}
-
-	r.Routes = append(r.Routes, &newRoute)
-	return &newRoute
+	if err := validatePath(path); err != nil {
+		return &newRoute, &RegistrationError{Kind: RegistrationBadPath, Router: r.Name, Method: method, Path: path, Source: source, Err: err}
+	}
+	return &newRoute, r.addRoute(&newRoute)
 }
 
 func (r *Router) Get(
@@ -97,36 +166,191 @@ func (r *Router) Delete(
 	return r.registerRoute(http.MethodDelete, path, handleFunc, fields)
 }
 
+func (r *Router) Head(
+	path string,
+	fields any,
+	handleFunc func(*Context),
+) *Route {
+	return r.registerRoute(http.MethodHead, path, handleFunc, fields)
+}
+
+func (r *Router) Options(
+	path string,
+	fields any,
+	handleFunc func(*Context),
+) *Route {
+	return r.registerRoute(http.MethodOptions, path, handleFunc, fields)
+}
+
+func (r *Router) Trace(
+	path string,
+	fields any,
+	handleFunc func(*Context),
+) *Route {
+	return r.registerRoute(http.MethodTrace, path, handleFunc, fields)
+}
+
+// Connect registers a CONNECT route. Only requests in origin form
+// (CONNECT /path) are matched; requests in authority form (CONNECT host:port),
+// as sent to proxies, carry no path. CONNECT routes are not documented in
+// OpenAPI, which has no CONNECT operation.
+func (r *Router) Connect(
+	path string,
+	fields any,
+	handleFunc func(*Context),
+) *Route {
+	return r.registerRoute(http.MethodConnect, path, handleFunc, fields)
+}
+
+// anyMethods are the methods Any registers a route for.
+var anyMethods = []string{
+	http.MethodGet,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+}
+
+// HandleMethods registers handleFunc under each of methods at path. One route is
+// created per method, so each gets its own OpenAPI operation; the routes are
+// returned in the order of methods. Methods are matched case-insensitively
+// and duplicates are ignored.
+func (r *Router) HandleMethods(
+	methods []string,
+	path string,
+	fields any,
+	handleFunc func(*Context),
+) []*Route {
+	return r.registerRoutes(methods, path, handleFunc, fields)
+}
+
+// Any registers handleFunc at path under GET, POST, PUT, PATCH and DELETE.
+// See HandleMethods.
+func (r *Router) Any(
+	path string,
+	fields any,
+	handleFunc func(*Context),
+) []*Route {
+	return r.registerRoutes(anyMethods, path, handleFunc, fields)
+}
+
+func (r *Router) registerRoutes(
+	methods []string,
+	path string,
+	handleFunc func(*Context),
+	fields any,
+) []*Route {
+	_, file, line, ok := runtime.Caller(2)
+	source := callerSource(file, line, ok)
+	if len(methods) == 0 {
+		r.fail(&RegistrationError{Kind: RegistrationBadMethod, Router: r.Name, Path: path, Source: source, Err: fmt.Errorf("no methods provided")})
+		return nil
+	}
+	comment := newLazyDescription(file, line, ok)
+	routes := make([]*Route, 0, len(methods))
+	seen := map[string]bool{}
+	for _, method := range methods {
+		method = strings.ToUpper(strings.TrimSpace(method))
+		if method == "" {
+			r.fail(&RegistrationError{Kind: RegistrationBadMethod, Router: r.Name, Path: path, Source: source, Err: fmt.Errorf("empty method")})
+			continue
+		}
+		if seen[method] {
+			continue
+		}
+		seen[method] = true
+		routes = append(routes, r.newRoute(method, path, handleFunc, fields, comment, source))
+	}
+	return routes
+}
+
 func (r *Router) WebSocket(
 	path string,
 	fields any,
 	handleFunc func(*Context),
 ) *Route {
+	return r.registerWebSocket(path, fields, handleFunc)
+}
+
+func (r *Router) registerWebSocket(
+	path string,
+	fields any,
+	handleFunc func(*Context),
+) *Route {
+	_, file, line, ok := runtime.Caller(2)
+	source := callerSource(file, line, ok)
 	newRoute := Route{
-		WebSocket: true,
-		Protocol:  "GET",
-		Path:      path,
-		Handler:   handleFunc,
-		Fields:    fields,
+		source:      source,
+		WebSocket:   true,
+		Protocol:    "GET",
+		Path:        path,
+		Handler:     handleFunc,
+		handlerName: funcName(handleFunc),
+		Fields:      fields,
+		Router:      r,
+		Responses:   Responses{},
+		circuit:     &panicCircuit{},
+	}
+	if err := validatePath(path); err != nil {
+		r.fail(&RegistrationError{Kind: RegistrationBadPath, Router: r.Name, Method: http.MethodGet, Path: path, Source: source, Err: err})
+		return &newRoute
+	}
+	if err := r.addRoute(&newRoute); err != nil {
+		r.fail(err)
 	}
-	r.Routes = append(r.Routes, &newRoute)
 	return &newRoute
 }
 
 func (r *Router) IncludeRouter(rt *Router) {
+	_, file, line, ok := runtime.Caller(1)
+	if err := r.tryIncludeRouter(rt, callerSource(file, line, ok)); err != nil {
+		r.fail(err)
+	}
+}
+
+// tryIncludeRouter is IncludeRouter returning the registration error instead
+// of reporting it. The router is not included if there is an error.
+func (r *Router) tryIncludeRouter(rt *Router, source string) *RegistrationError {
+	if rt == nil {
+		return &RegistrationError{Kind: RegistrationNilRouter, Router: r.Name, Source: source}
+	}
 	if rt.parent != nil {
-		err := fmt.Errorf(
-			"provided router is already attached to %s. A router may only be attached to one parent",
-			rt.parent,
-		)
-		panic(err)
+		return &RegistrationError{
+			Kind:   RegistrationRouterAttached,
+			Router: rt.Name,
+			Source: source,
+			Err: fmt.Errorf(
+				"provided router is already attached to %s. A router may only be attached to one parent",
+				rt.parent,
+			),
+		}
 	}
 
 	rt.parent = r
 	if rt.parent != nil {
 		rt.puff = rt.parent.puff
 	}
-	r.Routers = append(r.Routers, rt)
+	if rt.Host != "" {
+		rt.hostRegexp, rt.hostRegexpSource = regexp.MustCompile(hostPattern(rt.Host)), rt.Host
+	}
+	if err := r.addRouter(rt); err != nil {
+		rt.parent = nil
+		return err
+	}
+	return nil
+}
+
+// WithResponses documents responses for every route of the router and its
+// sub-routers. Responses set on a closer router or the route for the same
+// status code take precedence.
+func (r *Router) WithResponses(responses ...ResponseDefinition) *Router {
+	if r.Responses == nil {
+		r.Responses = Responses{}
+	}
+	for _, response := range responses {
+		r.Responses[response.StatusCode] = response.ResponseType
+	}
+	return r
 }
 
 // Use adds a middleware to the router's list of middlewares. Middleware functions
@@ -150,44 +374,243 @@ func (r *Router) Use(m Middleware) {
 	r.Middlewares = append(r.Middlewares, &m)
 }
 
+// ClearInherited opts the router out of the middlewares of its parent
+// routers, including the ones added with PuffApp.Use, e.g. for a public
+// webhooks router under an authenticated API router:
+//
+//	api.Use(auth)
+//	webhooks := puff.NewRouter("Webhooks", "/webhooks").ClearInherited()
+//	api.IncludeRouter(webhooks)
+//
+// Only the middlewares of the router, its sub-routers and its routes apply to
+// its routes. It must be called before the app serves.
+func (r *Router) ClearInherited() *Router {
+	r.isolated = true
+	return r
+}
+
+// middlewareChain returns the middlewares applying to the routes of the
+// router, outermost router first, up to the closest router that cleared its
+// inherited middlewares.
+func (r *Router) middlewareChain() []*Middleware {
+	var chain []*Middleware
+	for current := r; current != nil; current = current.parent {
+		chain = append(slices.Clip(current.Middlewares), chain...)
+		if current.isolated {
+			break
+		}
+	}
+	return chain
+}
+
 func (r *Router) String() string {
 	return fmt.Sprintf("Name: %s Prefix: %s", r.Name, r.Prefix)
 }
 
 func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	for _, router := range r.Routers {
-		if strings.HasPrefix(req.URL.Path, router.Prefix) {
-			router.ServeHTTP(w, req)
+	if r.parent == nil && r.puff != nil {
+		w = r.puff.withServerHeader(w)
+		var ok bool
+		req, ok = r.puff.applyPathPolicy(w, req)
+		if !ok {
+			return
+		}
+	}
+	if r.parent == nil && r.puff != nil && r.puff.rejectInMaintenance(w) {
+		return
+	}
+	if r.parent == nil && r.puff != nil && len(r.puff.Config.Rules) > 0 {
+		var handled bool
+		req, handled = r.puff.applyRules(w, req)
+		if handled {
+			return
+		}
+	}
+	if r.parent == nil && r.puff != nil && r.puff.Config.MethodOverride {
+		req = applyMethodOverride(req)
+	}
+	if r.parent == nil && r.puff != nil && r.puff.Config.Tenancy != nil {
+		var ok bool
+		req, ok = r.puff.withTenant(req)
+		if !ok {
+			r.puff.writeErrorResponse(w, http.StatusBadRequest, "tenant could not be resolved")
 			return
 		}
 	}
+	if r.parent == nil && r.puff != nil && !r.puff.Config.IgnoreTimeoutBudget {
+		var cancel func()
+		req, cancel = withTimeoutBudget(req)
+		defer cancel()
+	}
+	if !r.serving() {
+		// the routes of a prepared app are compiled on registration; otherwise
+		// they may have changed since the last request.
+		r.writeRoutes(r.compileRoutes)
+	}
+	if r.rejectIfDisabled(w, req) {
+		return
+	}
+	var router *Router
+	r.readRoutes(func() { router = r.subRouterFor(req) })
+	if router == nil {
+		r.serveOwnRoutes(w, req)
+		return
+	}
+	// the routers between r and router are not searched again, but may be disabled.
+	var between []*Router
+	for current := router; current != r; current = current.parent {
+		between = append(between, current)
+	}
+	for i := len(between) - 1; i >= 0; i-- {
+		if between[i].rejectIfDisabled(w, req) {
+			return
+		}
+	}
+	router.serveOwnRoutes(w, req)
+}
+
+// serveOwnRoutes serves req with a route of r itself, or the 404 or 405
+// error of r if none matches.
+func (r *Router) serveOwnRoutes(w http.ResponseWriter, req *http.Request) {
 	c := NewContext(w, req, r.puff)
-	for _, route := range r.Routes {
-		if route.regexp == nil {
-			// TODO: need to fix this. this will be nil for the doc routes.
-			route.getCompletePath()
-			route.createRegexMatch()
-		}
-		isMatch := route.regexp.MatchString(req.URL.Path)
-		if isMatch && req.Method == route.Protocol {
-			matches := route.regexp.FindStringSubmatch(req.URL.Path)
-			err := populateInputSchema(c, route.Fields, route.params, matches)
-			if err != nil {
-				c.BadRequest(err.Error())
-				return
+	var route *Route
+	var allowed []string
+	r.readRoutes(func() { route, allowed = r.matchRoute(req) })
+	if route != nil && r.puff != nil && r.puff.Config.RedirectCanonicalCase {
+		if canonical := route.canonicalPath(req.URL.Path); canonical != req.URL.Path {
+			if req.URL.RawQuery != "" {
+				canonical += "?" + req.URL.RawQuery
 			}
-			if route.WebSocket {
-				err := c.handleWebSocket()
-				if err != nil { // the message has already been passed on by the function; we may just return at this point
-					return
-				}
+			http.Redirect(w, req, canonical, http.StatusPermanentRedirect)
+			return
+		}
+	}
+	if route != nil {
+		r.serveRoute(c, route)
+		return
+	}
+	if len(allowed) > 0 {
+		c.SetResponseHeader("Allow", strings.Join(allowed, ", "))
+		r.handleError(c, &HTTPError{StatusCode: http.StatusMethodNotAllowed, Message: "method not allowed"})
+		return
+	}
+	r.handleError(c, &HTTPError{StatusCode: http.StatusNotFound, Message: "not found"})
+}
+
+// caseInsensitive reports whether the router, one of its parents or the app
+// matches paths regardless of case.
+func (r *Router) caseInsensitive() bool {
+	for current := r; current != nil; current = current.parent {
+		if current.CaseInsensitive {
+			return true
+		}
+	}
+	return r != nil && r.puff != nil && r.puff.Config.CaseInsensitiveRouting
+}
+
+// hasPrefix reports whether path starts with the full prefix of the router,
+// including the prefixes of its parents, as whole segments, so "/user" does
+// not match "/users".
+func (r *Router) hasPrefix(path string) bool {
+	prefix := r.prefix
+	if !r.prefixResolved {
+		prefix = r.fullPrefix()
+	}
+	if len(path) < len(prefix) {
+		return false
+	}
+	if r.caseInsensitive() {
+		if !strings.EqualFold(path[:len(prefix)], prefix) {
+			return false
+		}
+	} else if !strings.HasPrefix(path, prefix) {
+		return false
+	}
+	return r.partialPrefix || len(path) == len(prefix) || strings.HasSuffix(prefix, "/") || path[len(prefix)] == '/'
+}
+
+// matchRoute finds the route of this router that serves req. Static segments
+// take precedence over parameters, which take precedence over catch-alls,
+// regardless of registration order. Among equally specific routes, routes
+// with query constraints that req satisfies take precedence over routes
+// without any. If no route matches, allowed lists the methods of the routes
+// that match the path.
+func (r *Router) matchRoute(req *http.Request) (match *Route, allowed []string) {
+	var fallback *Route
+	var matchPrecedence, fallbackPrecedence []int
+	for _, route := range r.Routes {
+		if !route.matchesPath(req.URL.Path) {
+			continue
+		}
+		if req.Method != route.Protocol {
+			allowed = append(allowed, route.Protocol)
+			continue
+		}
+		precedence := route.precedence()
+		if len(route.queryConstraints) == 0 {
+			if fallback == nil || comparePrecedence(precedence, fallbackPrecedence) < 0 {
+				fallback, fallbackPrecedence = route, precedence
 			}
-			handler := route.Handler
-			handler(c)
+			continue
+		}
+		if route.matchesQuery(req) && (match == nil || comparePrecedence(precedence, matchPrecedence) < 0) {
+			match, matchPrecedence = route, precedence
+		}
+	}
+	if match != nil && (fallback == nil || comparePrecedence(matchPrecedence, fallbackPrecedence) <= 0) {
+		return match, nil
+	}
+	if fallback != nil {
+		return fallback, nil
+	}
+	return nil, allowed
+}
+
+// serveRoute binds the input schema of route and runs its handler.
+func (r *Router) serveRoute(c *Context, route *Route) {
+	c.route = route
+	if route.deprecation != nil {
+		route.deprecation.setHeaders(c)
+	}
+	if r.rejectIfFeatureDisabled(c, route) {
+		return
+	}
+	if r.rejectIfTripped(c, route) {
+		return
+	}
+	if !route.bindsInput && !route.bindInput(c) {
+		return
+	}
+	release, ok := r.enterBulkhead(c, route)
+	if !ok {
+		return
+	}
+	timeout := route.timeout()
+	if route.WebSocket {
+		timeout = 0
+	}
+	if timeout == 0 {
+		defer release()
+	}
+	if route.WebSocket {
+		err := c.handleWebSocket()
+		if err != nil { // the message has already been passed on by the function; we may just return at this point
 			return
 		}
 	}
-	http.NotFound(w, req)
+	if limit := route.responseSizeLimit(); limit != nil && !route.WebSocket {
+		lw := &limitedResponseWriter{ResponseWriter: c.ResponseWriter, limit: *limit, route: route, header: c.ResponseWriter.Header().Clone()}
+		c.ResponseWriter = lw
+		defer lw.commit()
+	}
+	if timeout > 0 {
+		// the slot is freed by the handler goroutine, which may outlive the timeout.
+		r.serveWithTimeout(c, timeout, route.Handler, release)
+		return
+	}
+	defer r.recoverPanic(c)
+	handler := route.Handler
+	handler(c)
 }
 
 func Unprocessable(w http.ResponseWriter, r *http.Request) {
@@ -214,7 +637,7 @@ func (r *Router) patchRoutes() {
 		route.createRegexMatch()
 		err := route.handleInputSchema()
 		if err != nil {
-			panic("error with Input Schema for route " + route.Path + " on router " + r.Name + ". Error: " + err.Error())
+			panic(&RegistrationError{Kind: RegistrationBadFields, Router: r.Name, Method: route.Protocol, Path: route.Path, Source: route.source, Err: err})
 		}
 		slog.Debug(fmt.Sprintf("Serving route: %s", route.fullPath))
 		// populate route with their respective responses
@@ -0,0 +1,161 @@
+package puff
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// Disable takes the router and its sub-routers offline at runtime, e.g. to
+// mitigate an incident, without restarting the server. Requests to the
+// subtree are answered with statusCode, usually 503 or 404. A 503 response
+// carries a Retry-After header if retryAfter is not empty. It is safe to call
+// while serving requests.
+func (r *Router) Disable(statusCode int, retryAfter string) {
+	r.disabled.Store(&routerDisabled{statusCode: statusCode, retryAfter: retryAfter})
+}
+
+// Enable brings a router disabled with Disable back online.
+func (r *Router) Enable() {
+	r.disabled.Store(nil)
+}
+
+// Disabled reports whether the router was disabled with Disable. Sub-routers
+// of a disabled router report false, but are still unreachable.
+func (r *Router) Disabled() bool {
+	return r.disabled.Load() != nil
+}
+
+// routerDisabled is the response of a disabled router.
+type routerDisabled struct {
+	statusCode int
+	retryAfter string
+}
+
+// rejectIfDisabled responds for a disabled router.
+func (r *Router) rejectIfDisabled(w http.ResponseWriter, req *http.Request) bool {
+	d := r.disabled.Load()
+	if d == nil {
+		return false
+	}
+	c := NewContext(w, req, r.puff)
+	if d.statusCode == http.StatusServiceUnavailable && d.retryAfter != "" {
+		c.SetResponseHeader("Retry-After", d.retryAfter)
+	}
+	r.handleError(c, &HTTPError{StatusCode: d.statusCode, Message: strings.ToLower(http.StatusText(d.statusCode))})
+	return true
+}
+
+// RouterState is the state of a router as listed by the RouterControl routes.
+type RouterState struct {
+	Name   string `json:"name"`
+	Prefix string `json:"prefix"`
+	// Disabled is set while the router is disabled with Disable.
+	Disabled bool `json:"disabled"`
+	// StatusCode and RetryAfter are the response of a disabled router.
+	StatusCode int    `json:"status,omitempty"`
+	RetryAfter string `json:"retry_after,omitempty"`
+}
+
+// routerDisableRequest is the optional body of the disable route of RouterControl.
+type routerDisableRequest struct {
+	StatusCode int    `json:"status"`
+	RetryAfter string `json:"retry_after"`
+}
+
+// RouterControl adds a router at prefix toggling the other routers of the app
+// at runtime, e.g. from an incident dashboard or with curl:
+//
+//	GET  prefix/routers                lists the routers as RouterState
+//	POST prefix/routers/{name}/disable disables the router called name
+//	POST prefix/routers/{name}/enable  enables it again
+//
+// The disable route takes an optional JSON body setting the status code and
+// Retry-After of the router, e.g. {"status": 404}. Default: 503. Routers are
+// found by name; the first in registration order is used if names repeat.
+// The control router and the routers it is included in cannot be toggled.
+// The returned router must be protected, e.g. with an authentication
+// middleware, as anyone reaching it can take the application offline.
+func (a *PuffApp) RouterControl(prefix string) *Router {
+	control := NewRouter("RouterControl", prefix)
+	control.Get("/routers", nil, func(c *Context) {
+		var states []RouterState
+		a.RootRouter.readRoutes(func() {
+			a.RootRouter.walkRouters(func(r *Router) {
+				state := RouterState{Name: r.Name, Prefix: r.fullPrefix()}
+				if d := r.disabled.Load(); d != nil {
+					state.Disabled, state.StatusCode, state.RetryAfter = true, d.statusCode, d.retryAfter
+				}
+				states = append(states, state)
+			})
+		})
+		c.SendResponse(JSONResponse{StatusCode: http.StatusOK, Content: states})
+	})
+	control.Post("/routers/{name}/disable", nil, func(c *Context) {
+		router := a.controlledRouter(c, control)
+		if router == nil {
+			return
+		}
+		req := routerDisableRequest{StatusCode: http.StatusServiceUnavailable}
+		if body, err := c.GetBody(); err != nil || (len(body) > 0 && json.Unmarshal(body, &req) != nil) {
+			c.BadRequest("Body must be a JSON object with status and retry_after.")
+			return
+		}
+		if req.StatusCode < 400 || req.StatusCode > 599 {
+			c.BadRequest("status must be an error status code, got %d.", req.StatusCode)
+			return
+		}
+		router.Disable(req.StatusCode, req.RetryAfter)
+		c.SendResponse(JSONResponse{StatusCode: http.StatusOK, Content: RouterState{
+			Name: router.Name, Prefix: router.fullPrefix(), Disabled: true, StatusCode: req.StatusCode, RetryAfter: req.RetryAfter,
+		}})
+	})
+	control.Post("/routers/{name}/enable", nil, func(c *Context) {
+		router := a.controlledRouter(c, control)
+		if router == nil {
+			return
+		}
+		router.Enable()
+		c.SendResponse(JSONResponse{StatusCode: http.StatusOK, Content: RouterState{Name: router.Name, Prefix: router.fullPrefix()}})
+	})
+	a.IncludeRouter(control)
+	return control
+}
+
+// controlledRouter returns the router named by the path of a RouterControl
+// request, or responds with 404 if there is none. The control router and the
+// routers it belongs to cannot be toggled, so it cannot lock itself out.
+func (a *PuffApp) controlledRouter(c *Context, control *Router) *Router {
+	name := c.PathParams()["name"]
+	var router *Router
+	a.RootRouter.readRoutes(func() {
+		a.RootRouter.walkRouters(func(r *Router) {
+			if router == nil && r.Name == name && !control.within(r) {
+				router = r
+			}
+		})
+	})
+	if router == nil {
+		c.NotFound("Router %s not found.", name)
+	}
+	return router
+}
+
+// within reports whether r is parent or one of its ancestors.
+func (r *Router) within(parent *Router) bool {
+	for current := r; current != nil; current = current.parent {
+		if current == parent {
+			return true
+		}
+	}
+	return false
+}
+
+// walkRouters calls fn for the router and every router below it, in
+// registration order.
+func (r *Router) walkRouters(fn func(*Router)) {
+	fn(r)
+	for _, router := range r.Routers {
+		router.walkRouters(fn)
+	}
+}
@@ -0,0 +1,202 @@
+package puff
+
+import (
+	"fmt"
+	"runtime"
+	"slices"
+	"strings"
+)
+
+// The route table may change while the application serves requests: routes
+// and routers registered after ListenAndServe prepared the routes are prepared
+// on registration, and every change holds the write lock of the app's route
+// table while matching holds its read lock. Handlers run without the lock, so
+// they may register or remove routes themselves.
+
+// readRoutes runs fn holding the read lock of the route table.
+func (r *Router) readRoutes(fn func()) {
+	if r.puff == nil {
+		fn()
+		return
+	}
+	r.puff.routesMu.RLock()
+	defer r.puff.routesMu.RUnlock()
+	fn()
+}
+
+// writeRoutes runs fn holding the write lock of the route table.
+func (r *Router) writeRoutes(fn func()) {
+	if r.puff == nil {
+		fn()
+		return
+	}
+	r.puff.routesMu.Lock()
+	defer r.puff.routesMu.Unlock()
+	fn()
+}
+
+// serving reports whether the routes of the app were already patched, so new
+// routes must be prepared on registration.
+func (r *Router) serving() bool {
+	return r.puff != nil && r.puff.patched.Load()
+}
+
+// addRoute appends route to the router, preparing it if the app is serving.
+// The route is not added if it cannot be prepared.
+func (r *Router) addRoute(route *Route) (err *RegistrationError) {
+	r.writeRoutes(func() {
+		if !r.serving() {
+			// no request reads the routes before serving; append in amortized constant time.
+			r.Routes = append(r.Routes, route)
+			return
+		}
+		if err = r.prepareRoute(route, nil); err != nil {
+			return
+		}
+		r.attachChain(route)
+		// copy on write, so slices handed out earlier are not modified.
+		r.Routes = append(slices.Clip(r.Routes), route)
+		r.puff.routesChanged()
+	})
+	return err
+}
+
+// addRouter appends rt to the sub-routers, preparing its routes if the app is
+// serving. The router is not added if one of its routes cannot be prepared.
+func (r *Router) addRouter(rt *Router) (err *RegistrationError) {
+	r.writeRoutes(func() {
+		if !r.serving() {
+			r.Routers = append(slices.Clip(r.Routers), rt)
+			return
+		}
+		routes := rt.AllRoutes()
+		for _, route := range routes {
+			route.Router.puff = r.puff
+		}
+		for i, route := range routes {
+			if err = route.Router.prepareRoute(route, routes[:i]); err != nil {
+				rt.walkRouters(func(router *Router) { router.puff = nil })
+				return
+			}
+		}
+		for _, route := range routes {
+			route.Router.attachChain(route)
+		}
+		rt.compileRoutes()
+		r.Routers = append(slices.Clip(r.Routers), rt)
+		r.puff.routesChanged()
+	})
+	return err
+}
+
+// prepareRoute does for a route registered while serving what patchAllRoutes
+// does for the routes registered before: it resolves the path and fields and
+// rejects conflicts with the routes of the app and with pending, the routes
+// registered along with it.
+func (r *Router) prepareRoute(route *Route, pending []*Route) *RegistrationError {
+	route.resolveDescription()
+	route.getCompletePath()
+	route.createRegexMatch()
+	if err := route.handleInputSchema(); err != nil {
+		return &RegistrationError{Kind: RegistrationBadFields, Router: r.Name, Method: route.Protocol, Path: route.Path, Source: route.source, Err: err}
+	}
+	key := conflictKey(route)
+	for _, existing := range append(r.puff.AllRoutes(), pending...) {
+		if existing != route && existing.fullPath != "" && conflictKey(existing) == key {
+			return &RegistrationError{
+				Kind:   RegistrationConflict,
+				Router: r.Name,
+				Method: route.Protocol,
+				Path:   route.fullPath,
+				Source: route.source,
+				Err:    fmt.Errorf("route already registered on router %s%s", existing.Router.Name, sourceSuffix(existing.source)),
+			}
+		}
+	}
+	return nil
+}
+
+// attachChain wraps the handler of a prepared route with the middlewares of
+// the router.
+func (r *Router) attachChain(route *Route) {
+	var chain []Middleware
+	for _, m := range r.middlewareChain() {
+		chain = append(chain, *m)
+	}
+	attachRouteMiddlewares(route, chain)
+}
+
+// AddRoute registers handleFunc under method at path like Get, Post and the
+// other registration methods, but returns the RegistrationError, e.g. of a
+// conflict or invalid fields, instead of panicking. Use it to register routes
+// while serving, where the panic would only fail the request registering them.
+func (r *Router) AddRoute(method, path string, fields any, handleFunc func(*Context)) (*Route, error) {
+	_, file, line, ok := runtime.Caller(1)
+	method = strings.ToUpper(strings.TrimSpace(method))
+	if method == "" {
+		return nil, &RegistrationError{Kind: RegistrationBadMethod, Router: r.Name, Path: path, Source: callerSource(file, line, ok), Err: fmt.Errorf("empty method")}
+	}
+	route, err := r.tryNewRoute(method, path, handleFunc, fields, newLazyDescription(file, line, ok), callerSource(file, line, ok))
+	if err != nil {
+		return nil, err
+	}
+	return route, nil
+}
+
+// AddRouter includes rt like IncludeRouter, but returns the RegistrationError
+// instead of panicking. See AddRoute.
+func (r *Router) AddRouter(rt *Router) error {
+	_, file, line, ok := runtime.Caller(1)
+	if err := r.tryIncludeRouter(rt, callerSource(file, line, ok)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// conflictKey identifies the requests a route serves; two routes with the
+// same key conflict.
+func conflictKey(route *Route) string {
+	key := route.Protocol + " " + route.fullPath + route.queryConstraintString()
+	if hr := route.Router.hostRouter(); hr != nil {
+		key = strings.ToLower(hr.Host) + " " + key
+	}
+	return key
+}
+
+// RemoveRoute removes route from the router, also while serving. Requests
+// already being served by the route finish normally. It reports whether the
+// route belonged to the router.
+func (r *Router) RemoveRoute(route *Route) bool {
+	removed := false
+	r.writeRoutes(func() {
+		i := slices.Index(r.Routes, route)
+		if i < 0 {
+			return
+		}
+		r.Routes = slices.Delete(slices.Clone(r.Routes), i, i+1)
+		removed = true
+		if r.serving() {
+			r.puff.routesChanged()
+		}
+	})
+	return removed
+}
+
+// RemoveRouter removes the sub-router rt and its routes, also while serving.
+// It reports whether rt was a sub-router of the router.
+func (r *Router) RemoveRouter(rt *Router) bool {
+	removed := false
+	r.writeRoutes(func() {
+		i := slices.Index(r.Routers, rt)
+		if i < 0 {
+			return
+		}
+		r.Routers = slices.Delete(slices.Clone(r.Routers), i, i+1)
+		rt.parent = nil
+		removed = true
+		if r.serving() {
+			r.puff.routesChanged()
+		}
+	})
+	return removed
+}
@@ -0,0 +1,126 @@
+package puff
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// RouteTree describes a router and its sub-routers, e.g. to diff route
+// tables in CI or render them in dashboards. See Router.Tree.
+type RouteTree struct {
+	// Name is the name of the router.
+	Name string `json:"name"`
+	// Prefix is the full prefix of the router, including the prefixes of its parents.
+	Prefix string `json:"prefix"`
+	// Host is the host pattern the router is scoped to, if any.
+	Host string `json:"host,omitempty"`
+	// Middlewares are the names of the router's own middlewares.
+	Middlewares []string `json:"middlewares,omitempty"`
+	// Routes are the routes of the router.
+	Routes []RouteTreeRoute `json:"routes,omitempty"`
+	// Routers are the sub-routers of the router.
+	Routers []RouteTree `json:"routers,omitempty"`
+}
+
+// RouteTreeRoute describes a route in a RouteTree.
+type RouteTreeRoute struct {
+	// Method is the HTTP method, or GET for WebSocket routes.
+	Method string `json:"method"`
+	// Path is the full path including the prefixes of all routers.
+	Path string `json:"path"`
+	// Handler is the name of the handler function, e.g. "main.getUser".
+	Handler string `json:"handler"`
+	// WebSocket is set for WebSocket routes.
+	WebSocket bool `json:"websocket,omitempty"`
+	// Middlewares are the names of the route's own middlewares.
+	Middlewares []string `json:"middlewares,omitempty"`
+}
+
+// Tree returns the structure of the router and its sub-routers.
+func (r *Router) Tree() RouteTree {
+	var tree RouteTree
+	r.readRoutes(func() {
+		tree = r.tree(r.fullPrefix())
+	})
+	return tree
+}
+
+func (r *Router) tree(prefix string) RouteTree {
+	node := RouteTree{Name: r.Name, Prefix: prefix, Host: r.Host}
+	for _, m := range r.Middlewares {
+		node.Middlewares = append(node.Middlewares, middlewareName(*m))
+	}
+	for _, route := range r.Routes {
+		rt := RouteTreeRoute{
+			Method:    route.Protocol,
+			Path:      prefix + route.Path,
+			Handler:   route.handlerName,
+			WebSocket: route.WebSocket,
+		}
+		for _, m := range route.Middlewares {
+			rt.Middlewares = append(rt.Middlewares, middlewareName(*m))
+		}
+		node.Routes = append(node.Routes, rt)
+	}
+	for _, sub := range r.Routers {
+		node.Routers = append(node.Routers, sub.tree(prefix+sub.Prefix))
+	}
+	return node
+}
+
+// fullPrefix returns the prefix of the router including the prefixes of its parents.
+func (r *Router) fullPrefix() string {
+	prefix := ""
+	for current := r; current != nil; current = current.parent {
+		prefix = current.Prefix + prefix
+	}
+	return prefix
+}
+
+// TreeJSON returns the Tree of the router as indented JSON.
+func (r *Router) TreeJSON() ([]byte, error) {
+	return json.MarshalIndent(r.Tree(), "", "  ")
+}
+
+// TreeDOT returns the Tree of the router in the Graphviz DOT language, with
+// a node per router and route, e.g. to render with `dot -Tsvg`.
+func (r *Router) TreeDOT() string {
+	var b strings.Builder
+	b.WriteString("digraph routes {\n\trankdir=LR;\n\tnode [shape=box];\n")
+	ids := 0
+	var write func(node RouteTree) string
+	write = func(node RouteTree) string {
+		id := fmt.Sprintf("r%d", ids)
+		ids++
+		label := node.Name + `\n` + node.Prefix
+		if node.Host != "" {
+			label += `\n` + node.Host
+		}
+		if len(node.Middlewares) > 0 {
+			label += `\n[` + strings.Join(node.Middlewares, ", ") + "]"
+		}
+		fmt.Fprintf(&b, "\t%s [label=%s, style=rounded];\n", id, dotQuote(label))
+		for _, route := range node.Routes {
+			routeID := fmt.Sprintf("r%d", ids)
+			ids++
+			label := route.Method + " " + route.Path + `\n` + route.Handler
+			if len(route.Middlewares) > 0 {
+				label += `\n[` + strings.Join(route.Middlewares, ", ") + "]"
+			}
+			fmt.Fprintf(&b, "\t%s [label=%s];\n\t%s -> %s;\n", routeID, dotQuote(label), id, routeID)
+		}
+		for _, sub := range node.Routers {
+			fmt.Fprintf(&b, "\t%s -> %s;\n", id, write(sub))
+		}
+		return id
+	}
+	write(r.Tree())
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// dotQuote quotes s as a DOT string. Labels keep their \n line breaks.
+func dotQuote(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
@@ -0,0 +1,120 @@
+package puff
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// RuleAction is the action taken when a Rule matches.
+type RuleAction string
+
+const (
+	// RuleRedirect responds with a redirect to the rewritten URL.
+	RuleRedirect RuleAction = "redirect"
+	// RuleRewrite changes the request path before routing, invisibly to the client.
+	RuleRewrite RuleAction = "rewrite"
+)
+
+// Rule is a declarative redirect or rewrite evaluated before routing.
+type Rule struct {
+	// Match is a regular expression matched against the request path.
+	Match string `json:"match"`
+	// Action is either RuleRedirect or RuleRewrite.
+	Action RuleAction `json:"action"`
+	// To is the replacement for the matched path. It may reference capture
+	// groups from Match using $1 or ${name}. Leading slashes of a redirect
+	// target starting with a single slash are collapsed, so captured text
+	// cannot turn it into a redirect to another host.
+	To string `json:"to"`
+	// StatusCode is the status code used by RuleRedirect: 301, 302, 303, 307 or 308.
+	// Default: 308.
+	StatusCode int `json:"status_code"`
+}
+
+// compiledRule is a Rule with its Match expression compiled.
+type compiledRule struct {
+	Rule
+	re *regexp.Regexp
+}
+
+// LoadRules reads a JSON array of rules, e.g.
+//
+//	[{"match": "^/old/(.*)$", "action": "redirect", "to": "/new/$1"}]
+func LoadRules(r io.Reader) ([]Rule, error) {
+	var rules []Rule
+	if err := json.NewDecoder(r).Decode(&rules); err != nil {
+		return nil, fmt.Errorf("decoding rules failed: %w", err)
+	}
+	if _, err := compileRules(rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// compileRules compiles the match expression of every rule.
+func compileRules(rules []Rule) ([]compiledRule, error) {
+	compiled := make([]compiledRule, 0, len(rules))
+	for i, rule := range rules {
+		if rule.Action != RuleRedirect && rule.Action != RuleRewrite {
+			return nil, fmt.Errorf("rule %d: action must be %s or %s, got %q", i, RuleRedirect, RuleRewrite, rule.Action)
+		}
+		switch rule.StatusCode {
+		case 0, http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		default:
+			return nil, fmt.Errorf("rule %d: status code must be 301, 302, 303, 307 or 308, got %d", i, rule.StatusCode)
+		}
+		re, err := regexp.Compile(rule.Match)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: invalid match expression: %w", i, err)
+		}
+		compiled = append(compiled, compiledRule{Rule: rule, re: re})
+	}
+	return compiled, nil
+}
+
+// applyRules evaluates the app rules in order against req. The first
+// matching redirect rule writes the redirect and reports handled. Rewrite
+// rules change the request path and evaluation continues with the next rule.
+func (a *PuffApp) applyRules(w http.ResponseWriter, req *http.Request) (*http.Request, bool) {
+	a.rulesOnce.Do(func() {
+		var err error
+		a.rules, err = compileRules(a.Config.Rules)
+		if err != nil {
+			slog.Error("puff: ignoring rules", slog.String("error", err.Error()))
+		}
+	})
+
+	for _, rule := range a.rules {
+		path := req.URL.Path
+		match := rule.re.FindStringSubmatchIndex(path)
+		if match == nil {
+			continue
+		}
+		target := string(rule.re.ExpandString(nil, rule.To, path, match))
+		switch rule.Action {
+		case RuleRedirect:
+			if !strings.HasPrefix(rule.To, "//") {
+				target = localRedirectTarget(target)
+			}
+			if req.URL.RawQuery != "" && !strings.Contains(target, "?") {
+				target += "?" + req.URL.RawQuery
+			}
+			statusCode := rule.StatusCode
+			if statusCode == 0 {
+				statusCode = http.StatusPermanentRedirect
+			}
+			http.Redirect(w, req, target, statusCode)
+			return req, true
+		case RuleRewrite:
+			req = req.Clone(req.Context())
+			req.URL.Path = target
+			req.URL.RawPath = ""
+		}
+	}
+	return req, false
+}
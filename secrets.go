@@ -0,0 +1,192 @@
+package puff
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// SecretProvider loads secrets by name from a backing store such as the
+// environment, files mounted by an orchestrator, or a vault.
+type SecretProvider interface {
+	GetSecret(ctx context.Context, name string) ([]byte, error)
+}
+
+// SecretProviderFunc adapts a function, such as a Vault client callback, to a SecretProvider.
+type SecretProviderFunc func(ctx context.Context, name string) ([]byte, error)
+
+// GetSecret calls f(ctx, name).
+func (f SecretProviderFunc) GetSecret(ctx context.Context, name string) ([]byte, error) {
+	return f(ctx, name)
+}
+
+// EnvSecretProvider loads secrets from environment variables. The name is
+// upper-cased, has "-" and "." replaced by "_" and is prefixed with Prefix.
+type EnvSecretProvider struct {
+	Prefix string
+}
+
+// GetSecret returns the value of the environment variable for name.
+func (e EnvSecretProvider) GetSecret(_ context.Context, name string) ([]byte, error) {
+	key := e.Prefix + strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(name))
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return nil, fmt.Errorf("secret %s: environment variable %s is not set", name, key)
+	}
+	return []byte(value), nil
+}
+
+// FileSecretProvider loads secrets from files named after the secret in Dir,
+// e.g. Kubernetes or Docker secret mounts.
+type FileSecretProvider struct {
+	Dir string
+}
+
+// GetSecret returns the content of the file for name.
+func (f FileSecretProvider) GetSecret(_ context.Context, name string) ([]byte, error) {
+	if name != filepath.Base(name) {
+		return nil, fmt.Errorf("secret %s: name must not contain a path separator", name)
+	}
+	value, err := os.ReadFile(filepath.Join(f.Dir, name))
+	if err != nil {
+		return nil, fmt.Errorf("secret %s: %w", name, err)
+	}
+	return value, nil
+}
+
+// Secret is a named secret loaded from a SecretProvider. It is safe for
+// concurrent use and can be rotated at runtime with Rotate.
+type Secret struct {
+	// Name is the name of the secret in the provider.
+	Name string
+	// Provider is the store the secret is loaded from.
+	Provider SecretProvider
+
+	mu       sync.RWMutex
+	value    []byte
+	loaded   bool
+	onRotate []func(value []byte)
+}
+
+// NewSecret creates a Secret called name loaded from provider.
+func NewSecret(provider SecretProvider, name string) *Secret {
+	return &Secret{Name: name, Provider: provider}
+}
+
+// Load fetches the secret from its provider if it has not been loaded yet.
+func (s *Secret) Load(ctx context.Context) error {
+	s.mu.RLock()
+	loaded := s.loaded
+	s.mu.RUnlock()
+	if loaded {
+		return nil
+	}
+	return s.Rotate(ctx)
+}
+
+// Rotate fetches the current value of the secret from its provider, replaces
+// the cached value and runs the hooks registered with OnRotate.
+func (s *Secret) Rotate(ctx context.Context) error {
+	value, err := s.Provider.GetSecret(ctx, s.Name)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.value = value
+	s.loaded = true
+	hooks := s.onRotate
+	s.mu.Unlock()
+	for _, hook := range hooks {
+		hook(value)
+	}
+	return nil
+}
+
+// Value returns the cached value of the secret, or nil if it was never loaded.
+func (s *Secret) Value() []byte {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.value
+}
+
+// OnRotate registers a hook called with the new value every time the secret is rotated.
+func (s *Secret) OnRotate(hook func(value []byte)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onRotate = append(s.onRotate, hook)
+}
+
+// Secret returns the secret registered under name in AppConfig.Secrets, or nil.
+func (a *PuffApp) Secret(name string) *Secret {
+	return a.Config.Secrets[name]
+}
+
+// RotateSecrets reloads every secret in AppConfig.Secrets, as well as the TLS
+// secrets, from their providers. Rotated TLS certificates are used for new
+// connections without restarting the server.
+func (a *PuffApp) RotateSecrets(ctx context.Context) error {
+	for _, s := range a.allSecrets() {
+		if err := s.Rotate(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadSecrets loads every secret that has not been loaded yet.
+func (a *PuffApp) loadSecrets(ctx context.Context) error {
+	for _, s := range a.allSecrets() {
+		if err := s.Load(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *PuffApp) allSecrets() []*Secret {
+	secrets := make([]*Secret, 0, len(a.Config.Secrets)+2)
+	for _, s := range a.Config.Secrets {
+		secrets = append(secrets, s)
+	}
+	if a.Config.TLSCertificateSecret != nil && a.Config.TLSPrivateKeySecret != nil {
+		secrets = append(secrets, a.Config.TLSCertificateSecret, a.Config.TLSPrivateKeySecret)
+	}
+	return secrets
+}
+
+// tlsConfigFromSecrets returns a copy of cfg, or a new tls.Config if nil,
+// serving the certificate from the TLS secrets instead of its Certificates.
+// The certificate is parsed again only after a rotation.
+func (a *PuffApp) tlsConfigFromSecrets(cfg *tls.Config) *tls.Config {
+	var (
+		mu      sync.Mutex
+		cert    *tls.Certificate
+		certPEM []byte
+		keyPEM  []byte
+	)
+	if cfg == nil {
+		cfg = &tls.Config{}
+	} else {
+		cfg = cfg.Clone()
+	}
+	cfg.Certificates = nil
+	cfg.GetCertificate = func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+		c, k := a.Config.TLSCertificateSecret.Value(), a.Config.TLSPrivateKeySecret.Value()
+		mu.Lock()
+		defer mu.Unlock()
+		if cert != nil && string(c) == string(certPEM) && string(k) == string(keyPEM) {
+			return cert, nil
+		}
+		parsed, err := tls.X509KeyPair(c, k)
+		if err != nil {
+			return nil, fmt.Errorf("loading TLS certificate from secrets failed: %w", err)
+		}
+		cert, certPEM, keyPEM = &parsed, c, k
+		return cert, nil
+	}
+	return cfg
+}
@@ -0,0 +1,141 @@
+package puff
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// HealthCheck reports whether a dependency (database, cache, upstream API)
+// is reachable. It should return nil if the dependency is healthy.
+type HealthCheck func(ctx context.Context) error
+
+type namedHealthCheck struct {
+	name  string
+	check HealthCheck
+}
+
+// AddHealthCheck registers a health check under name. Registered health
+// checks are pinged by SelfCheck before the server starts; degraded checks
+// are logged instead of failing it. See SQLHealthCheck and the other
+// constructors for checks of common dependencies.
+func (a *PuffApp) AddHealthCheck(name string, check HealthCheck) {
+	a.healthChecks = append(a.healthChecks, namedHealthCheck{name: name, check: check})
+}
+
+// SelfCheckError is returned by SelfCheck and contains every problem found.
+type SelfCheckError struct {
+	Problems []error
+}
+
+func (e *SelfCheckError) Error() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "puff: self-check found %d problem(s):", len(e.Problems))
+	for _, p := range e.Problems {
+		sb.WriteString("\n  - ")
+		sb.WriteString(p.Error())
+	}
+	return sb.String()
+}
+
+func (e *SelfCheckError) Unwrap() []error {
+	return e.Problems
+}
+
+// SelfCheck verifies the application is able to serve requests: it resolves
+// the path and input schema of every route, checks for route conflicts and
+// invalid rules, generates and validates the OpenAPI document, and pings
+// every registered health check. Instead of failing on the first problem, it returns a
+// *SelfCheckError listing all of them, or nil if nothing is broken.
+//
+// ListenAndServe runs SelfCheck automatically unless DisableSelfCheck is set.
+func (a *PuffApp) SelfCheck() error {
+	var problems []error
+
+	for _, err := range a.deferredRegistrationErrors() {
+		problems = append(problems, err)
+	}
+	for _, route := range a.AllRoutes() {
+		if err := checkRoute(route); err != nil {
+			problems = append(problems, err)
+		}
+	}
+	for _, conflict := range a.findConflicts() {
+		problems = append(problems, conflict)
+	}
+	if _, err := compileRules(a.Config.Rules); err != nil {
+		problems = append(problems, err)
+	}
+	if len(problems) == 0 {
+		// the OpenAPI document depends on every route resolving correctly.
+		if err := a.checkOpenAPI(); err != nil {
+			problems = append(problems, err)
+		}
+	}
+
+	for _, child := range a.mounted {
+		if err := child.SelfCheck(); err != nil {
+			problems = append(problems, fmt.Errorf("mounted app %s: %w", child.Config.Name, err))
+		}
+	}
+
+	for _, hc := range a.healthChecks {
+		err := a.runHealthCheck(context.Background(), hc)
+		switch healthStatusOf(err) {
+		case HealthDegraded:
+			logDegraded(hc.name, err)
+		case HealthDown:
+			problems = append(problems, fmt.Errorf("health check %s failed: %w", hc.name, err))
+		}
+	}
+
+	if len(problems) > 0 {
+		return &SelfCheckError{Problems: problems}
+	}
+	return nil
+}
+
+// checkRoute resolves the full path, matcher and input schema of route,
+// returning a RegistrationError if any of them is broken.
+func checkRoute(route *Route) (err error) {
+	routerName := ""
+	if route.Router != nil {
+		routerName = route.Router.Name
+	}
+	defer func() {
+		// schema generation panics on unsupported types.
+		if a := recover(); a != nil {
+			err = &RegistrationError{Kind: RegistrationBadFields, Router: routerName, Method: route.Protocol, Path: route.Path, Source: route.source, Err: fmt.Errorf("%v", a)}
+		}
+	}()
+
+	route.getCompletePath()
+	if err := validatePath(route.fullPath); err != nil {
+		return &RegistrationError{Kind: RegistrationBadPath, Router: routerName, Method: route.Protocol, Path: route.fullPath, Source: route.source, Err: err}
+	}
+	if err := route.compileRegexMatch(); err != nil {
+		return &RegistrationError{Kind: RegistrationBadPath, Router: routerName, Method: route.Protocol, Path: route.fullPath, Source: route.source, Err: err}
+	}
+	if err := route.handleInputSchema(); err != nil {
+		return &RegistrationError{Kind: RegistrationBadFields, Router: routerName, Method: route.Protocol, Path: route.Path, Source: route.source, Err: err}
+	}
+	return nil
+}
+
+// checkOpenAPI generates the OpenAPI document and ensures it can be encoded.
+func (a *PuffApp) checkOpenAPI() (err error) {
+	if a.Config.DisableOpenAPIGeneration || a.Config.DocsURL == "" {
+		return nil
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("generating OpenAPI document failed: %v", r)
+		}
+	}()
+	a.GenerateOpenAPISpec()
+	if _, err := json.Marshal(a.Config.OpenAPI); err != nil {
+		return fmt.Errorf("OpenAPI document is invalid: %w", err)
+	}
+	return nil
+}
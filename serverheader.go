@@ -0,0 +1,61 @@
+package puff
+
+import "net/http"
+
+// bannerHeaders are the response headers disclosing the server software or
+// its version, removed with AppConfig.HideServerHeader.
+var bannerHeaders = []string{"Server", "X-Powered-By", "X-AspNet-Version", "X-AspNetMvc-Version", "X-Runtime", "X-Version"}
+
+// withServerHeader wraps w to control the Server header of the response as
+// configured by ServerHeader and HideServerHeader. w is returned as is if
+// neither is set.
+func (a *PuffApp) withServerHeader(w http.ResponseWriter) http.ResponseWriter {
+	if a.Config.ServerHeader == "" && !a.Config.HideServerHeader {
+		return w
+	}
+	return &serverHeaderWriter{ResponseWriter: w, server: a.Config.ServerHeader, hide: a.Config.HideServerHeader}
+}
+
+// serverHeaderWriter sets or removes the Server header when the response is
+// committed, overriding headers set by handlers, mounted handlers and
+// proxied upstreams.
+type serverHeaderWriter struct {
+	http.ResponseWriter
+	server string
+	hide   bool
+}
+
+// apply sets or removes the banner headers before the headers are sent.
+func (w *serverHeaderWriter) apply() {
+	h := w.Header()
+	if w.hide {
+		for _, name := range bannerHeaders {
+			h.Del(name)
+		}
+		return
+	}
+	h.Set("Server", w.server)
+}
+
+func (w *serverHeaderWriter) WriteHeader(statusCode int) {
+	w.apply()
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *serverHeaderWriter) Write(b []byte) (int, error) {
+	w.apply()
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap allows http.ResponseController to reach the underlying writer.
+func (w *serverHeaderWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Flush implements http.Flusher if the underlying writer supports it.
+func (w *serverHeaderWriter) Flush() {
+	w.apply()
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,199 @@
+package puff
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"time"
+)
+
+// RuntimeSettings are the settings of a PuffApp that can be changed while it
+// serves requests, with UpdateSettings or by reloading AppConfig.SettingsFile.
+// Values returned by PuffApp.Settings are shared and must not be modified.
+type RuntimeSettings struct {
+	// LogLevel is the level of the application logger.
+	LogLevel slog.Level `json:"log_level"`
+	// Maintenance answers every request with 503 Service Unavailable while set.
+	Maintenance bool `json:"maintenance"`
+	// MaintenanceMessage is the error message of requests rejected during maintenance.
+	// Default: "down for maintenance".
+	MaintenanceMessage string `json:"maintenance_message,omitempty"`
+	// RateLimits are rate limits by name, applied by subscribers of OnSettingsChange,
+	// e.g. to a KeyedLimiter with SetRate.
+	RateLimits map[string]RateLimitSetting `json:"rate_limits,omitempty"`
+	// CORSOrigins are the origins allowed to make cross-origin requests, read by the
+	// CORS middleware if configured to.
+	CORSOrigins []string `json:"cors_origins,omitempty"`
+}
+
+// RateLimitSetting is a rate limit of RuntimeSettings. In JSON the refill is a
+// duration string, e.g. {"burst": 5, "refill": "3m"}.
+type RateLimitSetting struct {
+	// Burst is the number of requests allowed at once.
+	Burst int
+	// Refill is the time it takes to allow one more request.
+	Refill time.Duration
+}
+
+type rateLimitSettingJSON struct {
+	Burst  int    `json:"burst"`
+	Refill string `json:"refill"`
+}
+
+func (r RateLimitSetting) MarshalJSON() ([]byte, error) {
+	return json.Marshal(rateLimitSettingJSON{Burst: r.Burst, Refill: r.Refill.String()})
+}
+
+func (r *RateLimitSetting) UnmarshalJSON(b []byte) error {
+	var raw rateLimitSettingJSON
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	refill, err := time.ParseDuration(raw.Refill)
+	if err != nil {
+		return fmt.Errorf("invalid rate limit refill: %w", err)
+	}
+	r.Burst, r.Refill = raw.Burst, refill
+	return nil
+}
+
+// clone returns a copy of s not sharing its map and slice.
+func (s RuntimeSettings) clone() RuntimeSettings {
+	s.RateLimits = maps.Clone(s.RateLimits)
+	s.CORSOrigins = slices.Clone(s.CORSOrigins)
+	return s
+}
+
+// Settings returns the current runtime settings of the application.
+func (a *PuffApp) Settings() RuntimeSettings {
+	if s := a.settings.Load(); s != nil {
+		return *s
+	}
+	if a.Config.Settings != nil {
+		return *a.Config.Settings
+	}
+	return RuntimeSettings{LogLevel: a.Config.LoggerConfig.Level}
+}
+
+// Settings returns the current runtime settings of the application serving the request.
+func (ctx *Context) Settings() RuntimeSettings {
+	if ctx.puff == nil {
+		return RuntimeSettings{}
+	}
+	return ctx.puff.Settings()
+}
+
+// OnSettingsChange subscribes f to changes of the runtime settings. f is
+// called with the new settings after every UpdateSettings or reload.
+func (a *PuffApp) OnSettingsChange(f func(RuntimeSettings)) {
+	a.settingsMu.Lock()
+	defer a.settingsMu.Unlock()
+	a.settingsSubscribers = append(a.settingsSubscribers, f)
+}
+
+// UpdateSettings replaces the runtime settings of the running application,
+// applies the log level and notifies the subscribers of OnSettingsChange.
+func (a *PuffApp) UpdateSettings(s RuntimeSettings) {
+	a.settingsMu.Lock()
+	defer a.settingsMu.Unlock()
+	a.updateSettings(s)
+}
+
+// updateSettings is UpdateSettings with settingsMu held.
+func (a *PuffApp) updateSettings(s RuntimeSettings) {
+	s = s.clone()
+	if s.LogLevel != a.Settings().LogLevel {
+		config := *a.Config.LoggerConfig
+		config.Level = s.LogLevel
+		slog.SetDefault(NewLogger(&config))
+	}
+	a.settings.Store(&s)
+	for _, f := range a.settingsSubscribers {
+		f(s)
+	}
+}
+
+// ReloadSettings reads AppConfig.SettingsFile, a JSON encoded RuntimeSettings,
+// and applies it with UpdateSettings. Settings missing from the file keep
+// their current value. Nothing changes if the file cannot be read or decoded.
+func (a *PuffApp) ReloadSettings() error {
+	if a.Config.SettingsFile == "" {
+		return fmt.Errorf("reloading settings failed: no SettingsFile configured")
+	}
+	b, err := os.ReadFile(a.Config.SettingsFile)
+	if err != nil {
+		return fmt.Errorf("reloading settings failed: %w", err)
+	}
+	// the settings are decoded over the current ones under the lock, so a
+	// concurrent UpdateSettings is not reverted.
+	a.settingsMu.Lock()
+	defer a.settingsMu.Unlock()
+	s := a.Settings().clone()
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("reloading settings from %s failed: %w", a.Config.SettingsFile, err)
+	}
+	a.updateSettings(s)
+	slog.Info("Reloaded settings", slog.String("file", a.Config.SettingsFile))
+	return nil
+}
+
+// ReloadSettingsOnSignal reloads AppConfig.SettingsFile whenever the process
+// receives one of signals, SIGHUP if none are given on platforms that have
+// it, until ctx is done.
+// Failed reloads are logged and keep the current settings.
+func (a *PuffApp) ReloadSettingsOnSignal(ctx context.Context, signals ...os.Signal) {
+	if len(signals) == 0 {
+		signals = defaultReloadSignals
+	}
+	if len(signals) == 0 {
+		slog.Warn("ReloadSettingsOnSignal has no signals to listen for on this platform.")
+		return
+	}
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, signals...)
+	go func() {
+		defer signal.Stop(ch)
+		for {
+			select {
+			case <-ch:
+				if err := a.ReloadSettings(); err != nil {
+					slog.Error(err.Error())
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// loadSettingsFile applies AppConfig.SettingsFile, if set, before serving.
+func (a *PuffApp) loadSettingsFile() error {
+	if a.Config.SettingsFile == "" {
+		return nil
+	}
+	return a.ReloadSettings()
+}
+
+// rejectInMaintenance answers the request with 503 and reports true while
+// the application is in maintenance mode.
+func (a *PuffApp) rejectInMaintenance(w http.ResponseWriter) bool {
+	s := a.settings.Load()
+	if s == nil && a.Config.Settings != nil {
+		s = a.Config.Settings
+	}
+	if s == nil || !s.Maintenance {
+		return false
+	}
+	message := s.MaintenanceMessage
+	if message == "" {
+		message = "down for maintenance"
+	}
+	a.writeErrorResponse(w, http.StatusServiceUnavailable, message)
+	return true
+}
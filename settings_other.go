@@ -0,0 +1,8 @@
+//go:build js || wasip1 || plan9 || windows
+
+package puff
+
+import "os"
+
+// defaultReloadSignals is empty since there is no SIGHUP on this platform.
+var defaultReloadSignals []os.Signal
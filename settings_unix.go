@@ -0,0 +1,12 @@
+//go:build !(js || wasip1 || plan9 || windows)
+
+package puff
+
+import (
+	"os"
+	"syscall"
+)
+
+// defaultReloadSignals are the signals ReloadSettingsOnSignal listens for if
+// none are given.
+var defaultReloadSignals = []os.Signal{syscall.SIGHUP}
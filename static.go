@@ -0,0 +1,318 @@
+package puff
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StaticConfig configures serving static files with StaticWithConfig.
+type StaticConfig struct {
+	// FS holds the files, e.g. os.DirFS("./assets") or an embed.FS.
+	FS fs.FS
+	// Root is the directory of FS to serve, e.g. "dist" for an embed.FS
+	// declared with //go:embed dist. Default: the root of FS.
+	Root string
+	// Index are the files served for a directory, in order of preference.
+	// Default: index.html.
+	Index []string
+	// Browse lists the content of directories without an index file.
+	// If false, they respond with 404.
+	Browse bool
+	// CacheControl is the Cache-Control header of served files.
+	// Default: "public, max-age=3600".
+	CacheControl string
+	// Precompressed serves the .br or .gz variant of a file, e.g. app.js.br for app.js,
+	// if it exists and the client accepts its encoding.
+	Precompressed bool
+	// CompressOnce gzips compressible files (text, JavaScript, JSON, SVG, ...) without a
+	// precompressed variant the first time they are requested and keeps them in memory,
+	// instead of compressing the same assets on every request.
+	CompressOnce bool
+
+	// gzipCache holds the files compressed because of CompressOnce.
+	gzipCache *sync.Map
+}
+
+// precompressedVariants are the encodings of precompressed files and their
+// extensions, in order of preference.
+var precompressedVariants = []struct {
+	encoding  string
+	extension string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// gzippedFile is a file compressed once because of CompressOnce. data is nil
+// if compressing the file did not make it smaller.
+type gzippedFile struct {
+	modTime time.Time
+	size    int64
+	data    []byte
+}
+
+// DefaultStaticConfig is the StaticConfig used by Static and StaticFS.
+var DefaultStaticConfig = StaticConfig{
+	Index:        []string{"index.html"},
+	CacheControl: "public, max-age=3600",
+}
+
+// Static serves the files of fsys under prefix, e.g.
+//
+//	router.Static("/assets", os.DirFS("./assets"))
+//
+// Files are streamed with a Content-Type derived from their name and support
+// conditional and range requests. The routes are excluded from OpenAPI; set
+// ExcludeFromOpenAPI to false on the returned route to include it.
+func (r *Router) Static(prefix string, fsys fs.FS) *Route {
+	config := DefaultStaticConfig
+	config.FS = fsys
+	return r.StaticWithConfig(prefix, config)
+}
+
+// StaticFS serves the directory root of fsys under prefix. It is meant for an
+// embed.FS, whose files keep the path they were embedded from:
+//
+//	//go:embed ui/dist
+//	var ui embed.FS
+//
+//	router.StaticFS("/ui", ui, "ui/dist")
+func (r *Router) StaticFS(prefix string, fsys fs.FS, root string) *Route {
+	config := DefaultStaticConfig
+	config.FS = fsys
+	config.Root = root
+	return r.StaticWithConfig(prefix, config)
+}
+
+// StaticWithConfig serves static files under prefix as configured by config.
+// It registers GET and HEAD routes for prefix+"/" and prefix+"/*filepath"
+// and returns the GET route for files.
+func (r *Router) StaticWithConfig(prefix string, config StaticConfig) *Route {
+	if config.FS == nil {
+		panic(&RegistrationError{Kind: RegistrationBadFields, Router: r.Name, Method: http.MethodGet, Path: prefix, Err: fmt.Errorf("static file system must not be nil")})
+	}
+	if config.Root != "" && config.Root != "." {
+		sub, err := fs.Sub(config.FS, config.Root)
+		if err != nil {
+			panic(&RegistrationError{Kind: RegistrationBadFields, Router: r.Name, Method: http.MethodGet, Path: prefix, Err: err})
+		}
+		config.FS = sub
+	}
+	if config.Index == nil {
+		config.Index = DefaultStaticConfig.Index
+	}
+	if config.CacheControl == "" {
+		config.CacheControl = DefaultStaticConfig.CacheControl
+	}
+	if config.CompressOnce {
+		config.gzipCache = &sync.Map{}
+	}
+	prefix = strings.TrimSuffix(prefix, "/")
+	var files *Route
+	for _, method := range []string{http.MethodGet, http.MethodHead} {
+		for _, p := range []string{prefix + "/", prefix + "/*filepath"} {
+			route := r.registerRoute(method, p, config.serve, nil)
+			route.ExcludeFromOpenAPI = true
+			if method == http.MethodGet && p != prefix+"/" {
+				files = route
+			}
+		}
+	}
+	return files
+}
+
+// serve writes the file named by the filepath parameter.
+func (config StaticConfig) serve(c *Context) {
+	name := strings.TrimPrefix(path.Clean("/"+c.PathParams()["filepath"]), "/")
+	if name == "" {
+		name = "."
+	}
+	info, err := fs.Stat(config.FS, name)
+	if err != nil {
+		c.NotFound("not found")
+		return
+	}
+	if info.IsDir() {
+		if !strings.HasSuffix(c.Request.URL.Path, "/") {
+			// relative links in index files and listings need the trailing slash.
+			http.Redirect(c.ResponseWriter, c.Request, c.Request.URL.Path+"/", http.StatusMovedPermanently)
+			return
+		}
+		dir := name
+		name = ""
+		for _, index := range config.Index {
+			candidate := path.Join(dir, index)
+			if indexInfo, err := fs.Stat(config.FS, candidate); err == nil && !indexInfo.IsDir() {
+				name, info = candidate, indexInfo
+				break
+			}
+		}
+		if name == "" {
+			if !config.Browse {
+				c.NotFound("not found")
+				return
+			}
+			config.list(c, dir)
+			return
+		}
+	}
+
+	f, err := config.FS.Open(name)
+	if err != nil {
+		c.NotFound("not found")
+		return
+	}
+	defer f.Close()
+	w, req := c.Raw()
+	contentType := contentTypeFromFileName(name)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", config.CacheControl)
+	if config.Precompressed || config.CompressOnce {
+		w.Header().Add("Vary", "Accept-Encoding")
+	}
+	if config.serveCompressed(w, req, name, info, contentType) {
+		return
+	}
+	if rs, ok := f.(io.ReadSeeker); ok {
+		http.ServeContent(w, req, "", info.ModTime(), rs)
+		return
+	}
+	if !info.ModTime().IsZero() {
+		w.Header().Set("Last-Modified", info.ModTime().UTC().Format(http.TimeFormat))
+	}
+	w.WriteHeader(http.StatusOK)
+	if req.Method != http.MethodHead {
+		io.Copy(w, f)
+	}
+}
+
+// serveCompressed writes a precompressed or cached gzipped variant of the
+// file name if the client accepts it. It reports false if there is none.
+func (config StaticConfig) serveCompressed(w http.ResponseWriter, req *http.Request, name string, info fs.FileInfo, contentType string) bool {
+	accept := req.Header.Get("Accept-Encoding")
+	if config.Precompressed {
+		for _, variant := range precompressedVariants {
+			if !acceptsEncoding(accept, variant.encoding) {
+				continue
+			}
+			f, err := config.FS.Open(name + variant.extension)
+			if err != nil {
+				continue
+			}
+			defer f.Close()
+			variantInfo, err := f.Stat()
+			rs, ok := f.(io.ReadSeeker)
+			if err != nil || !ok || variantInfo.IsDir() {
+				continue
+			}
+			w.Header().Set("Content-Encoding", variant.encoding)
+			http.ServeContent(w, req, "", variantInfo.ModTime(), rs)
+			return true
+		}
+	}
+	if config.gzipCache == nil || !acceptsEncoding(accept, "gzip") || !isCompressible(contentType) {
+		return false
+	}
+	data := config.gzipped(name, info)
+	if data == nil {
+		return false
+	}
+	w.Header().Set("Content-Encoding", "gzip")
+	http.ServeContent(w, req, "", info.ModTime(), bytes.NewReader(data))
+	return true
+}
+
+// gzipped returns the gzipped content of the file name, compressing it on
+// first use or when it changed. It returns nil if compressing did not help.
+func (config StaticConfig) gzipped(name string, info fs.FileInfo) []byte {
+	if v, ok := config.gzipCache.Load(name); ok {
+		cached := v.(gzippedFile)
+		if cached.modTime.Equal(info.ModTime()) && cached.size == info.Size() {
+			return cached.data
+		}
+	}
+	content, err := fs.ReadFile(config.FS, name)
+	if err != nil {
+		return nil
+	}
+	var buf bytes.Buffer
+	zw, _ := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	zw.Write(content)
+	zw.Close()
+	cached := gzippedFile{modTime: info.ModTime(), size: info.Size()}
+	if buf.Len() < len(content) {
+		cached.data = buf.Bytes()
+	}
+	config.gzipCache.Store(name, cached)
+	return cached.data
+}
+
+// isCompressible reports whether content of contentType benefits from compression.
+func isCompressible(contentType string) bool {
+	if strings.HasPrefix(contentType, "text/") {
+		return true
+	}
+	for _, s := range []string{"javascript", "json", "xml", "svg", "wasm"} {
+		if strings.Contains(contentType, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptsEncoding reports whether the Accept-Encoding header accept allows
+// encoding, i.e. lists it or * without q=0.
+func acceptsEncoding(accept, encoding string) bool {
+	accepted := false
+	for _, part := range strings.Split(accept, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		coding = strings.TrimSpace(coding)
+		if !strings.EqualFold(coding, encoding) && coding != "*" {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+		if strings.EqualFold(coding, encoding) {
+			// an explicit entry takes precedence over *.
+			return q > 0
+		}
+		accepted = q > 0
+	}
+	return accepted
+}
+
+// list writes an HTML listing of dir.
+func (config StaticConfig) list(c *Context, dir string) {
+	entries, err := fs.ReadDir(config.FS, dir)
+	if err != nil {
+		c.NotFound("not found")
+		return
+	}
+	var b strings.Builder
+	b.WriteString("<!doctype html>\n<pre>\n")
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() {
+			name += "/"
+		}
+		u := url.URL{Path: name}
+		fmt.Fprintf(&b, "<a href=\"%s\">%s</a>\n", html.EscapeString(u.String()), html.EscapeString(name))
+	}
+	b.WriteString("</pre>\n")
+	c.SendResponse(GenericResponse{Content: b.String(), ContentType: "text/html; charset=utf-8"})
+}
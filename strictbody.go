@@ -0,0 +1,126 @@
+package puff
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// unknownFieldsError is returned when a strict body has keys that are not
+// fields of its type. It holds a FieldError for every unknown key.
+type unknownFieldsError struct {
+	keys []string
+	errs []error
+}
+
+func (e *unknownFieldsError) Error() string {
+	return "unknown body fields: " + strings.Join(e.keys, ", ")
+}
+
+func (e *unknownFieldsError) Unwrap() []error {
+	return e.errs
+}
+
+// rejectUnknownFields decodes the JSON body value into fieldType with
+// DisallowUnknownFields. If the decoder rejects an unknown field, every
+// unknown key of the body is reported, nested keys in dotted notation.
+// Other decoding errors are left to regular body binding.
+func rejectUnknownFields(value string, pa Parameter, fieldType reflect.Type) error {
+	dec := json.NewDecoder(bytes.NewReader([]byte(value)))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(reflect.New(fieldType).Interface())
+	if err == nil || !strings.HasPrefix(err.Error(), "json: unknown field") {
+		return nil
+	}
+	var body any
+	if json.Unmarshal([]byte(value), &body) != nil {
+		return nil
+	}
+	keys := unknownJSONKeys(body, fieldType, "")
+	if len(keys) == 0 {
+		return nil
+	}
+	slices.Sort(keys)
+	errs := make([]error, len(keys))
+	for i, key := range keys {
+		errs[i] = newFieldError(Parameter{Name: key, In: pa.In}, fmt.Errorf("unknown field %s", key))
+	}
+	return &unknownFieldsError{keys: keys, errs: errs}
+}
+
+// unknownJSONKeys returns the keys of v, prefixed with prefix, that have no
+// matching field in t.
+func unknownJSONKeys(v any, t reflect.Type, prefix string) []string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	var keys []string
+	switch v := v.(type) {
+	case map[string]any:
+		switch t.Kind() {
+		case reflect.Struct:
+			fields := jsonFields(t)
+			for k, e := range v {
+				ft, ok := fields[k]
+				if !ok {
+					keys = append(keys, prefix+k)
+					continue
+				}
+				keys = append(keys, unknownJSONKeys(e, ft, prefix+k+".")...)
+			}
+		case reflect.Map:
+			for k, e := range v {
+				keys = append(keys, unknownJSONKeys(e, t.Elem(), prefix+k+".")...)
+			}
+		}
+	case []any:
+		if t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+			for i, e := range v {
+				p := strings.TrimSuffix(prefix, ".")
+				keys = append(keys, unknownJSONKeys(e, t.Elem(), fmt.Sprintf("%s[%d].", p, i))...)
+			}
+		}
+	}
+	return keys
+}
+
+// jsonFields returns the types of the fields of struct type t by their JSON
+// name, including the fields promoted from embedded structs.
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+	for i := range t.NumField() {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				for k, v := range jsonFields(ft) {
+					if _, ok := fields[k]; !ok {
+						fields[k] = v
+					}
+				}
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if nameTag := f.Tag.Get("name"); nameTag != "" {
+			name = nameTag
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = f.Type
+	}
+	return fields
+}
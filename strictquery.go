@@ -0,0 +1,66 @@
+package puff
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// StrictQuery rejects requests with query parameters that are not declared
+// in the route's fields, by WithQuery or by AllowQuery, responding with 400
+// Bad Request listing the unknown parameters. It catches client typos such as
+// ?pageSize= instead of ?page_size= that would otherwise be silently ignored.
+func (r *Route) StrictQuery() *Route {
+	r.strictQuery = true
+	return r
+}
+
+// AllowQuery declares query parameters the route accepts without binding
+// them to its fields, e.g. the page parameters read by Context.Paginate or
+// tracking parameters. It is only relevant together with StrictQuery.
+func (r *Route) AllowQuery(names ...string) *Route {
+	r.allowedQuery = append(r.allowedQuery, names...)
+	return r
+}
+
+// rejectUnknownQuery responds with 400 and returns true if the route is
+// strict and the request has undeclared query parameters.
+func (route *Route) rejectUnknownQuery(c *Context) bool {
+	if !route.strictQuery {
+		return false
+	}
+	var unknown []string
+	for name := range c.Request.URL.Query() {
+		if !route.declaresQuery(name) {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) == 0 {
+		return false
+	}
+	slices.Sort(unknown)
+	errs := make([]error, len(unknown))
+	for i, name := range unknown {
+		errs[i] = newFieldError(Parameter{Name: name, In: "query"}, fmt.Errorf("unknown query param %s", name))
+	}
+	c.sendError(http.StatusBadRequest, "unknown query params: "+strings.Join(unknown, ", "), errors.Join(errs...))
+	return true
+}
+
+// declaresQuery reports whether name is a query parameter of the route.
+func (route *Route) declaresQuery(name string) bool {
+	for _, p := range route.params {
+		if p.In == "query" && p.Name == name {
+			return true
+		}
+	}
+	if _, ok := route.queryConstraints[name]; ok {
+		return true
+	}
+	if route.fieldSelection != nil && slices.Contains(fieldSelectionParams, name) {
+		return true
+	}
+	return slices.Contains(route.allowedQuery, name)
+}
@@ -0,0 +1,92 @@
+package puff
+
+import (
+	"fmt"
+	"html/template"
+)
+
+const (
+	// SubjectKey is the Context key authentication middlewares store the
+	// authenticated caller under. It is read by the currentUser template
+	// function and by the AccessControl middleware by default.
+	SubjectKey = "Subject"
+	// CSRFCookieName is the name of the cookie holding the CSRF token.
+	CSRFCookieName = "CSRFMiddlewareToken"
+	// CSRFTokenKey is the Context key the CSRF middleware stores the current token under.
+	CSRFTokenKey = "CSRFToken"
+	// CSRFFormField is the form field the CSRF middleware accepts the token in
+	// when the header is not sent, as rendered by the csrfField template function.
+	CSRFFormField = "csrf_token"
+)
+
+// WithName names the route so templates can link to it with urlFor, e.g.
+// {{urlFor "user" "id" .ID}} for a route registered as "/users/{id}".
+func (r *Route) WithName(name string) *Route {
+	r.name = name
+	return r
+}
+
+// CSRFToken returns the CSRF token of the request, as issued by the CSRF
+// middleware, or an empty string if there is none.
+func (ctx *Context) CSRFToken() string {
+	if token, ok := ctx.Get(CSRFTokenKey).(string); ok {
+		return token
+	}
+	return ctx.GetCookie(CSRFCookieName)
+}
+
+// templateFuncs returns the functions available to templates rendered by
+// HTMLResponse, bound to ctx:
+//
+//	csrfToken    the CSRF token of the request
+//	csrfField    a hidden form input carrying the CSRF token
+//	urlFor       the URL of a named route or path, see Context.URLFor
+//	currentUser  the authenticated caller stored under SubjectKey
+//	flash        the flash messages of the request, see Context.Flashes
+func (ctx *Context) templateFuncs() map[string]any {
+	return map[string]any{
+		"csrfToken": ctx.CSRFToken,
+		"csrfField": func() template.HTML {
+			return template.HTML(`<input type="hidden" name="` + CSRFFormField + `" value="` + template.HTMLEscapeString(ctx.CSRFToken()) + `">`)
+		},
+		"urlFor": ctx.urlFor,
+		"currentUser": func() any {
+			return ctx.Get(SubjectKey)
+		},
+		"flash": ctx.Flashes,
+	}
+}
+
+// urlFor returns the URL of the route named target with its path parameters
+// set from the name/value pairs params, or of the path target if no route
+// has that name.
+func (ctx *Context) urlFor(target string, params ...any) string {
+	path := target
+	if ctx.puff != nil {
+		if route := ctx.puff.routeNamed(target); route != nil {
+			values := map[string]string{}
+			for i := 0; i+1 < len(params); i += 2 {
+				values[fmt.Sprint(params[i])] = fmt.Sprint(params[i+1])
+			}
+			path = expandRedirectTarget(route.fullPath, values)
+		}
+	}
+	return ctx.URLFor(path)
+}
+
+// routeNamed returns the route named name with WithName, or nil.
+func (a *PuffApp) routeNamed(name string) *Route {
+	var named *Route
+	a.RootRouter.readRoutes(func() {
+		for _, route := range a.AllRoutes() {
+			if route.name == name {
+				named = route
+				return
+			}
+		}
+	})
+	if named != nil && named.fullPath == "" {
+		named.getCompletePath()
+	}
+	return named
+}
@@ -0,0 +1,109 @@
+package puff
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// TenantStrategy defines where the tenant of a request is resolved from.
+type TenantStrategy int
+
+const (
+	// TenantFromHeader resolves the tenant from a request header (see TenancyConfig.HeaderName).
+	TenantFromHeader TenantStrategy = iota
+	// TenantFromSubdomain resolves the tenant from the first label of the request host,
+	// e.g. "acme" for "acme.example.com".
+	TenantFromSubdomain
+	// TenantFromPathPrefix resolves the tenant from the first path segment, e.g. "acme" for
+	// "/acme/pizza". The segment is stripped before route matching, so routes are registered
+	// without it.
+	TenantFromPathPrefix
+)
+
+// TenancyConfig configures tenant resolution for the application.
+type TenancyConfig struct {
+	// Strategy is where the tenant is resolved from.
+	Strategy TenantStrategy
+	// HeaderName is the request header used by TenantFromHeader. Default: "X-Tenant-ID".
+	HeaderName string
+	// Required rejects requests with no resolvable tenant with a 400 response.
+	Required bool
+	// Resolve, if set, replaces Strategy. It should return the tenant ID and whether
+	// one was found.
+	Resolve func(*http.Request) (string, bool)
+}
+
+// Tenant identifies the tenant a request belongs to.
+type Tenant struct {
+	// ID is the resolved tenant identifier.
+	ID string
+}
+
+// Key namespaces k with the tenant ID. Use it to partition rate limit
+// buckets, metrics and caches per tenant.
+func (t *Tenant) Key(k string) string {
+	if t == nil {
+		return k
+	}
+	return t.ID + ":" + k
+}
+
+type tenantContextKey struct{}
+
+// resolveTenant finds the tenant of req according to the config. For
+// TenantFromPathPrefix the returned request has the tenant segment
+// removed from its path.
+func (tc *TenancyConfig) resolveTenant(req *http.Request) (*http.Request, string, bool) {
+	if tc.Resolve != nil {
+		id, ok := tc.Resolve(req)
+		return req, id, ok
+	}
+	switch tc.Strategy {
+	case TenantFromSubdomain:
+		host := req.Host
+		if i := strings.LastIndex(host, ":"); i != -1 && !strings.Contains(host[i:], "]") {
+			host = host[:i]
+		}
+		labels := strings.Split(host, ".")
+		if len(labels) < 3 {
+			return req, "", false
+		}
+		return req, labels[0], true
+	case TenantFromPathPrefix:
+		path := strings.TrimPrefix(req.URL.Path, "/")
+		id, rest, _ := strings.Cut(path, "/")
+		if id == "" {
+			return req, "", false
+		}
+		r2 := req.Clone(req.Context())
+		r2.URL.Path = "/" + rest
+		r2.URL.RawPath = ""
+		return r2, id, true
+	default:
+		name := tc.HeaderName
+		if name == "" {
+			name = "X-Tenant-ID"
+		}
+		id := req.Header.Get(name)
+		return req, id, id != ""
+	}
+}
+
+// withTenant resolves the tenant for req and stores it on the request
+// context. The boolean is false if the request must be rejected.
+func (a *PuffApp) withTenant(req *http.Request) (*http.Request, bool) {
+	tc := a.Config.Tenancy
+	req, id, ok := tc.resolveTenant(req)
+	if !ok {
+		return req, !tc.Required
+	}
+	ctx := context.WithValue(req.Context(), tenantContextKey{}, &Tenant{ID: id})
+	return req.WithContext(ctx), true
+}
+
+// Tenant returns the tenant resolved for the request. It returns nil if
+// tenancy is not configured or no tenant was resolved.
+func (ctx *Context) Tenant() *Tenant {
+	return TenantFromContext(ctx.Request.Context())
+}
@@ -0,0 +1,65 @@
+package puff
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+)
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+	// exampleTime is the time shown as the example value of time fields.
+	exampleTime = time.Date(2024, time.March, 14, 15, 9, 26, 0, time.UTC)
+)
+
+// isTimeType reports whether t is time.Time or time.Duration, which are bound
+// from strings instead of their underlying struct and integer kinds.
+func isTimeType(t reflect.Type) bool {
+	return t == timeType || t == durationType
+}
+
+// timeSchema returns the OpenAPI schema of a time.Time formatted with layout,
+// RFC 3339 if empty, or of a time.Duration.
+func timeSchema(t reflect.Type, layout string) *Schema {
+	if t == durationType {
+		return &Schema{Type: "string", Format: "duration", Examples: []any{"1h30m"}}
+	}
+	if layout == "" {
+		layout = time.RFC3339
+	}
+	s := &Schema{Type: "string", Examples: []any{exampleTime.Format(layout)}}
+	switch layout {
+	case time.RFC3339, time.RFC3339Nano:
+		s.Format = "date-time"
+	case time.DateOnly:
+		s.Format = "date"
+	}
+	return s
+}
+
+// populateTimeField parses value into field, a time.Time formatted with
+// layout (RFC 3339 if empty) or a time.Duration such as "1h30m". An empty
+// value leaves the field unchanged.
+func populateTimeField(value string, field reflect.Value, layout string) error {
+	if value == "" {
+		return nil
+	}
+	if field.Type() == durationType {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("type error: the value %s cant be used as a duration, e.g. 1h30m", value)
+		}
+		field.SetInt(int64(d))
+		return nil
+	}
+	if layout == "" {
+		layout = time.RFC3339
+	}
+	t, err := time.Parse(layout, value)
+	if err != nil {
+		return fmt.Errorf("type error: the value %s cant be used as a time formatted like %s", value, exampleTime.Format(layout))
+	}
+	field.Set(reflect.ValueOf(t))
+	return nil
+}
@@ -0,0 +1,180 @@
+package puff
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// WithTimeout limits the time the route's handler may take to d, overriding
+// the Timeout of its routers. Once exceeded, the request context is canceled
+// and 504 Gateway Timeout is sent, rendered by the router's ErrorHandler. The
+// response is buffered until the handler returns or flushes.
+func (r *Route) WithTimeout(d time.Duration) *Route {
+	r.Timeout = d
+	return r
+}
+
+// timeout returns the timeout of the route, or of its closest router with one.
+func (r *Route) timeout() time.Duration {
+	if r.Timeout > 0 {
+		return r.Timeout
+	}
+	for current := r.Router; current != nil; current = current.parent {
+		if current.Timeout > 0 {
+			return current.Timeout
+		}
+	}
+	return 0
+}
+
+// serveWithTimeout runs handler with the request context canceled after d.
+// Like http.TimeoutHandler, the headers and body written by the handler are
+// buffered until it returns or flushes. If it has not finished by then, a 504
+// error is sent; whatever the handler writes afterwards is discarded. Once
+// the deadline passed, c belongs to the abandoned handler and is not touched.
+// finished is called once the handler returned, timed out or not.
+func (r *Router) serveWithTimeout(c *Context, d time.Duration, handler HandlerFunc, finished func()) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), d)
+	defer cancel()
+	req := c.Request.WithContext(ctx)
+	w, route, puff := c.ResponseWriter, c.route, c.puff
+	tw := &timeoutResponseWriter{w: w, h: w.Header().Clone()}
+	c.Request = req
+	c.ResponseWriter = tw
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer finished()
+		defer r.recoverPanic(c)
+		handler(c)
+	}()
+	select {
+	case <-done:
+		tw.mu.Lock()
+		defer tw.mu.Unlock()
+		tw.commit()
+	case <-ctx.Done():
+		tw.mu.Lock()
+		defer tw.mu.Unlock()
+		tw.timedOut = true
+		if tw.committed {
+			// the response has already been (partially) written; nothing more can be sent.
+			return
+		}
+		ec := NewContext(w, req, puff)
+		ec.route = route
+		r.handleError(ec, &HTTPError{StatusCode: http.StatusGatewayTimeout, Message: "request timed out"})
+	}
+}
+
+// timeoutResponseWriter buffers the response of a handler running with a
+// timeout, and discards it once the handler timed out.
+type timeoutResponseWriter struct {
+	w  http.ResponseWriter
+	mu sync.Mutex
+	// h are the headers written by the handler until the response is committed.
+	h          http.Header
+	buf        bytes.Buffer
+	statusCode int
+	timedOut   bool
+	// committed is true once the buffered response was written to w, after
+	// which writes go straight to w.
+	committed bool
+}
+
+func (w *timeoutResponseWriter) Header() http.Header {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.committed {
+		return w.w.Header()
+	}
+	return w.h
+}
+
+func (w *timeoutResponseWriter) WriteHeader(statusCode int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timedOut {
+		return
+	}
+	if w.committed {
+		w.w.WriteHeader(statusCode)
+		return
+	}
+	if statusCode < 200 {
+		// informational responses such as 103 Early Hints are not buffered.
+		w.copyHeaders()
+		w.w.WriteHeader(statusCode)
+		return
+	}
+	if w.statusCode == 0 {
+		w.statusCode = statusCode
+	}
+}
+
+func (w *timeoutResponseWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if w.statusCode == 0 {
+		w.statusCode = http.StatusOK
+	}
+	if w.committed {
+		return w.w.Write(b)
+	}
+	return w.buf.Write(b)
+}
+
+// Flush commits the response and flushes the underlying writer unless the
+// handler timed out.
+func (w *timeoutResponseWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timedOut {
+		return
+	}
+	if w.statusCode == 0 {
+		w.statusCode = http.StatusOK
+	}
+	w.commit()
+	if f, ok := w.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// commit writes the buffered headers, status code and body to the
+// underlying writer. w.mu must be held.
+func (w *timeoutResponseWriter) commit() {
+	if w.committed {
+		return
+	}
+	w.committed = true
+	w.copyHeaders()
+	if w.statusCode == 0 {
+		return
+	}
+	w.w.WriteHeader(w.statusCode)
+	w.w.Write(w.buf.Bytes())
+	w.buf.Reset()
+}
+
+// copyHeaders replaces the headers of the underlying writer with the headers
+// written by the handler. w.mu must be held.
+func (w *timeoutResponseWriter) copyHeaders() {
+	dst := w.w.Header()
+	clear(dst)
+	for k, v := range w.h {
+		dst[k] = v
+	}
+}
+
+// Unwrap allows http.ResponseController to reach the underlying writer.
+func (w *timeoutResponseWriter) Unwrap() http.ResponseWriter {
+	return w.w
+}
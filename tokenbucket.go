@@ -0,0 +1,225 @@
+package puff
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"time"
+)
+
+// ErrInvalidRate is returned for a burst or refill that is not positive.
+var ErrInvalidRate = errors.New("burst and refill must be positive")
+
+// TokenBucket is a token bucket rate limiter. It holds up to Burst tokens
+// and gains one token every Refill; each allowed action takes tokens from
+// it. Use it in handlers to throttle actions that are not tied to a route,
+// e.g. outgoing emails. It is safe for concurrent use.
+type TokenBucket struct {
+	burst  int
+	refill time.Duration
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucket creates a full TokenBucket holding up to burst tokens and
+// gaining one token every refill. It returns ErrInvalidRate if burst or
+// refill is not positive.
+func NewTokenBucket(burst int, refill time.Duration) (*TokenBucket, error) {
+	if burst <= 0 || refill <= 0 {
+		return nil, ErrInvalidRate
+	}
+	return newTokenBucket(burst, refill), nil
+}
+
+func newTokenBucket(burst int, refill time.Duration) *TokenBucket {
+	return &TokenBucket{burst: burst, refill: refill, tokens: float64(burst), last: time.Now()}
+}
+
+// Allow takes a token from the bucket and reports whether there was one.
+func (b *TokenBucket) Allow() bool {
+	_, ok := b.AllowN(1)
+	return ok
+}
+
+// AllowN takes n tokens from the bucket if it holds that many. Otherwise it
+// takes nothing, reports false and returns how long until n tokens are available.
+// Asking for more than the burst is never allowed.
+func (b *TokenBucket) AllowN(n int) (time.Duration, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.take(time.Now(), n)
+}
+
+// Tokens returns the number of whole tokens currently in the bucket.
+func (b *TokenBucket) Tokens() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.fill(time.Now())
+	return int(b.tokens)
+}
+
+// SetRate changes the burst and refill of the bucket, e.g. when the rate
+// limits are reloaded with PuffApp.UpdateSettings. Tokens above the new burst
+// are dropped. It returns ErrInvalidRate and keeps the current rate if burst
+// or refill is not positive, e.g. if the settings file is wrong.
+func (b *TokenBucket) SetRate(burst int, refill time.Duration) error {
+	if burst <= 0 || refill <= 0 {
+		return ErrInvalidRate
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.setRate(burst, refill)
+	return nil
+}
+
+// setRate is SetRate with a valid rate. b.mu must be held.
+func (b *TokenBucket) setRate(burst int, refill time.Duration) {
+	b.fill(time.Now())
+	b.burst, b.refill = burst, refill
+	b.tokens = math.Min(b.tokens, float64(burst))
+}
+
+// fill adds the tokens gained since the last call. b.mu must be held. A now
+// before the last fill, as passed by callers racing for b.mu, leaves last
+// untouched so that the time in between is not credited twice.
+func (b *TokenBucket) fill(now time.Time) {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(float64(b.burst), b.tokens+float64(elapsed)/float64(b.refill))
+		b.last = now
+	}
+}
+
+// take is AllowN at now. b.mu must be held.
+func (b *TokenBucket) take(now time.Time, n int) (time.Duration, bool) {
+	b.fill(now)
+	if n > b.burst {
+		return math.MaxInt64, false
+	}
+	if missing := float64(n) - b.tokens; missing > 0 {
+		return time.Duration(math.Ceil(missing * float64(b.refill))), false
+	}
+	b.tokens -= float64(n)
+	return 0, true
+}
+
+// full reports whether the bucket has refilled completely at now. b.mu must be held.
+func (b *TokenBucket) full(now time.Time) bool {
+	b.fill(now)
+	return b.tokens >= float64(b.burst)
+}
+
+// KeyedLimiter keeps a TokenBucket per key, e.g. to limit password attempts
+// per account:
+//
+//	loginAttempts, err := puff.NewKeyedLimiter(5, 3*time.Minute, 0)
+//
+//	if wait, ok := loginAttempts.AllowN(input.Email, 1); !ok {
+//		c.SetResponseHeader("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+//		c.Error(http.StatusTooManyRequests, "too many attempts")
+//		return
+//	}
+//
+// Buckets idle for longer than the TTL are evicted. It is safe for concurrent use.
+type KeyedLimiter struct {
+	burst  int
+	refill time.Duration
+	ttl    time.Duration
+
+	mu      sync.Mutex
+	buckets map[string]*TokenBucket
+	calls   int
+}
+
+// NewKeyedLimiter creates a KeyedLimiter whose buckets hold up to burst tokens
+// and gain one token every refill. Buckets unused for ttl are evicted; if ttl
+// is not positive, buckets are evicted once they have refilled, which never
+// lets a key through sooner than keeping the bucket would. It returns
+// ErrInvalidRate if burst or refill is not positive.
+func NewKeyedLimiter(burst int, refill time.Duration, ttl time.Duration) (*KeyedLimiter, error) {
+	if burst <= 0 || refill <= 0 {
+		return nil, ErrInvalidRate
+	}
+	return &KeyedLimiter{burst: burst, refill: refill, ttl: ttl, buckets: map[string]*TokenBucket{}}, nil
+}
+
+// Allow takes a token from the bucket of key and reports whether there was one.
+func (l *KeyedLimiter) Allow(key string) bool {
+	_, ok := l.AllowN(key, 1)
+	return ok
+}
+
+// AllowN takes n tokens from the bucket of key. See TokenBucket.AllowN.
+func (l *KeyedLimiter) AllowN(key string, n int) (time.Duration, bool) {
+	now := time.Now()
+	b := l.bucket(key, now)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.take(now, n)
+}
+
+// Reset forgets the bucket of key, e.g. after a successful login.
+func (l *KeyedLimiter) Reset(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.buckets, key)
+}
+
+// SetRate changes the burst and refill of every bucket of the limiter,
+// including those created later. See TokenBucket.SetRate.
+func (l *KeyedLimiter) SetRate(burst int, refill time.Duration) error {
+	if burst <= 0 || refill <= 0 {
+		return ErrInvalidRate
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.burst, l.refill = burst, refill
+	for _, b := range l.buckets {
+		b.mu.Lock()
+		b.setRate(burst, refill)
+		b.mu.Unlock()
+	}
+	return nil
+}
+
+// Len returns the number of keys with a bucket.
+func (l *KeyedLimiter) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.buckets)
+}
+
+// bucket returns the bucket of key, creating it if needed. Every 1024 calls
+// idle buckets are evicted.
+func (l *KeyedLimiter) bucket(key string, now time.Time) *TokenBucket {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.calls++
+	if l.calls%1024 == 0 {
+		l.evict(now)
+	}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = newTokenBucket(l.burst, l.refill)
+		l.buckets[key] = b
+	}
+	return b
+}
+
+// evict removes idle buckets. l.mu must be held.
+func (l *KeyedLimiter) evict(now time.Time) {
+	for key, b := range l.buckets {
+		b.mu.Lock()
+		idle := false
+		if l.ttl > 0 {
+			idle = now.Sub(b.last) > l.ttl
+		} else {
+			idle = b.full(now)
+		}
+		b.mu.Unlock()
+		if idle {
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package puff
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp/syntax"
+	"runtime"
+	"strings"
+	"unicode"
+)
+
+// Registrar is what the generic Get, Post, Put, Patch and Delete register
+// routes on: a *Router or a *PuffApp, whose root router is used.
+type Registrar interface {
+	registrar() *Router
+}
+
+func (r *Router) registrar() *Router { return r }
+
+func (a *PuffApp) registrar() *Router { return a.RootRouter }
+
+// Get registers a GET route whose handler receives the fields bound from the
+// request as a *T, e.g.
+//
+//	type GetPizza struct {
+//		ID int `kind:"path" name:"id"`
+//	}
+//
+//	puff.Get(app, "/pizzas/{id:int}", func(c *puff.Context, input *GetPizza) {
+//		...
+//	})
+//
+// Unlike Router.Get, the path parameters of path are checked against the
+// fields of kind path of T when the route is registered: each field must be
+// named like the parameter it is bound to, ignoring case, and a constrained
+// parameter such as {id:int} or {slug:[a-z-]+} must only match values the
+// type of its field can hold. Mismatches fail the registration like a bad
+// path. As with fields passed to Router.Get, the *T is shared by requests.
+func Get[T any](r Registrar, path string, handler func(*Context, *T)) *Route {
+	return registerTyped(r.registrar(), http.MethodGet, path, handler)
+}
+
+// Post registers a POST route whose handler receives the fields bound from
+// the request as a *T. See Get.
+func Post[T any](r Registrar, path string, handler func(*Context, *T)) *Route {
+	return registerTyped(r.registrar(), http.MethodPost, path, handler)
+}
+
+// Put registers a PUT route whose handler receives the fields bound from the
+// request as a *T. See Get.
+func Put[T any](r Registrar, path string, handler func(*Context, *T)) *Route {
+	return registerTyped(r.registrar(), http.MethodPut, path, handler)
+}
+
+// Patch registers a PATCH route whose handler receives the fields bound from
+// the request as a *T. See Get.
+func Patch[T any](r Registrar, path string, handler func(*Context, *T)) *Route {
+	return registerTyped(r.registrar(), http.MethodPatch, path, handler)
+}
+
+// Delete registers a DELETE route whose handler receives the fields bound
+// from the request as a *T. See Get.
+func Delete[T any](r Registrar, path string, handler func(*Context, *T)) *Route {
+	return registerTyped(r.registrar(), http.MethodDelete, path, handler)
+}
+
+// registerTyped registers the route of the generic registration functions,
+// after checking the path parameters against the fields of T.
+func registerTyped[T any](r *Router, method string, path string, handler func(*Context, *T)) *Route {
+	_, file, line, ok := runtime.Caller(2)
+	source := callerSource(file, line, ok)
+	input := new(T)
+	if err := checkPathFields(r.fullPrefix()+path, reflect.TypeOf(input).Elem(), r.jsonParamNames()); err != nil {
+		// the route is returned unregistered if the error is deferred.
+		r.fail(&RegistrationError{Kind: RegistrationBadFields, Router: r.Name, Method: method, Path: path, Source: source, Err: err})
+		return &Route{Path: path, Protocol: method, Router: r, source: source, Responses: Responses{}}
+	}
+	route := r.newRoute(method, path, func(c *Context) { handler(c, input) }, input, newLazyDescription(file, line, ok), source)
+	route.handlerName = funcName(handler)
+	return route
+}
+
+// checkPathFields returns an error if the fields of kind path of the struct t
+// do not match the path parameters of path they are bound to by position.
+func checkPathFields(path string, t reflect.Type, jsonNames bool) error {
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	params, err := parsePathParams(path)
+	if err != nil {
+		// reported as a bad path on registration.
+		return nil
+	}
+	index := 0
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if f.Tag.Get("kind") != "path" {
+			continue
+		}
+		name := paramName(f, jsonNames)
+		if index >= len(params) {
+			if index == len(params) && catchAllSegment.MatchString(path) {
+				index++
+				continue
+			}
+			return fmt.Errorf("field %s is of kind path, but path %s has no parameter %s", f.Name, path, name)
+		}
+		param := params[index]
+		index++
+		if !strings.EqualFold(param.name, name) {
+			return fmt.Errorf("field %s is bound to path parameter {%s} of %s, but is named %s", f.Name, param.name, path, name)
+		}
+		if param.pattern != "" && !patternFitsType(param.pattern, f.Type) {
+			return fmt.Errorf("path parameter {%s} of %s is constrained to %s, which matches values field %s of type %s cannot hold", param.name, path, param.pattern, f.Name, f.Type)
+		}
+	}
+	return nil
+}
+
+// patternFitsType reports whether every value matched by pattern is made of
+// characters a number of type t can be parsed from. Other types fit any
+// pattern.
+func patternFitsType(pattern string, t reflect.Type) bool {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if isTimeType(t) {
+		// time.Duration is an int64, parsed from values like 1h30m.
+		return true
+	}
+	var allowed string
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		allowed = "+-0123456789"
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		allowed = "+0123456789"
+	case reflect.Float32, reflect.Float64:
+		allowed = "+-.0123456789eE"
+	default:
+		return true
+	}
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		// invalid patterns are reported when the route is compiled.
+		return true
+	}
+	return onlyMatches(re.Simplify(), func(r rune) bool { return strings.ContainsRune(allowed, r) })
+}
+
+// onlyMatches reports whether re only matches strings of runes allowed.
+func onlyMatches(re *syntax.Regexp, allowed func(rune) bool) bool {
+	switch re.Op {
+	case syntax.OpLiteral:
+		for _, r := range re.Rune {
+			if !allowed(r) {
+				return false
+			}
+			if re.Flags&syntax.FoldCase != 0 && (!allowed(unicode.ToUpper(r)) || !allowed(unicode.ToLower(r))) {
+				return false
+			}
+		}
+		return true
+	case syntax.OpCharClass:
+		for i := 0; i+1 < len(re.Rune); i += 2 {
+			lo, hi := re.Rune[i], re.Rune[i+1]
+			if hi-lo > 64 {
+				return false
+			}
+			for r := lo; r <= hi; r++ {
+				if !allowed(r) {
+					return false
+				}
+			}
+		}
+		return true
+	case syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		return false
+	}
+	for _, sub := range re.Sub {
+		if !onlyMatches(sub, allowed) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,219 @@
+package puff
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// byteSizeUnits are the units of sizes in maxsize tags, in powers of 1024.
+var byteSizeUnits = []struct {
+	suffix string
+	size   int64
+}{
+	{"GB", 1 << 30},
+	{"MB", 1 << 20},
+	{"KB", 1 << 10},
+	{"B", 1},
+}
+
+// parseByteSize parses a size such as "512", "100KB", "10MB" or "1GB".
+func parseByteSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	unit := int64(1)
+	for _, u := range byteSizeUnits {
+		if n, ok := strings.CutSuffix(s, u.suffix); ok {
+			s, unit = strings.TrimSpace(n), u.size
+			break
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size %q, expected e.g. 512KB or 10MB", s)
+	}
+	if n > math.MaxInt64/unit {
+		return 0, fmt.Errorf("size %q is too large", s)
+	}
+	return n * unit, nil
+}
+
+// multipartMemory is the memory ParseMultipartForm buffers the uploaded files
+// of a request in before storing them in temporary files.
+const multipartMemory = 10 << 20
+
+// multipartOverhead is what a multipart body may hold besides its files: the
+// form values ParseMultipartForm accepts, the part headers and the boundaries.
+const multipartOverhead = multipartMemory + 10<<20 + 1<<20
+
+// uploadLimit returns the largest multipart body accepted by a route with the
+// input fields t bound to params: the sum of the maxsize of its files and multipartOverhead.
+// It returns 0, i.e. no limit, if t has no file, a file without maxsize or a
+// []*File, as the number of files is not bounded.
+func uploadLimit(t reflect.Type, params []Parameter) int64 {
+	var limit int64
+	var files bool
+	for i := range t.NumField() {
+		f := t.Field(i)
+		fields := []reflect.StructField{f}
+		if params[i].formStruct {
+			fields = formStructFields(f.Type)
+		}
+		for _, f := range fields {
+			if f.Type != reflect.TypeOf(new(File)) && f.Type != filesType {
+				continue
+			}
+			// the tags were checked on registration.
+			upload, _ := parseUploadConstraints(f)
+			if f.Type == filesType || upload == nil || upload.maxSize == 0 || limit > math.MaxInt64-multipartOverhead-upload.maxSize {
+				return 0
+			}
+			limit += upload.maxSize
+			files = true
+		}
+	}
+	if !files {
+		return 0
+	}
+	return limit + multipartOverhead
+}
+
+// closeFiles closes the uploaded files of a request that is rejected, so
+// their temporary files can be removed.
+func closeFiles(files ...*File) {
+	for _, f := range files {
+		if f != nil && f.MultipartFile != nil {
+			f.MultipartFile.Close()
+		}
+	}
+}
+
+// uploadConstraints are the limits of file fields set with the maxsize and
+// accept tags.
+type uploadConstraints struct {
+	// maxSize is the largest accepted file in bytes. Zero accepts any size.
+	maxSize int64
+	// maxSizeTag is the maxsize tag, used in error messages.
+	maxSizeTag string
+	// accept are the accepted media types, e.g. image/png or image/*.
+	accept []string
+}
+
+// parseUploadConstraints parses the maxsize and accept tags of the file
+// field f. It returns nil if f has neither.
+func parseUploadConstraints(f reflect.StructField) (*uploadConstraints, error) {
+	maxSize, accept := f.Tag.Get("maxsize"), f.Tag.Get("accept")
+	if maxSize == "" && accept == "" {
+		return nil, nil
+	}
+	if f.Type != reflect.TypeOf(new(File)) && f.Type != filesType {
+		return nil, fmt.Errorf("field %s must be a *File or []*File to have maxsize or accept", f.Name)
+	}
+	uc := &uploadConstraints{maxSizeTag: maxSize}
+	if maxSize != "" {
+		size, err := parseByteSize(maxSize)
+		if err != nil {
+			return nil, fmt.Errorf("invalid maxsize on field %s: %w", f.Name, err)
+		}
+		uc.maxSize = size
+	}
+	for _, mediaType := range strings.Split(accept, ",") {
+		if mediaType = strings.ToLower(strings.TrimSpace(mediaType)); mediaType != "" {
+			uc.accept = append(uc.accept, mediaType)
+		}
+	}
+	return uc, nil
+}
+
+// uploadError is a file rejected by its upload constraints, answered with
+// 413 Request Entity Too Large or 415 Unsupported Media Type.
+type uploadError struct {
+	statusCode int
+	err        error
+}
+
+func (e *uploadError) Error() string {
+	return e.err.Error()
+}
+
+func (e *uploadError) Unwrap() error {
+	return e.err
+}
+
+// check returns an uploadError if the file named name is too large or its
+// content is not of an accepted type. The type is sniffed from the content
+// with http.DetectContentType; the Content-Type sent by the client is not
+// trusted.
+func (uc *uploadConstraints) check(name string, f *File) error {
+	if uc == nil || f == nil {
+		return nil
+	}
+	if uc.maxSize > 0 && f.Size > uc.maxSize {
+		return &uploadError{
+			statusCode: http.StatusRequestEntityTooLarge,
+			err:        fmt.Errorf("file %s of %s is larger than %s", name, f.Name, uc.maxSizeTag),
+		}
+	}
+	if len(uc.accept) == 0 {
+		return nil
+	}
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f.MultipartFile, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return err
+	}
+	if _, err := f.MultipartFile.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	detected, _, _ := mime.ParseMediaType(http.DetectContentType(head[:n]))
+	for _, accepted := range uc.accept {
+		if accepted == detected || (strings.HasSuffix(accepted, "/*") && strings.HasPrefix(detected, strings.TrimSuffix(accepted, "*"))) {
+			return nil
+		}
+	}
+	return &uploadError{
+		statusCode: http.StatusUnsupportedMediaType,
+		err:        fmt.Errorf("file %s of %s has type %s, accepted: %s", name, f.Name, detected, strings.Join(uc.accept, ", ")),
+	}
+}
+
+// checkAll checks every file named name.
+func (uc *uploadConstraints) checkAll(name string, files []*File) error {
+	for _, f := range files {
+		if err := uc.check(name, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// describe returns the constraints for the OpenAPI description of the file.
+func (uc *uploadConstraints) describe() string {
+	var parts []string
+	if uc.maxSizeTag != "" {
+		parts = append(parts, "Max size: "+uc.maxSizeTag+".")
+	}
+	if len(uc.accept) > 0 {
+		parts = append(parts, "Accepted types: "+strings.Join(uc.accept, ", ")+".")
+	}
+	return strings.Join(parts, " ")
+}
+
+// documentUploadErrors documents the 413 and 415 responses of the file
+// constraints uc on the route, unless documented already.
+func (r *Route) documentUploadErrors(uc *uploadConstraints) {
+	if uc.maxSize > 0 {
+		if _, ok := r.documentedErrors[http.StatusRequestEntityTooLarge]; !ok {
+			r.Errors(ErrStatus(http.StatusRequestEntityTooLarge, "uploaded file is too large"))
+		}
+	}
+	if len(uc.accept) > 0 {
+		if _, ok := r.documentedErrors[http.StatusUnsupportedMediaType]; !ok {
+			r.Errors(ErrStatus(http.StatusUnsupportedMediaType, "uploaded file type is not accepted"))
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package puff
+
+import (
+	"log/slog"
+	"net"
+	"net/netip"
+	"strings"
+)
+
+// URLFor returns the absolute URL for path using AppConfig.BaseURL.
+// If BaseURL is not set, path is returned unchanged.
+func (a *PuffApp) URLFor(path string) string {
+	if a.Config.BaseURL == "" {
+		return path
+	}
+	return joinURL(a.Config.BaseURL, path)
+}
+
+// URLFor returns the absolute URL for path. AppConfig.BaseURL is used
+// if set, otherwise the scheme and host are derived from the request,
+// respecting the X-Forwarded-Proto and X-Forwarded-Host headers set by
+// the reverse proxies listed in AppConfig.TrustedProxies.
+func (ctx *Context) URLFor(path string) string {
+	if ctx.puff != nil && ctx.puff.Config.BaseURL != "" {
+		return joinURL(ctx.puff.Config.BaseURL, path)
+	}
+	return joinURL(ctx.requestScheme()+"://"+ctx.requestHost(), path)
+}
+
+// requestScheme returns the scheme the client used to make the request.
+func (ctx *Context) requestScheme() string {
+	if proto := ctx.forwardedHeader("X-Forwarded-Proto"); proto != "" {
+		return strings.TrimSpace(strings.Split(proto, ",")[0])
+	}
+	if ctx.Request.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// requestHost returns the host the client used to make the request.
+func (ctx *Context) requestHost() string {
+	if host := ctx.forwardedHeader("X-Forwarded-Host"); host != "" {
+		return strings.TrimSpace(strings.Split(host, ",")[0])
+	}
+	return ctx.Request.Host
+}
+
+// forwardedHeader returns the request header k if the request comes from a
+// trusted proxy, or "" otherwise.
+func (ctx *Context) forwardedHeader(k string) string {
+	if ctx.puff == nil || !ctx.puff.fromTrustedProxy(ctx.Request.RemoteAddr) {
+		return ""
+	}
+	return ctx.GetRequestHeader(k)
+}
+
+// fromTrustedProxy reports whether remoteAddr is one of AppConfig.TrustedProxies.
+func (a *PuffApp) fromTrustedProxy(remoteAddr string) bool {
+	a.trustedProxiesOnce.Do(func() {
+		for _, proxy := range a.Config.TrustedProxies {
+			prefix, err := netip.ParsePrefix(proxy)
+			if err != nil {
+				addr, aerr := netip.ParseAddr(proxy)
+				if aerr != nil {
+					slog.Warn("Ignoring invalid trusted proxy", slog.String("proxy", proxy))
+					continue
+				}
+				prefix = netip.PrefixFrom(addr, addr.BitLen())
+			}
+			a.trustedProxies = append(a.trustedProxies, prefix.Masked())
+		}
+	})
+	if len(a.trustedProxies) == 0 {
+		return false
+	}
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range a.trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// joinURL joins base and path ensuring exactly one slash between them.
+func joinURL(base, path string) string {
+	if path == "" {
+		return base
+	}
+	return strings.TrimSuffix(base, "/") + "/" + strings.TrimPrefix(path, "/")
+}
+
+// openAPIServers returns the OpenAPI servers list built from
+// AppConfig.BaseURL followed by AppConfig.Servers.
+func (a *PuffApp) openAPIServers() *[]Server {
+	servers := []Server{}
+	if a.Config.BaseURL != "" {
+		servers = append(servers, Server{URL: a.Config.BaseURL})
+	}
+	servers = append(servers, a.Config.Servers...)
+	return &servers
+}
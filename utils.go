@@ -3,11 +3,9 @@ package puff
 import (
 	cryptorand "crypto/rand"
 	"encoding/base64"
-	"encoding/json"
 	"fmt"
 	"math/rand/v2"
 	"mime"
-	"net/http"
 	"strings"
 )
 
@@ -64,12 +62,6 @@ func contentTypeFromFileName(name string) string {
 	return ct
 }
 
-func writeErrorResponse(w http.ResponseWriter, statusCode int, message string) {
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"error": message})
-	w.WriteHeader(statusCode)
-}
-
 func isAnyOfThese[T comparable](value T, these ...T) bool {
 	for _, t := range these {
 		if t == value {
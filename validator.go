@@ -0,0 +1,50 @@
+package puff
+
+import (
+	"errors"
+	"net/http"
+)
+
+// Validator is implemented by fields structs checking business rules the
+// struct tags cannot express, e.g. that a start date is before an end date.
+// Validate is called after the fields are bound from the request; an error
+// rejects the request with 422 Unprocessable Entity. Return FieldErrors,
+// joined with errors.Join, to report which fields are invalid.
+type Validator interface {
+	Validate() error
+}
+
+// ContextValidator is a Validator that needs the request, e.g. to check the
+// fields against the authenticated caller.
+type ContextValidator interface {
+	Validate(c *Context) error
+}
+
+// validateFields runs the Validate method of fields, if it has one.
+func validateFields(c *Context, fields any) error {
+	switch v := fields.(type) {
+	case Validator:
+		return v.Validate()
+	case ContextValidator:
+		return v.Validate(c)
+	}
+	return nil
+}
+
+// sendValidationError responds to the error of a Validator with 422, or with
+// the status of the HTTPError it holds or the status it is mapped to with MapError.
+func (ctx *Context) sendValidationError(err error) {
+	status, message := http.StatusUnprocessableEntity, err.Error()
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		status, message = httpErr.StatusCode, httpErr.Message
+	} else if mapped, ok := ctx.puff.mappedStatus(err); ok {
+		status, message = mapped, http.StatusText(mapped)
+	}
+	if status != http.StatusUnprocessableEntity {
+		// errors of other layers render like those sent with HandleError.
+		ctx.handleError(&HTTPError{StatusCode: status, Message: message, Err: err})
+		return
+	}
+	ctx.sendError(status, message, err)
+}
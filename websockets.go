@@ -6,7 +6,11 @@ import (
 
 // handleWebSocket accepts a new WebSocket connection and initializes the WebSocket struct.
 func (c *Context) handleWebSocket() error {
-	conn, err := websocket.AcceptHTTP(c.ResponseWriter, c.Request)
+	w := c.ResponseWriter
+	if m := c.connectionMetrics(); m != nil {
+		w = &meteredHijacker{ResponseWriter: w, metrics: m}
+	}
+	conn, err := websocket.AcceptHTTP(w, c.Request)
 	if err != nil {
 		c.BadRequest(err.Error())
 		return err
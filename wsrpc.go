@@ -0,0 +1,201 @@
+package puff
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"slices"
+
+	"github.com/tiredkangaroo/websocket"
+)
+
+// RPC error codes sent in RPCError.Code, following JSON-RPC 2.0.
+const (
+	RPCParseError     = -32700
+	RPCMethodNotFound = -32601
+	RPCInvalidParams  = -32602
+	RPCInternalError  = -32603
+	// RPCServerError is the code of errors returned by methods that are not an *RPCError.
+	RPCServerError = -32000
+)
+
+// RPC is a set of named methods served over a WebSocket route with
+// Router.RPC. Clients send text frames like
+//
+//	{"id": 1, "method": "users.get", "params": {"id": 7}}
+//
+// and receive {"id": 1, "result": ...} or {"id": 1, "error": {"code": ..., "message": ...}}.
+// Requests on a connection are handled one at a time, in order.
+type RPC struct {
+	methods map[string]*rpcMethod
+}
+
+// RPCError is the error envelope of a failed RPC call. Methods can return
+// one to choose the code sent to the client.
+type RPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    any    `json:"data,omitempty"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("rpc error %d: %s", e.Code, e.Message)
+}
+
+// RPCMethodInfo documents an RPC method. It is included in the OpenAPI
+// operation of the WebSocket route under x-rpc-methods.
+type RPCMethodInfo struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description,omitempty"`
+	Params      *Schema `json:"params,omitempty"`
+	Result      *Schema `json:"result,omitempty"`
+}
+
+type rpcMethod struct {
+	description string
+	params      reflect.Type
+	result      reflect.Type
+	call        func(c *Context, params json.RawMessage) (any, error)
+}
+
+// rpcRequest is a frame sent by the client.
+type rpcRequest struct {
+	ID     any             `json:"id,omitempty"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+// rpcResponse is a frame sent to the client.
+type rpcResponse struct {
+	ID     any       `json:"id"`
+	Result any       `json:"result,omitempty"`
+	Error  *RPCError `json:"error,omitempty"`
+}
+
+// NewRPC creates an RPC without methods. Add methods with RPCMethod.
+func NewRPC() *RPC {
+	return &RPC{methods: map[string]*rpcMethod{}}
+}
+
+// RPCMethod registers fn as the method name of rpc. The params of a call
+// are decoded into P; fn's result is sent as the result of the call.
+// It returns an error if the method is already registered.
+func RPCMethod[P, R any](rpc *RPC, name, description string, fn func(c *Context, params P) (R, error)) error {
+	if _, ok := rpc.methods[name]; ok {
+		return fmt.Errorf("rpc method %s registered twice", name)
+	}
+	rpc.methods[name] = &rpcMethod{
+		description: description,
+		params:      reflect.TypeFor[P](),
+		result:      reflect.TypeFor[R](),
+		call: func(c *Context, raw json.RawMessage) (any, error) {
+			var params P
+			if len(raw) > 0 && string(raw) != "null" {
+				if err := json.Unmarshal(raw, &params); err != nil {
+					return nil, &RPCError{Code: RPCInvalidParams, Message: err.Error()}
+				}
+			}
+			return fn(c, params)
+		},
+	}
+	return nil
+}
+
+// Methods documents the methods of rpc, sorted by name.
+func (rpc *RPC) Methods() []RPCMethodInfo {
+	return rpc.describe(nil)
+}
+
+func (rpc *RPC) describe(route *Route) []RPCMethodInfo {
+	names := make([]string, 0, len(rpc.methods))
+	for name := range rpc.methods {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	infos := make([]RPCMethodInfo, len(names))
+	for i, name := range names {
+		m := rpc.methods[name]
+		infos[i] = RPCMethodInfo{
+			Name:        name,
+			Description: m.description,
+			Params:      rpcSchema(route, m.params),
+			Result:      rpcSchema(route, m.result),
+		}
+	}
+	return infos
+}
+
+// rpcSchema returns the schema of t, or nil if it cannot be described.
+func rpcSchema(route *Route, t reflect.Type) (s *Schema) {
+	defer func() {
+		if recover() != nil {
+			s = nil
+		}
+	}()
+	return newDefinition(route, reflect.New(t).Interface())
+}
+
+// RPC registers a WebSocket route at path serving the methods of rpc.
+func (r *Router) RPC(path string, rpc *RPC) *Route {
+	route := r.registerWebSocket(path, nil, rpc.serve)
+	route.rpc = rpc
+	return route
+}
+
+// serve handles the RPC frames of the WebSocket connection until it is closed.
+func (rpc *RPC) serve(c *Context) {
+	for {
+		message, err := c.WebSocket.Read()
+		if err != nil {
+			return
+		}
+		switch message.Type {
+		case websocket.MessageClose:
+			return
+		case websocket.MessageText, websocket.MessageBinary:
+		default:
+			continue
+		}
+		res := rpc.handle(c, message.Data)
+		b, merr := json.Marshal(res)
+		if merr != nil {
+			b, _ = json.Marshal(rpcResponse{ID: res.ID, Error: &RPCError{Code: RPCInternalError, Message: "encoding the result failed"}})
+		}
+		if err := c.WebSocket.Write(&websocket.Message{Type: websocket.MessageText, Data: b}); err != nil {
+			return
+		}
+	}
+}
+
+// handle decodes and calls the request in data.
+func (rpc *RPC) handle(c *Context, data []byte) (res rpcResponse) {
+	var req rpcRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return rpcResponse{Error: &RPCError{Code: RPCParseError, Message: "invalid request: " + err.Error()}}
+	}
+	res.ID = req.ID
+	m, ok := rpc.methods[req.Method]
+	if !ok {
+		res.Error = &RPCError{Code: RPCMethodNotFound, Message: "method not found: " + req.Method}
+		return res
+	}
+	defer func() {
+		if a := recover(); a != nil {
+			slog.Error("puff: rpc method panicked", "method", req.Method, "error", a)
+			res.Result = nil
+			res.Error = &RPCError{Code: RPCInternalError, Message: "internal error"}
+		}
+	}()
+	result, err := m.call(c, req.Params)
+	if err != nil {
+		rpcErr, ok := err.(*RPCError)
+		if !ok {
+			rpcErr = &RPCError{Code: RPCServerError, Message: err.Error()}
+		}
+		res.Error = rpcErr
+		return res
+	}
+	res.Result = result
+	return res
+}
@@ -0,0 +1,75 @@
+package puff
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"mime"
+	"reflect"
+	"strings"
+)
+
+// defaultBodyMedia is the media type of body fields without the media tag.
+const defaultBodyMedia = "application/json"
+
+// isXMLMedia reports whether mediaType is XML, e.g. application/xml, text/xml
+// or application/soap+xml.
+func isXMLMedia(mediaType string) bool {
+	return mediaType == "application/xml" || mediaType == "text/xml" || strings.HasSuffix(mediaType, "+xml")
+}
+
+// parseMediaTag parses the comma separated media types of the media tag of a
+// body field of type t.
+func parseMediaTag(tag string, t reflect.Type) ([]string, error) {
+	var media []string
+	for _, m := range strings.Split(tag, ",") {
+		m = strings.ToLower(strings.TrimSpace(m))
+		if m != defaultBodyMedia && !isXMLMedia(m) {
+			return nil, fmt.Errorf("unsupported media type %q, must be application/json or XML", m)
+		}
+		if isXMLMedia(m) && isMapBody(t) {
+			return nil, fmt.Errorf("maps cannot be decoded from %s", m)
+		}
+		media = append(media, m)
+	}
+	return media, nil
+}
+
+// isMapBody reports whether the body type t is a map, which encoding/xml
+// cannot decode into.
+func isMapBody(t reflect.Type) bool {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Map
+}
+
+// bodyMedia returns the media type the body param is decoded from: the
+// Content-Type of the request if the param accepts it, otherwise the first
+// media type of the param.
+func (p Parameter) bodyMedia(c *Context) string {
+	if len(p.media) == 0 {
+		return defaultBodyMedia
+	}
+	contentType, _, _ := mime.ParseMediaType(c.GetRequestHeader("Content-Type"))
+	for _, m := range p.media {
+		if m == contentType || (isXMLMedia(m) && isXMLMedia(contentType)) {
+			return m
+		}
+	}
+	return p.media[0]
+}
+
+// populateXMLBodyField decodes the XML body value straight into field.
+func populateXMLBodyField(value string, field reflect.Value) error {
+	target := reflect.New(field.Type())
+	if err := xml.Unmarshal([]byte(value), target.Interface()); err != nil {
+		var syntaxErr *xml.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			return malformedBody(fmt.Errorf("expected xml, but got invalid xml: %s", err.Error()))
+		}
+		return malformedBody(err)
+	}
+	field.Set(target.Elem())
+	return nil
+}